@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youruser/bb7/internal/export"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Command-line subcommands. These run instead of the stdin/stdout protocol
+// loop and use state.Open so they never select or lock chats that an editor
+// session may have open.
+
+// runExport implements `bb7 export [flags] [chat-id]`.
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	formatName := fs.String("format", "", "output format: markdown, html, or json (default: from -o extension, else markdown)")
+	output := fs.String("o", "", "write to file instead of stdout")
+	global := fs.Bool("global", false, "export a global chat")
+	project := fs.String("project", "", "project root (default: current directory)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: bb7 export [-format markdown|html|json] [-o file] [-global] [-project dir] [chat-id]")
+		fmt.Fprintln(stderr, "Exports the given chat, or the last active chat if no ID is given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	name := *formatName
+	if name == "" && *output != "" {
+		name = strings.TrimPrefix(filepath.Ext(*output), ".")
+	}
+	format, err := export.ParseFormat(name)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 export: %v\n", err)
+		return 2
+	}
+
+	s, err := openStateForCLI(*project, *global)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 export: %v\n", err)
+		return 1
+	}
+
+	chatID := fs.Arg(0)
+	isGlobal := *global
+	if chatID == "" {
+		chatID, isGlobal = s.LastActiveChat()
+		if chatID == "" {
+			fmt.Fprintln(stderr, "bb7 export: no active chat; pass a chat ID")
+			return 1
+		}
+	}
+
+	bundle, err := s.ExportChat(chatID, isGlobal)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 export: %v\n", err)
+		return 1
+	}
+	data, err := export.Render(bundle, format)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 export: %v\n", err)
+		return 1
+	}
+
+	if *output == "" || *output == "-" {
+		stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(stderr, "bb7 export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runImport implements `bb7 import [flags] bundle.json`.
+func runImport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	global := fs.Bool("global", false, "import as a global chat")
+	project := fs.String("project", "", "project root (default: current directory)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: bb7 import [-global] [-project dir] bundle.json")
+		fmt.Fprintln(stderr, "Imports a chat exported with `bb7 export -format json` as a new chat.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	s, err := openStateForCLI(*project, *global)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 import: %v\n", err)
+		return 1
+	}
+	bundle, err := state.ReadBundle(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 import: %v\n", err)
+		return 1
+	}
+	chat, err := s.ImportChat(bundle, *global)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 import: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Imported %q as %s\n", chat.Name, chat.ID)
+	return 0
+}
+
+// runFsck implements `bb7 fsck [flags]`.
+func runFsck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	repair := fs.Bool("repair", false, "repair the problems found where possible")
+	global := fs.Bool("global", false, "check global chats")
+	project := fs.String("project", "", "project root (default: current directory)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: bb7 fsck [-repair] [-global] [-project dir]")
+		fmt.Fprintln(stderr, "Checks chat files, the chat index, and context snapshots, and with -repair restores")
+		fmt.Fprintln(stderr, "chats from their backups, drops unresolvable context entries, and rebuilds the index.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	s, err := openStateForCLI(*project, *global)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 fsck: %v\n", err)
+		return 1
+	}
+	issues, err := s.Fsck(*repair)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 fsck: %v\n", err)
+		return 1
+	}
+	if len(issues) == 0 {
+		fmt.Fprintln(stdout, "No problems found")
+		return 0
+	}
+	remaining := 0
+	for _, issue := range issues {
+		line := issue.Problem
+		if issue.ChatID != "" {
+			line = issue.ChatID + ": " + line
+		}
+		if issue.Repaired {
+			line += " (repaired)"
+		} else {
+			remaining++
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	switch {
+	case remaining == 0:
+		fmt.Fprintf(stdout, "%d problems found, all repaired\n", len(issues))
+		return 0
+	case *repair:
+		fmt.Fprintf(stdout, "%d problems found, %d could not be repaired\n", len(issues), remaining)
+	default:
+		fmt.Fprintf(stdout, "%d problems found; run with -repair to fix them\n", len(issues))
+	}
+	return 1
+}
+
+// runGC implements `bb7 gc`: it removes context snapshot objects no chat
+// references any more.
+func runGC(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	global := fs.Bool("global", false, "collect the global object store")
+	project := fs.String("project", "", "project root (default: current directory)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: bb7 gc [-global] [-project dir]")
+		fmt.Fprintln(stderr, "Removes context snapshots no chat references. Snapshots written in the last hour are kept.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	s, err := openStateForCLI(*project, *global)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 gc: %v\n", err)
+		return 1
+	}
+	result, err := s.GC()
+	if err != nil {
+		fmt.Fprintf(stderr, "bb7 gc: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Removed %d objects (%d bytes), kept %d\n", result.Objects, result.Bytes, result.Kept)
+	return 0
+}
+
+// openStateForCLI opens the project at projectRoot (default: the current
+// directory), or global-only mode when global is set.
+func openStateForCLI(projectRoot string, global bool) (*state.State, error) {
+	s := state.New()
+	if global {
+		return s, s.Open("")
+	}
+	if projectRoot == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		projectRoot = wd
+	}
+	return s, s.Open(projectRoot)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestHandleChatExport(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	if err := appState.AddUserMessage("Explain `main`", "test-model"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		handleChatExport("req-export", map[string]any{"format": "md"})
+	})
+	resp := firstResponseByType(responses, "export")
+	if resp == nil {
+		t.Fatalf("expected export response, got %+v", responses)
+	}
+	if resp["format"] != "markdown" || !strings.Contains(resp["content"].(string), "# integration-test-chat") {
+		t.Fatalf("unexpected export response: %+v", resp)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		handleChatExport("req-export-file", map[string]any{"format": "html", "path": "chat.html"})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("expected ok response, got %+v", responses)
+	}
+	data, err := os.ReadFile(filepath.Join(appState.ProjectRoot, "chat.html"))
+	if err != nil {
+		t.Fatalf("expected exported file: %v", err)
+	}
+	if !strings.Contains(string(data), "Explain <code>main</code>") {
+		t.Fatalf("unexpected html export:\n%s", data)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		handleChatExport("req-export-bad", map[string]any{"format": "pdf"})
+	})
+	if firstResponseByType(responses, "error") == nil {
+		t.Fatalf("expected error for unknown format, got %+v", responses)
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	chatID := appState.ActiveChat.ID
+	appState.AddUserMessage("hello", "test-model")
+	appState.ContextAdd("main.go", "package main\n")
+
+	var stdout, stderr bytes.Buffer
+	code := runExport([]string{"-project", appState.ProjectRoot, "-format", "json", chatID}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("runExport exit %d: %s", code, stderr.String())
+	}
+	var bundle state.ChatBundle
+	if err := json.Unmarshal(stdout.Bytes(), &bundle); err != nil {
+		t.Fatalf("invalid JSON bundle: %v", err)
+	}
+	if bundle.Chat.ID != chatID || bundle.FindContext("main.go") == nil {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+
+	// Without an ID the last active chat is exported; format follows -o.
+	out := filepath.Join(t.TempDir(), "chat.md")
+	stdout.Reset()
+	code = runExport([]string{"-project", appState.ProjectRoot, "-o", out}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("runExport exit %d: %s", code, stderr.String())
+	}
+	data, _ := os.ReadFile(out)
+	if !strings.HasPrefix(string(data), "# integration-test-chat") {
+		t.Fatalf("unexpected markdown export:\n%s", data)
+	}
+
+	stderr.Reset()
+	if code := runExport([]string{"-project", t.TempDir(), "abc"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit 1 outside a project, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "not a bb7 project") {
+		t.Fatalf("unexpected error output: %s", stderr.String())
+	}
+}
+
+func TestChatImportRoundTrip(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	srcID := appState.ActiveChat.ID
+	appState.ContextAdd("main.go", "package main\n")
+	appState.AddUserMessage("hello", "test-model")
+
+	bundlePath := filepath.Join(t.TempDir(), "chat.json")
+	var stdout, stderr bytes.Buffer
+	if code := runExport([]string{"-project", appState.ProjectRoot, "-o", bundlePath, srcID}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runExport exit %d: %s", code, stderr.String())
+	}
+
+	responses := captureJSONResponses(t, func() {
+		handleChatImport("req-import", map[string]any{"path": bundlePath})
+	})
+	ok := firstResponseByType(responses, "ok")
+	if ok == nil {
+		t.Fatalf("expected ok response, got %+v", responses)
+	}
+	newID, _ := ok["id"].(string)
+	if newID == "" || newID == srcID || ok["name"] != "integration-test-chat" {
+		t.Fatalf("unexpected import response: %+v", ok)
+	}
+	if appState.ActiveChat.ID != srcID {
+		t.Fatal("import should not change the active chat")
+	}
+
+	// CLI import adds another copy.
+	stdout.Reset()
+	if code := runImport([]string{"-project", appState.ProjectRoot, bundlePath}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runImport exit %d: %s", code, stderr.String())
+	}
+	chats, _ := appState.ChatList()
+	if len(chats) != 3 {
+		t.Fatalf("expected 3 chats after two imports, got %d", len(chats))
+	}
+
+	// Non-bundles are rejected.
+	bogus := filepath.Join(t.TempDir(), "bogus.json")
+	os.WriteFile(bogus, []byte(`{"hello": "world"}`), 0644)
+	responses = captureJSONResponses(t, func() {
+		handleChatImport("req-import-bad", map[string]any{"path": bogus})
+	})
+	if firstResponseByType(responses, "error") == nil {
+		t.Fatalf("expected error for invalid bundle, got %+v", responses)
+	}
+}
+
+func TestRunFsck(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	root := appState.ProjectRoot
+	chatPath := filepath.Join(root, ".bb7", "chats", appState.ActiveChat.ID, "chat.json")
+	appState.AddUserMessage("hello", "test-model")
+
+	var stdout, stderr bytes.Buffer
+	if code := runFsck([]string{"-project", root}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runFsck exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "No problems found") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+
+	os.WriteFile(chatPath, []byte("{"), 0644)
+	stdout.Reset()
+	if code := runFsck([]string{"-project", root}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit 1 with problems, got %d: %s", code, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "chat.json: corrupt") || !strings.Contains(stdout.String(), "run with -repair") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runFsck([]string{"-project", root, "-repair"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runFsck -repair exit %d: %s", code, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "(repaired)") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+	data, _ := os.ReadFile(chatPath)
+	if !json.Valid(data) {
+		t.Fatalf("chat.json not restored: %s", data)
+	}
+}
+
+func TestRunGC(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	root := appState.ProjectRoot
+	if err := appState.ContextAdd("main.go", "package main\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runGC([]string{"-project", root}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runGC exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Removed 0 objects (0 bytes), kept 1") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+	if code := runGC([]string{"-project", root, "extra"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("expected usage error, got exit %d", code)
+	}
+}
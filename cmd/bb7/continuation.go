@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/youruser/bb7/internal/llm"
+)
+
+// Continuation: when a response stops at the output limit
+// (finish_reason=length), send asks the model to go on from where it stopped,
+// up to max_continuations times, and stitches the pieces into one reply.
+// Text that was cut off continues as text. A cut-off tool call continues as
+// the rest of its JSON arguments, which are appended to the partial call
+// before it is handled. The reply so far that is sent back lists the tool
+// calls already handled, so the model doesn't make them again.
+
+const continueTextPrompt = "Your previous reply was cut off by the output limit. Continue exactly where it stopped. Do not repeat anything and do not add a preamble."
+
+const continueToolCallPrompt = "Your previous reply was cut off by the output limit while writing the arguments of a %s tool call. Reply with only the remaining characters of its JSON arguments, starting right after the last character shown above. Do not repeat anything, do not wrap the text in a code block, and do not call any tool."
+
+// continuationMessages extends the messages of a response that was cut off
+// with the reply so far and a request to continue it. done are the tool
+// calls already handled; call is the cut-off tool call, or nil when the text
+// was cut off.
+func continuationMessages(messages []llm.APIMessage, text string, done []toolCallLog, call *llm.ToolCall) []llm.APIMessage {
+	partial := text
+	prompt := continueTextPrompt
+	if len(done) > 0 {
+		var b strings.Builder
+		b.WriteString("Tool calls already made and handled (do not repeat them):")
+		for _, tc := range done {
+			b.WriteString("\n- " + tc.Tool)
+			if tc.Path != "" {
+				b.WriteString(" " + tc.Path)
+			}
+		}
+		partial = appendParagraph(partial, b.String())
+	}
+	if call != nil {
+		partial = appendParagraph(partial, call.Function.Name+" arguments so far:\n"+call.Function.Arguments)
+		prompt = fmt.Sprintf(continueToolCallPrompt, call.Function.Name)
+	}
+	result := append([]llm.APIMessage(nil), messages...)
+	return append(result,
+		llm.APIMessage{Role: "assistant", Content: partial},
+		llm.APIMessage{Role: "user", Content: prompt},
+	)
+}
+
+// appendParagraph appends p to text, separated by a blank line.
+func appendParagraph(text, p string) string {
+	if text == "" {
+		return p
+	}
+	return strings.TrimRight(text, "\n") + "\n\n" + p
+}
+
+// maxContinuations returns how many continuation requests a send may make.
+func maxContinuations() int {
+	if appConfig == nil || appConfig.MaxContinuations == nil {
+		return 0
+	}
+	return *appConfig.MaxContinuations
+}
+
+// truncatedToolCallError describes a tool call that the output limit cut off
+// and that could not be continued.
+func truncatedToolCallError(call *llm.ToolCall) string {
+	return fmt.Sprintf("%s call was cut off by the output limit (finish_reason=length); raise max_tokens or ask for smaller changes", call.Function.Name)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestHandleSendContinuesTruncatedResponse(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	args := writeFileArgsJSON(t, "src/a.go", "package main\n\nfunc main() {}\n")
+	split := len(args) / 2
+
+	var mu sync.Mutex
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/chat/completions" || strings.Contains(string(raw), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var body map[string]any
+		json.Unmarshal(raw, &body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		call := len(bodies)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		content := func(s string) {
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": s}}}})
+		}
+		finish := func(reason string) {
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": reason}}})
+		}
+		switch call {
+		case 1:
+			content("Here is the fil")
+			finish("length")
+		case 2:
+			content("e.")
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{map[string]any{
+				"index": 0, "id": "call_1", "type": "function",
+				"function": map[string]any{"name": "write_file", "arguments": args[:split]},
+			}}}}}})
+			finish("length")
+		default:
+			content(args[split:])
+			finish("stop")
+		}
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	maxCont := 2
+	appConfig.MaxContinuations = &maxCont
+
+	reqID := "req-continue"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses := captureJSONResponses(t, func() {
+		handleSend(reqID, map[string]any{"content": "Write a.go", "model": "test-model"})
+	})
+
+	done := firstResponseByType(responses, "done")
+	if done == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+	if done["finish_reason"] != "stop" {
+		t.Errorf("done finish_reason = %v, want stop", done["finish_reason"])
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("made %d requests, want 3", len(bodies))
+	}
+	lastMessage := func(body map[string]any) string {
+		msgs := body["messages"].([]any)
+		return msgs[len(msgs)-1].(map[string]any)["content"].(string)
+	}
+	if got := lastMessage(bodies[1]); got != continueTextPrompt {
+		t.Errorf("text continuation prompt = %q", got)
+	}
+	if got := lastMessage(bodies[2]); !strings.Contains(got, "arguments of a write_file tool call") {
+		t.Errorf("tool call continuation prompt = %q", got)
+	}
+	if _, ok := bodies[2]["tools"]; ok {
+		t.Error("tool call continuation should not offer tools")
+	}
+
+	msgs := appState.ActiveChat.Messages
+	last := msgs[len(msgs)-1]
+	if text := state.MessageText(last); !strings.HasPrefix(text, "Here is the file.") {
+		t.Errorf("stitched text = %q", text)
+	}
+	if last.FinishReason != "stop" {
+		t.Errorf("stored finish reason = %q, want stop", last.FinishReason)
+	}
+	if len(last.OutputFiles) != 1 || last.OutputFiles[0] != "src/a.go" {
+		t.Errorf("output files = %v", last.OutputFiles)
+	}
+}
+
+func TestHandleSendReportsToolCallStillTruncated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/chat/completions" || strings.Contains(string(raw), "test-title-model") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{map[string]any{
+			"index": 0, "id": "call_1", "type": "function",
+			"function": map[string]any{"name": "write_file", "arguments": `{"path":"src/a.go","content":"pack`},
+		}}}}}})
+		writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": llm.FinishReasonLength}}})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	noContinuations := 0
+	appConfig.MaxContinuations = &noContinuations
+
+	reqID := "req-truncated"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses := captureJSONResponses(t, func() {
+		handleSend(reqID, map[string]any{"content": "Write a.go", "model": "test-model"})
+	})
+
+	resp := firstResponseByType(responses, "diff_error")
+	if resp == nil {
+		t.Fatalf("expected diff_error response, got %+v", responses)
+	}
+	if errs, _ := resp["errors"].([]any); len(errs) != 1 || !strings.Contains(errs[0].(string), "cut off by the output limit") {
+		t.Errorf("diff errors = %v", resp["errors"])
+	}
+	msgs := appState.ActiveChat.Messages
+	if got := msgs[len(msgs)-1].FinishReason; got != llm.FinishReasonLength {
+		t.Errorf("stored finish reason = %q, want length", got)
+	}
+}
+
+func TestContinuationListsHandledToolCalls(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	full := writeFileArgsJSON(t, "src/b.go", "package x\n")
+	split := len(full) / 2
+	rest := full[split:]
+	var mu sync.Mutex
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/chat/completions" || strings.Contains(string(raw), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var body map[string]any
+		json.Unmarshal(raw, &body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		call := len(bodies)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if call == 1 {
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": "Writing both files."}}}})
+			for i, path := range []string{"src/a.go", "src/b.go"} {
+				args := writeFileArgsJSON(t, path, "package x\n")
+				if i == 1 {
+					args = args[:split]
+				}
+				writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{map[string]any{
+					"index": i, "id": "call_" + path, "type": "function",
+					"function": map[string]any{"name": "write_file", "arguments": args},
+				}}}}}})
+			}
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": "length"}}})
+		} else {
+			writeSSEJSON(t, w, map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": rest}}}})
+		}
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	maxCont := 1
+	appConfig.MaxContinuations = &maxCont
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-1", "content": "Write a.go", "model": "test-model"})
+		waitForStreams(t)
+	})
+
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("made %d requests, want 2", len(bodies))
+	}
+	msgs := bodies[1]["messages"].([]any)
+	partial := msgs[len(msgs)-2].(map[string]any)["content"].(string)
+	if !strings.HasPrefix(partial, "Writing both files.") || !strings.Contains(partial, "- write_file src/a.go") ||
+		strings.Contains(partial, "- write_file src/b.go") || !strings.Contains(partial, "write_file arguments so far:") {
+		t.Errorf("reply so far sent back = %q", partial)
+	}
+	for _, path := range []string{"src/a.go", "src/b.go"} {
+		if _, err := appState.GetOutputFile(path); err != nil {
+			t.Errorf("GetOutputFile(%s): %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Review mode: a send with "review": true also offers the report_findings
+// tool and adds review_prompt.txt to the system prompt. Reported findings are
+// stored as "finding" parts of the assistant message, and get_findings lists
+// them for the client's quickfix list.
+
+//go:embed review_prompt.txt
+var reviewPrompt string
+
+// collectFindings handles a report_findings tool call, adding its findings to
+// findings. It returns false for any other tool. A malformed call is logged
+// and reported in the stream but does not fail the response.
+func collectFindings(st *state.State, emit func(map[string]any), toolCall *llm.ToolCall, findings *[]state.Finding) bool {
+	if toolCall == nil || toolCall.Function.Name != llm.ReportFindingsTool.Function.Name {
+		return false
+	}
+	log.ToolCall(toolCall.Function.Name, toolCall.Function.Arguments)
+	args, err := llm.ParseReportFindingsArgs(toolCall.Function.Arguments)
+	if err != nil {
+		log.Info("Failed to parse report_findings args: %v", err)
+		if emit != nil {
+			emit(map[string]any{"type": "chunk", "content": "\n[Could not read findings: " + err.Error() + "]\n"})
+		}
+		return true
+	}
+	stateMu.Lock()
+	for _, a := range args.Findings {
+		*findings = append(*findings, st.NewFinding(state.Finding{
+			Path:         a.Path,
+			FileID:       a.FileID,
+			StartLine:    a.StartLine,
+			EndLine:      a.EndLine,
+			Severity:     a.Severity,
+			Category:     a.Category,
+			Message:      a.Message,
+			SuggestedFix: a.SuggestedFix,
+		}))
+	}
+	stateMu.Unlock()
+	if emit != nil {
+		emit(map[string]any{"type": "chunk", "content": fmt.Sprintf("\n[Reported %d finding(s)]\n", len(args.Findings))})
+	}
+	return true
+}
+
+// appendFindingParts adds the findings not already recorded in the chat to
+// parts. Must be called with stateMu held.
+func appendFindingParts(st *state.State, parts []state.MessagePart, findings []state.Finding) []state.MessagePart {
+	if len(findings) == 0 {
+		return parts
+	}
+	parts, dropped := st.AppendFindingParts(parts, findings)
+	if dropped > 0 {
+		log.Info("Dropped %d finding(s) already reported in this chat", dropped)
+	}
+	return parts
+}
+
+func handleGetFindings(reqID string) {
+	findings, err := appState.Findings()
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if findings == nil {
+		findings = []state.FindingStatus{}
+	}
+	respond(reqID, map[string]any{"type": "findings", "findings": findings})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestReviewSendRecordsFindings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	findingsArgs, _ := json.Marshal(map[string]any{"findings": []any{
+		map[string]any{"path": "main.go", "start_line": 2, "severity": "error", "category": "bug", "message": "counter is not synchronized", "suggested_fix": "use atomic.Int64"},
+		map[string]any{"path": "main.go", "start_line": 1, "severity": "info", "category": "style", "message": "missing package comment"},
+	}})
+	var sawTool, sawPrompt bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sawTool = strings.Contains(string(body), `"name":"report_findings"`)
+		sawPrompt = strings.Contains(string(body), "## Review Mode")
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Two issues."}}},
+		})
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{map[string]any{
+				"index": 0, "id": "call_1", "type": "function",
+				"function": map[string]any{"name": "report_findings", "arguments": string(findingsArgs)},
+			}}}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	if err := appState.ContextAdd("main.go", "package main\nvar counter int\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-1", "content": "review main.go", "review": true})
+		waitForStreams(t)
+		// The same findings reported again are not recorded twice.
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-2", "content": "again", "review": true})
+		waitForStreams(t)
+		sendQueueRequest(map[string]any{"action": "get_findings", "request_id": "req-findings"})
+	})
+
+	if !sawTool || !sawPrompt {
+		t.Errorf("review request: tool offered = %v, prompt added = %v", sawTool, sawPrompt)
+	}
+	resp := firstResponseByType(responses, "findings")
+	if resp == nil {
+		t.Fatalf("expected findings response, got %+v", responses)
+	}
+	list := resp["findings"].([]any)
+	if len(list) != 2 {
+		t.Fatalf("findings = %+v", list)
+	}
+	first := list[0].(map[string]any)
+	if first["path"] != "main.go" || first["start_line"] != 2.0 || first["end_line"] != 2.0 ||
+		first["suggested_fix"] != "use atomic.Int64" || first["file_id"] == "" || first["stale"] != false {
+		t.Errorf("first finding = %+v", first)
+	}
+
+	count := 0
+	for _, msg := range appState.ActiveChat.Messages {
+		for _, part := range msg.Parts {
+			if part.Type == state.PartTypeFinding {
+				count++
+			}
+		}
+	}
+	if count != 2 {
+		t.Errorf("stored %d finding parts, want 2", count)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Generation parameters (max_tokens, temperature, top_p and the reasoning
+// budget) come from three layers: config.json's "generation", the chat's
+// saved settings, and the send request. Each layer overrides the fields it
+// sets.
+
+// updateGenerationParams applies a protocol "generation" object to p. A key
+// with a null value clears that parameter.
+func updateGenerationParams(p llm.GenerationParams, raw any) (llm.GenerationParams, error) {
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return p, fmt.Errorf("%w: generation must be an object", llm.ErrInvalidGenerationParams)
+	}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "max_tokens":
+			p.MaxTokens, err = generationInt(key, value)
+		case "reasoning_max_tokens":
+			p.ReasoningMaxTokens, err = generationInt(key, value)
+		case "temperature":
+			p.Temperature, err = generationFloat(key, value)
+		case "top_p":
+			p.TopP, err = generationFloat(key, value)
+		case "reasoning_exclude":
+			if value == nil {
+				p.ReasoningExclude = nil
+			} else if b, ok := value.(bool); ok {
+				p.ReasoningExclude = &b
+			} else {
+				err = fmt.Errorf("%w: %s must be true or false", llm.ErrInvalidGenerationParams, key)
+			}
+		default:
+			err = fmt.Errorf("%w: unknown parameter %q", llm.ErrInvalidGenerationParams, key)
+		}
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, p.Validate()
+}
+
+func generationInt(key string, value any) (int, error) {
+	if value == nil {
+		return 0, nil
+	}
+	n, ok := value.(float64)
+	if !ok || n != float64(int(n)) {
+		return 0, fmt.Errorf("%w: %s must be a whole number", llm.ErrInvalidGenerationParams, key)
+	}
+	return int(n), nil
+}
+
+func generationFloat(key string, value any) (*float64, error) {
+	if value == nil {
+		return nil, nil
+	}
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be a number", llm.ErrInvalidGenerationParams, key)
+	}
+	return &n, nil
+}
+
+// resolveGeneration combines the config, chat and request generation
+// parameters with the request's reasoning effort, and checks the result
+// against the model's metadata. Unknown models are not checked. Must be
+// called with stateMu held.
+func resolveGeneration(chat *state.Chat, model, effort string, req map[string]any) (*llm.ReasoningConfig, llm.GenerationParams, error) {
+	params := appConfig.Generation
+	if chat.Generation != nil {
+		params = params.Merge(*chat.Generation)
+	}
+	if raw, ok := req["generation"]; ok && raw != nil {
+		override, err := updateGenerationParams(llm.GenerationParams{}, raw)
+		if err != nil {
+			return nil, params, err
+		}
+		params = params.Merge(override)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, params, err
+	}
+	reasoning, err := params.Reasoning(effort)
+	if err != nil {
+		return nil, params, err
+	}
+	if reasoning == nil && params.IsZero() {
+		return nil, params, nil
+	}
+	if info, ok := lookupModelInfo(model); ok {
+		if err := info.CheckGenerationParams(params, reasoning); err != nil {
+			return nil, params, err
+		}
+	}
+	return reasoning, params, nil
+}
+
+// saveChatGeneration applies a save_chat_settings "generation" update to the
+// active chat. Must be called with stateMu held.
+func saveChatGeneration(raw any) error {
+	chat := appState.ActiveChat
+	var current llm.GenerationParams
+	if chat.Generation != nil {
+		current = *chat.Generation
+	}
+	updated, err := updateGenerationParams(current, raw)
+	if err != nil {
+		return err
+	}
+	if updated.IsZero() {
+		chat.Generation = nil
+	} else {
+		// Forks share the pointer, so never modify it in place.
+		chat.Generation = &updated
+	}
+	return nil
+}
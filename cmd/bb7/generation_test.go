@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/llm"
+)
+
+func TestSendGenerationParams(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bodies := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies <- decoded
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "ok"}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	temperature := 0.7
+	appConfig.Generation = llm.GenerationParams{Temperature: &temperature, MaxTokens: 1000}
+	cacheModels([]llm.ModelInfo{{
+		ID:                  "test-model",
+		TopProvider:         llm.TopProvider{MaxCompletionTokens: 8000},
+		SupportedParameters: []string{"max_tokens", "temperature", "reasoning"},
+	}})
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "save_chat_settings", "request_id": "req-set",
+			"generation": map[string]any{"max_tokens": 6000.0, "reasoning_max_tokens": 2000.0}})
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-top-p", "content": "hi", "model": "test-model",
+			"generation": map[string]any{"top_p": 0.5}})
+		waitForStreams(t)
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-effort", "content": "hi", "model": "test-model", "reasoning_effort": "high"})
+		waitForStreams(t)
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-send", "content": "hi", "model": "test-model",
+			"generation": map[string]any{"temperature": 0.0}})
+		waitForStreams(t)
+	})
+
+	errs := map[string]string{}
+	for _, resp := range responses {
+		if resp["type"] == "error" {
+			errs[resp["request_id"].(string)], _ = resp["message"].(string)
+		}
+	}
+	if !strings.Contains(errs["req-top-p"], "does not support top_p") {
+		t.Errorf("unsupported top_p error = %q", errs["req-top-p"])
+	}
+	if !strings.Contains(errs["req-effort"], "cannot be used together") {
+		t.Errorf("effort with reasoning budget error = %q", errs["req-effort"])
+	}
+	if _, failed := errs["req-send"]; failed {
+		t.Fatalf("send failed: %v", errs["req-send"])
+	}
+
+	body := <-bodies
+	if body["max_tokens"] != 6000.0 || body["temperature"] != 0.0 {
+		t.Errorf("max_tokens = %v, temperature = %v", body["max_tokens"], body["temperature"])
+	}
+	if reasoning, _ := body["reasoning"].(map[string]any); reasoning == nil || reasoning["max_tokens"] != 2000.0 {
+		t.Errorf("reasoning = %v", body["reasoning"])
+	}
+	if _, ok := body["top_p"]; ok {
+		t.Error("top_p should not be sent")
+	}
+	if g := appState.ActiveChat.Generation; g == nil || g.MaxTokens != 6000 || g.ReasoningMaxTokens != 2000 {
+		t.Errorf("chat generation = %+v", g)
+	}
+	if n := len(appState.ActiveChat.Messages); n != 2 {
+		t.Errorf("rejected sends should not be recorded, got %d messages", n)
+	}
+}
@@ -19,9 +19,11 @@ import (
 
 	"github.com/youruser/bb7/internal/config"
 	"github.com/youruser/bb7/internal/diff"
+	"github.com/youruser/bb7/internal/export"
 	"github.com/youruser/bb7/internal/llm"
 	"github.com/youruser/bb7/internal/logging"
 	"github.com/youruser/bb7/internal/state"
+	"github.com/youruser/bb7/internal/webdoc"
 )
 
 //go:embed system_prompt.txt
@@ -54,6 +56,11 @@ var (
 	llmClient *llm.Client
 	log       = logging.Get()
 
+	webFetcher = webdoc.NewFetcher(webdoc.DefaultCacheDir())
+
+	modelCacheMu sync.Mutex
+	modelCache   map[string]llm.ModelInfo
+
 	llmMsgLogMu   sync.Mutex
 	llmMsgLogFile *os.File
 	respondMu     sync.Mutex
@@ -63,14 +70,54 @@ var (
 
 const markerLen = 60
 
-type streamState struct {
-	mu        sync.Mutex
-	cancel    context.CancelFunc
+// chatStream is a streaming request (send or send_compare) running in a chat.
+// Each chat streams at most one request at a time; different chats can stream
+// concurrently.
+type chatStream struct {
 	requestID string
+	chatID    string
+	st        *state.State // View on the chat, kept if the user switches chats
+	cancel    context.CancelFunc
 	canceled  bool
 }
 
-var activeStream streamState
+type streamRegistry struct {
+	mu     sync.Mutex
+	byChat map[string]*chatStream
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{byChat: make(map[string]*chatStream)}
+}
+
+var streams = newStreamRegistry()
+
+// instructionReport records which scoped instruction blocks (@when) applied
+// to the last send. Guarded by stateMu.
+type instructionReport struct {
+	ChatID   string                   `json:"chat_id"`
+	Model    string                   `json:"model"`
+	DiffMode string                   `json:"diff_mode"`
+	Blocks   []state.InstructionBlock `json:"blocks"`
+}
+
+var lastInstructionReport *instructionReport
+
+// instructionBlocksFor returns the @when blocks of the last send, limited to
+// one source ("global" or "project") unless source is empty.
+func instructionBlocksFor(source string) *instructionReport {
+	if lastInstructionReport == nil {
+		return nil
+	}
+	report := *lastInstructionReport
+	report.Blocks = []state.InstructionBlock{}
+	for _, block := range lastInstructionReport.Blocks {
+		if source == "" || block.Source == source {
+			report.Blocks = append(report.Blocks, block)
+		}
+	}
+	return &report
+}
 
 func makeMarker(label string, ch rune) string {
 	text := " " + label + " "
@@ -122,6 +169,14 @@ func main() {
 				fmt.Println("unknown")
 			}
 			return
+		case "export":
+			os.Exit(runExport(os.Args[2:], os.Stdout, os.Stderr))
+		case "import":
+			os.Exit(runImport(os.Args[2:], os.Stdout, os.Stderr))
+		case "fsck":
+			os.Exit(runFsck(os.Args[2:], os.Stdout, os.Stderr))
+		case "gc":
+			os.Exit(runGC(os.Args[2:], os.Stdout, os.Stderr))
 		}
 	}
 
@@ -255,82 +310,170 @@ func ensureConfig() error {
 	return nil
 }
 
-func reserveActiveStream(reqID string) bool {
-	activeStream.mu.Lock()
-	defer activeStream.mu.Unlock()
-	if activeStream.requestID != "" {
-		return false
+var errChatStreaming = errors.New("this chat is already streaming a response")
+
+// reserveChatStream registers a stream for reqID in the active chat, bound to
+// a view of the chat so it keeps writing there if the user switches chats.
+// Must be called with stateMu held.
+func reserveChatStream(reqID string) error {
+	if appState.ActiveChat == nil {
+		return state.ErrNoActiveChat
 	}
-	activeStream.requestID = reqID
-	activeStream.cancel = nil
-	activeStream.canceled = false
-	return true
+	if streams.active(appState.ActiveChat.ID) {
+		return errChatStreaming
+	}
+	st, err := appState.View()
+	if err != nil {
+		return err
+	}
+	if !streams.reserve(reqID, appState.ActiveChat.ID, st) {
+		st.Cleanup()
+		return errChatStreaming
+	}
+	return nil
 }
 
-func setActiveStreamCancel(reqID string, cancel context.CancelFunc) bool {
-	activeStream.mu.Lock()
-	defer activeStream.mu.Unlock()
-	if activeStream.requestID != reqID {
+func (r *streamRegistry) reserve(reqID, chatID string, st *state.State) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byChat[chatID]; ok || r.find(reqID) != nil {
 		return false
 	}
-	activeStream.cancel = cancel
+	r.byChat[chatID] = &chatStream{requestID: reqID, chatID: chatID, st: st}
 	return true
 }
 
-func clearActiveStream(reqID string) {
-	activeStream.mu.Lock()
-	defer activeStream.mu.Unlock()
-	if activeStream.requestID != reqID {
-		return
+// find returns the stream for reqID. Must be called with r.mu held.
+func (r *streamRegistry) find(reqID string) *chatStream {
+	for _, cs := range r.byChat {
+		if cs.requestID == reqID {
+			return cs
+		}
+	}
+	return nil
+}
+
+// view returns the chat view a stream writes to.
+func (r *streamRegistry) view(reqID string) *state.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cs := r.find(reqID); cs != nil {
+		return cs.st
 	}
-	activeStream.requestID = ""
-	activeStream.cancel = nil
-	activeStream.canceled = false
+	return nil
 }
 
-func cancelActiveStream(targetID string) bool {
-	activeStream.mu.Lock()
-	if activeStream.requestID == "" {
-		activeStream.mu.Unlock()
+func (r *streamRegistry) setCancel(reqID string, cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cs := r.find(reqID)
+	if cs == nil {
 		return false
 	}
-	if targetID != "" && activeStream.requestID != targetID {
-		activeStream.mu.Unlock()
+	cs.cancel = cancel
+	return true
+}
+
+// clear removes a finished stream and releases its view of the chat.
+func (r *streamRegistry) clear(reqID string) {
+	r.mu.Lock()
+	cs := r.find(reqID)
+	if cs != nil {
+		delete(r.byChat, cs.chatID)
+	}
+	r.mu.Unlock()
+	if cs != nil && cs.st != nil {
+		cs.st.Cleanup()
+	}
+}
+
+// handover passes the chat of the stream for fromID to a new stream for
+// reqID in one step, so no other request can start in the chat in between.
+// It returns the finished stream's view for the caller to clean up.
+func (r *streamRegistry) handover(fromID, reqID string, st *state.State) (*state.State, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cs := r.find(fromID)
+	if cs == nil || r.find(reqID) != nil {
+		return nil, false
+	}
+	r.byChat[cs.chatID] = &chatStream{requestID: reqID, chatID: cs.chatID, st: st}
+	return cs.st, true
+}
+
+// cancel cancels the stream for reqID. An empty reqID matches nothing.
+func (r *streamRegistry) cancel(reqID string) bool {
+	r.mu.Lock()
+	cs := r.find(reqID)
+	return r.cancelLocked(cs)
+}
+
+// cancelChat cancels the stream running in chatID.
+func (r *streamRegistry) cancelChat(chatID string) bool {
+	r.mu.Lock()
+	return r.cancelLocked(r.byChat[chatID])
+}
+
+// cancelLocked marks cs canceled and unlocks r.mu before calling its cancel
+// func.
+func (r *streamRegistry) cancelLocked(cs *chatStream) bool {
+	if cs == nil {
+		r.mu.Unlock()
 		return false
 	}
-	cancel := activeStream.cancel
-	activeStream.canceled = true
-	activeStream.mu.Unlock()
+	cancel := cs.cancel
+	cs.canceled = true
+	r.mu.Unlock()
 	if cancel != nil {
 		cancel()
 	}
 	return true
 }
 
-func wasStreamCanceled(reqID string) bool {
-	activeStream.mu.Lock()
-	defer activeStream.mu.Unlock()
-	return activeStream.requestID == reqID && activeStream.canceled
+func (r *streamRegistry) wasCanceled(reqID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cs := r.find(reqID)
+	return cs != nil && cs.canceled
 }
 
-func hasActiveStream() bool {
-	activeStream.mu.Lock()
-	defer activeStream.mu.Unlock()
-	return activeStream.requestID != ""
+// active reports whether chatID has a stream running.
+func (r *streamRegistry) active(chatID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.byChat[chatID]
+	return ok
+}
+
+// chatState returns the State that owns a chat: the stream's view while the
+// chat streams, otherwise appState.
+func (r *streamRegistry) chatState(chatID string) *state.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cs, ok := r.byChat[chatID]; ok && cs.st != nil {
+		return cs.st
+	}
+	return appState
+}
+
+// activeChatStreaming reports whether the active chat has a stream running.
+// Must be called with stateMu held.
+func activeChatStreaming() bool {
+	return appState.ActiveChat != nil && streams.active(appState.ActiveChat.ID)
 }
 
 // resolveFileBase returns the base content for an edit call.
 // It checks pending writes first (for files written earlier in the same
 // response), then output, then context. Must be called with stateMu held
 // (for output/context access).
-func resolveFileBase(path string, pendingWrites map[string]string) (string, string, string) {
+func resolveFileBase(st *state.State, path string, pendingWrites map[string]string) (string, string, string) {
 	if content, ok := pendingWrites[path]; ok {
 		return content, "pending", state.HashFileVersion(path, content)
 	}
-	if content, err := appState.GetOutputFile(path); err == nil {
+	if content, err := st.GetOutputFile(path); err == nil {
 		return content, "output", state.HashFileVersion(path, content)
 	}
-	if content, err := appState.GetContextFile(path); err == nil {
+	if content, err := st.GetContextFile(path); err == nil {
 		return content, "context", state.HashFileVersion(path, content)
 	}
 	return "", "", ""
@@ -379,6 +522,32 @@ func cloneStringMap(src map[string]string) map[string]string {
 	return dst
 }
 
+// deniedWriteErrors reports the pending writes that .bb7/policy denies.
+// They fail like broken edits, so none of the reply's files are written.
+func deniedWriteErrors(st *state.State, pendingWrites map[string]string) []string {
+	var errs []string
+	for path := range pendingWrites {
+		if err := st.CheckPathPolicy(state.PolicyWrite, path); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// readDenied reports whether .bb7/policy denies sending a context file that
+// is already in the chat, e.g. one added before the rule was written. Such
+// files are left out of requests. Errors other than a denial, such as an
+// invalid policy, are returned so the send fails instead.
+func readDenied(st *state.State, path string) (bool, error) {
+	err := st.CheckPathPolicy(state.PolicyRead, path)
+	if errors.Is(err, state.ErrPathDenied) {
+		log.Warn("Not sending %s: %v", path, err)
+		return true, nil
+	}
+	return false, err
+}
+
 func appendUniquePaths(existing []string, more []string) []string {
 	seen := make(map[string]bool, len(existing))
 	for _, path := range existing {
@@ -493,13 +662,13 @@ func toolCallEntriesFromLogs(logs []toolCallLog) []map[string]any {
 
 // appendAssistantWriteParts appends one AssistantWriteFile context_event per output file.
 // Must be called with stateMu held.
-func appendAssistantWriteParts(parts []state.MessagePart, outputFiles []string, pendingWrites map[string]string) []state.MessagePart {
+func appendAssistantWriteParts(st *state.State, parts []state.MessagePart, outputFiles []string, pendingWrites map[string]string) []state.MessagePart {
 	for _, path := range outputFiles {
 		content, ok := pendingWrites[path]
 		if !ok {
 			continue
 		}
-		cf := appState.FindContextFile(path)
+		cf := st.FindContextFile(path)
 		readOnly := false
 		external := false
 		if cf != nil {
@@ -533,7 +702,8 @@ func setTerminalStreamError(streamErr *string, msg string, cancel context.Cancel
 }
 
 func handleToolCallEvent(
-	reqID string,
+	st *state.State,
+	emit func(map[string]any),
 	diffMode string,
 	toolCall *llm.ToolCall,
 	pendingWrites map[string]string,
@@ -545,7 +715,6 @@ func handleToolCallEvent(
 	streamErr *string,
 	duplicatePathDetected *bool,
 	cancel context.CancelFunc,
-	emitChunks bool,
 ) {
 	if toolCall == nil {
 		return
@@ -577,7 +746,7 @@ func handleToolCallEvent(
 		}
 		seenOutputPaths[args.Path] = true
 		stateMu.Lock()
-		inContext := appState.HasContextFile(args.Path)
+		inContext := st.HasContextFile(args.Path)
 		isNew := !inContext
 		stateMu.Unlock()
 		pendingWrites[args.Path] = args.Content
@@ -587,8 +756,8 @@ func handleToolCallEvent(
 		}
 		log.Info("%s: %s (%d bytes)", action, args.Path, len(args.Content))
 		*outputFiles = append(*outputFiles, args.Path)
-		if emitChunks {
-			respond(reqID, map[string]any{"type": "chunk", "content": "\n[" + action + ": " + args.Path + "]\n"})
+		if emit != nil {
+			emit(map[string]any{"type": "chunk", "content": "\n[" + action + ": " + args.Path + "]\n"})
 		}
 
 	case "edit_file":
@@ -606,7 +775,7 @@ func handleToolCallEvent(
 			pathBaseSources := make(map[string]string)
 			for i, edit := range args.Edits {
 				stateMu.Lock()
-				base, baseSource, baseID := resolveFileBase(edit.Path, pendingWrites)
+				base, baseSource, baseID := resolveFileBase(st, edit.Path, pendingWrites)
 				stateMu.Unlock()
 				if baseSource == "" {
 					msg := fmt.Sprintf("edit_file: %s not in context or output", edit.Path)
@@ -650,8 +819,8 @@ func handleToolCallEvent(
 
 				log.Info("Assistant modified (search_replace_multi): %s edit %d (%d bytes, base=%s)", edit.Path, i, len(newContent), baseSource)
 			}
-			if emitChunks {
-				respond(reqID, map[string]any{"type": "chunk", "content": fmt.Sprintf("\n[Assistant modified: %d edit(s)]\n", len(args.Edits))})
+			if emit != nil {
+				emit(map[string]any{"type": "chunk", "content": fmt.Sprintf("\n[Assistant modified: %d edit(s)]\n", len(args.Edits))})
 			}
 
 		case "search_replace":
@@ -664,7 +833,7 @@ func handleToolCallEvent(
 			(*toolCallLogs)[toolLogIdx].Path = args.Path
 
 			stateMu.Lock()
-			base, baseSource, baseID := resolveFileBase(args.Path, pendingWrites)
+			base, baseSource, baseID := resolveFileBase(st, args.Path, pendingWrites)
 			stateMu.Unlock()
 			if baseSource == "" {
 				msg := fmt.Sprintf("edit_file: %s not in context or output", args.Path)
@@ -696,8 +865,8 @@ func handleToolCallEvent(
 			}
 
 			log.Info("Assistant modified (search_replace): %s (%d bytes, base=%s)", args.Path, len(newContent), baseSource)
-			if emitChunks {
-				respond(reqID, map[string]any{"type": "chunk", "content": "\n[Assistant modified: " + args.Path + "]\n"})
+			if emit != nil {
+				emit(map[string]any{"type": "chunk", "content": "\n[Assistant modified: " + args.Path + "]\n"})
 			}
 
 		case "anchored":
@@ -719,7 +888,7 @@ func handleToolCallEvent(
 			seenOutputPaths[args.Path] = true
 
 			stateMu.Lock()
-			base, baseSource, baseID := resolveFileBase(args.Path, pendingWrites)
+			base, baseSource, baseID := resolveFileBase(st, args.Path, pendingWrites)
 			stateMu.Unlock()
 			if baseSource == "" {
 				msg := fmt.Sprintf("edit_file: %s not in context or output", args.Path)
@@ -760,8 +929,8 @@ func handleToolCallEvent(
 
 			log.Info("Assistant modified (anchored): %s (%d bytes, base=%s)", args.Path, len(newContent), baseSource)
 			*outputFiles = append(*outputFiles, args.Path)
-			if emitChunks {
-				respond(reqID, map[string]any{"type": "chunk", "content": "\n[Assistant modified: " + args.Path + "]\n"})
+			if emit != nil {
+				emit(map[string]any{"type": "chunk", "content": "\n[Assistant modified: " + args.Path + "]\n"})
 			}
 		}
 	}
@@ -773,6 +942,14 @@ func actionMutatesChatState(action string) bool {
 		"chat_select",
 		"chat_edit",
 		"chat_delete",
+		"chat_archive",
+		"chat_restore",
+		"chat_bulk",
+		"trash_empty",
+		"chat_tag",
+		"chat_untag",
+		"chat_move_folder",
+		"chat_pin",
 		"chat_rename",
 		"chat_force_unlock",
 		"fork_chat",
@@ -780,6 +957,8 @@ func actionMutatesChatState(action string) bool {
 		"save_draft",
 		"save_chat_settings",
 		"context_add",
+		"context_add_url",
+		"context_add_image",
 		"context_add_section",
 		"context_update",
 		"context_set_readonly",
@@ -790,7 +969,9 @@ func actionMutatesChatState(action string) bool {
 		"apply_file_as",
 		"diff_local_done",
 		"generate_title",
-		"add_system_message":
+		"add_system_message",
+		"select_variant",
+		"chat_import":
 		return true
 	default:
 		return false
@@ -804,10 +985,23 @@ func actionUsesChatState(action string) bool {
 		"chat_new",
 		"chat_list",
 		"search_chats",
+		"template_list",
+		"template_render",
 		"chat_select",
 		"chat_get",
 		"chat_edit",
 		"chat_delete",
+		"chat_archive",
+		"trash_list",
+		"chat_restore",
+		"trash_empty",
+		"chat_bulk",
+		"chat_tag",
+		"chat_untag",
+		"chat_move_folder",
+		"chat_pin",
+		"chat_tags",
+		"project_usage",
 		"chat_active",
 		"chat_rename",
 		"chat_force_unlock",
@@ -816,6 +1010,7 @@ func actionUsesChatState(action string) bool {
 		"save_draft",
 		"save_chat_settings",
 		"context_add",
+		"context_add_image",
 		"context_add_section",
 		"context_update",
 		"context_set_readonly",
@@ -827,33 +1022,43 @@ func actionUsesChatState(action string) bool {
 		"output_delete",
 		"get_diff_paths",
 		"get_file_statuses",
+		"get_findings",
 		"apply_file",
 		"apply_file_as",
 		"diff_local_done",
 		"estimate_tokens",
 		"send",
+		"send_compare",
+		"regenerate",
+		"select_variant",
 		"generate_title",
 		"get_customization_info",
 		"prepare_instructions",
-		"add_system_message":
+		"add_system_message",
+		"chat_export",
+		"chat_import",
+		"chat_tree",
+		"chat_compare",
+		"queue_list",
+		"queue_cancel",
+		"queue_resume":
 		return true
 	default:
 		return false
 	}
 }
 
-// actionBlockedDuringStream returns true for actions that mutate chat state
-// in ways that conflict with an active streaming goroutine. Read-only actions
-// and idempotent init are allowed through so the UI can reopen mid-stream.
+// actionBlockedDuringStream returns true for actions that mutate the active
+// chat in ways that conflict with a stream running in it. Read-only actions,
+// idempotent init, and switching to another chat are allowed through, so the
+// user can keep working in other chats and the UI can reopen mid-stream.
+// Actions that take a chat ID check that chat themselves.
 func actionBlockedDuringStream(action string) bool {
 	switch action {
-	case "chat_new",
-		"chat_select",
-		"chat_delete",
-		"chat_edit",
-		"fork_chat",
-		"chat_new_with_context",
+	case "chat_edit",
 		"context_add",
+		"context_add_url",
+		"context_add_image",
 		"context_add_section",
 		"context_update",
 		"context_set_readonly",
@@ -866,6 +1071,7 @@ func actionBlockedDuringStream(action string) bool {
 		"save_draft",
 		"save_chat_settings",
 		"prepare_instructions",
+		"select_variant",
 		"add_system_message":
 		return true
 	default:
@@ -885,14 +1091,13 @@ func handleRequest(line string) {
 	log.Request(action, line)
 	reqID := requestID(req)
 
-	if hasActiveStream() && actionBlockedDuringStream(action) {
-		respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
-		return
-	}
-
 	if actionUsesChatState(action) {
 		stateMu.Lock()
 		defer stateMu.Unlock()
+		if actionBlockedDuringStream(action) && activeChatStreaming() {
+			respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
+			return
+		}
 	}
 
 	switch action {
@@ -927,6 +1132,13 @@ func handleRequest(line string) {
 		if err := ensureConfig(); err == nil && appConfig.DefaultModelExplicit {
 			resp["default_model"] = appConfig.DefaultModel
 		}
+		if n := appState.QueueResumable(); n > 0 {
+			resp["resumable_sends"] = n
+		}
+		purgeExpiredTrash()
+		if err := appState.MigratePinnedChats(); err != nil {
+			log.Warn("migrating pinned_chats.json: %v", err)
+		}
 		respond(reqID, resp)
 
 	case "chat_new":
@@ -955,13 +1167,12 @@ func handleRequest(line string) {
 
 	case "chat_list":
 		global, _ := req["global"].(bool)
-		var chats []state.ChatSummary
-		var err error
-		if global || appState.GlobalOnly {
-			chats, err = appState.ChatListGlobal()
-		} else {
-			chats, err = appState.ChatList()
-		}
+		opts := state.ChatListOptions{}
+		opts.Archived, _ = req["archived"].(bool)
+		opts.Tag, _ = req["tag"].(string)
+		opts.Folder, _ = req["folder"].(string)
+		opts.Sort, _ = req["sort"].(string)
+		chats, err := appState.ChatListFiltered(global || appState.GlobalOnly, opts)
 		if err != nil {
 			respond(reqID, errorResponse(err))
 			return
@@ -970,14 +1181,16 @@ func handleRequest(line string) {
 
 	case "search_chats":
 		query, _ := req["query"].(string)
-		global, _ := req["global"].(bool)
-		var results []state.ChatSearchResult
-		var err error
-		if global || appState.GlobalOnly {
-			results, err = appState.SearchChatsGlobal(query)
-		} else {
-			results, err = appState.SearchChats(query)
+		scopeName, _ := req["scope"].(string)
+		if global, _ := req["global"].(bool); global {
+			scopeName = "global"
+		}
+		scope, err := state.ParseSearchScope(scopeName)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
 		}
+		results, err := appState.Search(query, scope)
 		if err != nil {
 			respond(reqID, errorResponse(err))
 			return
@@ -1001,6 +1214,11 @@ func handleRequest(line string) {
 			respond(reqID, errorResponse(err))
 			return
 		}
+		// Back in a streaming chat: share the stream's copy so chat_get
+		// sees its progress and later edits don't overwrite the reply.
+		if st := streams.chatState(id); st != appState && st.ActiveChat.Global == appState.ActiveChat.Global {
+			appState.ActiveChat = st.ActiveChat
+		}
 		respond(reqID, map[string]any{"type": "ok"})
 
 	case "chat_get":
@@ -1022,6 +1240,8 @@ func handleRequest(line string) {
 			"created":           appState.ActiveChat.Created,
 			"model":             appState.ActiveChat.Model,
 			"reasoning_effort":  appState.ActiveChat.ReasoningEffort,
+			"persona":           appState.ActiveChat.Persona,
+			"generation":        appState.ActiveChat.Generation,
 			"draft":             appState.ActiveChat.Draft,
 			"messages":          appState.ActiveChat.Messages,
 			"instructions_info": instrInfo,
@@ -1062,6 +1282,10 @@ func handleRequest(line string) {
 			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
 			return
 		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
 		global, _ := req["global"].(bool)
 		var err error
 		if global || appState.GlobalOnly {
@@ -1073,14 +1297,158 @@ func handleRequest(line string) {
 			respond(reqID, errorResponse(err))
 			return
 		}
+		// With a retention of zero the chat is removed right away.
+		if _, err := appState.PurgeTrash(global || appState.GlobalOnly, trashRetention()); err != nil {
+			log.Warn("purging trash: %v", err)
+		}
+		respond(reqID, map[string]any{"type": "ok"})
+
+	case "chat_archive":
+		id, _ := req["id"].(string)
+		if id == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+			return
+		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
+		global, _ := req["global"].(bool)
+		archived, ok := req["archived"].(bool)
+		if !ok {
+			archived = true
+		}
+		if err := appState.ChatArchive(id, global || appState.GlobalOnly, archived); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok"})
+
+	case "chat_tag", "chat_untag":
+		id, _ := req["id"].(string)
+		if id == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+			return
+		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
+		global, _ := req["global"].(bool)
+		update := appState.ChatTag
+		if action == "chat_untag" {
+			update = appState.ChatUntag
+		}
+		tags, err := update(id, global || appState.GlobalOnly, stringList(req, "tags"))
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok", "id": id, "tags": tags})
+
+	case "chat_move_folder":
+		id, _ := req["id"].(string)
+		if id == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+			return
+		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
+		global, _ := req["global"].(bool)
+		folder, _ := req["folder"].(string)
+		folder, err := appState.ChatMoveFolder(id, global || appState.GlobalOnly, folder)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok", "id": id, "folder": folder})
+
+	case "chat_pin":
+		id, _ := req["id"].(string)
+		if id == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+			return
+		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
+		global, _ := req["global"].(bool)
+		pinned, ok := req["pinned"].(bool)
+		if !ok {
+			pinned = true
+		}
+		if err := appState.ChatPin(id, global || appState.GlobalOnly, pinned); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
 		respond(reqID, map[string]any{"type": "ok"})
 
+	case "chat_tags":
+		global, _ := req["global"].(bool)
+		tags, err := appState.ChatTags(global || appState.GlobalOnly)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "chat_tags", "tags": tags})
+
+	case "project_usage":
+		global, _ := req["global"].(bool)
+		global = global || appState.GlobalOnly
+		usage, err := appState.ProjectUsage(global)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "project_usage", "global": global, "usage": usage})
+
+	case "trash_list":
+		global, _ := req["global"].(bool)
+		chats, err := appState.TrashList(global || appState.GlobalOnly)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "trash_list", "chats": chats, "retention_days": int(trashRetention().Hours() / 24)})
+
+	case "chat_restore":
+		id, _ := req["id"].(string)
+		if id == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+			return
+		}
+		global, _ := req["global"].(bool)
+		if err := appState.ChatRestore(id, global || appState.GlobalOnly); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok", "id": id})
+
+	case "trash_empty":
+		global, _ := req["global"].(bool)
+		purged, err := appState.PurgeTrash(global || appState.GlobalOnly, 0)
+		if err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok", "purged": len(purged)})
+
+	case "chat_bulk":
+		handleChatBulk(reqID, req)
+
 	case "chat_move":
 		id, _ := req["id"].(string)
 		if id == "" {
 			respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
 			return
 		}
+		if streams.active(id) {
+			respond(reqID, errorResponse(errChatStreaming))
+			return
+		}
 		to, _ := req["to"].(string)
 		var err error
 		switch to {
@@ -1124,11 +1492,13 @@ func handleRequest(line string) {
 			return
 		}
 		global, _ := req["global"].(bool)
+		// A streaming chat is renamed through its stream's copy.
+		owner := streams.chatState(id)
 		var err error
 		if global || appState.GlobalOnly {
-			err = appState.ChatRenameGlobal(id, name)
+			err = owner.ChatRenameGlobal(id, name)
 		} else {
-			err = appState.ChatRename(id, name)
+			err = owner.ChatRename(id, name)
 		}
 		if err != nil {
 			respond(reqID, errorResponse(err))
@@ -1214,11 +1584,34 @@ func handleRequest(line string) {
 		if effort, ok := req["reasoning_effort"].(string); ok {
 			appState.ActiveChat.ReasoningEffort = effort
 		}
+		if raw, ok := req["generation"]; ok {
+			if err := saveChatGeneration(raw); err != nil {
+				respond(reqID, errorResponse(err))
+				return
+			}
+		}
+		persona, personaSet := req["persona"].(string)
+		if personaSet {
+			if err := selectChatPersona(persona); err != nil {
+				respond(reqID, errorResponse(err))
+				return
+			}
+		}
 		if err := appState.SaveActiveChat(); err != nil {
 			respond(reqID, errorResponse(err))
 			return
 		}
-		respond(reqID, map[string]any{"type": "ok"})
+		resp := map[string]any{"type": "ok"}
+		if personaSet {
+			// Selecting a persona can change the model and reasoning effort.
+			resp["persona"] = appState.ActiveChat.Persona
+			resp["model"] = appState.ActiveChat.Model
+			resp["reasoning_effort"] = appState.ActiveChat.ReasoningEffort
+		}
+		if _, ok := req["generation"]; ok {
+			resp["generation"] = appState.ActiveChat.Generation
+		}
+		respond(reqID, resp)
 
 	case "context_add":
 		path, _ := req["path"].(string)
@@ -1234,6 +1627,14 @@ func handleRequest(line string) {
 		}
 		respond(reqID, map[string]any{"type": "ok"})
 
+	case "context_add_image":
+		handleContextAddImage(reqID, req)
+
+	case "context_add_url":
+		// Fetching may be slow; the handler takes stateMu itself once the
+		// document is downloaded.
+		go handleContextAddURL(reqID, req)
+
 	case "context_add_section":
 		path, _ := req["path"].(string)
 		content, _ := req["content"].(string)
@@ -1466,18 +1867,60 @@ func handleRequest(line string) {
 		handleEstimateTextTokens(reqID, req)
 
 	case "send":
-		if !reserveActiveStream(reqID) {
-			respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
+		if err := applySendTemplate(req); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		if err := checkDiffMode(req); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		if queue, _ := req["queue"].(bool); queue && activeChatStreaming() {
+			queueSend(reqID, req)
+			return
+		}
+		if err := reserveChatStream(reqID); err != nil {
+			respond(reqID, errorResponse(err))
 			return
 		}
+		recordRunningSend(reqID, req)
 		go handleSend(reqID, req)
 
+	case "regenerate":
+		handleRegenerate(reqID, req)
+
+	case "select_variant":
+		handleSelectVariant(reqID, req)
+
+	case "get_findings":
+		handleGetFindings(reqID)
+
+	case "send_compare":
+		if err := reserveChatStream(reqID); err != nil {
+			respond(reqID, errorResponse(err))
+			return
+		}
+		go handleSendCompare(reqID, req)
+
 	case "generate_title":
 		handleGenerateTitle(reqID, req)
 
 	case "cancel":
-		targetID, _ := req["target_request_id"].(string)
-		if !cancelActiveStream(targetID) {
+		var canceled bool
+		if targetID, _ := req["target_request_id"].(string); targetID != "" {
+			canceled = streams.cancel(targetID)
+		} else {
+			chatID, _ := req["chat_id"].(string)
+			if chatID == "" {
+				stateMu.Lock()
+				if appState.ActiveChat != nil {
+					chatID = appState.ActiveChat.ID
+				}
+				stateMu.Unlock()
+			}
+			canceled = streams.cancelChat(chatID)
+		}
+		if !canceled {
 			respond(reqID, map[string]any{"type": "error", "message": "No active request to cancel"})
 			return
 		}
@@ -1497,6 +1940,10 @@ func handleRequest(line string) {
 		if isGlobalChat {
 			projectError = ""
 		}
+		directories := info.Directories
+		if directories == nil {
+			directories = []state.DirectoryInstructions{}
+		}
 		systemOverride := false
 		if homeDir, err := os.UserHomeDir(); err == nil {
 			overridePath := filepath.Join(homeDir, ".config", "bb7", "system_prompt.txt")
@@ -1510,6 +1957,8 @@ func handleRequest(line string) {
 			"global_instructions":        globalValid,
 			"project_instructions":       projectValid,
 			"project_instructions_error": projectError,
+			"directory_instructions":     directories,
+			"instruction_blocks":         instructionBlocksFor(""),
 		})
 
 	case "prepare_instructions":
@@ -1523,7 +1972,11 @@ func handleRequest(line string) {
 			respond(reqID, errorResponse(err))
 			return
 		}
-		respond(reqID, map[string]any{"type": "instructions_path", "path": path})
+		respond(reqID, map[string]any{
+			"type":               "instructions_path",
+			"path":               path,
+			"instruction_blocks": instructionBlocksFor(level),
+		})
 
 	case "add_system_message":
 		if appState.ActiveChat == nil {
@@ -1554,31 +2007,312 @@ func handleRequest(line string) {
 		}
 		respond(reqID, map[string]any{"type": "ok"})
 
+	case "chat_export":
+		handleChatExport(reqID, req)
+
+	case "chat_import":
+		handleChatImport(reqID, req)
+
+	case "chat_tree":
+		handleChatTree(reqID, req)
+
+	case "chat_compare":
+		handleChatCompare(reqID, req)
+
+	case "queue_list":
+		handleQueueList(reqID, req)
+
+	case "queue_cancel":
+		handleQueueCancel(reqID, req)
+
+	case "queue_resume":
+		handleQueueResume(reqID, req)
+
+	case "persona_list":
+		handlePersonaList(reqID)
+
+	case "template_list":
+		handleTemplateList(reqID)
+
+	case "template_render":
+		handleTemplateRender(reqID, req)
+
 	default:
 		respond(reqID, map[string]any{"type": "error", "message": fmt.Sprintf("Unknown action: %s", action)})
 	}
 }
 
-func handleGetBalance(reqID string) {
-	// Load config if needed
-	if err := ensureConfig(); err != nil {
+// handleChatExport renders a chat as Markdown, HTML, or a JSON bundle. Without
+// chat_id the active chat is exported. With path the result is written to
+// that file (relative to the project root); otherwise it is returned inline.
+func handleChatExport(reqID string, req map[string]any) {
+	chatID, _ := req["chat_id"].(string)
+	global, _ := req["global"].(bool)
+	if chatID == "" {
+		if appState.ActiveChat == nil {
+			respond(reqID, errorResponse(state.ErrNoActiveChat))
+			return
+		}
+		chatID = appState.ActiveChat.ID
+		global = appState.ActiveChat.Global
+	}
+
+	formatName, _ := req["format"].(string)
+	format, err := export.ParseFormat(formatName)
+	if err != nil {
 		respond(reqID, errorResponse(err))
 		return
 	}
 
-	balance, err := llmClient.GetBalance()
+	bundle, err := appState.ExportChat(chatID, global || appState.GlobalOnly)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	data, err := export.Render(bundle, format)
 	if err != nil {
 		respond(reqID, errorResponse(err))
 		return
 	}
 
-	respond(reqID, map[string]any{
-		"type":          "balance",
-		"total_credits": balance.Data.TotalCredits,
+	path, _ := req["path"].(string)
+	if path == "" {
+		respond(reqID, map[string]any{"type": "export", "format": string(format), "content": string(data)})
+		return
+	}
+	if !filepath.IsAbs(path) {
+		if appState.ProjectRoot == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Export path must be absolute when no project is set"})
+			return
+		}
+		path = filepath.Join(appState.ProjectRoot, path)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "ok", "path": path, "format": string(format)})
+}
+
+// chatRefFromRequest reads the chat a lineage request refers to: the given
+// field, or the active chat if it is empty. The global flag follows the
+// active chat unless set explicitly.
+func chatRefFromRequest(req map[string]any, field string) (string, bool, error) {
+	chatID, _ := req[field].(string)
+	global, _ := req["global"].(bool)
+	if chatID == "" {
+		if appState.ActiveChat == nil {
+			return "", false, state.ErrNoActiveChat
+		}
+		chatID = appState.ActiveChat.ID
+		global = global || appState.ActiveChat.Global
+	}
+	return chatID, global || appState.GlobalOnly, nil
+}
+
+// handleChatTree returns the fork family of a chat.
+func handleChatTree(reqID string, req map[string]any) {
+	chatID, global, err := chatRefFromRequest(req, "chat_id")
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	root, err := appState.ChatTree(chatID, global)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "chat_tree", "chat_id": chatID, "root": root})
+}
+
+// handleChatCompare diffs two chats of the same fork family. "left" defaults
+// to the active chat.
+func handleChatCompare(reqID string, req map[string]any) {
+	rightID, _ := req["right"].(string)
+	if rightID == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: right"})
+		return
+	}
+	leftID, global, err := chatRefFromRequest(req, "left")
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	cmp, err := appState.ChatCompare(leftID, rightID, global)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{
+		"type":            "chat_compare",
+		"left":            cmp.Left,
+		"right":           cmp.Right,
+		"common_messages": cmp.CommonMessages,
+		"turns":           cmp.Turns,
+		"files":           cmp.Files,
+	})
+}
+
+// handleChatImport creates a new chat from a JSON bundle written by
+// chat_export. The chat gets a fresh ID and is not selected.
+func handleChatImport(reqID string, req map[string]any) {
+	path, _ := req["path"].(string)
+	if path == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: path"})
+		return
+	}
+	if !filepath.IsAbs(path) {
+		if appState.ProjectRoot == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Import path must be absolute when no project is set"})
+			return
+		}
+		path = filepath.Join(appState.ProjectRoot, path)
+	}
+	global, _ := req["global"].(bool)
+
+	bundle, err := state.ReadBundle(path)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	chat, err := appState.ImportChat(bundle, global)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	resp := map[string]any{"type": "ok", "id": chat.ID, "name": chat.Name}
+	if chat.Global {
+		resp["global"] = true
+	}
+	respond(reqID, resp)
+}
+
+func handleGetBalance(reqID string) {
+	// Load config if needed
+	if err := ensureConfig(); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	balance, err := llmClient.GetBalance()
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	respond(reqID, map[string]any{
+		"type":          "balance",
+		"total_credits": balance.Data.TotalCredits,
 		"total_usage":   balance.Data.TotalUsage,
 	})
 }
 
+// handleContextAddImage reads an image from disk and adds it to context.
+// Images are read by the backend because they routinely exceed the 1 MB
+// request line limit once base64-encoded.
+func handleContextAddImage(reqID string, req map[string]any) {
+	path, _ := req["path"].(string)
+	if path == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: path"})
+		return
+	}
+	if appState.ActiveChat == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+
+	fullPath := path
+	if !filepath.IsAbs(fullPath) {
+		if appState.ProjectRoot == "" {
+			respond(reqID, map[string]any{"type": "error", "message": "Image path must be absolute when no project is set"})
+			return
+		}
+		fullPath = filepath.Join(appState.ProjectRoot, path)
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if info.Size() > state.MaxImageBytes {
+		respond(reqID, errorResponse(state.ErrImageTooLarge))
+		return
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	if err := appState.ContextAddImage(path, data); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "ok"})
+}
+
+var errChatChangedDuringFetch = errors.New("the active chat changed while the URL was being fetched; add it again")
+
+// handleContextAddURL fetches a documentation page (or reuses the shared web
+// cache) and adds it to the chat that was active when it was requested as a
+// read-only context document. With refresh set, the page is refetched and an
+// existing entry is updated.
+func handleContextAddURL(reqID string, req map[string]any) {
+	rawURL, _ := req["url"].(string)
+	refresh, _ := req["refresh"].(bool)
+	if rawURL == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: url"})
+		return
+	}
+
+	// The document goes to the chat that was active when it was requested.
+	stateMu.Lock()
+	chat := appState.ActiveChat
+	stateMu.Unlock()
+	if chat == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+	chatID, global := chat.ID, chat.Global
+
+	doc, err := webFetcher.Fetch(context.Background(), rawURL, refresh)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if c := appState.ActiveChat; c == nil || c.ID != chatID || c.Global != global {
+		respond(reqID, errorResponse(errChatChangedDuringFetch))
+		return
+	}
+	if activeChatStreaming() {
+		respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
+		return
+	}
+
+	if refresh && appState.HasContextFile(doc.URL) {
+		err = appState.ContextUpdate(doc.URL, doc.Content)
+	} else {
+		err = appState.ContextAddURL(doc.URL, doc.Content)
+	}
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	respond(reqID, map[string]any{
+		"type":       "ok",
+		"path":       doc.URL,
+		"title":      doc.Title,
+		"cached":     doc.FromCache,
+		"fetched_at": doc.FetchedAt,
+	})
+}
+
 func handleGetModels(reqID string) {
 	// Load config if needed
 	if err := ensureConfig(); err != nil {
@@ -1591,6 +2325,7 @@ func handleGetModels(reqID string) {
 		respond(reqID, errorResponse(err))
 		return
 	}
+	cacheModels(models.Data)
 
 	// Transform to simplified format for frontend
 	var modelList []map[string]any
@@ -1616,6 +2351,7 @@ func handleGetModels(reqID string) {
 			"max_completion_tokens": m.TopProvider.MaxCompletionTokens,
 			"supports_reasoning":    supportsReasoning,
 			"supports_tools":        supportsTools,
+			"supports_images":       m.SupportsImageInput(),
 			"pricing": map[string]any{
 				"prompt":             m.Pricing.Prompt,
 				"completion":         m.Pricing.Completion,
@@ -1633,6 +2369,92 @@ func handleGetModels(reqID string) {
 	})
 }
 
+// cacheModels replaces the model metadata cache used for capability checks.
+func cacheModels(models []llm.ModelInfo) {
+	cache := make(map[string]llm.ModelInfo, len(models))
+	for _, m := range models {
+		cache[m.ID] = m
+	}
+	modelCacheMu.Lock()
+	modelCache = cache
+	modelCacheMu.Unlock()
+}
+
+// lookupModelInfo returns metadata for a model. The model list is fetched once
+// if nothing is cached yet (the UI normally loads it on startup via get_models).
+// Returns false when the model is unknown or the list cannot be fetched.
+func lookupModelInfo(model string) (llm.ModelInfo, bool) {
+	modelCacheMu.Lock()
+	cache := modelCache
+	modelCacheMu.Unlock()
+
+	if cache == nil && llmClient != nil {
+		if models, err := llmClient.GetModels(); err == nil {
+			cacheModels(models.Data)
+			modelCacheMu.Lock()
+			cache = modelCache
+			modelCacheMu.Unlock()
+		} else {
+			log.Info("Could not fetch models for capability check: %v", err)
+		}
+	}
+
+	info, ok := cache[model]
+	return info, ok
+}
+
+// checkImageSupport returns an error if the chat has images in context and the
+// model is known not to accept image input. Unknown models are allowed through
+// so custom or newly released models are not blocked by a stale list.
+func checkImageSupport(st *state.State, model string) error {
+	if !st.HasImages() {
+		return nil
+	}
+	info, ok := lookupModelInfo(model)
+	if ok && !info.SupportsImageInput() {
+		return fmt.Errorf("model %s does not support image input: remove images from context or choose a vision-capable model", model)
+	}
+	return nil
+}
+
+// collectImageParts returns content parts for the images in context, each
+// preceded by an @image marker so the model can relate it to its path.
+func collectImageParts(st *state.State) ([]llm.ContentPart, error) {
+	chat := st.ActiveChat
+	var parts []llm.ContentPart
+	for i := range chat.ContextFiles {
+		cf := &chat.ContextFiles[i]
+		if !cf.IsImage() {
+			continue
+		}
+		if denied, err := readDenied(st, cf.Path); err != nil || denied {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, mediaType, err := st.GetContextImage(cf.Path)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts,
+			llm.TextPart(fmt.Sprintf("@image id=%s path=%s", cf.Version, cf.Path)),
+			llm.ImagePart(mediaType, data),
+		)
+	}
+	return parts, nil
+}
+
+// userAPIMessage builds the single user message sent to the LLM. Images are
+// attached after the text body as multimodal content parts.
+func userAPIMessage(body string, images []llm.ContentPart) llm.APIMessage {
+	msg := llm.APIMessage{Role: "user", Content: body}
+	if len(images) > 0 {
+		msg.Parts = append([]llm.ContentPart{llm.TextPart(body)}, images...)
+	}
+	return msg
+}
+
 func handleEstimateTokens(reqID string, req map[string]any) {
 	if appState.ActiveChat == nil {
 		respond(reqID, errorResponse(state.ErrNoActiveChat))
@@ -1676,10 +2498,28 @@ func handleEstimateTextTokens(reqID string, req map[string]any) {
 	})
 }
 
+// checkDiffMode rejects a diff_mode in a send request that config.json would
+// not accept either.
+func checkDiffMode(req map[string]any) error {
+	if mode, _ := req["diff_mode"].(string); mode != "" && !config.ValidDiffMode(mode) {
+		return config.ErrInvalidDiffMode
+	}
+	return nil
+}
+
 func handleSend(reqID string, req map[string]any) {
-	defer clearActiveStream(reqID)
+	queueID, _ := req["queue_id"].(string)
+	defer finishSend(reqID, queueID)
 
-	if wasStreamCanceled(reqID) {
+	// The stream works on its own view of the chat, which stays valid if the
+	// user switches to another chat meanwhile.
+	st := streams.view(reqID)
+	if st == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+
+	if streams.wasCanceled(reqID) {
 		respond(reqID, map[string]any{"type": "error", "message": "Response aborted by user."})
 		return
 	}
@@ -1702,12 +2542,8 @@ func handleSend(reqID string, req map[string]any) {
 		return
 	}
 
-	// Get reasoning config (optional)
-	var reasoningConfig *llm.ReasoningConfig
-	if reasoningEffort, ok := req["reasoning_effort"].(string); ok && reasoningEffort != "" {
-		reasoningConfig = &llm.ReasoningConfig{Effort: reasoningEffort}
-		log.Info("Reasoning enabled with effort: %s", reasoningEffort)
-	}
+	reasoningEffort, _ := req["reasoning_effort"].(string)
+	review, _ := req["review"].(bool)
 
 	// Get model (from request or fall back to chat's model, then config default)
 	model, _ := req["model"].(string)
@@ -1715,56 +2551,128 @@ func handleSend(reqID string, req map[string]any) {
 	if appConfig.DiffMode != nil && *appConfig.DiffMode != "" {
 		diffMode = *appConfig.DiffMode
 	}
+	// Queue entries are checked again; they may predate this check.
+	if err := checkDiffMode(req); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if override, _ := req["diff_mode"].(string); override != "" {
+		diffMode = override
+	}
 	var instructionsBlock string
 	var body string
 	var err error
 	var activeChatID string
 	var requestCacheKey string
 	stateMu.Lock()
-	if appState.ActiveChat == nil {
+	if st.ActiveChat == nil {
 		stateMu.Unlock()
 		respond(reqID, errorResponse(state.ErrNoActiveChat))
 		return
 	}
 	// Global chats use no tools
-	isGlobalChat := appState.ActiveChat.Global
+	isGlobalChat := st.ActiveChat.Global
 	if isGlobalChat {
+		if review {
+			stateMu.Unlock()
+			respond(reqID, map[string]any{"type": "error", "message": "Review mode is not available for global chats"})
+			return
+		}
 		diffMode = "none"
 	}
 	if model == "" {
-		model = appState.ActiveChat.Model
+		model = st.ActiveChat.Model
 	}
 	if model == "" {
 		model = appConfig.DefaultModel
 	}
 	// Persist the resolved model on the chat so chat_get reflects it.
-	if model != "" && model != appState.ActiveChat.Model {
-		appState.ActiveChat.Model = model
+	if model != "" && model != st.ActiveChat.Model {
+		st.ActiveChat.Model = model
 	}
 
 	// Build instructions block (fail fast if invalid)
-	instructionsBlock, err = appState.BuildInstructionsBlock()
+	var instructionBlocks []state.InstructionBlock
+	instructionsBlock, instructionBlocks, err = st.BuildScopedInstructionsBlock(state.InstructionScope{Model: model, DiffMode: diffMode})
 	if err != nil {
 		stateMu.Unlock()
 		respond(reqID, errorResponse(err))
 		return
 	}
+	personaName, persona := chatPersona(st.ActiveChat)
+	instructionsBlock = personaPromptBlock(personaName, persona) + instructionsBlock
+	lastInstructionReport = &instructionReport{
+		ChatID:   st.ActiveChat.ID,
+		Model:    model,
+		DiffMode: diffMode,
+		Blocks:   instructionBlocks,
+	}
 
-	// Add user message
-	if err := appState.AddUserMessage(content, model); err != nil {
+	// Reject images for non-vision models before anything is recorded.
+	if err := checkImageSupport(st, model); err != nil {
+		stateMu.Unlock()
+		respond(reqID, errorResponse(err))
+		return
+	}
+	// Likewise for generation parameters the model doesn't accept.
+	reasoningConfig, generation, err := resolveGeneration(st.ActiveChat, model, reasoningEffort, req)
+	if err != nil {
 		stateMu.Unlock()
 		respond(reqID, errorResponse(err))
 		return
 	}
+	if reasoningConfig != nil {
+		log.Info("Reasoning enabled (effort: %q, max_tokens: %d, exclude: %v)", reasoningConfig.Effort, reasoningConfig.MaxTokens, reasoningConfig.Exclude)
+	}
+
+	// Add user message. A resumed send whose message was recorded before the
+	// backend exited answers that message instead of adding it again.
+	if resume, _ := req["resume"].(bool); !resume || !endsWithUserMessage(st.ActiveChat, content) {
+		if err := st.AddUserMessage(content, model); err != nil {
+			stateMu.Unlock()
+			respond(reqID, errorResponse(err))
+			return
+		}
+	}
+	if queueID != "" {
+		if _, err := st.QueueUpdate(queueID, func(q *state.QueuedSend) { q.Recorded = true }); err != nil {
+			log.Error("Failed to update queued send: %v", err)
+		}
+	}
 
 	// Build a single structured user message containing context, history, and latest input.
-	body, err = buildLLMUserMessage(retryContext, diffMode)
+	secrets, err := newSecretScanner(st)
 	if err != nil {
 		stateMu.Unlock()
 		respond(reqID, errorResponse(err))
 		return
 	}
-	activeChatID = appState.ActiveChat.ID
+	body, err = buildLLMUserMessageWithOverrides(st, retryContext, diffMode, nil, secrets)
+	if errors.Is(err, errSecretsBlocked) {
+		respond(reqID, secrets.report())
+		msg := secrets.blockedMessage()
+		if addErr := st.AddSystemMessage(msg); addErr != nil {
+			log.Error("Failed to record system message: %v", addErr)
+		}
+		stateMu.Unlock()
+		respond(reqID, map[string]any{"type": "error", "message": msg})
+		return
+	}
+	if err != nil {
+		stateMu.Unlock()
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if resp := secrets.report(); resp != nil {
+		respond(reqID, resp)
+	}
+	imageParts, err := collectImageParts(st)
+	if err != nil {
+		stateMu.Unlock()
+		respond(reqID, errorResponse(err))
+		return
+	}
+	activeChatID = st.ActiveChat.ID
 	if appConfig.ExplicitCacheKey != nil && *appConfig.ExplicitCacheKey {
 		requestCacheKey = "bb7:" + activeChatID + ":" + model
 	}
@@ -1779,51 +2687,24 @@ func handleSend(reqID string, req map[string]any) {
 	var writeCalls []llm.WriteFileArgs
 	var toolCallLogs []toolCallLog
 	var diffErrors []string                  // diff failures (LLM errors, not system errors)
+	var findings []state.Finding             // review findings (review mode)
 	pendingWrites := make(map[string]string) // buffered file writes (committed on success)
 	seenOutputPaths := make(map[string]bool)
 	duplicatePathDetected := false
 
-	// Build full system prompt with user/project instructions
-	// Check for system prompt override (development feature)
-	effectiveSystemPrompt := systemPrompt
-	if homeDir, err := os.UserHomeDir(); err == nil {
-		overridePath := filepath.Join(homeDir, ".config", "bb7", "system_prompt.txt")
-		if content, err := os.ReadFile(overridePath); err == nil {
-			stripped := state.StripComments(string(content))
-			if strings.TrimSpace(stripped) != "" {
-				effectiveSystemPrompt = stripped
-				log.Info("Using system prompt override from %s", overridePath)
-			}
-		}
-	}
-	fullSystemPrompt := effectiveSystemPrompt
-	if instructionsBlock != "" {
-		fullSystemPrompt = effectiveSystemPrompt + "\n" + instructionsBlock
-	}
-
-	// Global chats get no tool prompts
-	if !isGlobalChat {
-		switch diffMode {
-		case "search_replace":
-			fullSystemPrompt += "\n" + editFileSRPrompt
-		case "search_replace_multi":
-			fullSystemPrompt += "\n" + editFileSRMultiPrompt
-		case "anchored":
-			fullSystemPrompt += "\n" + editFileAnchorPrompt
-		default:
-			fullSystemPrompt += "\n" + writeFilePrompt
-		}
+	fullSystemPrompt := buildSystemPrompt(instructionsBlock, diffMode, isGlobalChat)
+	tools := llm.DefaultTools(diffMode)
+	if review {
+		fullSystemPrompt += "\n" + reviewPrompt
+		tools = llm.ReviewTools(diffMode)
 	}
 
 	logLLMMessage("SYSTEM", fullSystemPrompt, activeChatID, model)
 	logLLMMessage("USER", body, activeChatID, model)
-	messages := []llm.APIMessage{{
-		Role:    "user",
-		Content: body,
-	}}
+	messages := []llm.APIMessage{userAPIMessage(body, imageParts)}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	if !setActiveStreamCancel(reqID, cancel) {
+	if !streams.setCancel(reqID, cancel) {
 		cancel()
 		respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
 		return
@@ -1833,15 +2714,21 @@ func handleSend(reqID string, req map[string]any) {
 	}()
 
 	var streamErr string
+	var finishReason string
+	var truncatedCall *llm.ToolCall // tool call cut off by the output limit
 
-	// Stream response
-	log.Info("Starting LLM stream for model: %s (diff_mode: %s)", model, diffMode)
-	streamStart := time.Now()
-	err = llmClient.ChatStream(ctx, model, fullSystemPrompt, messages, reasoningConfig, diffMode, requestCacheKey, func(event llm.StreamEvent) {
+	emit := func(resp map[string]any) { respond(reqID, resp) }
+	onEvent := func(event llm.StreamEvent) {
 		switch event.Type {
 		case "content":
-			// Regular text content - stream to UI and accumulate
 			log.Stream("content", event.Content)
+			if truncatedCall != nil {
+				// A continuation of a cut-off tool call carries the rest
+				// of its arguments.
+				truncatedCall.Function.Arguments += event.Content
+				break
+			}
+			// Regular text content - stream to UI and accumulate
 			textContent.WriteString(event.Content)
 			respond(reqID, map[string]any{"type": "chunk", "content": event.Content})
 
@@ -1852,8 +2739,13 @@ func handleSend(reqID string, req map[string]any) {
 			respond(reqID, map[string]any{"type": "thinking", "content": event.Reasoning})
 
 		case "tool_call":
+			secrets.restoreToolCall(event.ToolCall)
+			if collectFindings(st, emit, event.ToolCall, &findings) {
+				break
+			}
 			handleToolCallEvent(
-				reqID,
+				st,
+				emit,
 				diffMode,
 				event.ToolCall,
 				pendingWrites,
@@ -1865,20 +2757,55 @@ func handleSend(reqID string, req map[string]any) {
 				&streamErr,
 				&duplicatePathDetected,
 				cancel,
-				true,
 			)
 
+		case llm.FinishReasonLength:
+			if event.ToolCall != nil {
+				truncatedCall = event.ToolCall
+			}
+
+		case llm.FinishReasonContentFilter:
+			respond(reqID, map[string]any{"type": "chunk", "content": "\n[Response stopped by the content filter]\n"})
+
 		case "done":
 			log.Stream("done", "")
-			if event.Usage != nil {
-				lastUsage = event.Usage
-			}
+			lastUsage = mergeUsage(lastUsage, event.Usage)
+			finishReason = event.FinishReason
 
 		case "error":
 			log.Error("Stream error: %s", event.Error)
 			setTerminalStreamError(&streamErr, event.Error, cancel)
 		}
-	})
+	}
+
+	// Stream response
+	log.Info("Starting LLM stream for model: %s (diff_mode: %s)", model, diffMode)
+	streamStart := time.Now()
+	err = llmClient.ChatStream(ctx, model, fullSystemPrompt, messages, reasoningConfig, generation, tools, requestCacheKey, onEvent)
+
+	// Continue a response cut off by the output limit and stitch the parts.
+	for n := 0; err == nil && streamErr == "" && finishReason == llm.FinishReasonLength && n < maxContinuations(); n++ {
+		if truncatedCall == nil && textContent.Len() == 0 {
+			break // only reasoning was cut off; there is nothing to continue
+		}
+		log.Info("Output limit reached; continuing response (%d/%d)", n+1, maxContinuations())
+		respond(reqID, map[string]any{"type": "chunk", "content": "\n[Output limit reached, continuing...]\n"})
+		continueTools := tools
+		if truncatedCall != nil {
+			continueTools = nil // the reply is the rest of the call's arguments
+		}
+		finishReason = ""
+		err = llmClient.ChatStream(ctx, model, fullSystemPrompt, continuationMessages(messages, textContent.String(), toolCallLogs, truncatedCall), reasoningConfig, generation, continueTools, requestCacheKey, onEvent)
+	}
+	if err == nil && streamErr == "" && truncatedCall != nil {
+		if finishReason == llm.FinishReasonLength {
+			diffErrors = append(diffErrors, truncatedToolCallError(truncatedCall))
+		} else {
+			call := truncatedCall
+			truncatedCall = nil
+			onEvent(llm.StreamEvent{Type: "tool_call", ToolCall: call})
+		}
+	}
 
 	if err == nil && streamErr != "" {
 		err = errors.New(streamErr)
@@ -1897,15 +2824,15 @@ func handleSend(reqID string, req map[string]any) {
 		retryPendingWrites := cloneStringMap(pendingWrites)
 		var retryBody string
 		stateMu.Lock()
-		retryBody, err = buildLLMUserMessageWithOverrides(retryContextData, diffMode, retryPendingWrites)
+		retryBody, err = buildLLMUserMessageWithOverrides(st, retryContextData, diffMode, retryPendingWrites, secrets)
 		stateMu.Unlock()
+		if resp := secrets.report(); resp != nil {
+			respond(reqID, resp)
+		}
 		if err == nil {
 			logLLMMessage("SYSTEM", fullSystemPrompt, activeChatID, model)
 			logLLMMessage("USER", retryBody, activeChatID, model)
-			retryMessages := []llm.APIMessage{{
-				Role:    "user",
-				Content: retryBody,
-			}}
+			retryMessages := []llm.APIMessage{userAPIMessage(retryBody, imageParts)}
 
 			var retryTextContent strings.Builder
 			var retryThinkingContent strings.Builder
@@ -1918,7 +2845,7 @@ func handleSend(reqID string, req map[string]any) {
 			var retryStreamErr string
 			var retryUsage *llm.Usage
 
-			retryErr := llmClient.ChatStream(ctx, model, fullSystemPrompt, retryMessages, nil, diffMode, requestCacheKey, func(event llm.StreamEvent) {
+			retryErr := llmClient.ChatStream(ctx, model, fullSystemPrompt, retryMessages, nil, generation, tools, requestCacheKey, func(event llm.StreamEvent) {
 				switch event.Type {
 				case "content":
 					log.Stream("content", event.Content)
@@ -1927,8 +2854,13 @@ func handleSend(reqID string, req map[string]any) {
 					log.Stream("reasoning", event.Reasoning)
 					retryThinkingContent.WriteString(event.Reasoning)
 				case "tool_call":
+					secrets.restoreToolCall(event.ToolCall)
+					if collectFindings(st, nil, event.ToolCall, &findings) {
+						break
+					}
 					handleToolCallEvent(
-						reqID,
+						st,
+						nil,
 						diffMode,
 						event.ToolCall,
 						retryPendingWrites,
@@ -1940,7 +2872,6 @@ func handleSend(reqID string, req map[string]any) {
 						&retryStreamErr,
 						&retryDuplicatePathDetected,
 						cancel,
-						false,
 					)
 				case "done":
 					log.Stream("done", "")
@@ -1978,6 +2909,10 @@ func handleSend(reqID string, req map[string]any) {
 				diffErrors = nil
 				log.Info("Hidden repair retry succeeded (%d file(s) updated)", len(outputFiles))
 			}
+		} else if errors.Is(err, errSecretsBlocked) {
+			log.Warn("Hidden retry not sent: its request contains possible secrets")
+			diffErrors = append(diffErrors, fmt.Sprintf("hidden retry not sent: %d possible secret(s) in its request", len(secrets.findings)))
+			err = nil
 		} else {
 			log.Error("Failed to build hidden retry context: %v", err)
 			diffErrors = append(diffErrors, "hidden retry setup failed: "+err.Error())
@@ -1985,6 +2920,12 @@ func handleSend(reqID string, req map[string]any) {
 		}
 	}
 
+	if err == nil {
+		stateMu.Lock()
+		diffErrors = append(diffErrors, deniedWriteErrors(st, pendingWrites)...)
+		stateMu.Unlock()
+	}
+
 	// Always log the assistant response (even on error/cancel) so the debug
 	// log contains what the LLM actually sent.
 	logLLMMessage("ASSISTANT", buildAssistantLogContent(
@@ -2002,10 +2943,10 @@ func handleSend(reqID string, req map[string]any) {
 		}
 		if errors.Is(err, context.DeadlineExceeded) {
 			msg = "Request timed out."
-		} else if errors.Is(err, context.Canceled) && wasStreamCanceled(reqID) {
+		} else if errors.Is(err, context.Canceled) && streams.wasCanceled(reqID) {
 			// Save any partial assistant response so the user and LLM can
 			// refer to the incomplete answer in follow-up messages.
-			if textContent.Len() > 0 || thinkingContent.Len() > 0 || len(writeCalls) > 0 {
+			if textContent.Len() > 0 || thinkingContent.Len() > 0 || len(writeCalls) > 0 || len(findings) > 0 {
 				var cancelParts []state.MessagePart
 				if thinkingContent.Len() > 0 {
 					cancelParts = append(cancelParts, state.MessagePart{
@@ -2021,34 +2962,29 @@ func handleSend(reqID string, req map[string]any) {
 				}
 				cancelOutputFiles := outputFiles
 				stateMu.Lock()
+				cancelParts = appendFindingParts(st, cancelParts, findings)
 				// Only commit writes and add file events when no diff errors occurred
 				if len(diffErrors) == 0 {
-					for path, content := range pendingWrites {
-						if writeErr := appState.WriteOutputFile(path, content); writeErr != nil {
-							log.Error("Failed to commit file %s on cancel: %v", path, writeErr)
-						}
+					if writeErr := st.CommitOutputFiles(pendingWrites); writeErr != nil {
+						log.Error("Failed to commit files on cancel: %v", writeErr)
 					}
-					cancelParts = appendAssistantWriteParts(cancelParts, outputFiles, pendingWrites)
+					cancelParts = appendAssistantWriteParts(st, cancelParts, outputFiles, pendingWrites)
 				} else {
 					cancelOutputFiles = nil
 				}
 				stateMu.Unlock()
 				stateMu.Lock()
-				if addErr := appState.AddAssistantMessage(cancelParts, cancelOutputFiles, model, nil); addErr != nil {
+				if addErr := st.AddAssistantMessage(cancelParts, cancelOutputFiles, model, nil); addErr != nil {
 					log.Error("Failed to save partial assistant message: %v", addErr)
-				} else if reasoningConfig != nil {
-					msgs := appState.ActiveChat.Messages
-					msgs[len(msgs)-1].ReasoningEffort = reasoningConfig.Effort
-					if saveErr := appState.SaveActiveChat(); saveErr != nil {
-						log.Error("Failed to save reasoning effort on partial message: %v", saveErr)
-					}
+				} else if saveErr := annotateAssistantMessage(st, reasoningConfig, personaName, finishReason); saveErr != nil {
+					log.Error("Failed to save reasoning effort on partial message: %v", saveErr)
 				}
 				stateMu.Unlock()
 			}
 			msg = "Response aborted by user."
 		}
 		stateMu.Lock()
-		if addErr := appState.AddSystemMessage(msg); addErr != nil {
+		if addErr := st.AddSystemMessage(msg); addErr != nil {
 			log.Error("Failed to record system message: %v", addErr)
 		}
 		stateMu.Unlock()
@@ -2091,14 +3027,11 @@ func handleSend(reqID string, req map[string]any) {
 
 		// Save assistant message without file events and with nil output files
 		stateMu.Lock()
-		if addErr := appState.AddAssistantMessage(diffErrParts, nil, model, msgUsage); addErr != nil {
+		diffErrParts = appendFindingParts(st, diffErrParts, findings)
+		if addErr := st.AddAssistantMessage(diffErrParts, nil, model, msgUsage); addErr != nil {
 			log.Error("Failed to save assistant message on diff error: %v", addErr)
-		} else if reasoningConfig != nil {
-			msgs := appState.ActiveChat.Messages
-			msgs[len(msgs)-1].ReasoningEffort = reasoningConfig.Effort
-			if saveErr := appState.SaveActiveChat(); saveErr != nil {
-				log.Error("Failed to save reasoning effort on diff error: %v", saveErr)
-			}
+		} else if saveErr := annotateAssistantMessage(st, reasoningConfig, personaName, finishReason); saveErr != nil {
+			log.Error("Failed to save reasoning effort on diff error: %v", saveErr)
 		}
 		stateMu.Unlock()
 
@@ -2129,10 +3062,8 @@ func handleSend(reqID string, req map[string]any) {
 
 	// Success path: commit all pending writes
 	stateMu.Lock()
-	for path, content := range pendingWrites {
-		if writeErr := appState.WriteOutputFile(path, content); writeErr != nil {
-			log.Error("Failed to commit file %s: %v", path, writeErr)
-		}
+	if writeErr := st.CommitOutputFiles(pendingWrites); writeErr != nil {
+		log.Error("Failed to commit files: %v", writeErr)
 	}
 	stateMu.Unlock()
 
@@ -2150,9 +3081,10 @@ func handleSend(reqID string, req map[string]any) {
 		}}, parts...)
 	}
 
-	// Add file write events as context_event parts (at the end, after thinking/text)
+	// Add findings, then file write events as context_event parts (at the end, after thinking/text)
 	stateMu.Lock()
-	parts = appendAssistantWriteParts(parts, outputFiles, pendingWrites)
+	parts = appendFindingParts(st, parts, findings)
+	parts = appendAssistantWriteParts(st, parts, outputFiles, pendingWrites)
 	stateMu.Unlock()
 
 	// Convert usage for storage
@@ -2170,28 +3102,24 @@ func handleSend(reqID string, req map[string]any) {
 
 	// Save assistant message with parts and usage
 	stateMu.Lock()
-	if err := appState.AddAssistantMessage(parts, outputFiles, model, msgUsage); err != nil {
+	if err := st.AddAssistantMessage(parts, outputFiles, model, msgUsage); err != nil {
 		stateMu.Unlock()
 		respond(reqID, errorResponse(err))
 		return
 	}
-	// Set reasoning effort on the saved message
-	if reasoningConfig != nil {
-		msgs := appState.ActiveChat.Messages
-		msgs[len(msgs)-1].ReasoningEffort = reasoningConfig.Effort
-		if saveErr := appState.SaveActiveChat(); saveErr != nil {
-			log.Error("Failed to save reasoning effort: %v", saveErr)
-		}
+	// Set reasoning effort and persona on the saved message
+	if saveErr := annotateAssistantMessage(st, reasoningConfig, personaName, finishReason); saveErr != nil {
+		log.Error("Failed to save reasoning effort: %v", saveErr)
 	}
 	stateMu.Unlock()
 
 	// Auto-generate title after first message exchange (only if title_model is configured)
 	if appConfig.TitleModel != "" {
 		stateMu.Lock()
-		if appState.ActiveChat != nil {
+		if st.ActiveChat != nil {
 			userMsgCount := 0
 			firstUserContent := ""
-			for _, msg := range appState.ActiveChat.Messages {
+			for _, msg := range st.ActiveChat.Messages {
 				if msg.Role == "user" {
 					userMsgCount++
 					if userMsgCount == 1 {
@@ -2200,7 +3128,10 @@ func handleSend(reqID string, req map[string]any) {
 				}
 			}
 			if userMsgCount == 1 && firstUserContent != "" {
-				autoTitleGenerateAsync(appState.ActiveChat.ID, firstUserContent, appState.ActiveChat.ContextFiles)
+				autoTitleGenerateAsync(st.ActiveChat.ID, firstUserContent, st.ActiveChat.ContextFiles)
+				if appConfig.SuggestTags != nil && *appConfig.SuggestTags {
+					autoTagAsync(st, st.ActiveChat.ID, st.ActiveChat.Global, firstUserContent)
+				}
 			}
 		}
 		stateMu.Unlock()
@@ -2221,9 +3152,48 @@ func handleSend(reqID string, req map[string]any) {
 		}
 	}
 	doneResp["duration"] = streamDuration
+	if finishReason != "" {
+		doneResp["finish_reason"] = finishReason
+	}
 	respond(reqID, doneResp)
 }
 
+// buildSystemPrompt assembles the system prompt: the built-in prompt (or the
+// user's override), the instructions block, and the tool prompt for diffMode.
+func buildSystemPrompt(instructionsBlock, diffMode string, isGlobalChat bool) string {
+	// Check for system prompt override (development feature)
+	effectiveSystemPrompt := systemPrompt
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		overridePath := filepath.Join(homeDir, ".config", "bb7", "system_prompt.txt")
+		if content, err := os.ReadFile(overridePath); err == nil {
+			stripped := state.StripComments(string(content))
+			if strings.TrimSpace(stripped) != "" {
+				effectiveSystemPrompt = stripped
+				log.Info("Using system prompt override from %s", overridePath)
+			}
+		}
+	}
+	fullSystemPrompt := effectiveSystemPrompt
+	if instructionsBlock != "" {
+		fullSystemPrompt = effectiveSystemPrompt + "\n" + instructionsBlock
+	}
+
+	// Global chats get no tool prompts
+	if !isGlobalChat {
+		switch diffMode {
+		case "search_replace":
+			fullSystemPrompt += "\n" + editFileSRPrompt
+		case "search_replace_multi":
+			fullSystemPrompt += "\n" + editFileSRMultiPrompt
+		case "anchored":
+			fullSystemPrompt += "\n" + editFileAnchorPrompt
+		default:
+			fullSystemPrompt += "\n" + writeFilePrompt
+		}
+	}
+	return fullSystemPrompt
+}
+
 // appendUsageCSV appends a usage entry to the global usage CSV log (~/.bb7/usage.csv).
 // This runs in the backend so cost tracking is independent of which UI mode sent the message.
 func appendUsageCSV(model string, usage *llm.Usage) {
@@ -2292,7 +3262,7 @@ func autoTitleGenerateAsync(chatID, content string, contextFiles []state.Context
 		}
 
 		stateMu.Lock()
-		if err := appState.SetChatName(chatID, title); err != nil {
+		if err := streams.chatState(chatID).SetChatName(chatID, title); err != nil {
 			stateMu.Unlock()
 			log.Error("Failed to set chat name: %v", err)
 			return
@@ -2433,7 +3403,7 @@ func writeHistoryMessage(b *strings.Builder, id int, role, kind, content string)
 	writeRawBlock(b, header, content, footer)
 }
 
-func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]fileBlock, []fileBlock, bool, error) {
+func collectFileBlocks(st *state.State, chat *state.Chat, outputOverrides map[string]string) ([]fileBlock, []fileBlock, bool, error) {
 	var readonly []fileBlock
 	var writable []fileBlock
 	versionChanged := false
@@ -2443,7 +3413,18 @@ func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]f
 		cf := &chat.ContextFiles[i]
 		contextPaths[cf.Path] = true
 
-		contextContent, err := appState.GetContextFile(cf.Path)
+		// Images are attached as content parts, not file blocks.
+		if cf.IsImage() {
+			continue
+		}
+		if denied, err := readDenied(st, cf.Path); err != nil || denied {
+			if err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+
+		contextContent, err := st.GetContextFile(cf.Path)
 		if err != nil {
 			return nil, nil, false, err
 		}
@@ -2475,7 +3456,7 @@ func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]f
 					outputContent = out
 					hasOutput = true
 				}
-			} else if out, err := appState.GetOutputFile(cf.Path); err == nil && out != "" {
+			} else if out, err := st.GetOutputFile(cf.Path); err == nil && out != "" {
 				outputContent = out
 				hasOutput = true
 			}
@@ -2483,11 +3464,15 @@ func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]f
 
 		switch {
 		case cf.ReadOnly || cf.External:
+			source := "context"
+			if state.IsURLPath(cf.Path) {
+				source = "web"
+			}
 			readonly = append(readonly, fileBlock{
 				ID:      contextVersion,
 				Path:    cf.Path,
 				Mode:    "ro",
-				Source:  "context",
+				Source:  source,
 				Content: contextContent,
 			})
 		case hasOutput:
@@ -2518,7 +3503,7 @@ func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]f
 		}
 	}
 
-	outputFiles, err := appState.ListOutputFiles()
+	outputFiles, err := st.ListOutputFiles()
 	if err != nil {
 		return nil, nil, false, err
 	}
@@ -2542,7 +3527,7 @@ func collectFileBlocks(chat *state.Chat, outputOverrides map[string]string) ([]f
 		content := ""
 		if out, ok := outputOverrides[path]; ok {
 			content = out
-		} else if out, getErr := appState.GetOutputFile(path); getErr == nil {
+		} else if out, getErr := st.GetOutputFile(path); getErr == nil {
 			content = out
 		}
 		if content == "" {
@@ -2691,21 +3676,21 @@ func formatRetryContext(rc *retryContextData, diffMode string) string {
 // writable files. This avoids hidden assistant messages and keeps ordering stable.
 // If retryContext is non-nil, a @retry_context block is appended after @latest.
 func buildLLMUserMessage(retryContext *retryContextData, diffMode string) (string, error) {
-	return buildLLMUserMessageWithOverrides(retryContext, diffMode, nil)
+	return buildLLMUserMessageWithOverrides(appState, retryContext, diffMode, nil, nil)
 }
 
-func buildLLMUserMessageWithOverrides(retryContext *retryContextData, diffMode string, outputOverrides map[string]string) (string, error) {
-	chat := appState.ActiveChat
+func buildLLMUserMessageWithOverrides(st *state.State, retryContext *retryContextData, diffMode string, outputOverrides map[string]string, secrets *secretScanner) (string, error) {
+	chat := st.ActiveChat
 	if chat == nil {
 		return "", state.ErrNoActiveChat
 	}
 
-	readonly, writable, versionChanged, err := collectFileBlocks(chat, outputOverrides)
+	readonly, writable, versionChanged, err := collectFileBlocks(st, chat, outputOverrides)
 	if err != nil {
 		return "", err
 	}
 	if versionChanged {
-		if err := appState.SaveActiveChat(); err != nil {
+		if err := st.SaveActiveChat(); err != nil {
 			return "", err
 		}
 	}
@@ -2744,6 +3729,15 @@ func buildLLMUserMessageWithOverrides(retryContext *retryContextData, diffMode s
 			case state.PartTypeCode, state.PartTypeRaw:
 				writeHistoryMessage(&historyBuf, entryID, msg.Role, string(part.Type), part.Content)
 				entryID++
+			case state.PartTypeFinding:
+				if part.Finding != nil {
+					content := state.FormatFinding(*part.Finding)
+					if part.Finding.FileID != "" {
+						content = "file_id=" + part.Finding.FileID + " " + content
+					}
+					writeHistoryMessage(&historyBuf, entryID, msg.Role, string(part.Type), content)
+					entryID++
+				}
 			}
 		}
 	}
@@ -2777,7 +3771,7 @@ func buildLLMUserMessageWithOverrides(retryContext *retryContextData, diffMode s
 		writeFileBlocks(&b, writable)
 	}
 
-	return strings.TrimRight(b.String(), "\n"), nil
+	return secrets.scan(strings.TrimRight(b.String(), "\n"))
 }
 
 func errorResponse(err error) map[string]any {
@@ -2808,7 +3802,11 @@ func errorResponse(err error) map[string]any {
 	default:
 		msg = err.Error()
 	}
-	return map[string]any{"type": "error", "message": msg}
+	resp := map[string]any{"type": "error", "message": msg}
+	if errors.Is(err, state.ErrPathDenied) {
+		resp["code"] = "path_denied"
+	}
+	return resp
 }
 
 func respond(reqID string, data map[string]any) {
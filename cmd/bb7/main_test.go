@@ -9,10 +9,11 @@ import (
 	"testing"
 
 	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
 )
 
 func resetActiveStreamForTest() {
-	activeStream = streamState{}
+	streams = newStreamRegistry()
 }
 
 func TestRequestID(t *testing.T) {
@@ -51,23 +52,32 @@ func TestAddResponseID(t *testing.T) {
 	}
 }
 
-func TestReserveActiveStream(t *testing.T) {
+func TestReserveChatStream(t *testing.T) {
 	resetActiveStreamForTest()
 	t.Cleanup(resetActiveStreamForTest)
 
-	if !reserveActiveStream("req-1") {
+	if !streams.reserve("req-1", "chat-a", nil) {
 		t.Fatalf("expected first reservation to succeed")
 	}
-	if reserveActiveStream("req-2") {
-		t.Fatalf("expected second reservation to fail while active")
+	if streams.reserve("req-2", "chat-a", nil) {
+		t.Fatalf("expected second reservation in the same chat to fail")
 	}
-	if !hasActiveStream() {
-		t.Fatalf("expected active stream after reservation")
+	if streams.reserve("req-1", "chat-b", nil) {
+		t.Fatalf("expected reused request ID to be rejected")
+	}
+	if !streams.reserve("req-2", "chat-b", nil) {
+		t.Fatalf("expected reservation in another chat to succeed")
+	}
+	if !streams.active("chat-a") || !streams.active("chat-b") {
+		t.Fatalf("expected both chats to be streaming")
 	}
 
-	clearActiveStream("req-1")
-	if hasActiveStream() {
-		t.Fatalf("expected no active stream after clear")
+	streams.clear("req-1")
+	if streams.active("chat-a") {
+		t.Fatalf("expected no stream in chat-a after clear")
+	}
+	if !streams.active("chat-b") {
+		t.Fatalf("expected chat-b to keep streaming")
 	}
 }
 
@@ -75,32 +85,35 @@ func TestCancelReservedStreamWithoutCancelFunc(t *testing.T) {
 	resetActiveStreamForTest()
 	t.Cleanup(resetActiveStreamForTest)
 
-	if !reserveActiveStream("req-1") {
+	if !streams.reserve("req-1", "chat-a", nil) {
 		t.Fatalf("failed to reserve stream")
 	}
-	if !cancelActiveStream("req-1") {
+	if !streams.cancel("req-1") {
 		t.Fatalf("expected cancel to succeed for reserved stream")
 	}
-	if !wasStreamCanceled("req-1") {
+	if !streams.wasCanceled("req-1") {
 		t.Fatalf("expected canceled flag to be set")
 	}
+	if streams.cancel("") {
+		t.Fatalf("expected empty request ID to match nothing")
+	}
 }
 
-func TestSetActiveStreamCancelAndCancel(t *testing.T) {
+func TestSetStreamCancelAndCancel(t *testing.T) {
 	resetActiveStreamForTest()
 	t.Cleanup(resetActiveStreamForTest)
 
-	if !reserveActiveStream("req-1") {
+	if !streams.reserve("req-1", "chat-a", nil) {
 		t.Fatalf("failed to reserve stream")
 	}
 
 	called := false
-	if !setActiveStreamCancel("req-1", func() {
+	if !streams.setCancel("req-1", func() {
 		called = true
 	}) {
 		t.Fatalf("expected cancel func to be set")
 	}
-	if !cancelActiveStream("req-1") {
+	if !streams.cancel("req-1") {
 		t.Fatalf("expected cancel to succeed")
 	}
 	if !called {
@@ -108,15 +121,32 @@ func TestSetActiveStreamCancelAndCancel(t *testing.T) {
 	}
 }
 
-func TestSetActiveStreamCancelRejectsMismatchedRequest(t *testing.T) {
+func TestCancelChatTargetsOnlyThatChat(t *testing.T) {
 	resetActiveStreamForTest()
 	t.Cleanup(resetActiveStreamForTest)
 
-	if !reserveActiveStream("req-1") {
+	streams.reserve("req-1", "chat-a", nil)
+	streams.reserve("req-2", "chat-b", nil)
+	if !streams.cancelChat("chat-b") {
+		t.Fatalf("expected cancel by chat ID to succeed")
+	}
+	if streams.wasCanceled("req-1") || !streams.wasCanceled("req-2") {
+		t.Fatalf("expected only chat-b's stream to be canceled")
+	}
+	if streams.cancelChat("chat-c") {
+		t.Fatalf("expected cancel for an idle chat to fail")
+	}
+}
+
+func TestSetStreamCancelRejectsUnknownRequest(t *testing.T) {
+	resetActiveStreamForTest()
+	t.Cleanup(resetActiveStreamForTest)
+
+	if !streams.reserve("req-1", "chat-a", nil) {
 		t.Fatalf("failed to reserve stream")
 	}
-	if setActiveStreamCancel("req-2", func() {}) {
-		t.Fatalf("expected mismatched request ID to be rejected")
+	if streams.setCancel("req-2", func() {}) {
+		t.Fatalf("expected unknown request ID to be rejected")
 	}
 }
 
@@ -130,6 +160,8 @@ func TestActionMutatesChatState(t *testing.T) {
 		"fork_chat",
 		"save_draft",
 		"context_add",
+		"context_add_url",
+		"context_add_image",
 		"context_add_section",
 		"context_update",
 		"context_set_readonly",
@@ -139,6 +171,7 @@ func TestActionMutatesChatState(t *testing.T) {
 		"apply_file",
 		"apply_file_as",
 		"generate_title",
+		"chat_import",
 	}
 
 	for _, action := range mutating {
@@ -176,6 +209,10 @@ func TestActionUsesChatState(t *testing.T) {
 		"send",
 		"generate_title",
 		"prepare_instructions",
+		"chat_export",
+		"chat_import",
+		"chat_tree",
+		"chat_compare",
 	}
 
 	for _, action := range stateActions {
@@ -402,3 +439,52 @@ func TestAppendUsageCSVSkipsNilAndZeroCost(t *testing.T) {
 	appendUsageCSV("model", nil)
 	appendUsageCSV("model", &llm.Usage{Cost: 0})
 }
+
+func TestHandleChatTreeAndCompare(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	rootID := appState.ActiveChat.ID
+	appState.AddUserMessage("Write hello", "model-a")
+	appState.AddAssistantMessage([]state.MessagePart{{Type: state.PartTypeText, Content: "hello\n"}}, nil, "model-a", nil)
+
+	fork, err := appState.ForkChat(rootID, 0)
+	if err != nil {
+		t.Fatalf("ForkChat failed: %v", err)
+	}
+	appState.AddUserMessage("Write hello", "model-b")
+	appState.AddAssistantMessage([]state.MessagePart{{Type: state.PartTypeText, Content: "hello there\n"}}, nil, "model-b", nil)
+
+	responses := captureJSONResponses(t, func() {
+		handleChatTree("req-tree", map[string]any{})
+	})
+	tree := firstResponseByType(responses, "chat_tree")
+	if tree == nil || tree["chat_id"] != fork.NewChatID {
+		t.Fatalf("unexpected tree response: %+v", responses)
+	}
+	root, _ := tree["root"].(map[string]any)
+	children, _ := root["children"].([]any)
+	if root["id"] != rootID || len(children) != 1 {
+		t.Fatalf("unexpected tree: %+v", root)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		handleChatCompare("req-compare", map[string]any{"right": rootID})
+	})
+	cmp := firstResponseByType(responses, "chat_compare")
+	if cmp == nil {
+		t.Fatalf("expected chat_compare response, got %+v", responses)
+	}
+	turns, _ := cmp["turns"].([]any)
+	if cmp["common_messages"] != float64(0) || len(turns) != 1 {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+	if d, _ := turns[0].(map[string]any)["diff"].(string); !strings.Contains(d, "-hello there\n+hello\n") {
+		t.Errorf("unexpected diff: %q", d)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		handleChatCompare("req-compare-missing", map[string]any{})
+	})
+	if firstResponseByType(responses, "error") == nil {
+		t.Error("expected error without right chat")
+	}
+}
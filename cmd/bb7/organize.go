@@ -0,0 +1,100 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+//go:embed tag_prompt.txt
+var tagPrompt string
+
+// maxSuggestedTags caps how many tags the title model may add.
+const maxSuggestedTags = 3
+
+// stringList reads a JSON array of strings from a request field. A single
+// string is accepted as a one-element list.
+func stringList(req map[string]any, key string) []string {
+	switch v := req[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// parseSuggestedTags turns the title model's reply into valid tags,
+// dropping anything that is not one.
+func parseSuggestedTags(reply string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, field := range strings.FieldsFunc(reply, func(r rune) bool { return r == ',' || r == '\n' }) {
+		tag, err := state.NormalizeTag(strings.Trim(strings.TrimSpace(field), "\"'`.-"))
+		if err != nil || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxSuggestedTags {
+			break
+		}
+	}
+	return tags
+}
+
+// autoTagAsync asks the title model for tags for a new chat, adds them,
+// and sends a tags_updated event. Tags already used in the chat's scope are
+// offered so the model reuses them. Caller must hold stateMu.
+func autoTagAsync(st *state.State, chatID string, global bool, content string) {
+	var existing []string
+	if counts, err := st.ChatTags(global); err == nil {
+		for tag := range counts {
+			existing = append(existing, tag)
+		}
+		sort.Strings(existing)
+	}
+	go func() {
+		prompt := fmt.Sprintf("User message: %s", content)
+		if len(existing) > 0 {
+			prompt += fmt.Sprintf("\n\nExisting tags: %s", strings.Join(existing, ", "))
+		}
+		reply, err := llmClient.ChatSimple(appConfig.TitleModel, tagPrompt, []llm.APIMessage{
+			{Role: "user", Content: prompt},
+		})
+		if err != nil {
+			log.Error("Failed to suggest tags: %v", err)
+			return
+		}
+		suggested := parseSuggestedTags(reply)
+		if len(suggested) == 0 {
+			log.Warn("No usable tags in suggestion %q", reply)
+			return
+		}
+
+		stateMu.Lock()
+		tags, err := streams.chatState(chatID).ChatTag(chatID, global, suggested)
+		stateMu.Unlock()
+		if err != nil {
+			log.Error("Failed to tag chat: %v", err)
+			return
+		}
+		log.Info("Suggested tags for chat %s: %s", chatID, strings.Join(suggested, ", "))
+
+		respond("", map[string]any{
+			"type":    "tags_updated",
+			"chat_id": chatID,
+			"tags":    tags,
+		})
+	}()
+}
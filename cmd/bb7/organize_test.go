@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChatTagActionsAndListing(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	tagged := appState.ActiveChat.ID
+	if _, err := appState.ChatNew("other", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_tag", "request_id": "req-1", "id": tagged, "tags": []any{"Parser", "bugs"}})
+		sendQueueRequest(map[string]any{"action": "chat_move_folder", "request_id": "req-2", "id": tagged, "folder": "work"})
+		sendQueueRequest(map[string]any{"action": "chat_pin", "request_id": "req-3", "id": tagged})
+	})
+	for _, resp := range responses {
+		if resp["type"] != "ok" {
+			t.Fatalf("responses = %+v", responses)
+		}
+	}
+	if tags, _ := responses[0]["tags"].([]any); len(tags) != 2 || tags[0] != "bugs" {
+		t.Errorf("chat_tag tags = %v", responses[0]["tags"])
+	}
+
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_list", "request_id": "req-4", "tag": "parser"})
+	})
+	resp := firstResponseByType(responses, "chat_list")
+	chats, _ := resp["chats"].([]any)
+	if len(chats) != 1 {
+		t.Fatalf("chat_list by tag = %+v", responses)
+	}
+	chat := chats[0].(map[string]any)
+	if chat["id"] != tagged || chat["folder"] != "work" || chat["pinned"] != true {
+		t.Errorf("listed chat = %+v", chat)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_list", "request_id": "req-5", "sort": "size"})
+		sendQueueRequest(map[string]any{"action": "chat_tag", "request_id": "req-6", "id": tagged, "tags": []any{"a,b"}})
+	})
+	if len(responses) != 2 || responses[0]["type"] != "error" || responses[1]["type"] != "error" {
+		t.Errorf("invalid sort and tag = %+v", responses)
+	}
+}
+
+func TestParseSuggestedTags(t *testing.T) {
+	for reply, want := range map[string][]string{
+		"auth, Feature":                       {"auth", "feature"},
+		"#parser, parser, \"bugs\".":          {"parser", "bugs"},
+		"one, two words, three, four, five":   {"one", "three", "four"},
+		"Sure! Here are tags:\nauth, backend": {"auth", "backend"},
+	} {
+		if got := parseSuggestedTags(reply); !slices.Equal(got, want) {
+			t.Errorf("parseSuggestedTags(%q) = %v, want %v", reply, got, want)
+		}
+	}
+}
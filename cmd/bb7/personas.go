@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/youruser/bb7/internal/config"
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Personas are configured in config.json (see config.Persona). A chat selects
+// one with save_chat_settings; its system prompt fragment is sent with every
+// request in that chat and each reply records the persona that produced it.
+
+var errUnknownPersona = errors.New("unknown persona")
+
+// configuredPersonas returns the personas in config.json, loading it if
+// needed. Without a usable config there are none.
+func configuredPersonas() map[string]config.Persona {
+	if err := ensureConfig(); err != nil {
+		return nil
+	}
+	return appConfig.Personas
+}
+
+// chatPersona returns the chat's persona name if it is still configured.
+func chatPersona(chat *state.Chat) (string, config.Persona) {
+	if chat == nil || chat.Persona == "" {
+		return "", config.Persona{}
+	}
+	persona, ok := configuredPersonas()[chat.Persona]
+	if !ok {
+		log.Info("Chat persona %q is no longer configured; ignoring it", chat.Persona)
+		return "", config.Persona{}
+	}
+	return chat.Persona, persona
+}
+
+// personaPromptBlock formats a persona's system prompt fragment.
+func personaPromptBlock(name string, persona config.Persona) string {
+	prompt := strings.TrimSpace(persona.SystemPrompt)
+	if prompt == "" {
+		return ""
+	}
+	return "<persona name=\"" + name + "\">\n" + prompt + "\n</persona>\n\n"
+}
+
+func handlePersonaList(reqID string) {
+	configured := configuredPersonas()
+	personas := make([]map[string]any, 0, len(configured))
+	for name, persona := range configured {
+		personas = append(personas, map[string]any{
+			"name":             name,
+			"description":      persona.Description,
+			"model":            persona.Model,
+			"reasoning_effort": persona.ReasoningEffort,
+		})
+	}
+	sort.Slice(personas, func(i, j int) bool {
+		return personas[i]["name"].(string) < personas[j]["name"].(string)
+	})
+	respond(reqID, map[string]any{"type": "personas", "personas": personas})
+}
+
+// selectChatPersona sets the active chat's persona ("" clears it). Selecting
+// a persona also applies its model and reasoning effort to the chat.
+// Must be called with stateMu held.
+func selectChatPersona(name string) error {
+	chat := appState.ActiveChat
+	if name == "" {
+		chat.Persona = ""
+		return nil
+	}
+	persona, ok := configuredPersonas()[name]
+	if !ok {
+		return errUnknownPersona
+	}
+	chat.Persona = name
+	if persona.Model != "" {
+		chat.Model = persona.Model
+	}
+	if persona.ReasoningEffort != "" {
+		chat.ReasoningEffort = persona.ReasoningEffort
+	}
+	return nil
+}
+
+// annotateAssistantMessage records the reasoning effort, persona, and finish
+// reason on the assistant message just added to st's chat. Must be called
+// with stateMu held.
+func annotateAssistantMessage(st *state.State, reasoningConfig *llm.ReasoningConfig, persona, finishReason string) error {
+	if reasoningConfig == nil && persona == "" && finishReason == "" {
+		return nil
+	}
+	msgs := st.ActiveChat.Messages
+	last := &msgs[len(msgs)-1]
+	if reasoningConfig != nil {
+		last.ReasoningEffort = reasoningConfig.Effort
+	}
+	last.Persona = persona
+	last.FinishReason = finishReason
+	return st.SaveActiveChat()
+}
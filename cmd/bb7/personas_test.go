@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/config"
+)
+
+func TestPersonaSelectionAndSend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		bodies <- string(body)
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Looks racy."}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	appConfig.Personas = map[string]config.Persona{
+		"reviewer": {SystemPrompt: "Hunt for concurrency bugs.", Model: "test-reviewer", ReasoningEffort: "high"},
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "save_chat_settings", "request_id": "req-bad", "persona": "missing"})
+		sendQueueRequest(map[string]any{"action": "save_chat_settings", "request_id": "req-set", "persona": "reviewer"})
+		sendQueueRequest(map[string]any{"action": "persona_list", "request_id": "req-list"})
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-send", "content": "check this"})
+		waitForStreams(t)
+	})
+
+	if resp := firstResponseByType(responses, "error"); resp == nil || resp["request_id"] != "req-bad" {
+		t.Errorf("expected error for unknown persona, got %+v", resp)
+	}
+	set := firstResponseByType(responses, "ok")
+	if set == nil || set["persona"] != "reviewer" || set["model"] != "test-reviewer" || set["reasoning_effort"] != "high" {
+		t.Errorf("save_chat_settings response = %+v", set)
+	}
+	list := firstResponseByType(responses, "personas")
+	if list == nil || len(list["personas"].([]any)) != 1 {
+		t.Errorf("persona_list = %+v", list)
+	}
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+
+	body := strings.ReplaceAll(strings.ReplaceAll(<-bodies, `\u003c`, "<"), `\u003e`, ">")
+	if !strings.Contains(body, `<persona name=\"reviewer\">\nHunt for concurrency bugs.`) {
+		t.Errorf("persona prompt missing from request: %s", body)
+	}
+	if !strings.Contains(body, `"model":"test-reviewer"`) {
+		t.Errorf("persona model not used: %s", body)
+	}
+	chat := appState.ActiveChat
+	if chat.Persona != "reviewer" || chat.Model != "test-reviewer" || chat.ReasoningEffort != "high" {
+		t.Errorf("chat settings = %q %q %q", chat.Persona, chat.Model, chat.ReasoningEffort)
+	}
+	if last := chat.Messages[len(chat.Messages)-1]; last.Role != "assistant" || last.Persona != "reviewer" {
+		t.Errorf("assistant message = %+v", last)
+	}
+}
+
+func TestPersonasWithoutConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setupSendIntegrationEnv(t, "")
+	appConfig = nil
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "persona_list", "request_id": "req-list"})
+		sendQueueRequest(map[string]any{"action": "save_chat_settings", "request_id": "req-set", "persona": "reviewer"})
+	})
+
+	list := firstResponseByType(responses, "personas")
+	if list == nil || len(list["personas"].([]any)) != 0 {
+		t.Errorf("persona_list without config = %+v", list)
+	}
+	resp := firstResponseByType(responses, "error")
+	if resp == nil || resp["request_id"] != "req-set" || resp["message"] != errUnknownPersona.Error() {
+		t.Errorf("expected unknown persona error, got %+v", resp)
+	}
+}
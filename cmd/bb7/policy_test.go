@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathPolicyActions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for i, path := range []string{"src/main.go", "vendor/lib/lib.go"} {
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{map[string]any{
+					"index": i, "id": "call_" + path, "type": "function",
+					"function": map[string]any{"name": "write_file", "arguments": writeFileArgsJSON(t, path, "package x\n")},
+				}}}}},
+			})
+		}
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	if err := os.WriteFile(filepath.Join(appState.ProjectRoot, ".bb7", "policy"), []byte("deny-read .env\ndeny-write vendor/**\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "context_add", "request_id": "req-1", "path": ".env", "content": "KEY=1\n"})
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-2", "content": "vendor a lib"})
+		waitForStreams(t)
+	})
+
+	resp := firstResponseByType(responses, "error")
+	if resp == nil || resp["code"] != "path_denied" || !strings.Contains(resp["message"].(string), ".bb7/policy line 1") {
+		t.Fatalf("context_add response = %+v", responses)
+	}
+	diffErr := requireDiffErrorResponse(t, responses)
+	errs, _ := diffErr["errors"].([]any)
+	if len(errs) != 1 || !strings.Contains(errs[0].(string), "write of vendor/lib/lib.go denied") {
+		t.Errorf("diff_error errors = %v", diffErr["errors"])
+	}
+	// Writes are all or nothing, so the allowed file isn't written either.
+	if _, err := appState.GetOutputFile("src/main.go"); err == nil {
+		t.Error("src/main.go was written")
+	}
+}
+
+func TestPathPolicySkipsDeniedContextOnSend(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(data), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = string(data)
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "ok"}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	// Added before the rule existed.
+	for path, content := range map[string]string{".env": "KEY=hunter2\n", "main.go": "package main\n"} {
+		if err := appState.ContextAdd(path, content); err != nil {
+			t.Fatalf("ContextAdd(%s) failed: %v", path, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(appState.ProjectRoot, ".bb7", "policy"), []byte("deny-read .env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-1", "content": "hi"})
+		waitForStreams(t)
+	})
+
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+	if strings.Contains(body, "hunter2") || !strings.Contains(body, "package main") {
+		t.Errorf("request body = %s", body)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/youruser/bb7/internal/state"
+)
+
+// handleRegenerate answers the active chat's last user message again. The
+// previous reply is kept as an alternate of the message (see
+// state.RegenerateLast); model, reasoning_effort, diff_mode, generation, and
+// review apply to the new reply as they do for send.
+// Must be called with stateMu held.
+func handleRegenerate(reqID string, req map[string]any) {
+	if appState.ActiveChat == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+	if activeChatStreaming() {
+		respond(reqID, errorResponse(errChatStreaming))
+		return
+	}
+	if err := checkDiffMode(req); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	model, _ := req["model"].(string)
+	content, err := appState.RegenerateLast(model)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if model == "" {
+		msgs := appState.ActiveChat.Messages
+		req["model"] = msgs[len(msgs)-1].Model
+	}
+	req["content"] = content
+	req["resume"] = true // the message is already recorded
+	if err := reserveChatStream(reqID); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	recordRunningSend(reqID, req)
+	go handleSend(reqID, req)
+}
+
+// handleSelectVariant makes an alternate reply of the last user message its
+// reply again. Must be called with stateMu held.
+func handleSelectVariant(reqID string, req map[string]any) {
+	if appState.ActiveChat == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+	indexVal, ok := req["message_index"].(float64)
+	if !ok {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: message_index"})
+		return
+	}
+	variantVal, ok := req["variant"].(float64)
+	if !ok {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: variant"})
+		return
+	}
+	if err := appState.SelectVariant(int(indexVal), int(variantVal)); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "ok"})
+}
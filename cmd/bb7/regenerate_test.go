@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestRegenerateKeepsPreviousReplyAsAlternate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/chat/completions" || strings.Contains(string(raw), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var body map[string]any
+		json.Unmarshal(raw, &body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Answer from " + body["model"].(string)}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-1", "content": "question", "model": "test-model"})
+		waitForStreams(t)
+		sendQueueRequest(map[string]any{"action": "regenerate", "request_id": "req-2", "model": "other-model"})
+		waitForStreams(t)
+	})
+	if n := countResponsesByType(responses, "done"); n != 2 {
+		t.Fatalf("expected two done responses, got %+v", responses)
+	}
+
+	msgs := appState.ActiveChat.Messages
+	var texts []string
+	for _, msg := range msgs {
+		texts = append(texts, msg.Role+":"+state.MessageText(msg))
+	}
+	if strings.Join(texts, "|") != "user:question|assistant:Answer from other-model" {
+		t.Fatalf("messages = %v", texts)
+	}
+	user := msgs[0]
+	if user.Model != "other-model" || len(user.Alternates) != 1 || state.MessageText(user.Alternates[0]) != "Answer from test-model" {
+		t.Errorf("user message = %+v", user)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "select_variant", "request_id": "req-3", "message_index": 0, "variant": 0})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("select_variant: %+v", responses)
+	}
+	msgs = appState.ActiveChat.Messages
+	if got := state.MessageText(msgs[len(msgs)-1]); got != "Answer from test-model" {
+		t.Errorf("selected reply = %q", got)
+	}
+}
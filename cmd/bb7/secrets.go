@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Secret scanning. Every request body is scanned for things that look like
+// credentials before it is sent. Depending on secret_scan, findings are only
+// reported ("warn"), replaced by placeholders ("redact"), or stop the send
+// ("block"). A placeholder is an HMAC of the secret under a random key kept
+// in .bb7/secret_key, so the same secret gets the same placeholder in every
+// request of a project, while whoever sees a request can't test guesses
+// against it. Placeholders the model writes back are restored before output
+// files are saved.
+//
+// A hidden repair retry is scanned like the first request. Its body holds the
+// model's pending writes, which contain any secrets restored into them, so
+// they are redacted or block the retry just like the user's own files.
+
+// secretRule is a pattern for one kind of secret. When the pattern has a
+// group, the first group is the secret and the rest is context.
+type secretRule struct {
+	name string
+	re   *regexp.Regexp
+	// Only values with at least this Shannon entropy (bits per byte) count
+	minEntropy float64
+}
+
+var builtinSecretRules = []secretRule{
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{name: "api_key", re: regexp.MustCompile(`\bsk-(?:[a-z]+-)*[A-Za-z0-9_-]{20,}`)},
+	{name: "stripe_key", re: regexp.MustCompile(`\b[rs]k_(?:live|test)_[A-Za-z0-9]{16,}\b`)},
+	{name: "slack_token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{name: "google_api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	// Random-looking values assigned to secret-sounding names, as in .env files
+	{
+		name:       "high_entropy",
+		re:         regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|pwd|api[_-]?key|access[_-]?key|private[_-]?key|credential|auth)[a-z0-9_.-]*["']?\s*[:=]\s*["']?([a-z0-9+/=_.~-]{16,})`),
+		minEntropy: 3.5,
+	},
+}
+
+// secretPlaceholderPattern matches placeholders so they are not reported as
+// secrets themselves.
+var secretPlaceholderPattern = regexp.MustCompile(`^BB7_SECRET_[0-9a-f]{12}$`)
+
+var errSecretsBlocked = errors.New("request blocked: it contains possible secrets")
+
+// secretFinding is one possible secret in a request body. Secrets are never
+// reported in full; Preview shows only the first characters.
+type secretFinding struct {
+	Rule        string `json:"rule"`
+	Path        string `json:"path,omitempty"` // Context file it is in; empty for chat messages
+	Line        int    `json:"line,omitempty"` // Line in that file
+	Preview     string `json:"preview"`
+	Placeholder string `json:"placeholder,omitempty"` // Set when the secret was redacted
+}
+
+// secretScanner scans the request bodies of one send.
+type secretScanner struct {
+	mode     string
+	key      []byte // Placeholder key (redact mode)
+	rules    []secretRule
+	findings []secretFinding // Findings of the last scanned body
+	secrets  map[string]string
+	// Findings of every scan so far, and those not yet sent to the client
+	seen       map[secretFinding]bool
+	unreported []secretFinding
+}
+
+// newSecretScanner returns a scanner for the configured mode and patterns,
+// or nil when scanning is off. st is the chat the request is for.
+func newSecretScanner(st *state.State) (*secretScanner, error) {
+	mode := "off"
+	if appConfig != nil && appConfig.SecretScan != nil {
+		mode = *appConfig.SecretScan
+	}
+	if mode == "off" {
+		return nil, nil
+	}
+	rules := append([]secretRule(nil), builtinSecretRules...)
+	for _, pattern := range appConfig.SecretPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secret_patterns: %w", err)
+		}
+		rules = append(rules, secretRule{name: "custom", re: re})
+	}
+	sc := &secretScanner{mode: mode, rules: rules, secrets: make(map[string]string), seen: make(map[secretFinding]bool)}
+	if mode == "redact" {
+		key, err := st.SecretKey()
+		if err != nil {
+			return nil, fmt.Errorf("secret key: %w", err)
+		}
+		sc.key = key
+	}
+	return sc, nil
+}
+
+// secretMatch is a secret at body[start:end].
+type secretMatch struct {
+	rule       string
+	start, end int
+}
+
+// scan checks a request body. It returns the body to send, which has
+// placeholders in place of secrets in "redact" mode, and errSecretsBlocked
+// in "block" mode when anything was found. A nil scanner passes the body
+// through.
+func (sc *secretScanner) scan(body string) (string, error) {
+	if sc == nil {
+		return body, nil
+	}
+	matches := sc.match(body)
+	sc.findings = nil
+	if len(matches) == 0 {
+		return body, nil
+	}
+
+	blocks := fileBlockSpans(body)
+	for _, m := range matches {
+		secret := body[m.start:m.end]
+		finding := secretFinding{Rule: m.rule, Preview: secretPreview(secret)}
+		finding.Path, finding.Line = locateInFileBlocks(body, blocks, m.start)
+		if sc.mode == "redact" {
+			finding.Placeholder = secretPlaceholder(sc.key, secret)
+			sc.secrets[finding.Placeholder] = secret
+		}
+		sc.findings = append(sc.findings, finding)
+		if !sc.seen[finding] {
+			sc.seen[finding] = true
+			sc.unreported = append(sc.unreported, finding)
+		}
+	}
+	log.Warn("Found %d possible secret(s) in request (secret_scan=%s)", len(matches), sc.mode)
+
+	switch sc.mode {
+	case "block":
+		return "", errSecretsBlocked
+	case "redact":
+		var b strings.Builder
+		prev := 0
+		for _, m := range matches {
+			b.WriteString(body[prev:m.start])
+			b.WriteString(secretPlaceholder(sc.key, body[m.start:m.end]))
+			prev = m.end
+		}
+		b.WriteString(body[prev:])
+		return b.String(), nil
+	}
+	return body, nil
+}
+
+// match returns the secrets in body in order. Where matches overlap, the
+// earlier one wins; at the same position the longer one does.
+func (sc *secretScanner) match(body string) []secretMatch {
+	var all []secretMatch
+	for _, rule := range sc.rules {
+		for _, loc := range rule.re.FindAllStringSubmatchIndex(body, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			secret := body[start:end]
+			if secret == "" || secretPlaceholderPattern.MatchString(secret) {
+				continue
+			}
+			if rule.minEntropy > 0 && (!hasLetterAndDigit(secret) || shannonEntropy(secret) < rule.minEntropy) {
+				continue
+			}
+			all = append(all, secretMatch{rule: rule.name, start: start, end: end})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+	var matches []secretMatch
+	for _, m := range all {
+		if len(matches) > 0 && m.start < matches[len(matches)-1].end {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// restoreToolCall puts redacted secrets back into a tool call's arguments,
+// so files the model writes contain the real values and its edits match
+// the files on disk.
+func (sc *secretScanner) restoreToolCall(call *llm.ToolCall) {
+	if sc == nil || call == nil || len(sc.secrets) == 0 {
+		return
+	}
+	args := call.Function.Arguments
+	for placeholder, secret := range sc.secrets {
+		if !strings.Contains(args, placeholder) {
+			continue
+		}
+		// Arguments are JSON; the secret must be escaped like a string.
+		quoted, _ := json.Marshal(secret)
+		args = strings.ReplaceAll(args, placeholder, string(quoted[1:len(quoted)-1]))
+	}
+	call.Function.Arguments = args
+}
+
+// report returns a secrets_detected response with the findings not reported
+// yet, or nil when there are none. A send reports each finding once, however
+// many of its request bodies contain it.
+func (sc *secretScanner) report() map[string]any {
+	if sc == nil || len(sc.unreported) == 0 {
+		return nil
+	}
+	resp := map[string]any{
+		"type":     "secrets_detected",
+		"mode":     sc.mode,
+		"findings": sc.unreported,
+	}
+	sc.unreported = nil
+	return resp
+}
+
+// blockedMessage explains why a send was blocked.
+func (sc *secretScanner) blockedMessage() string {
+	return fmt.Sprintf("Send blocked: %d possible secret(s) in the request. Remove them or set secret_scan to \"redact\".", len(sc.findings))
+}
+
+// secretPlaceholder returns the placeholder for a secret under key.
+func secretPlaceholder(key []byte, secret string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(secret))
+	return "BB7_SECRET_" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// secretPreview shows the start of a secret, enough to recognize it.
+func secretPreview(secret string) string {
+	if strings.HasPrefix(secret, "-----BEGIN") {
+		if end := strings.Index(secret, "\n"); end > 0 {
+			return secret[:end]
+		}
+	}
+	n := 4
+	if len(secret) < 12 {
+		n = len(secret) / 3
+	}
+	return secret[:n] + strings.Repeat("*", 8)
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.IndexFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }) >= 0
+}
+
+// shannonEntropy returns the entropy of s in bits per byte.
+func shannonEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var entropy float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// fileBlockSpan is the content of one @file block in a request body.
+type fileBlockSpan struct {
+	path       string
+	start, end int // Content offsets
+	firstLine  int // Line number of the first content line
+}
+
+// fileBlockSpans finds the @file blocks written by writeFileBlocks.
+func fileBlockSpans(body string) []fileBlockSpan {
+	var spans []fileBlockSpan
+	offset := 0
+	var current *fileBlockSpan
+	for _, line := range strings.SplitAfter(body, "\n") {
+		switch {
+		case current == nil && strings.HasPrefix(line, "@file id="):
+			span := fileBlockSpan{start: offset + len(line), firstLine: 1}
+			header := strings.TrimSuffix(line, "\n")
+			if i := strings.Index(header, " path="); i >= 0 {
+				span.path = header[i+len(" path="):]
+				if j := strings.Index(span.path, " mode="); j >= 0 {
+					span.path = span.path[:j]
+				}
+			}
+			if i := strings.Index(header, " lines="); i >= 0 {
+				fmt.Sscanf(header[i+len(" lines="):], "%d-", &span.firstLine)
+			}
+			current = &span
+		case current != nil && strings.HasPrefix(line, "@end file id="):
+			current.end = offset
+			spans = append(spans, *current)
+			current = nil
+		}
+		offset += len(line)
+	}
+	return spans
+}
+
+// locateInFileBlocks returns the file and line of a body offset, or an
+// empty path when the offset is outside every file block.
+func locateInFileBlocks(body string, spans []fileBlockSpan, offset int) (string, int) {
+	for _, span := range spans {
+		if offset >= span.start && offset < span.end {
+			return span.path, span.firstLine + strings.Count(body[span.start:offset], "\n")
+		}
+	}
+	return "", 0
+}
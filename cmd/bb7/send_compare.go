@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youruser/bb7/internal/llm"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Multi-model comparison. send_compare sends one prompt to several models at
+// once. Each model answers in its own branch of the active chat (see
+// state.BranchChat), so replies and pending output stay apart and can be
+// diffed with chat_compare afterwards. The active chat itself is unchanged.
+
+const maxCompareModels = 4
+
+// compareRun is one model's share of a send_compare request.
+type compareRun struct {
+	model    string
+	chatID   string
+	streamID string       // Registers the branch in streams while it runs
+	st       *state.State // View on the branch chat (see state.OpenChat)
+	body     string
+	cacheKey string
+	secrets  *secretScanner // Shared by all runs; restores redacted secrets
+	// System prompt with the instructions that apply to this model
+	systemPrompt string
+	persona      string
+	reasoning    *llm.ReasoningConfig
+	generation   llm.GenerationParams
+
+	outputFiles []string
+	usage       *llm.Usage
+	duration    float64
+	diffErrors  []string
+	err         string
+}
+
+func (r *compareRun) result() map[string]any {
+	res := map[string]any{
+		"model":        r.model,
+		"chat_id":      r.chatID,
+		"output_files": r.outputFiles,
+		"duration":     r.duration,
+	}
+	if res["output_files"] == nil {
+		res["output_files"] = []string{}
+	}
+	if r.usage != nil {
+		res["usage"] = map[string]any{
+			"prompt_tokens":     r.usage.PromptTokens,
+			"completion_tokens": r.usage.CompletionTokens,
+			"cached_tokens":     r.usage.CachedTokens,
+			"total_tokens":      r.usage.TotalTokens,
+			"cost":              r.usage.Cost,
+		}
+	}
+	if len(r.diffErrors) > 0 {
+		res["diff_errors"] = r.diffErrors
+	}
+	if r.err != "" {
+		res["error"] = r.err
+	}
+	return res
+}
+
+// parseCompareModels validates the models field of a send_compare request.
+func parseCompareModels(raw any) ([]string, error) {
+	list, _ := raw.([]any)
+	seen := make(map[string]bool, len(list))
+	var models []string
+	for _, v := range list {
+		model, _ := v.(string)
+		model = strings.TrimSpace(model)
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		models = append(models, model)
+	}
+	if len(models) < 2 {
+		return nil, errors.New("send_compare needs at least two different models")
+	}
+	if len(models) > maxCompareModels {
+		return nil, fmt.Errorf("send_compare supports at most %d models", maxCompareModels)
+	}
+	return models, nil
+}
+
+func handleSendCompare(reqID string, req map[string]any) {
+	defer finishSend(reqID, "")
+
+	parent := streams.view(reqID)
+	if parent == nil {
+		respond(reqID, errorResponse(state.ErrNoActiveChat))
+		return
+	}
+
+	if streams.wasCanceled(reqID) {
+		respond(reqID, map[string]any{"type": "error", "message": "Response aborted by user."})
+		return
+	}
+
+	content, _ := req["content"].(string)
+	if content == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: content"})
+		return
+	}
+	models, err := parseCompareModels(req["models"])
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	if err := ensureConfig(); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+
+	reasoningEffort, _ := req["reasoning_effort"].(string)
+	diffMode := "write_file"
+	if appConfig.DiffMode != nil && *appConfig.DiffMode != "" {
+		diffMode = *appConfig.DiffMode
+	}
+
+	stateMu.Lock()
+	secrets, err := newSecretScanner(parent)
+	if err != nil {
+		stateMu.Unlock()
+		respond(reqID, errorResponse(err))
+		return
+	}
+	runs, imageParts, err := prepareCompareRuns(reqID, parent, content, models, diffMode, reasoningEffort, req, secrets)
+	stateMu.Unlock()
+	if errors.Is(err, errSecretsBlocked) {
+		respond(reqID, secrets.report())
+		respond(reqID, map[string]any{"type": "error", "message": secrets.blockedMessage()})
+		return
+	}
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if resp := secrets.report(); resp != nil {
+		respond(reqID, resp)
+	}
+	defer func() {
+		for _, run := range runs {
+			streams.clear(run.streamID)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !streams.setCancel(reqID, cancel) {
+		respond(reqID, map[string]any{"type": "error", "message": "Another request is already in progress"})
+		return
+	}
+
+	log.Info("Starting compare streams for %d models (diff_mode: %s)", len(runs), diffMode)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *compareRun) {
+			defer wg.Done()
+			defer streams.clear(run.streamID)
+			runCompareStream(ctx, reqID, run, run.systemPrompt, imageParts, diffMode)
+		}(run)
+	}
+	wg.Wait()
+
+	results := make([]map[string]any, 0, len(runs))
+	var totalCost float64
+	for _, run := range runs {
+		results = append(results, run.result())
+		if run.usage != nil {
+			totalCost += run.usage.Cost
+		}
+	}
+	respond(reqID, map[string]any{
+		"type":     "compare_done",
+		"results":  results,
+		"cost":     totalCost,
+		"duration": time.Since(start).Seconds(),
+		"canceled": streams.wasCanceled(reqID),
+	})
+}
+
+// prepareCompareRuns creates one branch of the parent chat per model, records
+// the prompt in each, and builds the request bodies, scanned by secrets. Each
+// branch is reserved in streams so other requests treat it as streaming. On
+// failure the branches created so far are released and deleted. Must be
+// called with stateMu held.
+func prepareCompareRuns(reqID string, parentState *state.State, content string, models []string, diffMode, reasoningEffort string, req map[string]any, secrets *secretScanner) ([]*compareRun, []llm.ContentPart, error) {
+	parent := parentState.ActiveChat
+	if parent.Global {
+		return nil, nil, errors.New("send_compare is not available for global chats")
+	}
+
+	// Scoped instruction blocks can depend on the model.
+	personaName, persona := chatPersona(parent)
+	systemPrompts := make(map[string]string, len(models))
+	for _, model := range models {
+		instructionsBlock, _, err := parentState.BuildScopedInstructionsBlock(state.InstructionScope{Model: model, DiffMode: diffMode})
+		if err != nil {
+			return nil, nil, err
+		}
+		systemPrompts[model] = buildSystemPrompt(personaPromptBlock(personaName, persona)+instructionsBlock, diffMode, false)
+	}
+	type generation struct {
+		reasoning *llm.ReasoningConfig
+		params    llm.GenerationParams
+	}
+	generations := make(map[string]generation, len(models))
+	for _, model := range models {
+		if err := checkImageSupport(parentState, model); err != nil {
+			return nil, nil, err
+		}
+		reasoning, params, err := resolveGeneration(parent, model, reasoningEffort, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		generations[model] = generation{reasoning, params}
+	}
+	imageParts, err := collectImageParts(parentState)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var runs []*compareRun
+	fail := func(err error) ([]*compareRun, []llm.ContentPart, error) {
+		for _, run := range runs {
+			streams.clear(run.streamID)
+			if delErr := parentState.ChatDelete(run.chatID); delErr != nil {
+				log.Error("Failed to remove compare branch %s: %v", run.chatID, delErr)
+			}
+		}
+		return nil, nil, err
+	}
+	for _, model := range models {
+		chat, err := parentState.BranchChat(parent.ID, parent.Name+" ["+model+"]", model)
+		if err != nil {
+			return fail(err)
+		}
+		st, err := parentState.OpenChat(chat.ID)
+		if err != nil {
+			parentState.ChatDelete(chat.ID)
+			return fail(err)
+		}
+		streamID := reqID + "/" + chat.ID
+		if !streams.reserve(streamID, chat.ID, st) {
+			st.Cleanup()
+			parentState.ChatDelete(chat.ID)
+			return fail(errChatStreaming)
+		}
+		run := &compareRun{
+			model:        model,
+			chatID:       chat.ID,
+			streamID:     streamID,
+			st:           st,
+			systemPrompt: systemPrompts[model],
+			persona:      personaName,
+			reasoning:    generations[model].reasoning,
+			generation:   generations[model].params,
+			secrets:      secrets,
+		}
+		runs = append(runs, run)
+
+		if err := st.AddUserMessage(content, model); err != nil {
+			return fail(err)
+		}
+		run.body, err = buildLLMUserMessageWithOverrides(st, nil, diffMode, nil, secrets)
+		if err != nil {
+			return fail(err)
+		}
+		if appConfig.ExplicitCacheKey != nil && *appConfig.ExplicitCacheKey {
+			run.cacheKey = "bb7:" + chat.ID + ":" + model
+		}
+	}
+	return runs, imageParts, nil
+}
+
+// runCompareStream streams one model's reply and saves it to its branch.
+// Events are tagged with the model and branch chat ID. A failing model does
+// not stop the others; only canceling the request does.
+func runCompareStream(
+	parentCtx context.Context,
+	reqID string,
+	run *compareRun,
+	fullSystemPrompt string,
+	imageParts []llm.ContentPart,
+	diffMode string,
+) {
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+	// A cancel for the branch chat stops only this model.
+	streams.setCancel(run.streamID, cancel)
+
+	emit := func(resp map[string]any) {
+		resp["model"] = run.model
+		resp["chat_id"] = run.chatID
+		respond(reqID, resp)
+	}
+
+	var textContent strings.Builder
+	var thinkingContent strings.Builder
+	var outputFiles []string
+	var lastUsage *llm.Usage
+	var writeCalls []llm.WriteFileArgs
+	var toolCallLogs []toolCallLog
+	var diffErrors []string
+	var streamErr string
+	var finishReason string
+	pendingWrites := make(map[string]string)
+	seenOutputPaths := make(map[string]bool)
+	duplicatePathDetected := false
+
+	logLLMMessage("SYSTEM", fullSystemPrompt, run.chatID, run.model)
+	logLLMMessage("USER", run.body, run.chatID, run.model)
+	messages := []llm.APIMessage{userAPIMessage(run.body, imageParts)}
+
+	streamStart := time.Now()
+	err := llmClient.ChatStream(ctx, run.model, fullSystemPrompt, messages, run.reasoning, run.generation, llm.DefaultTools(diffMode), run.cacheKey, func(event llm.StreamEvent) {
+		switch event.Type {
+		case "content":
+			log.Stream("content", event.Content)
+			textContent.WriteString(event.Content)
+			emit(map[string]any{"type": "chunk", "content": event.Content})
+
+		case "reasoning":
+			log.Stream("reasoning", event.Reasoning)
+			thinkingContent.WriteString(event.Reasoning)
+			emit(map[string]any{"type": "thinking", "content": event.Reasoning})
+
+		case "tool_call":
+			run.secrets.restoreToolCall(event.ToolCall)
+			handleToolCallEvent(
+				run.st,
+				emit,
+				diffMode,
+				event.ToolCall,
+				pendingWrites,
+				seenOutputPaths,
+				&outputFiles,
+				&writeCalls,
+				&toolCallLogs,
+				&diffErrors,
+				&streamErr,
+				&duplicatePathDetected,
+				cancel,
+			)
+
+		case llm.FinishReasonLength:
+			// Comparisons are not continued; a cut-off call fails the run.
+			if event.ToolCall != nil {
+				diffErrors = append(diffErrors, truncatedToolCallError(event.ToolCall))
+			}
+
+		case "done":
+			log.Stream("done", "")
+			if event.Usage != nil {
+				lastUsage = event.Usage
+			}
+			finishReason = event.FinishReason
+
+		case "error":
+			log.Error("Stream error (%s): %s", run.model, event.Error)
+			setTerminalStreamError(&streamErr, event.Error, cancel)
+		}
+	})
+	if err == nil && streamErr != "" {
+		err = errors.New(streamErr)
+	}
+	run.duration = time.Since(streamStart).Seconds()
+	run.usage = lastUsage
+	if err == nil {
+		stateMu.Lock()
+		diffErrors = append(diffErrors, deniedWriteErrors(run.st, pendingWrites)...)
+		stateMu.Unlock()
+	}
+
+	logLLMMessage("ASSISTANT", buildAssistantLogContent(
+		thinkingContent.String(),
+		textContent.String(),
+		toolCallLogs,
+		diffErrors,
+		err,
+	), run.chatID, run.model)
+	appendUsageCSV(run.model, lastUsage)
+
+	var parts []state.MessagePart
+	if thinkingContent.Len() > 0 {
+		parts = append(parts, state.MessagePart{Type: state.PartTypeThinking, Content: thinkingContent.String()})
+	}
+	if textContent.Len() > 0 {
+		parts = append(parts, state.MessagePart{Type: state.PartTypeText, Content: textContent.String()})
+	}
+	var msgUsage *state.MessageUsage
+	if lastUsage != nil {
+		msgUsage = &state.MessageUsage{
+			PromptTokens:     lastUsage.PromptTokens,
+			CompletionTokens: lastUsage.CompletionTokens,
+			CachedTokens:     lastUsage.CachedTokens,
+			TotalTokens:      lastUsage.TotalTokens,
+			Cost:             lastUsage.Cost,
+			Duration:         run.duration,
+		}
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	switch {
+	case err != nil:
+		msg := streamErr
+		if msg == "" {
+			msg = err.Error()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			msg = "Request timed out."
+		} else if errors.Is(err, context.Canceled) && (streams.wasCanceled(reqID) || streams.wasCanceled(run.streamID)) {
+			// Keep the partial reply; file writes of a canceled model are dropped.
+			msg = "Response aborted by user."
+			if len(parts) > 0 {
+				if addErr := run.st.AddAssistantMessage(parts, nil, run.model, nil); addErr != nil {
+					log.Error("Failed to save partial assistant message: %v", addErr)
+				} else if saveErr := annotateAssistantMessage(run.st, run.reasoning, run.persona, finishReason); saveErr != nil {
+					log.Error("Failed to save reasoning effort on partial message: %v", saveErr)
+				}
+			}
+		}
+		run.err = msg
+		if addErr := run.st.AddSystemMessage(msg); addErr != nil {
+			log.Error("Failed to record system message: %v", addErr)
+		}
+		return
+
+	case len(diffErrors) > 0:
+		// As in send, file writes are all or nothing per response.
+		run.diffErrors = diffErrors
+		if addErr := run.st.AddAssistantMessage(parts, nil, run.model, msgUsage); addErr != nil {
+			log.Error("Failed to save assistant message on diff error: %v", addErr)
+			return
+		}
+
+	default:
+		if writeErr := run.st.CommitOutputFiles(pendingWrites); writeErr != nil {
+			log.Error("Failed to commit files: %v", writeErr)
+		}
+		parts = appendAssistantWriteParts(run.st, parts, outputFiles, pendingWrites)
+		if addErr := run.st.AddAssistantMessage(parts, outputFiles, run.model, msgUsage); addErr != nil {
+			run.err = addErr.Error()
+			return
+		}
+		run.outputFiles = outputFiles
+	}
+
+	if saveErr := annotateAssistantMessage(run.st, run.reasoning, run.persona, finishReason); saveErr != nil {
+		log.Error("Failed to save reasoning effort: %v", saveErr)
+	}
+}
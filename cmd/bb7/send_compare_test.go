@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// compareServer answers streaming requests according to the requested model.
+func compareServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, model string)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var reqBody map[string]any
+		json.Unmarshal(body, &reqBody)
+		model, _ := reqBody["model"].(string)
+		w.Header().Set("Content-Type", "text/event-stream")
+		handle(w, r, model)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeModelReply(t *testing.T, w http.ResponseWriter, text, path, content string, cost float64) {
+	t.Helper()
+	writeSSEJSON(t, w, map[string]any{
+		"choices": []any{map[string]any{"delta": map[string]any{"content": text}}},
+	})
+	writeSSEJSON(t, w, map[string]any{
+		"choices": []any{map[string]any{"delta": map[string]any{
+			"tool_calls": []any{map[string]any{
+				"index": 0,
+				"id":    "call_1",
+				"type":  "function",
+				"function": map[string]any{
+					"name":      "write_file",
+					"arguments": writeFileArgsJSON(t, path, content),
+				},
+			}},
+		}}},
+	})
+	writeSSEJSON(t, w, map[string]any{
+		"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15, "cost": cost},
+	})
+	writeSSEDone(t, w)
+}
+
+func compareResults(t *testing.T, responses []map[string]any) (map[string]any, map[string]map[string]any) {
+	t.Helper()
+	if countResponsesByType(responses, "compare_done") != 1 {
+		t.Fatalf("expected one compare_done response, got %+v", responses)
+	}
+	done := firstResponseByType(responses, "compare_done")
+	byModel := make(map[string]map[string]any)
+	for _, item := range done["results"].([]any) {
+		res := item.(map[string]any)
+		byModel[res["model"].(string)] = res
+	}
+	return done, byModel
+}
+
+func TestHandleSendCompareIntegration(t *testing.T) {
+	server := compareServer(t, func(w http.ResponseWriter, r *http.Request, model string) {
+		switch model {
+		case "model-a":
+			writeModelReply(t, w, "Answer A", "main.go", "package a\n", 0.01)
+		case "model-b":
+			writeModelReply(t, w, "Answer B", "main.go", "package b\n", 0.02)
+		}
+	})
+	setupSendIntegrationEnv(t, server.URL)
+	parentID := appState.ActiveChat.ID
+
+	reqID := "req-compare"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses := captureJSONResponses(t, func() {
+		handleSendCompare(reqID, map[string]any{
+			"content": "Write main.go",
+			"models":  []any{"model-a", "model-b"},
+		})
+	})
+
+	if countResponsesByType(responses, "error") != 0 {
+		t.Fatalf("unexpected error responses: %+v", responses)
+	}
+	done, results := compareResults(t, responses)
+	if len(results) != 2 {
+		t.Fatalf("expected results for both models, got %+v", done["results"])
+	}
+	if cost := done["cost"].(float64); cost < 0.0299 || cost > 0.0301 {
+		t.Errorf("total cost = %v, want 0.03", cost)
+	}
+	if done["canceled"] != false {
+		t.Errorf("canceled = %v", done["canceled"])
+	}
+
+	// Every streamed chunk names its model and branch.
+	for _, resp := range responses {
+		if resp["type"] != "chunk" {
+			continue
+		}
+		res, ok := results[resp["model"].(string)]
+		if !ok || resp["chat_id"] != res["chat_id"] {
+			t.Errorf("chunk not tagged with its branch: %+v", resp)
+		}
+	}
+
+	if len(appState.ActiveChat.Messages) != 0 {
+		t.Errorf("active chat should be unchanged, has %d messages", len(appState.ActiveChat.Messages))
+	}
+	for model, want := range map[string]string{"model-a": "package a\n", "model-b": "package b\n"} {
+		res := results[model]
+		if res["error"] != nil {
+			t.Fatalf("%s failed: %v", model, res["error"])
+		}
+		if files := res["output_files"].([]any); len(files) != 1 || files[0] != "main.go" {
+			t.Errorf("%s output_files = %v", model, files)
+		}
+		view, err := appState.OpenChat(res["chat_id"].(string))
+		if err != nil {
+			t.Fatalf("OpenChat failed: %v", err)
+		}
+		chat := view.ActiveChat
+		if chat.ParentID != parentID || chat.Model != model {
+			t.Errorf("branch lineage/model = %q/%q", chat.ParentID, chat.Model)
+		}
+		if len(chat.Messages) != 2 || chat.Messages[1].Model != model {
+			t.Errorf("branch messages = %+v", chat.Messages)
+		}
+		if got, _ := view.GetOutputFile("main.go"); got != want {
+			t.Errorf("%s output = %q, want %q", model, got, want)
+		}
+		view.Cleanup()
+	}
+}
+
+func TestHandleSendCompareModelFailureIsIsolated(t *testing.T) {
+	server := compareServer(t, func(w http.ResponseWriter, r *http.Request, model string) {
+		if model == "model-b" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error":{"message":"upstream down"}}`)
+			return
+		}
+		writeModelReply(t, w, "Answer A", "main.go", "package a\n", 0.01)
+	})
+	setupSendIntegrationEnv(t, server.URL)
+
+	reqID := "req-compare-fail"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses := captureJSONResponses(t, func() {
+		handleSendCompare(reqID, map[string]any{
+			"content": "Write main.go",
+			"models":  []any{"model-a", "model-b"},
+		})
+	})
+
+	_, results := compareResults(t, responses)
+	if results["model-a"]["error"] != nil {
+		t.Errorf("model-a should succeed, got %v", results["model-a"]["error"])
+	}
+	if results["model-b"]["error"] == nil {
+		t.Error("model-b should report its error")
+	}
+}
+
+func TestHandleSendCompareCancelStopsAllStreams(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(2)
+	server := compareServer(t, func(w http.ResponseWriter, r *http.Request, model string) {
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Partial " + model}}},
+		})
+		started.Done()
+		<-r.Context().Done()
+	})
+	setupSendIntegrationEnv(t, server.URL)
+
+	reqID := "req-compare-cancel"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	go func() {
+		started.Wait()
+		streams.cancel(reqID)
+	}()
+	responses := captureJSONResponses(t, func() {
+		handleSendCompare(reqID, map[string]any{
+			"content": "Write main.go",
+			"models":  []any{"model-a", "model-b"},
+		})
+	})
+
+	done, results := compareResults(t, responses)
+	if done["canceled"] != true {
+		t.Errorf("canceled = %v", done["canceled"])
+	}
+	for model, res := range results {
+		if res["error"] != "Response aborted by user." {
+			t.Errorf("%s error = %v", model, res["error"])
+		}
+	}
+}
+
+func TestParseCompareModels(t *testing.T) {
+	models, err := parseCompareModels([]any{"a", " b ", "a", ""})
+	if err != nil || len(models) != 2 || models[1] != "b" {
+		t.Errorf("parseCompareModels = %v, %v", models, err)
+	}
+	if _, err := parseCompareModels([]any{"a", "a"}); err == nil {
+		t.Error("expected error for a single distinct model")
+	}
+	if _, err := parseCompareModels([]any{"a", "b", "c", "d", "e"}); err == nil {
+		t.Error("expected error for too many models")
+	}
+}
+
+func TestHandleSendCompareBranchesAreStreaming(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(2)
+	release := make(chan struct{})
+	server := compareServer(t, func(w http.ResponseWriter, r *http.Request, model string) {
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Partial " + model}}},
+		})
+		started.Done()
+		<-release
+		writeModelReply(t, w, " done", "main.go", "package main\n", 0.01)
+	})
+	setupSendIntegrationEnv(t, server.URL)
+	parentID := appState.ActiveChat.ID
+
+	request := func(req map[string]any) {
+		line, _ := json.Marshal(req)
+		handleRequest(string(line))
+	}
+
+	reqID := "req-compare-busy"
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	var branches []string
+	responses := captureJSONResponses(t, func() {
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			handleSendCompare(reqID, map[string]any{
+				"content": "Write main.go",
+				"models":  []any{"model-a", "model-b"},
+			})
+		}()
+		started.Wait()
+
+		streams.mu.Lock()
+		for chatID := range streams.byChat {
+			if chatID != parentID {
+				branches = append(branches, chatID)
+			}
+		}
+		streams.mu.Unlock()
+		if len(branches) != 2 {
+			t.Errorf("expected both branches to be streaming, got %v", branches)
+		}
+		for _, id := range branches {
+			request(map[string]any{"action": "chat_delete", "request_id": "req-del-" + id, "id": id})
+		}
+		if len(branches) > 0 {
+			// Selecting a branch shares the run's copy of it.
+			request(map[string]any{"action": "chat_select", "request_id": "req-sel", "id": branches[0]})
+			stateMu.Lock()
+			if appState.ActiveChat != streams.chatState(branches[0]).ActiveChat {
+				t.Error("selected branch should share the streaming run's chat")
+			}
+			stateMu.Unlock()
+		}
+		close(release)
+		<-finished
+	})
+
+	byID := make(map[string][]map[string]any)
+	for _, resp := range responses {
+		id, _ := resp["request_id"].(string)
+		byID[id] = append(byID[id], resp)
+	}
+	for _, id := range branches {
+		if firstResponseByType(byID["req-del-"+id], "error") == nil {
+			t.Errorf("expected deleting streaming branch %s to fail, got %+v", id, byID["req-del-"+id])
+		}
+	}
+	if firstResponseByType(byID["req-sel"], "ok") == nil {
+		t.Errorf("expected selecting a streaming branch to succeed, got %+v", byID["req-sel"])
+	}
+	_, results := compareResults(t, responses)
+	for model, res := range results {
+		if res["error"] != nil {
+			t.Errorf("%s failed: %v", model, res["error"])
+		}
+	}
+	if n := len(appState.ActiveChat.Messages); n != 2 {
+		t.Errorf("selected branch has %d messages, want the finished reply", n)
+	}
+	for _, id := range branches {
+		if streams.active(id) {
+			t.Errorf("finished branch %s should be released", id)
+		}
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +19,7 @@ import (
 	"github.com/youruser/bb7/internal/diff"
 	"github.com/youruser/bb7/internal/llm"
 	"github.com/youruser/bb7/internal/state"
+	"github.com/youruser/bb7/internal/webdoc"
 )
 
 func setupSendIntegrationEnv(t *testing.T, baseURL string) {
@@ -24,7 +28,8 @@ func setupSendIntegrationEnv(t *testing.T, baseURL string) {
 	oldAppState := appState
 	oldAppConfig := appConfig
 	oldLLMClient := llmClient
-	oldActiveStream := activeStream
+	oldStreams := streams
+	oldModelCache := modelCache
 
 	appState = state.New()
 	diffMode := "search_replace"
@@ -37,6 +42,7 @@ func setupSendIntegrationEnv(t *testing.T, baseURL string) {
 	}
 	llmClient = llm.NewClient(baseURL, appConfig.APIKey, false, true, false)
 	resetActiveStreamForTest()
+	modelCache = nil
 
 	projectRoot := t.TempDir()
 	if err := appState.ProjectInit(projectRoot); err != nil {
@@ -53,7 +59,8 @@ func setupSendIntegrationEnv(t *testing.T, baseURL string) {
 		appState = oldAppState
 		appConfig = oldAppConfig
 		llmClient = oldLLMClient
-		activeStream = oldActiveStream
+		streams = oldStreams
+		modelCache = oldModelCache
 	})
 }
 
@@ -297,8 +304,8 @@ func TestHandleSendIntegrationSuccess(t *testing.T) {
 	setupSendIntegrationEnv(t, server.URL)
 
 	reqID := "req-send-ok"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 
 	responses := captureJSONResponses(t, func() {
@@ -419,8 +426,8 @@ func TestHandleSendIntegrationExplicitCacheKey(t *testing.T) {
 	llmClient = llm.NewClient(server.URL, appConfig.APIKey, false, true, true)
 
 	reqID := "req-send-cache-key"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 
 	responses := captureJSONResponses(t, func() {
@@ -532,8 +539,8 @@ func TestHandleSendIntegrationConsolidatesWriteEventsPerFile(t *testing.T) {
 	}
 
 	reqID := "req-send-consolidated-events"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 
 	responses := captureJSONResponses(t, func() {
@@ -657,8 +664,8 @@ func TestHandleSendIntegrationFileIDMismatchReturnsDiffError(t *testing.T) {
 	outputID = state.HashFileVersion("src/game.c", "Goblin 👺\n")
 
 	reqID := "req-send-file-id-mismatch"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 
 	responses := captureJSONResponses(t, func() {
@@ -760,8 +767,8 @@ func TestHandleSendIntegrationDuplicateWriteTerminatesStream(t *testing.T) {
 	setupSendIntegrationEnv(t, server.URL)
 
 	reqID := "req-send-dup"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 
 	responses := captureJSONResponses(t, func() {
@@ -898,8 +905,8 @@ func TestHandleSendIntegrationSRMultiLargeBatchSuccess(t *testing.T) {
 	}
 
 	reqID := "req-send-sr-multi-large-success"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 	responses := captureJSONResponses(t, func() {
 		handleSend(reqID, map[string]any{
@@ -1019,8 +1026,8 @@ func TestHandleSendIntegrationSRMultiMidBatchFailureIsAtomicAndSingleToolCallRec
 	}
 
 	reqID := "req-send-sr-multi-mid-batch-failure"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 	responses := captureJSONResponses(t, func() {
 		handleSend(reqID, map[string]any{
@@ -1138,8 +1145,8 @@ func TestHandleSendIntegrationSRMultiMissingFileIDInOneEditFails(t *testing.T) {
 	}
 
 	reqID := "req-send-sr-multi-missing-file-id"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 	responses := captureJSONResponses(t, func() {
 		handleSend(reqID, map[string]any{
@@ -1350,8 +1357,8 @@ func TestHandleSendIntegrationHiddenRetryAppliesPartialAndSucceeds(t *testing.T)
 	}
 
 	reqID := "req-send-hidden-retry-success"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 	responses := captureJSONResponses(t, func() {
 		handleSend(reqID, map[string]any{
@@ -1532,8 +1539,8 @@ func TestHandleSendIntegrationHiddenRetryFailureFallsBackToDiffError(t *testing.
 	}
 
 	reqID := "req-send-hidden-retry-failure"
-	if !reserveActiveStream(reqID) {
-		t.Fatal("failed to reserve active stream")
+	if err := reserveChatStream(reqID); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
 	}
 	responses := captureJSONResponses(t, func() {
 		handleSend(reqID, map[string]any{
@@ -1570,3 +1577,266 @@ func TestHandleSendIntegrationHiddenRetryFailureFallsBackToDiffError(t *testing.
 		t.Fatalf("expected no output file written after retry failure")
 	}
 }
+
+func TestContextAddURLChatSwitchedDuringFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	docs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><body><p>Docs</p></body></html>")
+	}))
+	defer docs.Close()
+
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	oldFetcher := webFetcher
+	webFetcher = webdoc.NewFetcher(t.TempDir())
+	t.Cleanup(func() { webFetcher = oldFetcher })
+	first := appState.ActiveChat
+
+	responses := captureJSONResponses(t, func() {
+		done := make(chan struct{})
+		go func() {
+			handleContextAddURL("req-url", map[string]any{"url": docs.URL + "/lib"})
+			close(done)
+		}()
+		<-started
+		stateMu.Lock()
+		if _, err := appState.ChatNew("second", ""); err != nil {
+			t.Errorf("ChatNew failed: %v", err)
+		}
+		stateMu.Unlock()
+		close(release)
+		<-done
+	})
+
+	resp := firstResponseByType(responses, "error")
+	if resp == nil || !strings.Contains(resp["message"].(string), "active chat changed") {
+		t.Fatalf("expected chat changed error, got %+v", responses)
+	}
+	if n := len(appState.ActiveChat.ContextFiles); n != 0 {
+		t.Errorf("document added to the new chat: %+v", appState.ActiveChat.ContextFiles)
+	}
+	if n := len(first.ContextFiles); n != 0 {
+		t.Errorf("document added to the old chat: %+v", first.ContextFiles)
+	}
+}
+
+func TestContextAddURLIntegration(t *testing.T) {
+	docs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><title>Lib Docs</title></head><body><h1>Lib</h1><p>Call <code>lib.Do()</code>.</p></body></html>")
+	}))
+	defer docs.Close()
+
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	oldFetcher := webFetcher
+	webFetcher = webdoc.NewFetcher(t.TempDir())
+	t.Cleanup(func() { webFetcher = oldFetcher })
+
+	docURL := docs.URL + "/lib#usage"
+	responses := captureJSONResponses(t, func() {
+		handleContextAddURL("req-url", map[string]any{"url": docURL})
+	})
+	ok := firstResponseByType(responses, "ok")
+	if ok == nil {
+		t.Fatalf("expected ok response, got %+v", responses)
+	}
+	wantPath := docs.URL + "/lib"
+	if ok["path"] != wantPath || ok["title"] != "Lib Docs" {
+		t.Fatalf("unexpected ok response: %+v", ok)
+	}
+
+	cf := appState.FindContextFile(wantPath)
+	if cf == nil || !cf.External || !cf.ReadOnly {
+		t.Fatalf("expected read-only external context entry, got %+v", cf)
+	}
+
+	// Adding the same URL again without refresh is rejected.
+	responses = captureJSONResponses(t, func() {
+		handleContextAddURL("req-url-2", map[string]any{"url": wantPath})
+	})
+	if firstResponseByType(responses, "error") == nil {
+		t.Fatalf("expected duplicate error, got %+v", responses)
+	}
+
+	// Refresh updates the existing entry in place.
+	responses = captureJSONResponses(t, func() {
+		handleContextAddURL("req-url-3", map[string]any{"url": wantPath, "refresh": true})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("expected ok on refresh, got %+v", responses)
+	}
+	if n := len(appState.ActiveChat.ContextFiles); n != 1 {
+		t.Fatalf("expected 1 context file after refresh, got %d", n)
+	}
+
+	if err := appState.AddUserMessage("how do I call it?", "test-model"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	msg, err := buildLLMUserMessage(nil, "search_replace")
+	if err != nil {
+		t.Fatalf("buildLLMUserMessage failed: %v", err)
+	}
+	if !strings.Contains(msg, "path="+wantPath+" mode=ro source=web") {
+		t.Fatalf("expected web file block in LLM message, got:\n%s", msg)
+	}
+	if !strings.Contains(msg, "Call `lib.Do()`.") {
+		t.Fatalf("expected converted document content in LLM message, got:\n%s", msg)
+	}
+}
+
+func TestHandleSendIntegrationImageAttachments(t *testing.T) {
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": []any{
+					map[string]any{
+						"id":           "vision-model",
+						"architecture": map[string]any{"input_modalities": []any{"text", "image"}},
+					},
+					map[string]any{
+						"id":           "text-model",
+						"architecture": map[string]any{"input_modalities": []any{"text"}},
+					},
+				},
+			})
+		case "/chat/completions":
+			body, _ := io.ReadAll(r.Body)
+			var reqBody map[string]any
+			json.Unmarshal(body, &reqBody)
+			if stream, _ := reqBody["stream"].(bool); !stream {
+				// Title generation
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{
+					"choices": []any{
+						map[string]any{"message": map[string]any{"content": "Image Title"}},
+					},
+				})
+				return
+			}
+			requestBody = body
+			w.Header().Set("Content-Type", "text/event-stream")
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{
+					map[string]any{"delta": map[string]any{"content": "The button is misaligned."}},
+				},
+			})
+			writeSSEDone(t, w)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer func() {
+		// Wait briefly for async title generation goroutine to complete
+		time.Sleep(50 * time.Millisecond)
+		server.Close()
+	}()
+
+	setupSendIntegrationEnv(t, server.URL)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appState.ProjectRoot, "shot.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write image failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		handleContextAddImage("req-img", map[string]any{"path": "shot.png"})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("expected ok response, got %+v", responses)
+	}
+
+	// Text-only model is rejected before the message is recorded.
+	messagesBefore := len(appState.ActiveChat.Messages)
+	if err := reserveChatStream("req-text"); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses = captureJSONResponses(t, func() {
+		handleSend("req-text", map[string]any{"content": "What is wrong?", "model": "text-model"})
+	})
+	errResp := firstResponseByType(responses, "error")
+	if errResp == nil || !strings.Contains(errResp["message"].(string), "does not support image input") {
+		t.Fatalf("expected image support error, got %+v", responses)
+	}
+	if n := len(appState.ActiveChat.Messages); n != messagesBefore {
+		t.Fatalf("expected %d messages after rejected send, got %d", messagesBefore, n)
+	}
+	if requestBody != nil {
+		t.Fatal("expected no completion request for text-only model")
+	}
+
+	if err := reserveChatStream("req-vision"); err != nil {
+		t.Fatalf("failed to reserve stream: %v", err)
+	}
+	responses = captureJSONResponses(t, func() {
+		handleSend("req-vision", map[string]any{"content": "What is wrong?", "model": "vision-model"})
+	})
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+
+	var sent struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(requestBody, &sent); err != nil {
+		t.Fatalf("decode request body failed: %v", err)
+	}
+	last := sent.Messages[len(sent.Messages)-1]
+	var parts []map[string]any
+	if err := json.Unmarshal(last.Content, &parts); err != nil {
+		t.Fatalf("expected multimodal content array, got %s", last.Content)
+	}
+	var marker, imageURL string
+	for _, p := range parts {
+		switch p["type"] {
+		case "text":
+			if text := p["text"].(string); strings.HasPrefix(text, "@image ") {
+				marker = text
+			}
+		case "image_url":
+			imageURL = p["image_url"].(map[string]any)["url"].(string)
+		}
+	}
+	if !strings.Contains(marker, "path=shot.png") {
+		t.Fatalf("expected @image marker for shot.png, got parts %+v", parts)
+	}
+	if !strings.HasPrefix(imageURL, "data:image/png;base64,") {
+		t.Fatalf("expected PNG data URL, got %q", imageURL)
+	}
+}
+
+func TestSendRejectsUnknownDiffMode(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setupSendIntegrationEnv(t, "")
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-send", "content": "hi", "diff_mode": "none"})
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-queue", "content": "hi", "diff_mode": "replace", "queue": true})
+	})
+
+	if n := countResponsesByType(responses, "error"); n != 2 {
+		t.Fatalf("expected both sends to be rejected, got %+v", responses)
+	}
+	for _, resp := range responses {
+		if resp["message"] != config.ErrInvalidDiffMode.Error() {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	}
+	if len(appState.ActiveChat.Messages) != 0 || activeChatStreaming() {
+		t.Errorf("rejected send was recorded or started: %+v", appState.ActiveChat.Messages)
+	}
+	if items, _ := appState.QueueList(); len(items) != 0 {
+		t.Errorf("rejected send was queued: %+v", items)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Send queue. Each send is recorded in the persisted queue while it runs (see
+// state.QueuedSend) and removed when it finishes, so a send cut off by a
+// backend exit shows up as interrupted in queue_list. A send with "queue":
+// true arriving while its chat streams is queued instead of rejected and
+// starts, under its original request ID, when the chat's stream finishes.
+
+var (
+	errQueueEntryBusy    = errors.New("this send belongs to another running BB-7 instance")
+	errQueueEntryRunning = errors.New("this send is already running")
+)
+
+// queuedSendFromRequest builds a queue entry for a send in the active chat.
+// Must be called with stateMu held.
+func queuedSendFromRequest(reqID string, req map[string]any) state.QueuedSend {
+	content, _ := req["content"].(string)
+	model, _ := req["model"].(string)
+	effort, _ := req["reasoning_effort"].(string)
+	diffMode, _ := req["diff_mode"].(string)
+	generation, _ := req["generation"].(map[string]any)
+	review, _ := req["review"].(bool)
+	return state.QueuedSend{
+		ChatID:          appState.ActiveChat.ID,
+		Global:          appState.ActiveChat.Global,
+		Content:         content,
+		Model:           model,
+		ReasoningEffort: effort,
+		DiffMode:        diffMode,
+		Generation:      generation,
+		Review:          review,
+		RequestID:       reqID,
+	}
+}
+
+// queuedSendRequest rebuilds the send request for a queue entry.
+func queuedSendRequest(entry state.QueuedSend) map[string]any {
+	req := map[string]any{
+		"content":  entry.Content,
+		"queue_id": entry.ID,
+		"resume":   entry.Recorded,
+	}
+	if entry.Model != "" {
+		req["model"] = entry.Model
+	}
+	if entry.ReasoningEffort != "" {
+		req["reasoning_effort"] = entry.ReasoningEffort
+	}
+	if entry.DiffMode != "" {
+		req["diff_mode"] = entry.DiffMode
+	}
+	if entry.Generation != nil {
+		req["generation"] = entry.Generation
+	}
+	if entry.Review {
+		req["review"] = true
+	}
+	return req
+}
+
+// recordRunningSend records a send in the queue while it streams and stores
+// the entry ID in req. Best-effort: a send is not refused because the queue
+// can't be written. Must be called with stateMu held.
+func recordRunningSend(reqID string, req map[string]any) {
+	entry := queuedSendFromRequest(reqID, req)
+	entry.Status = state.QueueRunning
+	entry, err := appState.QueueAdd(entry)
+	if err != nil {
+		log.Error("Failed to record send in queue: %v", err)
+		return
+	}
+	req["queue_id"] = entry.ID
+}
+
+// queueSend queues a send behind the active chat's running stream.
+// Must be called with stateMu held.
+func queueSend(reqID string, req map[string]any) {
+	if content, _ := req["content"].(string); content == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: content"})
+		return
+	}
+	entry, err := appState.QueueAdd(queuedSendFromRequest(reqID, req))
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "queued", "id": entry.ID, "chat_id": entry.ChatID})
+}
+
+// chatView returns a State bound to a chat for a stream: a view of the active
+// chat if it is that chat, else the chat opened on its own.
+// Must be called with stateMu held.
+func chatView(chatID string, global bool) (*state.State, error) {
+	if c := appState.ActiveChat; c != nil && c.ID == chatID && c.Global == global {
+		return appState.View()
+	}
+	if global {
+		return appState.OpenGlobalChat(chatID)
+	}
+	return appState.OpenChat(chatID)
+}
+
+// startQueuedSend starts a queue entry in its chat under reqID. When after
+// is set, the entry takes over that finished stream's place in the chat
+// instead of reserving a free one.
+// Must be called with stateMu held.
+func startQueuedSend(reqID string, entry state.QueuedSend, after string) error {
+	if after == "" && streams.active(entry.ChatID) {
+		return errChatStreaming
+	}
+	st, err := chatView(entry.ChatID, entry.Global)
+	if err != nil {
+		return err
+	}
+	if after != "" {
+		prev, ok := streams.handover(after, reqID, st)
+		if !ok {
+			st.Cleanup()
+			return errChatStreaming
+		}
+		if prev != nil {
+			prev.Cleanup()
+		}
+	} else if !streams.reserve(reqID, entry.ChatID, st) {
+		st.Cleanup()
+		return errChatStreaming
+	}
+	entry, err = appState.QueueUpdate(entry.ID, func(q *state.QueuedSend) {
+		q.Status = state.QueueRunning
+		q.RequestID = reqID
+	})
+	if err != nil {
+		streams.clear(reqID)
+		return err
+	}
+	go handleSend(reqID, queuedSendRequest(entry))
+	return nil
+}
+
+// finishSend drops a finished send's queue entry and hands its chat to the
+// next send queued there, or releases the chat's stream if there is none.
+func finishSend(reqID, queueID string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if queueID != "" {
+		if err := appState.QueueRemove(queueID); err != nil && !errors.Is(err, state.ErrQueueEntryNotFound) {
+			log.Error("Failed to remove send from queue: %v", err)
+		}
+	}
+	if st := streams.view(reqID); st != nil && st.ActiveChat != nil {
+		if next, ok := appState.QueueNext(st.ActiveChat.ID, st.ActiveChat.Global); ok {
+			err := startQueuedSend(next.RequestID, next, reqID)
+			if err == nil {
+				return
+			}
+			log.Error("Failed to start queued send %s: %v", next.ID, err)
+		}
+	}
+	streams.clear(reqID)
+}
+
+func handleQueueList(reqID string, req map[string]any) {
+	items, err := appState.QueueList()
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if chatID, _ := req["chat_id"].(string); chatID != "" {
+		filtered := []state.QueuedSend{}
+		for _, item := range items {
+			if item.ChatID == chatID {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+	respond(reqID, map[string]any{"type": "queue", "items": items})
+}
+
+func handleQueueCancel(reqID string, req map[string]any) {
+	id, _ := req["id"].(string)
+	if id == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+		return
+	}
+	entry, err := appState.QueueGet(id)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if entry.Status == state.QueueRunning {
+		// finishSend removes the entry once the stream has stopped.
+		if !entry.Owned() || !streams.cancel(entry.RequestID) {
+			respond(reqID, errorResponse(errQueueEntryBusy))
+			return
+		}
+		respond(reqID, map[string]any{"type": "ok"})
+		return
+	}
+	if err := appState.QueueRemove(id); err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{"type": "ok"})
+}
+
+// handleQueueResume starts an interrupted or queued send now, or queues it
+// behind its chat's running stream. Its stream events carry this request's ID.
+func handleQueueResume(reqID string, req map[string]any) {
+	id, _ := req["id"].(string)
+	if id == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: id"})
+		return
+	}
+	entry, err := appState.QueueGet(id)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if entry.Status == state.QueueRunning && entry.Owned() {
+		respond(reqID, errorResponse(errQueueEntryRunning))
+		return
+	}
+	if !entry.Owned() && !entry.Orphaned() {
+		respond(reqID, errorResponse(errQueueEntryBusy))
+		return
+	}
+	// Take the entry over: it now belongs to this backend and request.
+	entry, err = appState.QueueUpdate(id, func(q *state.QueuedSend) {
+		q.Status = state.QueueQueued
+		q.RequestID = reqID
+		q.Claim()
+	})
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	if streams.active(entry.ChatID) {
+		respond(reqID, map[string]any{"type": "queued", "id": entry.ID, "chat_id": entry.ChatID})
+		return
+	}
+	if err := startQueuedSend(reqID, entry, ""); err != nil {
+		respond(reqID, errorResponse(err))
+	}
+}
+
+// endsWithUserMessage reports whether a chat's last message is a user message
+// with the given text, i.e. a send whose reply never arrived.
+func endsWithUserMessage(chat *state.Chat, content string) bool {
+	if len(chat.Messages) == 0 {
+		return false
+	}
+	last := chat.Messages[len(chat.Messages)-1]
+	return last.Role == "user" && state.MessageText(last) == content
+}
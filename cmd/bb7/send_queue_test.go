@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func sendQueueRequest(req map[string]any) {
+	line, _ := json.Marshal(req)
+	handleRequest(string(line))
+}
+
+func TestQueuedSendRunsAfterCurrentStream(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch {
+		case strings.Contains(string(body), "test-title-model"):
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.Contains(string(body), "follow-up"):
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{map[string]any{"delta": map[string]any{"content": "Second answer"}}},
+			})
+			writeSSEDone(t, w)
+		case strings.Contains(string(body), "first question"):
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{map[string]any{"delta": map[string]any{"content": "First answer"}}},
+			})
+			close(started)
+			<-release
+			writeSSEDone(t, w)
+		}
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-1", "content": "first question", "model": "test-model"})
+		<-started
+		sendQueueRequest(map[string]any{"action": "send", "request_id": "req-2", "content": "follow-up", "model": "test-model", "queue": true})
+		stateMu.Lock()
+		items, _ := appState.QueueList()
+		stateMu.Unlock()
+		if len(items) != 2 || items[1].Status != state.QueueQueued {
+			t.Errorf("queue while streaming = %+v", items)
+		}
+		close(release)
+		waitForStreams(t)
+	})
+
+	var queued, done []string
+	for _, resp := range responses {
+		switch resp["type"] {
+		case "queued":
+			queued = append(queued, resp["request_id"].(string))
+		case "done":
+			done = append(done, resp["request_id"].(string))
+		}
+	}
+	if len(queued) != 1 || queued[0] != "req-2" {
+		t.Errorf("queued responses = %v", queued)
+	}
+	if len(done) != 2 || done[0] != "req-1" || done[1] != "req-2" {
+		t.Fatalf("done responses = %v, all: %+v", done, responses)
+	}
+
+	var texts []string
+	for _, msg := range appState.ActiveChat.Messages {
+		texts = append(texts, msg.Role+":"+state.MessageText(msg))
+	}
+	want := []string{"user:first question", "assistant:First answer", "user:follow-up", "assistant:Second answer"}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %v, want %v", texts, want)
+	}
+	if items, _ := appState.QueueList(); len(items) != 0 {
+		t.Errorf("queue should be empty after both sends, got %+v", items)
+	}
+}
+
+func TestQueueResumeInterruptedSend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Resumed answer"}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+
+	// A send whose backend exited after recording the user message.
+	if err := appState.AddUserMessage("interrupted question", "test-model"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	entry, err := appState.QueueAdd(state.QueuedSend{
+		ChatID:  appState.ActiveChat.ID,
+		Content: "interrupted question",
+		Status:  state.QueueRunning,
+	})
+	if err != nil {
+		t.Fatalf("QueueAdd failed: %v", err)
+	}
+	appState.QueueUpdate(entry.ID, func(q *state.QueuedSend) {
+		q.Recorded = true
+		q.Owner = "exited-backend"
+	})
+	if n := appState.QueueResumable(); n != 1 {
+		t.Fatalf("QueueResumable = %d, want 1", n)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "queue_resume", "request_id": "req-resume", "id": entry.ID})
+		waitForStreams(t)
+	})
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+	msgs := appState.ActiveChat.Messages
+	if len(msgs) != 2 || state.MessageText(msgs[1]) != "Resumed answer" {
+		t.Fatalf("expected the recorded message to be answered once, got %+v", msgs)
+	}
+	if _, err := appState.QueueGet(entry.ID); err == nil {
+		t.Error("resumed send should leave the queue")
+	}
+}
+
+func TestQueueCancelRemovesQueuedSend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	entry, _ := appState.QueueAdd(state.QueuedSend{ChatID: appState.ActiveChat.ID, Content: "later"})
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "queue_cancel", "request_id": "req-c", "id": entry.ID})
+		sendQueueRequest(map[string]any{"action": "queue_list", "request_id": "req-l"})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("expected ok, got %+v", responses)
+	}
+	list := firstResponseByType(responses, "queue")
+	if list == nil || len(list["items"].([]any)) != 0 {
+		t.Errorf("queue_list after cancel = %+v", list)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForStreams polls until no chat is streaming.
+func waitForStreams(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		// A finishing send hands its chat to the next queued one under
+		// stateMu, so the registry only empties once the whole chain is done;
+		// taking stateMu also waits for the last finishSend to return.
+		stateMu.Lock()
+		streams.mu.Lock()
+		n := len(streams.byChat)
+		streams.mu.Unlock()
+		stateMu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("streams did not finish")
+}
+
+func TestStreamsInDifferentChatsRunConcurrently(t *testing.T) {
+	startedA := make(chan struct{})
+	startedB := make(chan struct{})
+	releaseA := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch {
+		case strings.Contains(string(body), "test-title-model"):
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.Contains(string(body), "question for A"):
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{map[string]any{"delta": map[string]any{"content": "Answer A"}}},
+			})
+			close(startedA)
+			<-releaseA
+			writeSSEDone(t, w)
+		case strings.Contains(string(body), "question for B"):
+			writeSSEJSON(t, w, map[string]any{
+				"choices": []any{map[string]any{"delta": map[string]any{"content": "Partial B"}}},
+			})
+			close(startedB)
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+	chatA := appState.ActiveChat.ID
+
+	request := func(req map[string]any) {
+		line, _ := json.Marshal(req)
+		handleRequest(string(line))
+	}
+
+	var chatB string
+	responses := captureJSONResponses(t, func() {
+		request(map[string]any{"action": "send", "request_id": "req-a", "content": "question for A", "model": "test-model"})
+		<-startedA
+
+		// Chat A is streaming; switching away and starting chat B is allowed.
+		request(map[string]any{"action": "chat_new", "request_id": "req-new", "name": "other"})
+		chatB = appState.ActiveChat.ID
+		request(map[string]any{"action": "chat_delete", "request_id": "req-del", "id": chatA})
+		request(map[string]any{"action": "send", "request_id": "req-b", "content": "question for B", "model": "test-model"})
+		<-startedB
+
+		// Cancel chat B by ID; chat A keeps streaming.
+		request(map[string]any{"action": "cancel", "request_id": "req-cancel", "chat_id": chatB})
+		close(releaseA)
+		waitForStreams(t)
+	})
+
+	byID := make(map[string][]map[string]any)
+	for _, resp := range responses {
+		id, _ := resp["request_id"].(string)
+		byID[id] = append(byID[id], resp)
+	}
+	if firstResponseByType(byID["req-new"], "ok") == nil {
+		t.Fatalf("chat_new failed during stream: %+v", byID["req-new"])
+	}
+	if firstResponseByType(byID["req-del"], "error") == nil {
+		t.Errorf("expected deleting the streaming chat to fail, got %+v", byID["req-del"])
+	}
+	if firstResponseByType(byID["req-cancel"], "ok") == nil {
+		t.Errorf("expected cancel by chat_id to succeed, got %+v", byID["req-cancel"])
+	}
+	if firstResponseByType(byID["req-a"], "done") == nil {
+		t.Fatalf("expected chat A to finish, got %+v", byID["req-a"])
+	}
+	if done := firstResponseByType(byID["req-b"], "done"); done != nil {
+		t.Errorf("expected chat B to be canceled, got %+v", done)
+	}
+
+	if appState.ActiveChat.ID != chatB {
+		t.Fatalf("active chat = %s, want %s", appState.ActiveChat.ID, chatB)
+	}
+	for _, msg := range appState.ActiveChat.Messages {
+		for _, part := range msg.Parts {
+			if strings.Contains(part.Content, "Answer A") {
+				t.Fatalf("chat A's reply leaked into chat B: %+v", msg)
+			}
+		}
+	}
+	view, err := appState.OpenChat(chatA)
+	if err != nil {
+		t.Fatalf("OpenChat failed: %v", err)
+	}
+	defer view.Cleanup()
+	msgs := view.ActiveChat.Messages
+	if len(msgs) != 2 || msgs[1].Role != "assistant" || !strings.Contains(msgs[1].Parts[0].Content, "Answer A") {
+		t.Fatalf("chat A messages = %+v", msgs)
+	}
+}
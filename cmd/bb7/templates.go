@@ -0,0 +1,85 @@
+package main
+
+import "github.com/youruser/bb7/internal/state"
+
+// Prompt templates (see state.Template). template_list and template_render
+// expose them to the plugin; a send with a "template" field is rendered here
+// before it is recorded, so queued and resumed sends carry the final text.
+
+func handleTemplateList(reqID string) {
+	templates, err := appState.ListTemplates()
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{
+		"type":      "templates",
+		"templates": templates,
+		"variables": state.TemplateVariables,
+	})
+}
+
+func handleTemplateRender(reqID string, req map[string]any) {
+	name, _ := req["name"].(string)
+	if name == "" {
+		respond(reqID, map[string]any{"type": "error", "message": "Missing required field: name"})
+		return
+	}
+	rendered, err := appState.RenderTemplate(name, templateVariablesFor(req["variables"]))
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	respond(reqID, map[string]any{
+		"type":             "template",
+		"name":             name,
+		"content":          rendered.Content,
+		"model":            rendered.Model,
+		"reasoning_effort": rendered.ReasoningEffort,
+		"diff_mode":        rendered.DiffMode,
+	})
+}
+
+// applySendTemplate renders the template named in a send request into its
+// content. The request's content becomes the template's {{input}} unless the
+// variables set it. The template's model, reasoning effort and diff mode
+// replace the request's. Must be called with stateMu held.
+func applySendTemplate(req map[string]any) error {
+	name, _ := req["template"].(string)
+	if name == "" {
+		return nil
+	}
+	vars := templateVariablesFor(req["variables"])
+	if content, _ := req["content"].(string); content != "" && vars["input"] == "" {
+		vars["input"] = content
+	}
+	rendered, err := appState.RenderTemplate(name, vars)
+	if err != nil {
+		return err
+	}
+	req["content"] = rendered.Content
+	if rendered.Model != "" {
+		req["model"] = rendered.Model
+	}
+	if rendered.ReasoningEffort != "" {
+		req["reasoning_effort"] = rendered.ReasoningEffort
+	}
+	if rendered.DiffMode != "" {
+		req["diff_mode"] = rendered.DiffMode
+	}
+	delete(req, "template")
+	return nil
+}
+
+// templateVariablesFor converts a request's "variables" object into template
+// variables, ignoring non-string values.
+func templateVariablesFor(raw any) map[string]string {
+	vars := map[string]string{}
+	obj, _ := raw.(map[string]any)
+	for key, value := range obj {
+		if s, ok := value.(string); ok {
+			vars[key] = s
+		}
+	}
+	return vars
+}
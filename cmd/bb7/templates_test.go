@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestSendRendersTemplate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if strings.Contains(string(body), "test-title-model") {
+			// Title generation is not under test.
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		bodies <- string(body)
+		writeSSEJSON(t, w, map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"content": "Reviewed"}}},
+		})
+		writeSSEDone(t, w)
+	}))
+	defer server.Close()
+	setupSendIntegrationEnv(t, server.URL)
+
+	dir := filepath.Join(appState.ProjectRoot, ".bb7", "templates")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	template := "---\nmodel: test-reviewer\n---\nReview {{file}}:\n{{selection}}\n"
+	if err := os.WriteFile(filepath.Join(dir, "review.md"), []byte(template), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "template_list", "request_id": "req-list"})
+		sendQueueRequest(map[string]any{
+			"action":     "send",
+			"request_id": "req-send",
+			"template":   "review",
+			"content":    "Be brief.",
+			"model":      "test-model",
+			"variables":  map[string]any{"file": "main.go", "selection": "x := 1"},
+		})
+		waitForStreams(t)
+	})
+
+	list := firstResponseByType(responses, "templates")
+	if list == nil || len(list["templates"].([]any)) != 1 {
+		t.Fatalf("template_list = %+v", list)
+	}
+	if firstResponseByType(responses, "done") == nil {
+		t.Fatalf("expected done response, got %+v", responses)
+	}
+	if body := <-bodies; !strings.Contains(body, `"model":"test-reviewer"`) {
+		t.Errorf("template model not used in request: %s", body)
+	}
+	msgs := appState.ActiveChat.Messages
+	want := "Review main.go:\nx := 1\n\nBe brief."
+	if len(msgs) != 2 || state.MessageText(msgs[0]) != want {
+		t.Fatalf("user message = %+v, want %q", msgs, want)
+	}
+}
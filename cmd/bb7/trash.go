@@ -0,0 +1,117 @@
+package main
+
+import (
+	"time"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+// defaultTrashRetentionDays applies when the config has not been loaded.
+const defaultTrashRetentionDays = 30
+
+// trashRetention returns how long deleted chats stay in the trash.
+func trashRetention() time.Duration {
+	days := defaultTrashRetentionDays
+	if appConfig != nil && appConfig.TrashRetentionDays != nil {
+		days = *appConfig.TrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeExpiredTrash removes chats past the retention period from the
+// project and global trash. Failures only mean the trash is purged later.
+func purgeExpiredTrash() {
+	if !appState.GlobalOnly {
+		if _, err := appState.PurgeTrash(false, trashRetention()); err != nil {
+			log.Warn("purging trash: %v", err)
+		}
+	}
+	if _, err := appState.PurgeTrash(true, trashRetention()); err != nil {
+		log.Warn("purging global trash: %v", err)
+	}
+}
+
+// handleChatBulk archives, unarchives, or deletes every chat a filter
+// selects: older_than_days, name (a glob), and empty (no messages sent)
+// combine. With dry_run the chats are only listed. The active chat, chats
+// open elsewhere, and chats with a running stream are skipped and reported.
+// Must be called with stateMu held.
+func handleChatBulk(reqID string, req map[string]any) {
+	operation, _ := req["operation"].(string)
+	global, _ := req["global"].(bool)
+	global = global || appState.GlobalOnly
+	filter := state.ChatFilter{}
+	if days, ok := req["older_than_days"].(float64); ok {
+		if days <= 0 {
+			respond(reqID, map[string]any{"type": "error", "message": "older_than_days must be positive"})
+			return
+		}
+		filter.OlderThan = time.Duration(days * float64(24*time.Hour))
+	}
+	filter.Name, _ = req["name"].(string)
+	filter.Empty, _ = req["empty"].(bool)
+	filter.Archived, _ = req["archived"].(bool)
+
+	var apply func(id string) error
+	switch operation {
+	case "archive":
+		filter.Archived = false
+		apply = func(id string) error { return appState.ChatArchive(id, global, true) }
+	case "unarchive":
+		filter.Archived = true
+		apply = func(id string) error { return appState.ChatArchive(id, global, false) }
+	case "delete":
+		apply = func(id string) error {
+			if global {
+				return appState.ChatDeleteGlobal(id)
+			}
+			return appState.ChatDelete(id)
+		}
+	default:
+		respond(reqID, map[string]any{"type": "error", "message": "Missing or invalid field: operation (must be 'archive', 'unarchive', or 'delete')"})
+		return
+	}
+
+	matched, err := appState.MatchChats(global, filter)
+	if err != nil {
+		respond(reqID, errorResponse(err))
+		return
+	}
+	dryRun, _ := req["dry_run"].(bool)
+	done := []state.ChatSummary{}
+	skipped := []map[string]any{}
+	skip := func(chat state.ChatSummary, reason string) {
+		skipped = append(skipped, map[string]any{"id": chat.ID, "name": chat.Name, "reason": reason})
+	}
+	for _, chat := range matched {
+		active := appState.ActiveChat != nil && appState.ActiveChat.ID == chat.ID && appState.ActiveChat.Global == global
+		switch {
+		case chat.Locked:
+			skip(chat, "open in another session")
+		case streams.active(chat.ID):
+			skip(chat, "a response is streaming")
+		case active && operation == "delete":
+			skip(chat, "active chat")
+		case dryRun:
+			done = append(done, chat)
+		default:
+			if err := apply(chat.ID); err != nil {
+				skip(chat, err.Error())
+				continue
+			}
+			done = append(done, chat)
+		}
+	}
+	if operation == "delete" && !dryRun && len(done) > 0 {
+		if _, err := appState.PurgeTrash(global, trashRetention()); err != nil {
+			log.Warn("purging trash: %v", err)
+		}
+	}
+	log.Info("chat_bulk %s: %d chats, %d skipped (dry_run=%v)", operation, len(done), len(skipped), dryRun)
+	respond(reqID, map[string]any{
+		"type":    "chat_bulk",
+		"chats":   done,
+		"skipped": skipped,
+		"dry_run": dryRun,
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestChatBulkDeleteAndRestore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	activeID := appState.ActiveChat.ID
+	var scratch []string
+	for _, name := range []string{"Scratch a", "Scratch b"} {
+		chat, err := appState.ChatNew(name, "")
+		if err != nil {
+			t.Fatalf("ChatNew failed: %v", err)
+		}
+		scratch = append(scratch, chat.ID)
+	}
+	if _, err := appState.ChatSelect(activeID); err != nil {
+		t.Fatalf("ChatSelect failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_bulk", "request_id": "req-1", "operation": "delete", "name": "scratch*", "dry_run": true})
+	})
+	resp := firstResponseByType(responses, "chat_bulk")
+	if resp == nil || len(resp["chats"].([]any)) != 2 {
+		t.Fatalf("dry run = %+v", responses)
+	}
+	if chats, _ := appState.ChatList(); len(chats) != 3 {
+		t.Fatalf("dry run deleted chats: %+v", chats)
+	}
+
+	// Every chat is empty; the active one is skipped.
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_bulk", "request_id": "req-2", "operation": "delete", "empty": true})
+	})
+	resp = firstResponseByType(responses, "chat_bulk")
+	if resp == nil || len(resp["chats"].([]any)) != 2 || len(resp["skipped"].([]any)) != 1 {
+		t.Fatalf("bulk delete = %+v", responses)
+	}
+	if chats, _ := appState.ChatList(); len(chats) != 1 || chats[0].ID != activeID {
+		t.Fatalf("chats after bulk delete = %+v", chats)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "trash_list", "request_id": "req-3"})
+		sendQueueRequest(map[string]any{"action": "chat_restore", "request_id": "req-4", "id": scratch[0]})
+	})
+	resp = firstResponseByType(responses, "trash_list")
+	if resp == nil || len(resp["chats"].([]any)) != 2 || resp["retention_days"] != float64(30) {
+		t.Fatalf("trash_list = %+v", responses)
+	}
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("chat_restore failed: %+v", responses)
+	}
+	if chats, _ := appState.ChatList(); len(chats) != 2 {
+		t.Fatalf("chats after restore = %+v", chats)
+	}
+
+	responses = captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_bulk", "request_id": "req-5", "operation": "archive"})
+	})
+	if firstResponseByType(responses, "error") == nil {
+		t.Fatalf("bulk archive without a filter = %+v", responses)
+	}
+}
+
+func TestChatDeleteWithoutRetention(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	zero := 0
+	appConfig.TrashRetentionDays = &zero
+	id := appState.ActiveChat.ID
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "chat_delete", "request_id": "req-1", "id": id})
+	})
+	if firstResponseByType(responses, "ok") == nil {
+		t.Fatalf("chat_delete = %+v", responses)
+	}
+	if trashed, _ := appState.TrashList(false); len(trashed) != 0 {
+		t.Errorf("chat kept in the trash with retention 0: %+v", trashed)
+	}
+}
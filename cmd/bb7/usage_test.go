@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func TestProjectUsageAction(t *testing.T) {
+	setupSendIntegrationEnv(t, "http://127.0.0.1:0")
+	if err := appState.AddUserMessage("q", "m"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	usage := &state.MessageUsage{PromptTokens: 400, CompletionTokens: 50, CachedTokens: 100, Cost: 0.02}
+	if err := appState.AddAssistantMessage([]state.MessagePart{{Type: "text", Content: "a"}}, nil, "m", usage); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+
+	responses := captureJSONResponses(t, func() {
+		sendQueueRequest(map[string]any{"action": "project_usage", "request_id": "req-1"})
+	})
+	resp := firstResponseByType(responses, "project_usage")
+	if resp == nil {
+		t.Fatalf("responses = %+v", responses)
+	}
+	totals, _ := resp["usage"].(map[string]any)
+	if totals["chats"] != float64(1) || totals["messages"] != float64(2) || totals["prompt_tokens"] != float64(400) ||
+		totals["cache_hit_ratio"] != 0.25 || totals["cost"] != 0.02 {
+		t.Errorf("usage = %+v", totals)
+	}
+}
@@ -490,7 +490,7 @@ func runTest(client *llm.Client, model, mode string, tc testCase, index, total i
 	var rawSSEData []string
 
 	start := time.Now()
-	err := client.ChatStream(ctx, model, systemPrompt, messages, nil, diffMode, "", func(event llm.StreamEvent) {
+	err := client.ChatStream(ctx, model, systemPrompt, messages, nil, llm.GenerationParams{}, llm.DefaultTools(diffMode), "", func(event llm.StreamEvent) {
 		switch event.Type {
 		case "raw":
 			rawSSEData = append(rawSSEData, event.Raw)
@@ -500,6 +500,11 @@ func runTest(client *llm.Client, model, mode string, tc testCase, index, total i
 			assistantReasoning.WriteString(event.Reasoning)
 		case "tool_call":
 			toolCalls = append(toolCalls, event.ToolCall)
+		case llm.FinishReasonLength:
+			// Score a call cut off by the output limit as written
+			if event.ToolCall != nil {
+				toolCalls = append(toolCalls, event.ToolCall)
+			}
 		case "done":
 			usage = event.Usage
 		}
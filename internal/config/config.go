@@ -3,32 +3,59 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+
+	"github.com/youruser/bb7/internal/llm"
 )
 
 var (
-	ErrNoConfig        = errors.New("config file not found")
-	ErrNoAPIKey        = errors.New("api_key not set in config")
-	ErrInvalidJSON     = errors.New("invalid config JSON")
-	ErrInvalidDiffMode = errors.New("diff_mode must be \"search_replace\", \"search_replace_multi\", \"anchored\", or \"off\"")
+	ErrNoConfig                = errors.New("config file not found")
+	ErrNoAPIKey                = errors.New("api_key not set in config")
+	ErrInvalidJSON             = errors.New("invalid config JSON")
+	ErrInvalidDiffMode         = errors.New("diff_mode must be \"search_replace\", \"search_replace_multi\", \"anchored\", or \"off\"")
+	ErrInvalidMaxContinuations = errors.New("max_continuations must be between 0 and 10")
+	ErrInvalidTrashRetention   = errors.New("trash_retention_days cannot be negative")
+	ErrInvalidPersona          = errors.New("persona names must be non-empty, and reasoning_effort must be \"low\", \"medium\", \"high\", or unset")
+	ErrInvalidSecretScan       = errors.New("secret_scan must be \"off\", \"warn\", \"redact\", or \"block\"")
+	ErrInvalidSecretPattern    = errors.New("invalid secret_patterns regex")
 )
 
 // Config holds the global BB-7 configuration.
 type Config struct {
-	APIKey                string  `json:"api_key"`
-	BaseURL               string  `json:"base_url"`
-	DefaultModel          string  `json:"default_model"`
-	TitleModel            string  `json:"title_model"`              // Model for auto-generating chat titles (cheap/fast)
-	AllowDataRetention    *bool   `json:"allow_data_retention"`     // Allow providers that retain data (default: true)
-	AllowTraining         *bool   `json:"allow_training"`           // Allow providers that train on data (default: false)
-	DiffMode              *string `json:"diff_mode"`                // Diff tool mode: "search_replace_multi", "search_replace", "anchored", or "off"
-	ExplicitCacheKey      *bool   `json:"explicit_cache_key"`       // Send prompt_cache_key with chat requests (default: false)
-	AutoRetryPartialEdits *bool   `json:"auto_retry_partial_edits"` // Hidden repair retry after partial diff apply failures (default: false)
+	APIKey                string   `json:"api_key"`
+	BaseURL               string   `json:"base_url"`
+	DefaultModel          string   `json:"default_model"`
+	TitleModel            string   `json:"title_model"`              // Model for auto-generating chat titles (cheap/fast)
+	AllowDataRetention    *bool    `json:"allow_data_retention"`     // Allow providers that retain data (default: true)
+	AllowTraining         *bool    `json:"allow_training"`           // Allow providers that train on data (default: false)
+	DiffMode              *string  `json:"diff_mode"`                // Diff tool mode: "search_replace_multi", "search_replace", "anchored", or "off"
+	ExplicitCacheKey      *bool    `json:"explicit_cache_key"`       // Send prompt_cache_key with chat requests (default: false)
+	AutoRetryPartialEdits *bool    `json:"auto_retry_partial_edits"` // Hidden repair retry after partial diff apply failures (default: false)
+	MaxContinuations      *int     `json:"max_continuations"`        // Continuation requests when a response hits the output limit (default: 2, 0 disables)
+	TrashRetentionDays    *int     `json:"trash_retention_days"`     // Days deleted chats stay in the trash (default: 30, 0 deletes immediately)
+	SuggestTags           *bool    `json:"suggest_tags"`             // Let title_model tag new chats (default: false)
+	SecretScan            *string  `json:"secret_scan"`              // What to do with secrets found in a request: "off", "warn" (default), "redact", or "block"
+	SecretPatterns        []string `json:"secret_patterns"`          // Extra regexes for secrets; the first group, if any, is the secret
+
+	Personas   map[string]Persona   `json:"personas"`   // Named personas a chat can select
+	Generation llm.GenerationParams `json:"generation"` // Default output limit and sampling parameters
 
 	DefaultModelExplicit bool `json:"-"` // true if user explicitly set default_model in config
 }
 
+// Persona is a named assistant role. Its system prompt fragment is added to
+// the system prompt of chats that select it; its model and reasoning effort
+// become the chat's settings when it is selected.
+type Persona struct {
+	Description     string `json:"description"`
+	SystemPrompt    string `json:"system_prompt"`
+	Model           string `json:"model"`
+	ReasoningEffort string `json:"reasoning_effort"`
+}
+
 // Load reads the config from ~/.config/bb7/config.json.
 func Load() (*Config, error) {
 	homeDir, err := os.UserHomeDir()
@@ -89,12 +116,66 @@ func LoadFrom(path string) (*Config, error) {
 		f := false
 		cfg.AutoRetryPartialEdits = &f
 	}
-	switch *cfg.DiffMode {
-	case "search_replace", "search_replace_multi", "anchored", "off":
+	if cfg.MaxContinuations == nil {
+		n := 2
+		cfg.MaxContinuations = &n
+	}
+	if *cfg.MaxContinuations < 0 || *cfg.MaxContinuations > 10 {
+		return nil, ErrInvalidMaxContinuations
+	}
+	if cfg.TrashRetentionDays == nil {
+		n := 30
+		cfg.TrashRetentionDays = &n
+	}
+	if *cfg.TrashRetentionDays < 0 {
+		return nil, ErrInvalidTrashRetention
+	}
+	if cfg.SuggestTags == nil {
+		f := false
+		cfg.SuggestTags = &f
+	}
+	if cfg.SecretScan == nil {
+		mode := "warn"
+		cfg.SecretScan = &mode
+	}
+	switch *cfg.SecretScan {
+	case "off", "warn", "redact", "block":
 		// valid
 	default:
+		return nil, ErrInvalidSecretScan
+	}
+	for _, pattern := range cfg.SecretPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidSecretPattern, pattern, err)
+		}
+	}
+	if !ValidDiffMode(*cfg.DiffMode) {
 		return nil, ErrInvalidDiffMode
 	}
+	if err := cfg.Generation.Validate(); err != nil {
+		return nil, fmt.Errorf("generation: %w", err)
+	}
+	for name, persona := range cfg.Personas {
+		if name == "" {
+			return nil, ErrInvalidPersona
+		}
+		switch persona.ReasoningEffort {
+		case "", "low", "medium", "high":
+			// valid
+		default:
+			return nil, ErrInvalidPersona
+		}
+	}
 
 	return &cfg, nil
 }
+
+// ValidDiffMode reports whether mode is a supported diff_mode, for config.json
+// and for the diff_mode of a single send.
+func ValidDiffMode(mode string) bool {
+	switch mode {
+	case "search_replace", "search_replace_multi", "anchored", "off":
+		return true
+	}
+	return false
+}
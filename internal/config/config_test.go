@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/youruser/bb7/internal/llm"
 )
 
 func TestLoadFrom(t *testing.T) {
@@ -46,6 +49,66 @@ func TestLoadFrom(t *testing.T) {
 		}
 	})
 
+	t.Run("personas", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{
+			"api_key": "sk-test-123",
+			"personas": {
+				"reviewer": {"description": "Code review", "system_prompt": "Be critical.", "model": "gpt-4", "reasoning_effort": "high"},
+				"terse": {"system_prompt": "Answer in one paragraph."}
+			}
+		}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := LoadFrom(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reviewer := cfg.Personas["reviewer"]
+		if reviewer.SystemPrompt != "Be critical." || reviewer.Model != "gpt-4" || reviewer.ReasoningEffort != "high" {
+			t.Errorf("reviewer = %+v", reviewer)
+		}
+		if _, ok := cfg.Personas["terse"]; !ok {
+			t.Error("terse persona missing")
+		}
+
+		bad := `{"api_key": "sk-test-123", "personas": {"x": {"reasoning_effort": "max"}}}`
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFrom(path); err != ErrInvalidPersona {
+			t.Errorf("err = %v, want ErrInvalidPersona", err)
+		}
+	})
+
+	t.Run("generation", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{"api_key": "sk-test-123", "generation": {"max_tokens": 4096, "temperature": 0.2, "reasoning_exclude": true}}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFrom(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		g := cfg.Generation
+		if g.MaxTokens != 4096 || g.Temperature == nil || *g.Temperature != 0.2 || g.ReasoningExclude == nil || !*g.ReasoningExclude {
+			t.Errorf("generation = %+v", g)
+		}
+
+		bad := `{"api_key": "sk-test-123", "generation": {"top_p": 1.5}}`
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFrom(path); !errors.Is(err, llm.ErrInvalidGenerationParams) {
+			t.Errorf("err = %v, want ErrInvalidGenerationParams", err)
+		}
+	})
+
 	t.Run("defaults applied", func(t *testing.T) {
 		dir := t.TempDir()
 		path := filepath.Join(dir, "config.json")
@@ -77,6 +140,70 @@ func TestLoadFrom(t *testing.T) {
 		if cfg.AutoRetryPartialEdits == nil || *cfg.AutoRetryPartialEdits {
 			t.Errorf("AutoRetryPartialEdits should default to false, got %v", cfg.AutoRetryPartialEdits)
 		}
+		if cfg.MaxContinuations == nil || *cfg.MaxContinuations != 2 {
+			t.Errorf("MaxContinuations should default to 2, got %v", cfg.MaxContinuations)
+		}
+		if cfg.TrashRetentionDays == nil || *cfg.TrashRetentionDays != 30 {
+			t.Errorf("TrashRetentionDays should default to 30, got %v", cfg.TrashRetentionDays)
+		}
+		if cfg.SuggestTags == nil || *cfg.SuggestTags {
+			t.Errorf("SuggestTags should default to false, got %v", cfg.SuggestTags)
+		}
+		if cfg.SecretScan == nil || *cfg.SecretScan != "warn" {
+			t.Errorf("SecretScan should default to \"warn\", got %v", cfg.SecretScan)
+		}
+	})
+
+	t.Run("secret_scan invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{"api_key": "sk-test-123", "secret_scan": "ignore"}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadFrom(path); err != ErrInvalidSecretScan {
+			t.Errorf("err = %v, want ErrInvalidSecretScan", err)
+		}
+	})
+
+	t.Run("secret_patterns invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{"api_key": "sk-test-123", "secret_patterns": ["internal-[a-z"]}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadFrom(path); !errors.Is(err, ErrInvalidSecretPattern) {
+			t.Errorf("err = %v, want ErrInvalidSecretPattern", err)
+		}
+	})
+
+	t.Run("trash_retention_days invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{"api_key": "sk-test-123", "trash_retention_days": -1}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadFrom(path); err != ErrInvalidTrashRetention {
+			t.Errorf("err = %v, want ErrInvalidTrashRetention", err)
+		}
+	})
+
+	t.Run("max_continuations invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		content := `{"api_key": "sk-test-123", "max_continuations": -1}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadFrom(path); err != ErrInvalidMaxContinuations {
+			t.Errorf("err = %v, want ErrInvalidMaxContinuations", err)
+		}
 	})
 
 	t.Run("diff_mode anchored", func(t *testing.T) {
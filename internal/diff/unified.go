@@ -0,0 +1,204 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// opKind identifies a line-level edit operation.
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type lineOp struct {
+	kind opKind
+	line string
+	a, b int // 0-indexed line positions in old/new before this op
+}
+
+// Unified returns a unified diff between oldContent and newContent with the
+// given number of context lines. Returns "" when the contents are equal.
+// oldName and newName label the ---/+++ headers.
+func Unified(oldName, newName, oldContent, newContent string, context int) string {
+	if oldContent == newContent {
+		return ""
+	}
+	a := SplitLines(oldContent)
+	b := SplitLines(newContent)
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Group changes into hunks separated by more than 2*context equal lines.
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []lineOp) {
+	aStart, bStart := ops[0].a, ops[0].b
+	aCount, bCount := 0, 0
+	for _, op := range ops {
+		if op.kind != opInsert {
+			aCount++
+		}
+		if op.kind != opDelete {
+			bCount++
+		}
+	}
+	// Unified format uses 1-indexed starts, or the preceding line for empty ranges.
+	if aCount > 0 {
+		aStart++
+	}
+	if bCount > 0 {
+		bStart++
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, op := range ops {
+		switch op.kind {
+		case opEqual:
+			out.WriteString(" ")
+		case opDelete:
+			out.WriteString("-")
+		case opInsert:
+			out.WriteString("+")
+		}
+		out.WriteString(op.line)
+		out.WriteString("\n")
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines computes a shortest edit script between a and b using Myers'
+// algorithm. Common prefix and suffix are trimmed first since LLM edits
+// usually touch a small part of the file.
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []lineOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, lineOp{kind: opEqual, line: a[i], a: i, b: i})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		ai, bi := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, lineOp{kind: opEqual, line: a[ai], a: ai, b: bi})
+	}
+	return ops
+}
+
+func myers(a, b []string, aOff, bOff int) []lineOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	if offset == 0 {
+		return nil
+	}
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+	for d := 0; d <= offset; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, aOff, bOff, offset)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, a, b []string, aOff, bOff, offset int) []lineOp {
+	x, y := len(a), len(b)
+	var rev []lineOp
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, lineOp{kind: opEqual, line: a[x], a: aOff + x, b: bOff + y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, lineOp{kind: opInsert, line: b[y], a: aOff + x, b: bOff + y})
+		} else {
+			x--
+			rev = append(rev, lineOp{kind: opDelete, line: a[x], a: aOff + x, b: bOff + y})
+		}
+	}
+	ops := make([]lineOp, len(rev))
+	for i := range rev {
+		ops[i] = rev[len(rev)-1-i]
+	}
+	return ops
+}
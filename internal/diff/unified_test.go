@@ -0,0 +1,49 @@
+package diff
+
+import "testing"
+
+func TestUnified_Equal(t *testing.T) {
+	if got := Unified("a", "b", "x\ny\n", "x\ny\n", 3); got != "" {
+		t.Errorf("expected empty diff, got:\n%s", got)
+	}
+}
+
+func TestUnified_SingleChange(t *testing.T) {
+	old := "one\ntwo\nthree\nfour\nfive\n"
+	new := "one\ntwo\nTHREE\nfour\nfive\n"
+	got := Unified("a/f.txt", "b/f.txt", old, new, 1)
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_NewFile(t *testing.T) {
+	got := Unified("/dev/null", "b/new.go", "", "package main\n", 3)
+	want := "--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+package main\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	new := "1\nX\n3\n4\n5\n6\n7\n8\nY\n10\n"
+	got := Unified("a", "b", old, new, 1)
+	want := "--- a\n+++ b\n" +
+		"@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n" +
+		"@@ -8,3 +8,3 @@\n 8\n-9\n+Y\n 10\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_InsertAndDelete(t *testing.T) {
+	old := "a\nb\nc\n"
+	new := "a\nc\nd\n"
+	got := Unified("old", "new", old, new, 3)
+	want := "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n c\n+d\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+// Package export renders chats into shareable documents: Markdown for
+// reading and pasting, self-contained HTML for browsers, and a JSON bundle
+// that can be imported back into BB-7.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/youruser/bb7/internal/diff"
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Format is an export output format.
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+	FormatJSON     Format = "json"
+)
+
+// diffContext is the number of unchanged lines shown around output changes.
+const diffContext = 3
+
+// ParseFormat parses a format name. Accepts "markdown"/"md", "html", and "json";
+// an empty name defaults to Markdown.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "markdown", "md":
+		return FormatMarkdown, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (supported: markdown, html, json)", name)
+}
+
+// Extension returns the conventional file extension for a format.
+func (f Format) Extension() string {
+	switch f {
+	case FormatHTML:
+		return ".html"
+	case FormatJSON:
+		return ".json"
+	}
+	return ".md"
+}
+
+// Render renders a bundle in the given format.
+func Render(b *state.ChatBundle, format Format) ([]byte, error) {
+	switch format {
+	case FormatMarkdown:
+		return []byte(Markdown(b)), nil
+	case FormatHTML:
+		return []byte(HTML(b)), nil
+	case FormatJSON:
+		data, err := json.MarshalIndent(b, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// OutputDiff describes a pending output file relative to its context base.
+type OutputDiff struct {
+	Path  string
+	Added bool   // No context base: the LLM created the file
+	Diff  string // Unified diff; empty if output matches context
+}
+
+// OutputDiffs returns the pending output files of a bundle as unified diffs
+// against their context snapshots.
+func OutputDiffs(b *state.ChatBundle) []OutputDiff {
+	var diffs []OutputDiff
+	for _, out := range b.Output {
+		d := OutputDiff{Path: out.Path}
+		base := ""
+		oldName := "a/" + out.Path
+		if ctx := b.FindContext(out.Path); ctx != nil {
+			base = ctx.Content
+		} else {
+			d.Added = true
+			oldName = "/dev/null"
+		}
+		d.Diff = diff.Unified(oldName, "b/"+out.Path, base, out.Content, diffContext)
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// isEventOnly reports whether a message consists only of context events.
+// These are rendered as notes rather than as conversation turns.
+func isEventOnly(msg state.Message) bool {
+	if len(msg.Parts) == 0 {
+		return false
+	}
+	for _, p := range msg.Parts {
+		if p.Type != state.PartTypeContextEvent {
+			return false
+		}
+	}
+	return true
+}
+
+// roleLabel returns the display name for a message role.
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	}
+	return role
+}
+
+// describeEvent returns a one-line, human-readable description of a context
+// event. code formats a path (backticks for Markdown, <code> for HTML).
+func describeEvent(p state.MessagePart, code func(string) string) string {
+	path := code(p.Path)
+	lines := ""
+	if p.StartLine > 0 && p.EndLine > 0 {
+		lines = fmt.Sprintf(" lines %d-%d", p.StartLine, p.EndLine)
+	}
+	switch p.Action {
+	case state.ActionUserAddFile:
+		if p.ReadOnly != nil && *p.ReadOnly {
+			return "Added " + path + " to context (read-only)"
+		}
+		return "Added " + path + " to context"
+	case state.ActionUserAddSection:
+		return "Added " + path + lines + " to context"
+	case state.ActionUserRemoveFile:
+		return "Removed " + path + " from context"
+	case state.ActionUserRemoveSection:
+		return "Removed " + path + lines + " from context"
+	case state.ActionUserSetReadOnly:
+		if p.ReadOnly != nil && *p.ReadOnly {
+			return "Marked " + path + " read-only"
+		}
+		return "Marked " + path + " writable"
+	case state.ActionUserWriteFile:
+		return "Updated " + path + " in context"
+	case state.ActionUserApplyFile:
+		return "Applied output to " + path
+	case state.ActionUserPartialApply:
+		return "Partially applied output to " + path
+	case state.ActionUserSaveAs:
+		if p.OriginalPath != "" {
+			return "Saved output for " + code(p.OriginalPath) + " as " + path
+		}
+		return "Saved output as " + path
+	case state.ActionUserRejectOutput:
+		return "Rejected output for " + path
+	case state.ActionAssistantWriteFile:
+		if p.Added {
+			return "Assistant created " + path
+		}
+		return "Assistant modified " + path
+	case state.ActionForkWarningModified:
+		return path + " changed since the original chat"
+	case state.ActionForkWarningDeleted:
+		return path + " was deleted since the original chat"
+	case state.ActionForkWarningMissing:
+		return "Image " + path + " is missing since the original chat"
+	}
+	return string(p.Action) + " " + path
+}
+
+// contextLabel returns the annotations shown next to a context file.
+func contextLabel(cf state.ContextFile) string {
+	var notes []string
+	switch {
+	case cf.StartLine > 0 && cf.EndLine > 0:
+		notes = append(notes, fmt.Sprintf("lines %d-%d", cf.StartLine, cf.EndLine))
+	case cf.IsImage():
+		notes = append(notes, "image")
+	case state.IsURLPath(cf.Path):
+		notes = append(notes, "web")
+	case cf.External:
+		notes = append(notes, "external")
+	}
+	if cf.ReadOnly && !cf.IsImage() && !state.IsURLPath(cf.Path) && !cf.External {
+		notes = append(notes, "read-only")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+// messageHeading returns the heading text for a conversation turn.
+func messageHeading(msg state.Message) string {
+	parts := []string{roleLabel(msg.Role)}
+	if msg.Role == "assistant" && msg.Model != "" {
+		parts = append(parts, msg.Model)
+	}
+	if ts := formatTime(msg.Timestamp); ts != "" {
+		parts = append(parts, ts)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// usageSummary formats token usage for an assistant message, or "".
+func usageSummary(u *state.MessageUsage) string {
+	if u == nil {
+		return ""
+	}
+	var parts []string
+	if u.PromptTokens > 0 || u.CompletionTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d in / %d out tokens", u.PromptTokens, u.CompletionTokens))
+	}
+	if u.Cost > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", u.Cost))
+	}
+	if u.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("%.1fs", u.Duration))
+	}
+	return strings.Join(parts, " · ")
+}
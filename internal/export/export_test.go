@@ -0,0 +1,164 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+func testBundle() *state.ChatBundle {
+	ro := true
+	created := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	return &state.ChatBundle{
+		Format:     state.BundleFormat,
+		Version:    state.BundleVersion,
+		ExportedAt: created.Add(time.Hour),
+		Chat: state.Chat{
+			ID:      "abc123",
+			Name:    "Fix <greeting>",
+			Created: created,
+			Model:   "test/model",
+			ContextFiles: []state.ContextFile{
+				{Path: "main.go"},
+				{Path: "README.md", ReadOnly: true},
+			},
+			Messages: []state.Message{
+				{Role: "assistant", Parts: []state.MessagePart{
+					{Type: state.PartTypeContextEvent, Action: state.ActionUserAddFile, Path: "README.md", ReadOnly: &ro},
+				}},
+				{Role: "user", Timestamp: created, Parts: []state.MessagePart{
+					{Type: state.PartTypeText, Content: "Make it say `hello world`"},
+				}},
+				{Role: "assistant", Model: "test/model", Timestamp: created.Add(time.Minute), Parts: []state.MessagePart{
+					{Type: state.PartTypeThinking, Content: "The string literal needs changing."},
+					{Type: state.PartTypeText, Content: "Updated:\n\n```go\nfmt.Println(\"hello world\") // greet\n```"},
+				}, Usage: &state.MessageUsage{PromptTokens: 100, CompletionTokens: 20, Cost: 0.0012}},
+				{Role: "assistant", Parts: []state.MessagePart{
+					{Type: state.PartTypeContextEvent, Action: state.ActionAssistantWriteFile, Path: "main.go"},
+				}},
+			},
+		},
+		Context: []state.BundleFile{
+			{Path: "main.go", Content: "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"},
+			{Path: "README.md", Content: "# Demo\n"},
+		},
+		Output: []state.BundleFile{
+			{Path: "main.go", Content: "package main\n\nfunc main() {\n\tfmt.Println(\"hello world\")\n}\n"},
+			{Path: "new.txt", Content: "fresh\n"},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{"": FormatMarkdown, "md": FormatMarkdown, "Markdown": FormatMarkdown, "html": FormatHTML, "json": FormatJSON}
+	for in, want := range tests {
+		got, err := ParseFormat(in)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	md := Markdown(testBundle())
+
+	wants := []string{
+		"# Fix <greeting>",
+		"- **Model:** test/model",
+		"- `README.md` (read-only)",
+		"> *Added `README.md` to context (read-only)*",
+		"### User · 2026-03-01 09:30 UTC",
+		"Make it say `hello world`",
+		"### Assistant · test/model · 2026-03-01 09:31 UTC",
+		"<details>\n<summary>Thinking</summary>\n\nThe string literal needs changing.\n\n</details>",
+		"100 in / 20 out tokens · $0.0012",
+		"> *Assistant modified `main.go`*",
+		"## Pending output",
+		"```diff\n--- a/main.go\n+++ b/main.go\n",
+		"-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"hello world\")\n",
+		"### `new.txt` (new file)",
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+fresh\n",
+	}
+	for _, want := range wants {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q\n--- got ---\n%s", want, md)
+		}
+	}
+}
+
+func TestMarkdownFenceEscapesBackticks(t *testing.T) {
+	var out strings.Builder
+	writeFence(&out, "md", "```go\ncode\n```\n")
+	if !strings.HasPrefix(out.String(), "````md\n") || !strings.HasSuffix(out.String(), "\n````\n") {
+		t.Errorf("fence not lengthened:\n%s", out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	page := HTML(testBundle())
+
+	wants := []string{
+		"<title>Fix &lt;greeting&gt;</title>",
+		"<article class=\"user\">",
+		"Make it say <code>hello world</code>",
+		"<details>\n<summary>Thinking</summary>",
+		`<span class="s">&#34;hello world&#34;</span>`,
+		`<span class="c">// greet</span>`,
+		`<span class="da">+	fmt.Println(&#34;hello world&#34;)`,
+		"<div class=\"event\">Assistant modified <code>main.go</code></div>",
+	}
+	for _, want := range wants {
+		if !strings.Contains(page, want) {
+			t.Errorf("html missing %q", want)
+		}
+	}
+	if strings.Contains(page, "<greeting>") {
+		t.Error("chat name not escaped")
+	}
+	for _, external := range []string{"<script", "<link", "http://", "https://"} {
+		if strings.Contains(page, external) {
+			t.Errorf("html should be self-contained, found %q", external)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("local x = 'a' -- note", "lua")
+	want := `<span class="k">local</span> x = <span class="s">&#39;a&#39;</span> <span class="c">-- note</span>`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := highlight("<b>", "unknown"); got != "&lt;b&gt;" {
+		t.Errorf("unknown language should only escape, got %s", got)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	b := testBundle()
+	b.Context = append(b.Context, state.BundleFile{Path: "shot.png", MediaType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}})
+
+	data, err := Render(b, FormatJSON)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	var got state.ChatBundle
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got.Format != state.BundleFormat || got.Chat.ID != "abc123" || len(got.Chat.Messages) != 4 {
+		t.Errorf("unexpected bundle: %+v", got)
+	}
+	if len(got.Output) != 2 || got.Output[0].Content != b.Output[0].Content {
+		t.Error("output snapshots not preserved")
+	}
+	img := got.Context[len(got.Context)-1]
+	if string(img.Data) != "\x89PNG" {
+		t.Errorf("image data not preserved: %q", img.Data)
+	}
+}
@@ -0,0 +1,241 @@
+package export
+
+import (
+	"html"
+	"strings"
+)
+
+// language describes the lexical rules used for syntax highlighting. The
+// highlighter is intentionally small: it recognizes comments, strings,
+// numbers, and keywords, which is enough to make exported code readable
+// without bundling a full grammar library.
+type language struct {
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string
+	keywords      map[string]bool
+}
+
+func keywords(words string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLike = [][2]string{{"/*", "*/"}}
+
+	langGo = &language{
+		lineComments: []string{"//"}, blockComments: cLike, quotes: "\"'`",
+		keywords: keywords(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var nil true false iota`),
+	}
+	langLua = &language{
+		lineComments: []string{"--"}, blockComments: [][2]string{{"--[[", "]]"}}, quotes: "\"'",
+		keywords: keywords(`and break do else elseif end false for function goto if in local nil not or
+			repeat return then true until while`),
+	}
+	langPython = &language{
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: keywords(`False None True and as assert async await break class continue def del elif else
+			except finally for from global if import in is lambda nonlocal not or pass raise return try while
+			with yield self`),
+	}
+	langJS = &language{
+		lineComments: []string{"//"}, blockComments: cLike, quotes: "\"'`",
+		keywords: keywords(`async await break case catch class const continue debugger default delete do else
+			export extends false finally for function if import in instanceof let new null return super switch
+			this throw true try typeof undefined var void while yield interface type enum implements`),
+	}
+	langRust = &language{
+		lineComments: []string{"//"}, blockComments: cLike, quotes: "\"",
+		keywords: keywords(`as async await break const continue crate else enum extern false fn for if impl in
+			let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use
+			where while`),
+	}
+	langC = &language{
+		lineComments: []string{"//"}, blockComments: cLike, quotes: "\"'",
+		keywords: keywords(`auto break case catch char class const continue default delete do double else enum
+			extern false float for friend goto if inline int long namespace new nullptr private protected public
+			register return short signed sizeof static struct switch template this throw true try typedef
+			typename union unsigned using virtual void volatile while bool string var readonly override abstract
+			final interface extends implements package import boolean null`),
+	}
+	langShell = &language{
+		lineComments: []string{"#"}, quotes: "\"'",
+		keywords: keywords(`if then else elif fi case esac for while until do done in function return local
+			export set unset`),
+	}
+	langJSON = &language{quotes: "\"", keywords: keywords(`true false null`)}
+)
+
+// languageFor returns highlighting rules for a fence language name or file
+// extension, or nil if unknown.
+func languageFor(name string) *language {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "go":
+		return langGo
+	case "lua":
+		return langLua
+	case "python", "py":
+		return langPython
+	case "javascript", "js", "jsx", "typescript", "ts", "tsx", "mjs":
+		return langJS
+	case "rust", "rs":
+		return langRust
+	case "c", "h", "cpp", "cc", "hpp", "c++", "java", "cs", "csharp", "kotlin", "kt", "swift":
+		return langC
+	case "sh", "bash", "zsh", "shell":
+		return langShell
+	case "json":
+		return langJSON
+	}
+	return nil
+}
+
+// highlight returns HTML-escaped code with <span> tokens for lang.
+// Unknown languages are escaped without highlighting.
+func highlight(code, lang string) string {
+	l := languageFor(lang)
+	if l == nil {
+		return html.EscapeString(code)
+	}
+
+	var out strings.Builder
+	span := func(class, text string) {
+		out.WriteString(`<span class="`)
+		out.WriteString(class)
+		out.WriteString(`">`)
+		out.WriteString(html.EscapeString(text))
+		out.WriteString("</span>")
+	}
+
+	i := 0
+	for i < len(code) {
+		rest := code[i:]
+
+		if n := matchComment(l, rest); n > 0 {
+			span("c", rest[:n])
+			i += n
+			continue
+		}
+
+		c := rest[0]
+		if strings.IndexByte(l.quotes, c) >= 0 {
+			n := stringLen(rest, c)
+			span("s", rest[:n])
+			i += n
+			continue
+		}
+
+		if isDigit(c) {
+			n := 1
+			for n < len(rest) && (isIdent(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			span("n", rest[:n])
+			i += n
+			continue
+		}
+
+		if isIdent(c) {
+			n := 1
+			for n < len(rest) && isIdent(rest[n]) {
+				n++
+			}
+			if word := rest[:n]; l.keywords[word] {
+				span("k", word)
+			} else {
+				out.WriteString(html.EscapeString(word))
+			}
+			i += n
+			continue
+		}
+
+		out.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return out.String()
+}
+
+// matchComment returns the length of a comment starting at s, or 0.
+func matchComment(l *language, s string) int {
+	for _, bc := range l.blockComments {
+		if strings.HasPrefix(s, bc[0]) {
+			if end := strings.Index(s[len(bc[0]):], bc[1]); end >= 0 {
+				return len(bc[0]) + end + len(bc[1])
+			}
+			return len(s)
+		}
+	}
+	for _, lc := range l.lineComments {
+		if strings.HasPrefix(s, lc) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return end
+			}
+			return len(s)
+		}
+	}
+	return 0
+}
+
+// stringLen returns the length of a string literal starting at s[0] == quote.
+// Backslash escapes are honored; unterminated strings end at the line end
+// (or run to the end for backtick raw strings).
+func stringLen(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// highlightDiff returns an HTML-escaped unified diff with added, removed, and
+// hunk header lines wrapped in spans.
+func highlightDiff(d string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(d, "\n") {
+		if line == "" {
+			continue
+		}
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			class = "dh"
+		case strings.HasPrefix(line, "@@"):
+			class = "dk"
+		case strings.HasPrefix(line, "+"):
+			class = "da"
+		case strings.HasPrefix(line, "-"):
+			class = "dd"
+		}
+		if class == "" {
+			out.WriteString(html.EscapeString(line))
+			continue
+		}
+		out.WriteString(`<span class="`)
+		out.WriteString(class)
+		out.WriteString(`">`)
+		out.WriteString(html.EscapeString(line))
+		out.WriteString("</span>")
+	}
+	return out.String()
+}
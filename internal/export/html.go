@@ -0,0 +1,213 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+const htmlStyle = `
+body { margin: 0; background: #fafafa; color: #1f2328; font: 15px/1.55 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 880px; margin: 0 auto; padding: 24px 16px 64px; }
+h1 { margin-bottom: 4px; }
+.meta { color: #656d76; font-size: 13px; margin: 0 0 24px; }
+.meta span + span::before { content: " · "; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: 4px; margin-top: 32px; }
+article { border: 1px solid #d0d7de; border-radius: 6px; margin: 16px 0; background: #fff; }
+article > header { font-weight: 600; font-size: 13px; padding: 6px 12px; border-bottom: 1px solid #d0d7de; background: #f6f8fa; border-radius: 6px 6px 0 0; }
+article.user > header { background: #ddf4ff; }
+article.system > header { background: #fff8c5; }
+article > .body { padding: 4px 12px; }
+article > footer { color: #656d76; font-size: 12px; padding: 0 12px 8px; }
+p { white-space: pre-wrap; margin: 8px 0; }
+.event { color: #656d76; font-size: 13px; font-style: italic; margin: 6px 0 6px 12px; }
+details { margin: 8px 0; color: #656d76; }
+summary { cursor: pointer; font-size: 13px; }
+details p { font-size: 13px; }
+code { font: 13px ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; background: #eff1f3; padding: 1px 4px; border-radius: 4px; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: 10px 12px; overflow-x: auto; }
+pre code { background: none; padding: 0; }
+ul.context { padding-left: 20px; }
+.note { color: #656d76; font-size: 13px; }
+.k { color: #cf222e; } .s { color: #0a3069; } .c { color: #6e7781; font-style: italic; } .n { color: #0550ae; }
+.da { color: #116329; background: #dafbe1; display: inline-block; width: 100%; }
+.dd { color: #82071e; background: #ffebe9; display: inline-block; width: 100%; }
+.dk { color: #8250df; } .dh { font-weight: 600; }
+`
+
+// HTML renders a chat as a self-contained HTML page with inline styles and
+// syntax-highlighted code blocks. No external resources are referenced.
+func HTML(b *state.ChatBundle) string {
+	chat := &b.Chat
+	var out strings.Builder
+
+	name := chat.Name
+	if name == "" {
+		name = "Untitled chat"
+	}
+	out.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	out.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(&out, "<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n<main>\n", html.EscapeString(name), htmlStyle)
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<div class=\"meta\">", html.EscapeString(name))
+	if chat.Model != "" {
+		fmt.Fprintf(&out, "<span>%s</span>", html.EscapeString(chat.Model))
+	}
+	if ts := formatTime(chat.Created); ts != "" {
+		fmt.Fprintf(&out, "<span>Created %s</span>", ts)
+	}
+	fmt.Fprintf(&out, "<span>Exported %s</span></div>\n", formatTime(b.ExportedAt))
+
+	if len(chat.ContextFiles) > 0 {
+		out.WriteString("<h2>Context</h2>\n<ul class=\"context\">\n")
+		for _, cf := range chat.ContextFiles {
+			fmt.Fprintf(&out, "<li>%s%s</li>\n", htmlCode(cf.Path), html.EscapeString(contextLabel(cf)))
+		}
+		out.WriteString("</ul>\n")
+	}
+
+	out.WriteString("<h2>Conversation</h2>\n")
+	for _, msg := range chat.Messages {
+		if isEventOnly(msg) {
+			for _, p := range msg.Parts {
+				fmt.Fprintf(&out, "<div class=\"event\">%s</div>\n", describeEvent(p, htmlCode))
+			}
+			continue
+		}
+		role := html.EscapeString(msg.Role)
+		fmt.Fprintf(&out, "<article class=\"%s\">\n<header>%s</header>\n<div class=\"body\">\n", role, html.EscapeString(messageHeading(msg)))
+		for _, p := range msg.Parts {
+			writeHTMLPart(&out, p)
+		}
+		out.WriteString("</div>\n")
+		if usage := usageSummary(msg.Usage); usage != "" {
+			fmt.Fprintf(&out, "<footer>%s</footer>\n", html.EscapeString(usage))
+		}
+		out.WriteString("</article>\n")
+	}
+
+	diffs := OutputDiffs(b)
+	if len(diffs) > 0 {
+		out.WriteString("<h2>Pending output</h2>\n")
+		for _, d := range diffs {
+			label := ""
+			if d.Added {
+				label = " (new file)"
+			}
+			fmt.Fprintf(&out, "<h3>%s%s</h3>\n", htmlCode(d.Path), label)
+			if d.Diff == "" {
+				out.WriteString("<p class=\"note\">No changes from context.</p>\n")
+				continue
+			}
+			fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", highlightDiff(d.Diff))
+		}
+	}
+
+	out.WriteString("</main>\n</body>\n</html>\n")
+	return out.String()
+}
+
+func writeHTMLPart(out *strings.Builder, p state.MessagePart) {
+	switch p.Type {
+	case state.PartTypeText:
+		out.WriteString(renderProse(p.Content))
+	case state.PartTypeThinking:
+		if strings.TrimSpace(p.Content) == "" {
+			return
+		}
+		out.WriteString("<details>\n<summary>Thinking</summary>\n")
+		out.WriteString(renderProse(p.Content))
+		out.WriteString("</details>\n")
+	case state.PartTypeCode, state.PartTypeRaw:
+		fmt.Fprintf(out, "<pre><code>%s</code></pre>\n", highlight(p.Content, p.Language))
+	case state.PartTypeContextEvent:
+		fmt.Fprintf(out, "<div class=\"event\">%s</div>\n", describeEvent(p, htmlCode))
+	case state.PartTypeFinding:
+		if p.Finding == nil {
+			return
+		}
+		f := p.Finding
+		fmt.Fprintf(out, "<div class=\"finding %s\"><strong>%s</strong> %s: %s</div>\n",
+			html.EscapeString(f.Severity), html.EscapeString(f.Severity), htmlCode(findingLocation(f)), html.EscapeString(f.Message))
+		if f.SuggestedFix != "" {
+			fmt.Fprintf(out, "<pre><code>%s</code></pre>\n", html.EscapeString(f.SuggestedFix))
+		}
+	}
+}
+
+// renderProse converts message text to HTML. Fenced code blocks are
+// highlighted; other text is split into paragraphs with inline code spans.
+// Remaining Markdown syntax is shown as written.
+func renderProse(text string) string {
+	var out strings.Builder
+	var para []string
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		body := strings.Join(para, "\n")
+		para = nil
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+		out.WriteString("<p>")
+		out.WriteString(inlineCode(body))
+		out.WriteString("</p>\n")
+	}
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			n := 0
+			for n < len(trimmed) && trimmed[n] == '`' {
+				n++
+			}
+			fence := trimmed[:n]
+			lang := strings.TrimSpace(trimmed[len(fence):])
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimLeft(lines[i], " "), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", highlight(strings.Join(code, "\n"), lang))
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		para = append(para, line)
+	}
+	flush()
+	return out.String()
+}
+
+// inlineCode escapes text and converts `code` spans to <code> elements.
+func inlineCode(text string) string {
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(text, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		out.WriteString(html.EscapeString(text[:start]))
+		out.WriteString(htmlCode(text[start+1 : start+1+end]))
+		text = text[start+1+end+1:]
+	}
+	out.WriteString(html.EscapeString(text))
+	return out.String()
+}
+
+func htmlCode(s string) string {
+	return "<code>" + html.EscapeString(s) + "</code>"
+}
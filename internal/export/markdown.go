@@ -0,0 +1,154 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/youruser/bb7/internal/state"
+)
+
+// Markdown renders a chat as a Markdown document. Thinking is collapsed in
+// <details> blocks, context events become quoted notes, and pending output
+// files are shown as diffs against their context snapshots.
+func Markdown(b *state.ChatBundle) string {
+	chat := &b.Chat
+	var out strings.Builder
+
+	name := chat.Name
+	if name == "" {
+		name = "Untitled chat"
+	}
+	fmt.Fprintf(&out, "# %s\n\n", name)
+	if chat.Model != "" {
+		fmt.Fprintf(&out, "- **Model:** %s\n", chat.Model)
+	}
+	if ts := formatTime(chat.Created); ts != "" {
+		fmt.Fprintf(&out, "- **Created:** %s\n", ts)
+	}
+	fmt.Fprintf(&out, "- **Exported:** %s\n", formatTime(b.ExportedAt))
+
+	if len(chat.ContextFiles) > 0 {
+		out.WriteString("\n## Context\n\n")
+		for _, cf := range chat.ContextFiles {
+			fmt.Fprintf(&out, "- %s%s\n", mdCode(cf.Path), contextLabel(cf))
+		}
+	}
+
+	out.WriteString("\n## Conversation\n")
+	for _, msg := range chat.Messages {
+		if isEventOnly(msg) {
+			out.WriteString("\n")
+			for _, p := range msg.Parts {
+				fmt.Fprintf(&out, "> *%s*\n", describeEvent(p, mdCode))
+			}
+			continue
+		}
+		fmt.Fprintf(&out, "\n### %s\n", messageHeading(msg))
+		for _, p := range msg.Parts {
+			writeMarkdownPart(&out, p)
+		}
+		if usage := usageSummary(msg.Usage); usage != "" {
+			fmt.Fprintf(&out, "\n<sub>%s</sub>\n", usage)
+		}
+	}
+
+	diffs := OutputDiffs(b)
+	if len(diffs) > 0 {
+		out.WriteString("\n## Pending output\n")
+		for _, d := range diffs {
+			label := ""
+			if d.Added {
+				label = " (new file)"
+			}
+			fmt.Fprintf(&out, "\n### %s%s\n\n", mdCode(d.Path), label)
+			if d.Diff == "" {
+				out.WriteString("*No changes from context.*\n")
+				continue
+			}
+			writeFence(&out, "diff", d.Diff)
+		}
+	}
+
+	return out.String()
+}
+
+func writeMarkdownPart(out *strings.Builder, p state.MessagePart) {
+	switch p.Type {
+	case state.PartTypeText:
+		if strings.TrimSpace(p.Content) == "" {
+			return
+		}
+		out.WriteString("\n")
+		out.WriteString(strings.TrimRight(p.Content, "\n"))
+		out.WriteString("\n")
+	case state.PartTypeThinking:
+		if strings.TrimSpace(p.Content) == "" {
+			return
+		}
+		out.WriteString("\n<details>\n<summary>Thinking</summary>\n\n")
+		out.WriteString(strings.TrimRight(p.Content, "\n"))
+		out.WriteString("\n\n</details>\n")
+	case state.PartTypeCode, state.PartTypeRaw:
+		out.WriteString("\n")
+		writeFence(out, p.Language, p.Content)
+	case state.PartTypeContextEvent:
+		fmt.Fprintf(out, "\n> *%s*\n", describeEvent(p, mdCode))
+	case state.PartTypeFinding:
+		if p.Finding == nil {
+			return
+		}
+		f := p.Finding
+		fmt.Fprintf(out, "\n- **%s** %s: %s\n", f.Severity, mdCode(findingLocation(f)), f.Message)
+		if f.SuggestedFix != "" {
+			out.WriteString("\n")
+			writeFence(out, "", f.SuggestedFix)
+		}
+	}
+}
+
+// writeFence writes content in a fenced code block whose fence is longer than
+// any backtick run inside the content.
+func writeFence(out *strings.Builder, lang, content string) {
+	fence := strings.Repeat("`", max(3, longestRun(content, '`')+1))
+	out.WriteString(fence)
+	out.WriteString(lang)
+	out.WriteString("\n")
+	out.WriteString(content)
+	if !strings.HasSuffix(content, "\n") {
+		out.WriteString("\n")
+	}
+	out.WriteString(fence)
+	out.WriteString("\n")
+}
+
+// findingLocation formats a finding's location as path:start[-end].
+func findingLocation(f *state.Finding) string {
+	loc := fmt.Sprintf("%s:%d", f.Path, f.StartLine)
+	if f.EndLine > f.StartLine {
+		loc += fmt.Sprintf("-%d", f.EndLine)
+	}
+	return loc
+}
+
+// mdCode formats s as inline code, padding the delimiters when s contains
+// backticks.
+func mdCode(s string) string {
+	ticks := strings.Repeat("`", longestRun(s, '`')+1)
+	if strings.Contains(s, "`") {
+		return ticks + " " + s + " " + ticks
+	}
+	return ticks + s + ticks
+}
+
+func longestRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
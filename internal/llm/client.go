@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -68,8 +69,10 @@ type StreamCallback func(event StreamEvent)
 // ChatStream sends a chat request and streams the response.
 // The callback is called for each event (content chunks, tool calls, completion).
 // If reasoning is non-nil, extended thinking is enabled with the specified effort level.
+// params sets the optional output limit and sampling parameters.
+// tools are the tools offered to the model (see DefaultTools and ReviewTools).
 // cacheKey is optional and is sent as prompt_cache_key when explicit cache keys are enabled.
-func (c *Client) ChatStream(ctx context.Context, model, systemPrompt string, messages []APIMessage, reasoning *ReasoningConfig, diffMode, cacheKey string, callback StreamCallback) error {
+func (c *Client) ChatStream(ctx context.Context, model, systemPrompt string, messages []APIMessage, reasoning *ReasoningConfig, params GenerationParams, tools []Tool, cacheKey string, callback StreamCallback) error {
 	// Prepend system message
 	allMessages := make([]APIMessage, 0, len(messages)+1)
 	allMessages = append(allMessages, APIMessage{
@@ -81,9 +84,12 @@ func (c *Client) ChatStream(ctx context.Context, model, systemPrompt string, mes
 	reqBody := ChatRequest{
 		Model:          model,
 		Messages:       allMessages,
-		Tools:          DefaultTools(diffMode),
+		Tools:          tools,
 		Stream:         true,
 		Reasoning:      reasoning,
+		MaxTokens:      params.MaxTokens,
+		Temperature:    params.Temperature,
+		TopP:           params.TopP,
 		Provider:       c.providerPreferences(),
 		PromptCacheKey: "",
 	}
@@ -133,6 +139,7 @@ func (c *Client) processStream(ctx context.Context, reader io.Reader, callback S
 	// Track tool calls being built up across multiple deltas
 	toolCalls := make(map[int]*ToolCall)
 	var lastUsage *Usage
+	var finishReason string
 	log.Debug("Starting SSE stream processing")
 
 	for scanner.Scan() {
@@ -155,15 +162,7 @@ func (c *Client) processStream(ctx context.Context, reader io.Reader, callback S
 		// Stream end marker
 		if data == "[DONE]" {
 			log.Debug("SSE stream received [DONE], emitting %d tool calls", len(toolCalls))
-			// Emit any complete tool calls
-			for _, tc := range toolCalls {
-				log.Debug("Emitting tool call: %s", tc.Function.Name)
-				callback(StreamEvent{
-					Type:     "tool_call",
-					ToolCall: tc,
-				})
-			}
-			callback(StreamEvent{Type: "done", Usage: lastUsage})
+			finishStream(toolCalls, finishReason, lastUsage, callback)
 			return nil
 		}
 
@@ -195,6 +194,9 @@ func (c *Client) processStream(ctx context.Context, reader io.Reader, callback S
 		}
 
 		choice := resp.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
 		delta := choice.Delta
 		if delta == nil {
 			delta = choice.Message
@@ -256,16 +258,55 @@ func (c *Client) processStream(ctx context.Context, reader io.Reader, callback S
 
 	// If stream ended without [DONE], still emit any collected tool calls
 	log.Debug("SSE stream ended without [DONE], emitting %d tool calls (fallback)", len(toolCalls))
-	for _, tc := range toolCalls {
-		log.Debug("Emitting tool call (fallback): %s", tc.Function.Name)
+	finishStream(toolCalls, finishReason, lastUsage, callback)
+
+	return nil
+}
+
+// finishStream emits the collected tool calls, a "length" or
+// "content_filter" event when the response ended early, and "done".
+// When the output limit cut the response off inside a tool call, that call
+// (the last one started) is incomplete: it is carried by the "length" event
+// instead of being emitted as a "tool_call".
+func finishStream(toolCalls map[int]*ToolCall, finishReason string, usage *Usage, callback StreamCallback) {
+	truncated := -1
+	if finishReason == FinishReasonLength {
+		for idx := range toolCalls {
+			if idx > truncated {
+				truncated = idx
+			}
+		}
+	}
+	indexes := make([]int, 0, len(toolCalls))
+	for idx := range toolCalls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		if idx == truncated {
+			continue
+		}
+		log.Debug("Emitting tool call: %s", toolCalls[idx].Function.Name)
 		callback(StreamEvent{
 			Type:     "tool_call",
-			ToolCall: tc,
+			ToolCall: toolCalls[idx],
 		})
 	}
-	callback(StreamEvent{Type: "done", Usage: lastUsage})
-
-	return nil
+	switch finishReason {
+	case FinishReasonLength:
+		event := StreamEvent{Type: FinishReasonLength}
+		if truncated >= 0 {
+			event.ToolCall = toolCalls[truncated]
+			log.Info("Output limit reached inside tool call: %s", event.ToolCall.Function.Name)
+		} else {
+			log.Info("Output limit reached")
+		}
+		callback(event)
+	case FinishReasonContentFilter:
+		log.Info("Response stopped by content filter")
+		callback(StreamEvent{Type: FinishReasonContentFilter})
+	}
+	callback(StreamEvent{Type: "done", Usage: usage, FinishReason: finishReason})
 }
 
 // friendlyStreamError rewrites raw HTTP/2 stream errors into user-readable messages.
@@ -301,6 +342,41 @@ func ParseWriteFileArgs(argsJSON string) (*WriteFileArgs, error) {
 	return &args, nil
 }
 
+// ParseReportFindingsArgs parses the arguments JSON for a report_findings
+// tool call. end_line defaults to start_line.
+func ParseReportFindingsArgs(argsJSON string) (*ReportFindingsArgs, error) {
+	var args ReportFindingsArgs
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return nil, err
+	}
+	for i := range args.Findings {
+		f := &args.Findings[i]
+		if f.Path == "" {
+			return nil, fmt.Errorf("report_findings: finding %d: missing path", i+1)
+		}
+		if f.Message == "" {
+			return nil, fmt.Errorf("report_findings: finding %d: missing message", i+1)
+		}
+		if f.StartLine < 1 {
+			return nil, fmt.Errorf("report_findings: finding %d: start_line must be at least 1", i+1)
+		}
+		if f.EndLine == 0 {
+			f.EndLine = f.StartLine
+		}
+		if f.EndLine < f.StartLine {
+			return nil, fmt.Errorf("report_findings: finding %d: end_line before start_line", i+1)
+		}
+		severityOK := false
+		for _, s := range FindingSeverities {
+			severityOK = severityOK || f.Severity == s
+		}
+		if !severityOK {
+			return nil, fmt.Errorf("report_findings: finding %d: severity must be one of %s", i+1, strings.Join(FindingSeverities, ", "))
+		}
+	}
+	return &args, nil
+}
+
 // ParseAnchoredEditArgs parses the arguments JSON for an anchored edit_file tool call.
 func ParseAnchoredEditArgs(argsJSON string) (*AnchoredEditArgs, error) {
 	var args AnchoredEditArgs
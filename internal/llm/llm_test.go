@@ -1,6 +1,9 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -404,3 +407,199 @@ func TestNewClient(t *testing.T) {
 		t.Error("explicitCacheKey = false, want true")
 	}
 }
+
+func TestProcessStreamFinishReason(t *testing.T) {
+	run := func(t *testing.T, sse string) []StreamEvent {
+		t.Helper()
+		var events []StreamEvent
+		client := NewClient("https://api.example.com/v1", "sk-test", false, true, false)
+		err := client.processStream(context.Background(), strings.NewReader(sse), func(event StreamEvent) {
+			if event.Type != "raw" {
+				events = append(events, event)
+			}
+		})
+		if err != nil {
+			t.Fatalf("processStream: %v", err)
+		}
+		return events
+	}
+
+	t.Run("truncated tool call", func(t *testing.T) {
+		events := run(t, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"a","type":"function","function":{"name":"write_file","arguments":"{\"path\":\"a.go\"}"}}]}}]}
+data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"b","type":"function","function":{"name":"write_file","arguments":"{\"path\":\"b"}}]}}]}
+data: {"choices":[{"delta":{},"finish_reason":"length"}]}
+data: [DONE]
+`)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		if strings.Join(types, ",") != "tool_call,length,done" {
+			t.Fatalf("event types = %v", types)
+		}
+		if events[0].ToolCall.ID != "a" {
+			t.Errorf("complete tool call = %+v", events[0].ToolCall)
+		}
+		if events[1].ToolCall == nil || events[1].ToolCall.ID != "b" {
+			t.Errorf("length event tool call = %+v", events[1].ToolCall)
+		}
+		if events[2].FinishReason != FinishReasonLength {
+			t.Errorf("done finish reason = %q", events[2].FinishReason)
+		}
+	})
+
+	t.Run("content filter", func(t *testing.T) {
+		events := run(t, `data: {"choices":[{"delta":{"content":"Hel"}}]}
+data: {"choices":[{"delta":{},"finish_reason":"content_filter"}]}
+`)
+		if len(events) != 3 || events[1].Type != FinishReasonContentFilter || events[2].FinishReason != FinishReasonContentFilter {
+			t.Errorf("events = %+v", events)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		events := run(t, `data: {"choices":[{"delta":{"content":"Hi"},"finish_reason":"stop"}]}
+data: [DONE]
+`)
+		if len(events) != 2 || events[1].Type != "done" || events[1].FinishReason != "stop" {
+			t.Errorf("events = %+v", events)
+		}
+	})
+}
+
+func TestAPIMessageMarshalJSON(t *testing.T) {
+	t.Run("plain content", func(t *testing.T) {
+		data, err := json.Marshal(APIMessage{Role: "user", Content: "hello"})
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		if string(data) != `{"role":"user","content":"hello"}` {
+			t.Errorf("got %s", data)
+		}
+	})
+
+	t.Run("multimodal parts", func(t *testing.T) {
+		msg := APIMessage{
+			Role:    "user",
+			Content: "ignored when parts are set",
+			Parts:   []ContentPart{TextPart("look"), ImagePart("image/png", []byte{1, 2, 3})},
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		var decoded struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type     string `json:"type"`
+				Text     string `json:"text"`
+				ImageURL struct {
+					URL string `json:"url"`
+				} `json:"image_url"`
+			} `json:"content"`
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("content is not a parts array: %v (%s)", err, data)
+		}
+		if len(decoded.Content) != 2 {
+			t.Fatalf("expected 2 parts, got %d", len(decoded.Content))
+		}
+		if decoded.Content[0].Type != "text" || decoded.Content[0].Text != "look" {
+			t.Errorf("unexpected text part: %+v", decoded.Content[0])
+		}
+		if decoded.Content[1].Type != "image_url" || decoded.Content[1].ImageURL.URL != "data:image/png;base64,AQID" {
+			t.Errorf("unexpected image part: %+v", decoded.Content[1])
+		}
+	})
+}
+
+func TestModelInfoSupportsImageInput(t *testing.T) {
+	tests := []struct {
+		name string
+		arch ModelArchitecture
+		want bool
+	}{
+		{"input modalities with image", ModelArchitecture{InputModalities: []string{"text", "image"}}, true},
+		{"input modalities text only", ModelArchitecture{InputModalities: []string{"text"}, Modality: "text+image->text"}, false},
+		{"legacy modality string", ModelArchitecture{Modality: "text+image->text"}, true},
+		{"legacy text only", ModelArchitecture{Modality: "text->text"}, false},
+		{"image output only", ModelArchitecture{Modality: "text->image"}, false},
+		{"unknown", ModelArchitecture{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (ModelInfo{Architecture: tt.arch}).SupportsImageInput(); got != tt.want {
+				t.Errorf("SupportsImageInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationParams(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	yes := true
+
+	base := GenerationParams{MaxTokens: 4000, Temperature: f(0.5)}
+	merged := base.Merge(GenerationParams{Temperature: f(0.1), ReasoningMaxTokens: 1000})
+	if merged.MaxTokens != 4000 || *merged.Temperature != 0.1 || merged.ReasoningMaxTokens != 1000 {
+		t.Errorf("Merge() = %+v", merged)
+	}
+
+	invalid := []GenerationParams{
+		{MaxTokens: -1},
+		{Temperature: f(2.5)},
+		{TopP: f(0)},
+		{MaxTokens: 1000, ReasoningMaxTokens: 1000},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); !errors.Is(err, ErrInvalidGenerationParams) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidGenerationParams", p, err)
+		}
+	}
+
+	if r, err := (GenerationParams{}).Reasoning(""); r != nil || err != nil {
+		t.Errorf("Reasoning(\"\") = %+v, %v; want nil", r, err)
+	}
+	if r, err := (GenerationParams{ReasoningMaxTokens: 2000, ReasoningExclude: &yes}).Reasoning(""); err != nil || r.MaxTokens != 2000 || !r.Exclude {
+		t.Errorf("budget reasoning = %+v, %v", r, err)
+	}
+	if _, err := (GenerationParams{ReasoningMaxTokens: 2000}).Reasoning("high"); err == nil {
+		t.Error("effort and reasoning budget together should fail")
+	}
+	if _, err := (GenerationParams{ReasoningExclude: &yes}).Reasoning(""); err == nil {
+		t.Error("reasoning_exclude without reasoning should fail")
+	}
+
+	model := ModelInfo{
+		ID:                  "m",
+		TopProvider:         TopProvider{MaxCompletionTokens: 8000},
+		SupportedParameters: []string{"max_tokens", "temperature"},
+	}
+	if err := model.CheckGenerationParams(GenerationParams{MaxTokens: 8000, Temperature: f(1)}, nil); err != nil {
+		t.Errorf("supported params rejected: %v", err)
+	}
+	if err := model.CheckGenerationParams(GenerationParams{MaxTokens: 9000}, nil); err == nil || !strings.Contains(err.Error(), "8000") {
+		t.Errorf("max_tokens over the limit: %v", err)
+	}
+	if err := model.CheckGenerationParams(GenerationParams{TopP: f(0.9)}, nil); err == nil || !strings.Contains(err.Error(), "top_p") {
+		t.Errorf("unsupported top_p: %v", err)
+	}
+	if err := model.CheckGenerationParams(GenerationParams{}, &ReasoningConfig{Effort: "low"}); err == nil {
+		t.Error("reasoning on a model without reasoning support should fail")
+	}
+}
+
+func TestEstimateImageTokens(t *testing.T) {
+	if got := EstimateImageTokens(750, 100); got != 100 {
+		t.Errorf("small image = %d, want 100", got)
+	}
+	// Large images are scaled so the long edge is imageMaxEdge.
+	large := EstimateImageTokens(4000, 2000)
+	want := EstimateImageTokens(imageMaxEdge, imageMaxEdge/2)
+	if large != want {
+		t.Errorf("large image = %d, want %d", large, want)
+	}
+	if got := EstimateImageTokens(0, 0); got != ImageTokensUnknown {
+		t.Errorf("unknown dims = %d, want %d", got, ImageTokensUnknown)
+	}
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GenerationParams are optional limits and sampling settings for a chat
+// request. They can be set as a config default, per chat, and per send; unset
+// fields (zero or nil) leave the provider's default.
+type GenerationParams struct {
+	MaxTokens          int      `json:"max_tokens,omitempty"`           // output token limit
+	Temperature        *float64 `json:"temperature,omitempty"`          // 0-2
+	TopP               *float64 `json:"top_p,omitempty"`                // (0, 1]
+	ReasoningMaxTokens int      `json:"reasoning_max_tokens,omitempty"` // reasoning token budget
+	ReasoningExclude   *bool    `json:"reasoning_exclude,omitempty"`    // hide reasoning from the response
+}
+
+// ErrInvalidGenerationParams is returned for out-of-range or conflicting
+// generation parameters.
+var ErrInvalidGenerationParams = errors.New("invalid generation parameters")
+
+// Merge returns p with every field that is set in over replaced.
+func (p GenerationParams) Merge(over GenerationParams) GenerationParams {
+	if over.MaxTokens != 0 {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		p.TopP = over.TopP
+	}
+	if over.ReasoningMaxTokens != 0 {
+		p.ReasoningMaxTokens = over.ReasoningMaxTokens
+	}
+	if over.ReasoningExclude != nil {
+		p.ReasoningExclude = over.ReasoningExclude
+	}
+	return p
+}
+
+// IsZero reports whether no parameter is set.
+func (p GenerationParams) IsZero() bool {
+	return p == GenerationParams{}
+}
+
+// Validate checks the parameters on their own, without a model.
+func (p GenerationParams) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidGenerationParams, fmt.Sprintf(format, args...))
+	}
+	if p.MaxTokens < 0 {
+		return invalid("max_tokens must be positive")
+	}
+	if p.ReasoningMaxTokens < 0 {
+		return invalid("reasoning_max_tokens must be positive")
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return invalid("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return invalid("top_p must be greater than 0 and at most 1")
+	}
+	if p.MaxTokens > 0 && p.ReasoningMaxTokens >= p.MaxTokens {
+		return invalid("reasoning_max_tokens (%d) must be less than max_tokens (%d)", p.ReasoningMaxTokens, p.MaxTokens)
+	}
+	return nil
+}
+
+// Reasoning builds the reasoning config for a request with the given effort
+// ("" for none). Returns nil when reasoning is not requested at all. A
+// reasoning token budget and an effort level are mutually exclusive.
+func (p GenerationParams) Reasoning(effort string) (*ReasoningConfig, error) {
+	if effort != "" && p.ReasoningMaxTokens > 0 {
+		return nil, fmt.Errorf("%w: reasoning effort %q and reasoning_max_tokens cannot be used together", ErrInvalidGenerationParams, effort)
+	}
+	exclude := p.ReasoningExclude != nil && *p.ReasoningExclude
+	if effort == "" && p.ReasoningMaxTokens == 0 {
+		if exclude {
+			return nil, fmt.Errorf("%w: reasoning_exclude needs a reasoning effort or reasoning_max_tokens", ErrInvalidGenerationParams)
+		}
+		return nil, nil
+	}
+	return &ReasoningConfig{Effort: effort, MaxTokens: p.ReasoningMaxTokens, Exclude: exclude}, nil
+}
+
+// SupportsParameter reports whether the model lists name in its supported
+// parameters. Models without a list are assumed to support everything.
+func (m ModelInfo) SupportsParameter(name string) bool {
+	if len(m.SupportedParameters) == 0 {
+		return true
+	}
+	for _, param := range m.SupportedParameters {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckGenerationParams returns an error if the model does not accept the
+// parameters or reasoning config, or if max_tokens exceeds its output limit.
+func (m ModelInfo) CheckGenerationParams(p GenerationParams, reasoning *ReasoningConfig) error {
+	unsupported := func(param string) error {
+		return fmt.Errorf("%w: model %s does not support %s", ErrInvalidGenerationParams, m.ID, param)
+	}
+	if p.MaxTokens > 0 {
+		if !m.SupportsParameter("max_tokens") {
+			return unsupported("max_tokens")
+		}
+		if limit := m.TopProvider.MaxCompletionTokens; limit > 0 && p.MaxTokens > limit {
+			return fmt.Errorf("%w: max_tokens %d exceeds the %d output tokens model %s allows", ErrInvalidGenerationParams, p.MaxTokens, limit, m.ID)
+		}
+	}
+	if p.Temperature != nil && !m.SupportsParameter("temperature") {
+		return unsupported("temperature")
+	}
+	if p.TopP != nil && !m.SupportsParameter("top_p") {
+		return unsupported("top_p")
+	}
+	if reasoning != nil && !m.SupportsParameter("reasoning") {
+		return unsupported("reasoning")
+	}
+	return nil
+}
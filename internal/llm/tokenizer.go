@@ -44,3 +44,32 @@ func EstimateTokensSimple(text string) int {
 	}
 	return count
 }
+
+// Image token estimation constants. Providers downscale large images before
+// tokenizing; these mirror the common behavior (long edge capped, roughly one
+// token per 750 pixels).
+const (
+	imageMaxEdge        = 1568
+	imagePixelsPerToken = 750
+	// ImageTokensUnknown is used when an image's dimensions cannot be read.
+	ImageTokensUnknown = 1600
+)
+
+// EstimateImageTokens returns an approximate token count for an image of the
+// given pixel dimensions.
+func EstimateImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return ImageTokensUnknown
+	}
+	w, h := float64(width), float64(height)
+	if long := max(w, h); long > imageMaxEdge {
+		scale := imageMaxEdge / long
+		w *= scale
+		h *= scale
+	}
+	tokens := int(w * h / imagePixelsPerToken)
+	if tokens < 1 {
+		tokens = 1
+	}
+	return tokens
+}
@@ -156,6 +156,64 @@ var EditFileSRMultiTool = Tool{
 	},
 }
 
+// ReportFindingsTool records structured code review findings. It is added to
+// the tools in review mode.
+var ReportFindingsTool = Tool{
+	Type: "function",
+	Function: ToolFunction{
+		Name:        "report_findings",
+		Description: "Report code review findings as structured data.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"findings": map[string]any{
+					"type":        "array",
+					"description": "Findings for the files in context",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"path": map[string]any{
+								"type":        "string",
+								"description": "Relative file path the finding refers to",
+							},
+							"file_id": map[string]any{
+								"type":        "string",
+								"description": "id of the @file version the line numbers refer to",
+							},
+							"start_line": map[string]any{
+								"type":        "integer",
+								"description": "First line of the finding (1-indexed)",
+							},
+							"end_line": map[string]any{
+								"type":        "integer",
+								"description": "Last line of the finding, inclusive (defaults to start_line)",
+							},
+							"severity": map[string]any{
+								"type": "string",
+								"enum": FindingSeverities,
+							},
+							"category": map[string]any{
+								"type":        "string",
+								"description": "Short category, e.g. bug, security, performance, style",
+							},
+							"message": map[string]any{
+								"type":        "string",
+								"description": "What is wrong and why",
+							},
+							"suggested_fix": map[string]any{
+								"type":        "string",
+								"description": "Replacement code or a concrete fix (optional)",
+							},
+						},
+						"required": []string{"path", "start_line", "severity", "category", "message"},
+					},
+				},
+			},
+			"required": []string{"findings"},
+		},
+	},
+}
+
 // DefaultTools returns the tools to include in every request.
 // diffMode controls which tools are exposed:
 //   - "search_replace": write_file + edit_file (search/replace schema)
@@ -185,3 +243,8 @@ func DefaultTools(diffMode string) []Tool {
 		return []Tool{WriteFileTool}
 	}
 }
+
+// ReviewTools returns the tools for diffMode plus report_findings.
+func ReviewTools(diffMode string) []Tool {
+	return append(DefaultTools(diffMode), ReportFindingsTool)
+}
@@ -1,10 +1,18 @@
 package llm
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
 // Request types for OpenRouter/OpenAI-compatible API
 
 // ReasoningConfig controls extended thinking/reasoning for supported models.
 type ReasoningConfig struct {
-	Effort string `json:"effort,omitempty"` // "low", "medium", "high", or empty to disable
+	Effort    string `json:"effort,omitempty"`     // "low", "medium", "high", or empty to disable
+	MaxTokens int    `json:"max_tokens,omitempty"` // reasoning token budget (instead of Effort)
+	Exclude   bool   `json:"exclude,omitempty"`    // reason internally but don't return the reasoning
 }
 
 type ProviderPreferences struct {
@@ -18,6 +26,9 @@ type ChatRequest struct {
 	Tools          []Tool               `json:"tools,omitempty"`
 	Stream         bool                 `json:"stream"`
 	Reasoning      *ReasoningConfig     `json:"reasoning,omitempty"`
+	MaxTokens      int                  `json:"max_tokens,omitempty"`
+	Temperature    *float64             `json:"temperature,omitempty"`
+	TopP           *float64             `json:"top_p,omitempty"`
 	Provider       *ProviderPreferences `json:"provider,omitempty"`
 	PromptCacheKey string               `json:"prompt_cache_key,omitempty"`
 }
@@ -27,6 +38,49 @@ type APIMessage struct {
 	Content    string     `json:"content,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Parts, when set, is sent as a multimodal content array instead of Content.
+	Parts []ContentPart `json:"-"`
+}
+
+// MarshalJSON encodes Content as a plain string, or as an array of content
+// parts when Parts is set (required for image input).
+func (m APIMessage) MarshalJSON() ([]byte, error) {
+	type apiMessageAlias APIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(apiMessageAlias(m))
+	}
+	return json.Marshal(struct {
+		apiMessageAlias
+		Content []ContentPart `json:"content"`
+	}{apiMessageAlias(m), m.Parts})
+}
+
+// ContentPart is one element of a multimodal message content array.
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references image data, either by URL or as a base64 data URL.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // "auto", "low", or "high"
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image content part with the data inlined as a base64 data URL.
+func ImagePart(mediaType string, data []byte) ContentPart {
+	return ContentPart{
+		Type: "image_url",
+		ImageURL: &ImageURL{
+			URL: "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data),
+		},
+	}
 }
 
 type Tool struct {
@@ -97,15 +151,22 @@ type APIError struct {
 	Code    string `json:"code"`
 }
 
+// Finish reasons that end a response early.
+const (
+	FinishReasonLength        = "length"         // hit the output token limit
+	FinishReasonContentFilter = "content_filter" // stopped by the provider's content filter
+)
+
 // StreamEvent represents a parsed event from the SSE stream.
 type StreamEvent struct {
-	Type      string    // "raw", "content", "reasoning", "tool_call", "done", "error"
-	Raw       string    // For "raw" events (verbatim SSE data payload, including "[DONE]")
-	Content   string    // For "content" events
-	Reasoning string    // For "reasoning" events (thinking models)
-	ToolCall  *ToolCall // For "tool_call" events
-	Error     string    // For "error" events
-	Usage     *Usage    // For "done" events, if available
+	Type         string    // "raw", "content", "reasoning", "tool_call", "length", "content_filter", "done", "error"
+	Raw          string    // For "raw" events (verbatim SSE data payload, including "[DONE]")
+	Content      string    // For "content" events
+	Reasoning    string    // For "reasoning" events (thinking models)
+	ToolCall     *ToolCall // For "tool_call" events, and for "length" events that cut off a tool call
+	Error        string    // For "error" events
+	Usage        *Usage    // For "done" events, if available
+	FinishReason string    // For "done" events, if the provider sent one
 }
 
 // WriteFileArgs is the parsed arguments for the write_file tool.
@@ -114,6 +175,26 @@ type WriteFileArgs struct {
 	Content string `json:"content"`
 }
 
+// FindingSeverities are the severities report_findings accepts.
+var FindingSeverities = []string{"error", "warning", "info"}
+
+// FindingArgs is one finding of a report_findings tool call.
+type FindingArgs struct {
+	Path         string `json:"path"`
+	FileID       string `json:"file_id"`
+	StartLine    int    `json:"start_line"`
+	EndLine      int    `json:"end_line"`
+	Severity     string `json:"severity"`
+	Category     string `json:"category"`
+	Message      string `json:"message"`
+	SuggestedFix string `json:"suggested_fix"`
+}
+
+// ReportFindingsArgs is the parsed arguments for the report_findings tool.
+type ReportFindingsArgs struct {
+	Findings []FindingArgs `json:"findings"`
+}
+
 // AnchoredEditChange represents a single change within an anchored edit_file tool call.
 type AnchoredEditChange struct {
 	Start   []string `json:"start"`
@@ -156,17 +237,46 @@ type TopProvider struct {
 	MaxCompletionTokens int `json:"max_completion_tokens"`
 }
 
+// ModelArchitecture describes the input and output modalities of a model.
+type ModelArchitecture struct {
+	Modality         string   `json:"modality,omitempty"` // e.g. "text+image->text"
+	InputModalities  []string `json:"input_modalities,omitempty"`
+	OutputModalities []string `json:"output_modalities,omitempty"`
+}
+
 // ModelInfo from /api/v1/models endpoint.
 type ModelInfo struct {
-	ID                  string       `json:"id"`
-	Name                string       `json:"name"`
-	Description         string       `json:"description"`
-	Created             int64        `json:"created"`
-	ExpirationDate      *string      `json:"expiration_date"`
-	ContextLength       int          `json:"context_length"`
-	Pricing             ModelPricing `json:"pricing"`
-	TopProvider         TopProvider  `json:"top_provider"`
-	SupportedParameters []string     `json:"supported_parameters,omitempty"`
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	Description         string            `json:"description"`
+	Created             int64             `json:"created"`
+	ExpirationDate      *string           `json:"expiration_date"`
+	ContextLength       int               `json:"context_length"`
+	Pricing             ModelPricing      `json:"pricing"`
+	TopProvider         TopProvider       `json:"top_provider"`
+	Architecture        ModelArchitecture `json:"architecture"`
+	SupportedParameters []string          `json:"supported_parameters,omitempty"`
+}
+
+// SupportsImageInput reports whether the model accepts image input.
+// input_modalities is authoritative; the older modality string
+// ("text+image->text") is used when it is absent.
+func (m ModelInfo) SupportsImageInput() bool {
+	if len(m.Architecture.InputModalities) > 0 {
+		for _, modality := range m.Architecture.InputModalities {
+			if modality == "image" {
+				return true
+			}
+		}
+		return false
+	}
+	input, _, _ := strings.Cut(m.Architecture.Modality, "->")
+	for _, modality := range strings.Split(input, "+") {
+		if modality == "image" {
+			return true
+		}
+	}
+	return false
 }
 
 // ModelPricing contains per-token prices in USD.
@@ -120,6 +120,15 @@ func (l *Logger) Info(format string, args ...any) {
 	l.logf("INFO", format, args...)
 }
 
+// Warn logs a warning (file and stderr).
+func (l *Logger) Warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintf(os.Stderr, "BB-7 warning: %s\n", msg)
+	if l.enabled {
+		l.logf("WARN", format, args...)
+	}
+}
+
 // Error logs an error message (file and stderr).
 func (l *Logger) Error(format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
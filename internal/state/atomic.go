@@ -0,0 +1,111 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youruser/bb7/internal/logging"
+)
+
+// Crash-safe writes. State files are written to a temporary file next to
+// the destination, synced, and renamed over it, so a crash or a full disk
+// leaves either the old or the new content. chat.json additionally keeps
+// the previous good version as chat.json.bak.
+
+// tempFileSuffix marks temporary files; fsck removes any left by a crash.
+const tempFileSuffix = ".bb7tmp"
+
+// chatBackupSuffix is appended to chat.json for its backup.
+const chatBackupSuffix = ".bak"
+
+var log = logging.Get()
+
+// ErrChatCorrupt is returned when chat.json and its backup are both unreadable.
+var ErrChatCorrupt = errors.New("chat file is corrupt and has no usable backup")
+
+// writeFileAtomic writes data to path via a synced temporary file and a
+// rename.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*"+tempFileSuffix)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory entry change to disk. Not every platform
+// supports syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// isTempFile reports whether name is a temporary file of writeFileAtomic.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempFileSuffix)
+}
+
+// writeChatFile writes chat.json data to path, first moving the current
+// content to the backup if it is valid JSON. A corrupt file never replaces
+// a good backup.
+func writeChatFile(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && json.Valid(old) {
+		if err := writeFileAtomic(path+chatBackupSuffix, old, 0644); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// readChatFile reads chat.json at path. If it is not valid JSON but the
+// backup is, the backup is returned with a warning; the next save replaces
+// the corrupt file.
+func readChatFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrChatNotFound
+		}
+		return nil, err
+	}
+	if json.Valid(data) {
+		return data, nil
+	}
+	backup, err := os.ReadFile(path + chatBackupSuffix)
+	if err != nil || !json.Valid(backup) {
+		return nil, fmt.Errorf("%w: %s", ErrChatCorrupt, path)
+	}
+	log.Warn("%s is corrupt; loaded %s%s instead (run bb7 fsck -repair to restore it)", path, filepath.Base(path), chatBackupSuffix)
+	return backup, nil
+}
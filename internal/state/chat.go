@@ -26,7 +26,7 @@ func generateID() (string, error) {
 // releasePreviousLock releases the lock on the previously active chat (if any).
 func (s *State) releasePreviousLock() {
 	if s.lockedChatDir != "" {
-		ReleaseLock(s.lockedChatDir)
+		dropLock(s.lockedChatDir)
 		s.lockedChatDir = ""
 	}
 }
@@ -65,9 +65,6 @@ func (s *State) ChatNew(name, model string) (*Chat, error) {
 	}
 
 	chatDir := s.chatDir(id)
-	if err := os.MkdirAll(s.contextDir(id), 0755); err != nil {
-		return nil, err
-	}
 	if err := os.MkdirAll(s.outputDir(id), 0755); err != nil {
 		return nil, err
 	}
@@ -82,7 +79,7 @@ func (s *State) ChatNew(name, model string) (*Chat, error) {
 
 	// Release old lock, acquire new one
 	s.releasePreviousLock()
-	if err := AcquireLock(chatDir); err != nil {
+	if err := holdLock(chatDir); err != nil {
 		// Lock failure is not fatal for chat creation
 	} else {
 		s.lockedChatDir = chatDir
@@ -93,7 +90,8 @@ func (s *State) ChatNew(name, model string) (*Chat, error) {
 	return chat, nil
 }
 
-// ChatList returns summaries of all chats, sorted by creation time (newest first).
+// ChatList returns summaries of all chats that are not archived, sorted by
+// creation time (newest first).
 func (s *State) ChatList() ([]ChatSummary, error) {
 	if err := s.requireInit(); err != nil {
 		return nil, err
@@ -116,13 +114,24 @@ func (s *State) ChatList() ([]ChatSummary, error) {
 		return idx.Chats[i].Created.After(idx.Chats[j].Created)
 	})
 
-	return idx.Chats, nil
+	return filterArchived(idx.Chats, false), nil
 }
 
 type chatSummaryFile struct {
-	ID      string    `json:"id"`
-	Name    string    `json:"name"`
-	Created time.Time `json:"created"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Created   time.Time `json:"created"`
+	ParentID  string    `json:"parent_id"`
+	ForkIndex int       `json:"fork_index"`
+	Archived  bool      `json:"archived"`
+	Pinned    bool      `json:"pinned"`
+	Tags      []string  `json:"tags"`
+	Folder    string    `json:"folder"`
+	Messages  []struct {
+		Role      string        `json:"role"`
+		Timestamp time.Time     `json:"timestamp"`
+		Usage     *MessageUsage `json:"usage"`
+	} `json:"messages"`
 }
 
 // loadChatSummary reads chat.json and extracts only summary fields.
@@ -137,31 +146,26 @@ func (s *State) ChatSelect(id string) (*Chat, error) {
 	}
 
 	chatDir := s.chatDir(id)
-
-	// Check if locked by another process
-	if IsLocked(chatDir) {
-		return nil, ErrChatLocked
+	if err := lockChatDir(chatDir); err != nil {
+		return nil, err
 	}
 
 	chat, err := s.loadChat(id)
 	if err != nil {
+		dropLock(chatDir)
 		return nil, err
 	}
 
-	// Release old lock, acquire new one
+	// Release old lock; the new one is already held
 	s.releasePreviousLock()
-	if err := AcquireLock(chatDir); err != nil {
-		// Lock failure is not fatal
-	} else {
-		s.lockedChatDir = chatDir
-	}
+	s.lockedChatDir = chatDir
 
 	s.ActiveChat = chat
 	s.saveActiveChatID(chat.ID)
 	return chat, nil
 }
 
-// ChatDelete removes a chat by ID.
+// ChatDelete moves a chat to the trash (see trash.go).
 func (s *State) ChatDelete(id string) error {
 	if err := s.requireInit(); err != nil {
 		return err
@@ -183,7 +187,7 @@ func (s *State) ChatDelete(id string) error {
 		s.saveActiveChatID("")
 	}
 
-	if err := os.RemoveAll(chatDir); err != nil {
+	if err := trashChatDir(chatDir, s.trashDirFor(false)); err != nil {
 		return err
 	}
 	if err := s.removeChatIndexEntry(id); err != nil {
@@ -228,11 +232,8 @@ func (s *State) ChatRename(id, name string) error {
 
 // loadChat reads a chat from disk, migrating it if needed.
 func (s *State) loadChat(id string) (*Chat, error) {
-	data, err := os.ReadFile(s.chatJSONPath(id))
+	data, err := readChatFile(s.chatJSONPath(id))
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrChatNotFound
-		}
 		return nil, err
 	}
 
@@ -241,22 +242,15 @@ func (s *State) loadChat(id string) (*Chat, error) {
 		return nil, err
 	}
 
-	if migrateChat(&chat) {
-		// Re-save in new format (lazy migration).
-		_ = s.saveChat(&chat)
-	}
+	// Re-save in new format (lazy migration).
+	migrateLoadedChat(s.chatDir(id), &chat, s.saveChat)
 
 	return &chat, nil
 }
 
 // saveChat writes a chat to disk.
 func (s *State) saveChat(chat *Chat) error {
-	data, err := json.MarshalIndent(chat, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(s.chatJSONPath(chat.ID), data, 0644)
+	return saveChatAt(s.chatDir(chat.ID), chat)
 }
 
 // SaveActiveChat persists the current active chat to disk.
@@ -309,6 +303,7 @@ func (s *State) AddUserMessage(content, model string) error {
 			FileID:    cf.Version,
 			StartLine: cf.StartLine,
 			EndLine:   cf.EndLine,
+			MediaType: cf.MediaType,
 		})
 	}
 
@@ -379,126 +374,32 @@ func (s *State) SetChatName(id, name string) error {
 	return nil
 }
 
-// SearchChats searches through all chats by title and content.
+// SearchChats searches project chats by title and content.
 // If query is empty, returns all chats as title matches.
 // Returns results with match_type indicating whether the match was in title or content.
 func (s *State) SearchChats(query string) ([]ChatSearchResult, error) {
 	if err := s.requireInit(); err != nil {
 		return nil, err
 	}
-
-	entries, err := os.ReadDir(s.chatsDir())
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []ChatSearchResult{}, nil
-		}
-		return nil, err
-	}
-
-	queryLower := strings.ToLower(query)
-	var results []ChatSearchResult
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		chat, err := s.loadChat(entry.Name())
-		if err != nil {
-			continue
-		}
-
-		// Empty query: return all chats as title matches
-		if query == "" {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "title",
-			})
-			continue
-		}
-
-		// Check title match (case-insensitive)
-		if strings.Contains(strings.ToLower(chat.Name), queryLower) {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "title",
-			})
-			continue
-		}
-
-		// Check content match
-		excerpt := searchChatContent(chat, queryLower)
-		if excerpt != "" {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "content",
-				Excerpt:   excerpt,
-			})
-		}
-	}
-
-	// Sort by creation time (newest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Created.After(results[j].Created)
-	})
-
-	return results, nil
-}
-
-// searchChatContent searches through message content for a query.
-// Returns an excerpt with context around the first match, or empty string if no match.
-func searchChatContent(chat *Chat, queryLower string) string {
-	for _, msg := range chat.Messages {
-		text := MessageText(msg)
-		textLower := strings.ToLower(text)
-
-		idx := strings.Index(textLower, queryLower)
-		if idx == -1 {
-			continue
-		}
-
-		// Extract excerpt with context (up to 80 chars around match)
-		start := idx - 30
-		if start < 0 {
-			start = 0
-		}
-		end := idx + len(queryLower) + 50
-		if end > len(text) {
-			end = len(text)
-		}
-
-		excerpt := text[start:end]
-		// Clean up: replace newlines with spaces, trim
-		excerpt = strings.ReplaceAll(excerpt, "\n", " ")
-		excerpt = strings.TrimSpace(excerpt)
-
-		// Add ellipsis if truncated
-		if start > 0 {
-			excerpt = "..." + excerpt
-		}
-		if end < len(text) {
-			excerpt = excerpt + "..."
-		}
-
-		return excerpt
-	}
-
-	return ""
+	return s.Search(query, SearchProject)
 }
 
 // ContextWarning describes an issue restoring a context file during fork.
 type ContextWarning struct {
 	Path            string `json:"path"`
-	Issue           string `json:"issue"` // "modified" or "deleted"
+	Issue           string `json:"issue"` // "modified", "deleted" or "missing"
 	OriginalVersion string `json:"original_version,omitempty"`
 }
 
+// missingIssue returns the warning issue for a snapshot file that is gone
+// from disk: "missing" for images, "deleted" for text files.
+func missingIssue(ref ContextFileRef) string {
+	if ref.MediaType != "" {
+		return "missing"
+	}
+	return "deleted"
+}
+
 // ForkChatResult contains the result of a fork operation.
 type ForkChatResult struct {
 	NewChatID          string           `json:"new_chat_id"`
@@ -551,19 +452,22 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 		Created:         time.Now().UTC(),
 		Model:           sourceChat.Model,
 		ReasoningEffort: sourceChat.ReasoningEffort,
+		Persona:         sourceChat.Persona,
+		Generation:      sourceChat.Generation,
 		Draft:           MessageText(forkMsg), // The fork message becomes the draft
+		ParentID:        sourceChat.ID,
+		ForkIndex:       forkIndex,
 		ContextFiles:    []ContextFile{},
 		Messages:        []Message{},
 	}
 
 	// Create directories for new chat
-	if err := os.MkdirAll(s.contextDir(newID), 0755); err != nil {
-		return nil, err
-	}
 	if err := os.MkdirAll(s.outputDir(newID), 0755); err != nil {
 		os.RemoveAll(s.chatDir(newID))
 		return nil, err
 	}
+	src := snapshotsOf(sourceChat, s.chatDir(chatID))
+	dst := snapshotsOf(newChat, s.chatDir(newID))
 
 	// Copy messages up to (not including) forkIndex
 	if forkIndex > 0 {
@@ -584,17 +488,18 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 				FileID:    cf.Version,
 				StartLine: cf.StartLine,
 				EndLine:   cf.EndLine,
+				MediaType: cf.MediaType,
 			}
 		}
 	}
 
 		for _, ref := range snapshot {
-			// Read content from source chat's context directory
-			srcPath, err := s.contextFilePath(chatID, ref)
+			// Read content from source chat's snapshots
+			srcPath, err := contextRefPathIn(src.contextBase, ref)
 			if err != nil {
 				return nil, err
 			}
-			content, err := os.ReadFile(srcPath)
+			content, err := src.read(srcPath)
 			if err != nil {
 			if os.IsNotExist(err) {
 				warnings = append(warnings, ContextWarning{
@@ -626,10 +531,11 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 			filesystemPath = filepath.Join(s.ProjectRoot, ref.Path)
 		}
 
-		if _, err := os.Stat(filesystemPath); os.IsNotExist(err) {
+		// URL documents have no local file; their snapshot is all there is.
+		if _, err := os.Stat(filesystemPath); os.IsNotExist(err) && !IsURLPath(ref.Path) {
 			warnings = append(warnings, ContextWarning{
 				Path:            ref.Path,
-				Issue:           "deleted",
+				Issue:           missingIssue(ref),
 				OriginalVersion: ref.FileID,
 			})
 			continue // Don't add deleted files to new chat's context
@@ -645,15 +551,12 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 			})
 		}
 
-			// Write to new chat's context directory
-			dstPath, err := s.contextFilePath(newID, ref)
+			// Reference the same object from the new chat
+			dstPath, err := contextRefPathIn(dst.contextBase, ref)
 			if err != nil {
 				return nil, err
 			}
-			if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-				return nil, err
-			}
-		if err := os.WriteFile(dstPath, content, 0644); err != nil {
+		if err := dst.write(dstPath, content); err != nil {
 			return nil, err
 		}
 
@@ -664,6 +567,7 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 			Version:   currentVersion, // Use actual restored content's version
 			StartLine: ref.StartLine,
 			EndLine:   ref.EndLine,
+			MediaType: ref.MediaType,
 		})
 	}
 
@@ -672,8 +576,11 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 		var parts []MessagePart
 		for _, w := range warnings {
 			action := ActionForkWarningModified
-			if w.Issue == "deleted" {
+			switch w.Issue {
+			case "deleted":
 				action = ActionForkWarningDeleted
+			case "missing":
+				action = ActionForkWarningMissing
 			}
 			parts = append(parts, MessagePart{
 				Type:    PartTypeContextEvent,
@@ -700,7 +607,7 @@ func (s *State) ForkChat(chatID string, forkIndex int) (*ForkChatResult, error)
 	// Release old lock, acquire new one
 	s.releasePreviousLock()
 	newChatDir := s.chatDir(newID)
-	if err := AcquireLock(newChatDir); err != nil {
+	if err := holdLock(newChatDir); err != nil {
 		// Lock failure is not fatal
 	} else {
 		s.lockedChatDir = newChatDir
@@ -745,17 +652,19 @@ func (s *State) EditUserMessage(msgIndex int, content string) ([]ContextWarning,
 				FileID:    cf.Version,
 				StartLine: cf.StartLine,
 				EndLine:   cf.EndLine,
+				MediaType: cf.MediaType,
 			}
 		}
 	}
 
+	snapshots := s.activeSnapshots()
 	var restoredContext []ContextFile
 	for _, ref := range snapshot {
-		srcPath, err := s.contextFilePath(s.ActiveChat.ID, ref)
+		srcPath, err := contextRefPathIn(snapshots.contextBase, ref)
 		if err != nil {
 			return nil, err
 		}
-		contentBytes, err := os.ReadFile(srcPath)
+		contentBytes, err := snapshots.read(srcPath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				warnings = append(warnings, ContextWarning{
@@ -784,10 +693,10 @@ func (s *State) EditUserMessage(msgIndex int, content string) ([]ContextWarning,
 			filesystemPath = filepath.Join(s.ProjectRoot, ref.Path)
 		}
 
-		if _, err := os.Stat(filesystemPath); os.IsNotExist(err) {
+		if _, err := os.Stat(filesystemPath); os.IsNotExist(err) && !IsURLPath(ref.Path) {
 			warnings = append(warnings, ContextWarning{
 				Path:            ref.Path,
-				Issue:           "deleted",
+				Issue:           missingIssue(ref),
 				OriginalVersion: ref.FileID,
 			})
 			continue
@@ -809,6 +718,7 @@ func (s *State) EditUserMessage(msgIndex int, content string) ([]ContextWarning,
 			Version:   currentVersion,
 			StartLine: ref.StartLine,
 			EndLine:   ref.EndLine,
+			MediaType: ref.MediaType,
 		})
 	}
 
@@ -844,8 +754,11 @@ func (s *State) EditUserMessage(msgIndex int, content string) ([]ContextWarning,
 		var parts []MessagePart
 		for _, w := range warnings {
 			action := ActionForkWarningModified
-			if w.Issue == "deleted" {
+			switch w.Issue {
+			case "deleted":
 				action = ActionForkWarningDeleted
+			case "missing":
+				action = ActionForkWarningMissing
 			}
 			parts = append(parts, MessagePart{
 				Type:    PartTypeContextEvent,
@@ -899,37 +812,44 @@ func (s *State) ChatNewWithContext(sourceChatID string) (*Chat, error) {
 		Created:         created,
 		Model:           sourceChat.Model,
 		ReasoningEffort: sourceChat.ReasoningEffort,
+		Persona:         sourceChat.Persona,
+		Generation:      sourceChat.Generation,
 		ContextFiles:    []ContextFile{},
 		Messages:        []Message{},
 	}
 
 	// Create directories
-	if err := os.MkdirAll(s.contextDir(newID), 0755); err != nil {
-		return nil, err
-	}
 	if err := os.MkdirAll(s.outputDir(newID), 0755); err != nil {
 		os.RemoveAll(s.chatDir(newID))
 		return nil, err
 	}
+	src := snapshotsOf(sourceChat, s.chatDir(sourceChatID))
+	dst := snapshotsOf(newChat, s.chatDir(newID))
 
-	// Copy context files from source chat, reading fresh content from disk
+	// Copy context files from source chat, reading fresh content from disk.
+	// Files .bb7/policy now denies are left behind.
 	for _, cf := range sourceChat.ContextFiles {
+		if s.CheckPathPolicy(PolicyRead, cf.Path) != nil {
+			continue
+		}
 		ref := ContextFileRef{
 			Path:      cf.Path,
 			FileID:    cf.Version,
 			StartLine: cf.StartLine,
 			EndLine:   cf.EndLine,
+			MediaType: cf.MediaType,
 		}
 
-		// For sections, copy from the source chat's context (sections are immutable)
-		// For full files, read fresh content from the filesystem
+		// For sections, images, and URL documents, copy from the source chat's
+		// context (they are immutable snapshots). For full files, read fresh
+		// content from the filesystem.
 		var content []byte
-		if cf.StartLine > 0 && cf.EndLine > 0 {
-			srcPath, err := s.contextFilePath(sourceChatID, ref)
+		if cf.StartLine > 0 && cf.EndLine > 0 || cf.IsImage() || IsURLPath(cf.Path) {
+			srcPath, err := contextRefPathIn(src.contextBase, ref)
 			if err != nil {
 				continue
 			}
-			content, err = os.ReadFile(srcPath)
+			content, err = src.read(srcPath)
 			if err != nil {
 				continue
 			}
@@ -947,14 +867,11 @@ func (s *State) ChatNewWithContext(sourceChatID string) (*Chat, error) {
 			}
 		}
 
-		dstPath, err := s.contextFilePath(newID, ref)
+		dstPath, err := contextRefPathIn(dst.contextBase, ref)
 		if err != nil {
 			continue
 		}
-		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-			continue
-		}
-		if err := os.WriteFile(dstPath, content, 0644); err != nil {
+		if err := dst.write(dstPath, content); err != nil {
 			continue
 		}
 
@@ -974,7 +891,7 @@ func (s *State) ChatNewWithContext(sourceChatID string) (*Chat, error) {
 
 	s.releasePreviousLock()
 	newChatDir := s.chatDir(newID)
-	if err := AcquireLock(newChatDir); err != nil {
+	if err := holdLock(newChatDir); err != nil {
 		// Lock failure is not fatal
 	} else {
 		s.lockedChatDir = newChatDir
@@ -1017,34 +934,49 @@ func (s *State) ChatNewWithContextGlobal(sourceChatID string) (*Chat, error) {
 		Created:         created,
 		Model:           sourceChat.Model,
 		ReasoningEffort: sourceChat.ReasoningEffort,
+		Persona:         sourceChat.Persona,
+		Generation:      sourceChat.Generation,
 		Global:          true,
 		ContextFiles:    []ContextFile{},
 		Messages:        []Message{},
 	}
 
 	newChatDir := s.globalChatDir(newID)
-	if err := os.MkdirAll(filepath.Join(newChatDir, "context"), 0755); err != nil {
+	if err := os.MkdirAll(newChatDir, 0755); err != nil {
 		return nil, err
 	}
+	src := snapshotsOf(sourceChat, s.globalChatDir(sourceChatID))
+	dst := snapshotsOf(newChat, newChatDir)
 
-	// Copy context files from source chat, reading fresh content from disk
-	srcContextDir := filepath.Join(s.globalChatsDir(), sourceChatID, "context")
+	// Copy context files from source chat, reading fresh content from disk.
+	// Files .bb7/policy now denies are left behind.
 	for _, cf := range sourceChat.ContextFiles {
+		if s.CheckPathPolicy(PolicyRead, cf.Path) != nil {
+			continue
+		}
 		ref := ContextFileRef{
 			Path:      cf.Path,
 			FileID:    cf.Version,
 			StartLine: cf.StartLine,
 			EndLine:   cf.EndLine,
+			MediaType: cf.MediaType,
 		}
 
-		// For sections, copy from source chat's context (sections are immutable)
-		// For full files, read fresh content from the filesystem
+		// For sections, images, and URL documents, copy from source chat's
+		// context (they are immutable snapshots). For full files, read fresh
+		// content from the filesystem.
 		var content []byte
-		if cf.StartLine > 0 && cf.EndLine > 0 {
+		if cf.StartLine > 0 && cf.EndLine > 0 || cf.IsImage() || IsURLPath(cf.Path) {
 			var srcPath string
-			srcPath = filepath.Join(srcContextDir, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine))
+			if cf.IsImage() {
+				srcPath = filepath.Join(src.contextBase, imagesDir, hashPath(ref.Path))
+			} else if IsURLPath(cf.Path) {
+				srcPath = filepath.Join(src.contextBase, externalDir, hashPath(ref.Path))
+			} else {
+				srcPath = filepath.Join(src.contextBase, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine))
+			}
 			var err error
-			content, err = os.ReadFile(srcPath)
+			content, err = src.read(srcPath)
 			if err != nil {
 				continue
 			}
@@ -1058,11 +990,13 @@ func (s *State) ChatNewWithContextGlobal(sourceChatID string) (*Chat, error) {
 		}
 
 		// Determine destination path
-		newContextDir := filepath.Join(newChatDir, "context")
+		newContextDir := dst.contextBase
 		var dstPath string
 		if ref.StartLine > 0 && ref.EndLine > 0 {
 			dstPath = filepath.Join(newContextDir, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine))
-		} else if filepath.IsAbs(ref.Path) {
+		} else if ref.MediaType != "" {
+			dstPath = filepath.Join(newContextDir, imagesDir, hashPath(ref.Path))
+		} else if isExternalRef(ref.Path) {
 			dstPath = filepath.Join(newContextDir, externalDir, hashPath(ref.Path))
 		} else {
 			var joinErr error
@@ -1072,10 +1006,7 @@ func (s *State) ChatNewWithContextGlobal(sourceChatID string) (*Chat, error) {
 			}
 		}
 
-		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-			continue
-		}
-		if err := os.WriteFile(dstPath, content, 0644); err != nil {
+		if err := dst.write(dstPath, content); err != nil {
 			continue
 		}
 
@@ -1094,7 +1025,7 @@ func (s *State) ChatNewWithContextGlobal(sourceChatID string) (*Chat, error) {
 	}
 
 	s.releasePreviousLock()
-	if err := AcquireLock(newChatDir); err != nil {
+	if err := holdLock(newChatDir); err != nil {
 		// Lock failure is not fatal
 	} else {
 		s.lockedChatDir = newChatDir
@@ -1114,16 +1045,17 @@ func saveChatAt(chatDir string, chat *Chat) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(chatPath, data, 0644)
+	if err := writeChatFile(chatPath, data); err != nil {
+		return err
+	}
+	updateSearchIndexAt(filepath.Dir(chatDir), chat)
+	return nil
 }
 
 // loadChatFrom reads a chat from a specific chat.json path, migrating it if needed.
 func loadChatFrom(chatJSONPath string) (*Chat, error) {
-	data, err := os.ReadFile(chatJSONPath)
+	data, err := readChatFile(chatJSONPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrChatNotFound
-		}
 		return nil, err
 	}
 
@@ -1132,13 +1064,14 @@ func loadChatFrom(chatJSONPath string) (*Chat, error) {
 		return nil, err
 	}
 
-	if migrateChat(&chat) {
-		// Re-save in new format (lazy migration).
-		newData, err := json.MarshalIndent(&chat, "", "  ")
-		if err == nil {
-			_ = os.WriteFile(chatJSONPath, newData, 0644)
+	// Re-save in new format (lazy migration).
+	migrateLoadedChat(filepath.Dir(chatJSONPath), &chat, func(chat *Chat) error {
+		newData, err := json.MarshalIndent(chat, "", "  ")
+		if err != nil {
+			return err
 		}
-	}
+		return writeChatFile(chatJSONPath, newData)
+	})
 
 	return &chat, nil
 }
@@ -1176,8 +1109,8 @@ func (s *State) ChatNewGlobal(name, model string) (*Chat, error) {
 	}
 
 	chatDir := s.globalChatDir(id)
-	// Global chats only need a context directory (no output dir)
-	if err := os.MkdirAll(filepath.Join(chatDir, "context"), 0755); err != nil {
+	// Global chats have no output directory
+	if err := os.MkdirAll(chatDir, 0755); err != nil {
 		return nil, err
 	}
 
@@ -1191,7 +1124,7 @@ func (s *State) ChatNewGlobal(name, model string) (*Chat, error) {
 
 	// Release old lock, acquire new one
 	s.releasePreviousLock()
-	if err := AcquireLock(chatDir); err != nil {
+	if err := holdLock(chatDir); err != nil {
 		// Lock failure is not fatal
 	} else {
 		s.lockedChatDir = chatDir
@@ -1202,7 +1135,8 @@ func (s *State) ChatNewGlobal(name, model string) (*Chat, error) {
 	return chat, nil
 }
 
-// ChatListGlobal returns summaries of all global chats, sorted by creation time (newest first).
+// ChatListGlobal returns summaries of all global chats that are not archived,
+// sorted by creation time (newest first).
 func (s *State) ChatListGlobal() ([]ChatSummary, error) {
 	if err := s.ensureGlobalChatsDir(); err != nil {
 		return nil, err
@@ -1226,32 +1160,27 @@ func (s *State) ChatListGlobal() ([]ChatSummary, error) {
 		return idx.Chats[i].Created.After(idx.Chats[j].Created)
 	})
 
-	return idx.Chats, nil
+	return filterArchived(idx.Chats, false), nil
 }
 
 // ChatSelectGlobal loads a global chat by ID and sets it as active.
 func (s *State) ChatSelectGlobal(id string) (*Chat, error) {
 	chatDir := s.globalChatDir(id)
-
-	// Check if locked by another process
-	if IsLocked(chatDir) {
-		return nil, ErrChatLocked
+	if err := lockChatDir(chatDir); err != nil {
+		return nil, err
 	}
 
 	chatPath := s.globalChatJSONPath(id)
 	chat, err := loadChatFrom(chatPath)
 	if err != nil {
+		dropLock(chatDir)
 		return nil, err
 	}
 	chat.Global = true // Ensure the flag is set
 
-	// Release old lock, acquire new one
+	// Release old lock; the new one is already held
 	s.releasePreviousLock()
-	if err := AcquireLock(chatDir); err != nil {
-		// Lock failure is not fatal
-	} else {
-		s.lockedChatDir = chatDir
-	}
+	s.lockedChatDir = chatDir
 
 	s.ActiveChat = chat
 	saveActiveChatIDAt(s.globalChatsDir(), chat.ID)
@@ -1261,7 +1190,7 @@ func (s *State) ChatSelectGlobal(id string) (*Chat, error) {
 	return chat, nil
 }
 
-// ChatDeleteGlobal removes a global chat by ID.
+// ChatDeleteGlobal moves a global chat to the global trash.
 func (s *State) ChatDeleteGlobal(id string) error {
 	chatDir := s.globalChatDir(id)
 	if _, err := os.Stat(chatDir); os.IsNotExist(err) {
@@ -1282,7 +1211,7 @@ func (s *State) ChatDeleteGlobal(id string) error {
 		}
 	}
 
-	if err := os.RemoveAll(chatDir); err != nil {
+	if err := trashChatDir(chatDir, s.trashDirFor(true)); err != nil {
 		return err
 	}
 	if err := removeChatIndexEntryAt(s.globalChatsDir(), id); err != nil {
@@ -1323,70 +1252,7 @@ func (s *State) ChatRenameGlobal(id, name string) error {
 
 // SearchChatsGlobal searches through all global chats by title and content.
 func (s *State) SearchChatsGlobal(query string) ([]ChatSearchResult, error) {
-	if err := s.ensureGlobalChatsDir(); err != nil {
-		return nil, err
-	}
-
-	chatsDir := s.globalChatsDir()
-	entries, err := os.ReadDir(chatsDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []ChatSearchResult{}, nil
-		}
-		return nil, err
-	}
-
-	queryLower := strings.ToLower(query)
-	var results []ChatSearchResult
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		chatPath := filepath.Join(chatsDir, entry.Name(), "chat.json")
-		chat, err := loadChatFrom(chatPath)
-		if err != nil {
-			continue
-		}
-
-		if query == "" {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "title",
-			})
-			continue
-		}
-
-		if strings.Contains(strings.ToLower(chat.Name), queryLower) {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "title",
-			})
-			continue
-		}
-
-		excerpt := searchChatContent(chat, queryLower)
-		if excerpt != "" {
-			results = append(results, ChatSearchResult{
-				ID:        chat.ID,
-				Name:      chat.Name,
-				Created:   chat.Created,
-				MatchType: "content",
-				Excerpt:   excerpt,
-			})
-		}
-	}
-
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Created.After(results[j].Created)
-	})
-
-	return results, nil
+	return s.Search(query, SearchGlobal)
 }
 
 // ChatForceUnlock forcefully removes the lock on a chat.
@@ -1444,16 +1310,22 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 		Created:         time.Now().UTC(),
 		Model:           sourceChat.Model,
 		ReasoningEffort: sourceChat.ReasoningEffort,
+		Persona:         sourceChat.Persona,
+		Generation:      sourceChat.Generation,
 		Global:          true,
 		Draft:           MessageText(forkMsg),
+		ParentID:        sourceChat.ID,
+		ForkIndex:       forkIndex,
 		ContextFiles:    []ContextFile{},
 		Messages:        []Message{},
 	}
 
 	newChatDir := s.globalChatDir(newID)
-	if err := os.MkdirAll(filepath.Join(newChatDir, "context"), 0755); err != nil {
+	if err := os.MkdirAll(newChatDir, 0755); err != nil {
 		return nil, err
 	}
+	src := snapshotsOf(sourceChat, filepath.Join(chatsDir, chatID))
+	dst := snapshotsOf(newChat, newChatDir)
 
 	// Copy messages up to (not including) forkIndex
 	if forkIndex > 0 {
@@ -1472,17 +1344,20 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 				FileID:    cf.Version,
 				StartLine: cf.StartLine,
 				EndLine:   cf.EndLine,
+				MediaType: cf.MediaType,
 			}
 		}
 	}
 
-	srcContextDir := filepath.Join(chatsDir, chatID, "context")
+	srcContextDir := src.contextBase
 	for _, ref := range snapshot {
 		// Determine source path
 		var srcPath string
 		if ref.StartLine > 0 && ref.EndLine > 0 {
 			srcPath = filepath.Join(srcContextDir, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine))
-		} else if filepath.IsAbs(ref.Path) {
+		} else if ref.MediaType != "" {
+			srcPath = filepath.Join(srcContextDir, imagesDir, hashPath(ref.Path))
+		} else if isExternalRef(ref.Path) {
 			srcPath = filepath.Join(srcContextDir, externalDir, hashPath(ref.Path))
 		} else {
 			var joinErr error
@@ -1492,7 +1367,7 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 			}
 		}
 
-		content, err := os.ReadFile(srcPath)
+		content, err := src.read(srcPath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				warnings = append(warnings, ContextWarning{
@@ -1506,10 +1381,10 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 		}
 
 		// Check if file still exists on filesystem
-		if _, err := os.Stat(ref.Path); os.IsNotExist(err) {
+		if _, err := os.Stat(ref.Path); os.IsNotExist(err) && !IsURLPath(ref.Path) {
 			warnings = append(warnings, ContextWarning{
 				Path:            ref.Path,
-				Issue:           "deleted",
+				Issue:           missingIssue(ref),
 				OriginalVersion: ref.FileID,
 			})
 			continue
@@ -1524,12 +1399,14 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 			})
 		}
 
-		// Write to new chat's context directory
-		newContextDir := filepath.Join(newChatDir, "context")
+		// Reference the same object from the new chat
+		newContextDir := dst.contextBase
 		var dstPath string
 		if ref.StartLine > 0 && ref.EndLine > 0 {
 			dstPath = filepath.Join(newContextDir, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine))
-		} else if filepath.IsAbs(ref.Path) {
+		} else if ref.MediaType != "" {
+			dstPath = filepath.Join(newContextDir, imagesDir, hashPath(ref.Path))
+		} else if isExternalRef(ref.Path) {
 			dstPath = filepath.Join(newContextDir, externalDir, hashPath(ref.Path))
 		} else {
 			var joinErr error
@@ -1539,10 +1416,7 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 			}
 		}
 
-		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-			return nil, err
-		}
-		if err := os.WriteFile(dstPath, content, 0644); err != nil {
+		if err := dst.write(dstPath, content); err != nil {
 			return nil, err
 		}
 
@@ -1562,6 +1436,7 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 			Version:   currentVersion,
 			StartLine: ref.StartLine,
 			EndLine:   ref.EndLine,
+			MediaType: ref.MediaType,
 		})
 	}
 
@@ -1569,8 +1444,11 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 		var parts []MessagePart
 		for _, w := range warnings {
 			action := ActionForkWarningModified
-			if w.Issue == "deleted" {
+			switch w.Issue {
+			case "deleted":
 				action = ActionForkWarningDeleted
+			case "missing":
+				action = ActionForkWarningMissing
 			}
 			parts = append(parts, MessagePart{
 				Type:    PartTypeContextEvent,
@@ -1593,7 +1471,7 @@ func (s *State) ForkChatGlobal(chatID string, forkIndex int) (*ForkChatResult, e
 
 	// Release old lock, acquire new one
 	s.releasePreviousLock()
-	if err := AcquireLock(newChatDir); err != nil {
+	if err := holdLock(newChatDir); err != nil {
 		// Lock failure is not fatal
 	} else {
 		s.lockedChatDir = newChatDir
@@ -1640,6 +1518,13 @@ func (s *State) ChatMoveToGlobal(id string) error {
 		return fmt.Errorf("chat ID already exists in global scope")
 	}
 
+	// Snapshot content lives in the object store of each scope
+	if chat, err := loadChatFrom(filepath.Join(srcDir, "chat.json")); err == nil {
+		if err := copyObjects(objectsDirForChat(srcDir), objectsDirForChat(dstDir), chat.Snapshots); err != nil {
+			return fmt.Errorf("failed to copy snapshots: %w", err)
+		}
+	}
+
 	// Move directory (rename if same filesystem, copy+delete otherwise)
 	if err := moveDir(srcDir, dstDir); err != nil {
 		return fmt.Errorf("failed to move chat: %w", err)
@@ -1694,6 +1579,13 @@ func (s *State) ChatMoveToProject(id string) error {
 		return fmt.Errorf("chat ID already exists in project scope")
 	}
 
+	// Snapshot content lives in the object store of each scope
+	if chat, err := loadChatFrom(filepath.Join(srcDir, "chat.json")); err == nil {
+		if err := copyObjects(objectsDirForChat(srcDir), objectsDirForChat(dstDir), chat.Snapshots); err != nil {
+			return fmt.Errorf("failed to copy snapshots: %w", err)
+		}
+	}
+
 	// Move directory (rename if same filesystem, copy+delete otherwise)
 	if err := moveDir(srcDir, dstDir); err != nil {
 		return fmt.Errorf("failed to move chat: %w", err)
@@ -1715,7 +1607,8 @@ func (s *State) ChatMoveToProject(id string) error {
 		chat.Created = time.Now()
 		for i := range chat.ContextFiles {
 			cf := &chat.ContextFiles[i]
-			if cf.External && filepath.IsAbs(cf.Path) && s.ProjectRoot != "" {
+			// Images keep their path: their snapshot is stored under a hash of it.
+			if cf.External && filepath.IsAbs(cf.Path) && s.ProjectRoot != "" && !cf.IsImage() {
 				within, err := IsWithinDir(s.ProjectRoot, cf.Path)
 				if err == nil && within {
 					if rel, err := RelativeToBase(s.ProjectRoot, cf.Path); err == nil {
@@ -6,9 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 )
 
-const chatIndexVersion = 1
+// chatIndexVersion 2 added tags, folder, pinned, last activity, and cost;
+// 3 added token and message counts. Older indexes are rebuilt from the
+// chats on first use.
+const chatIndexVersion = 3
 
 type chatIndex struct {
 	Version         int           `json:"version"`
@@ -45,7 +49,7 @@ func loadChatIndexFrom(chatsDir string) (chatIndex, error) {
 	if idx.Version == 0 {
 		idx.Version = chatIndexVersion
 	}
-	if idx.Version != chatIndexVersion {
+	if idx.Version > chatIndexVersion {
 		return chatIndex{}, errors.New("unsupported chat index version")
 	}
 	return idx, nil
@@ -66,7 +70,7 @@ func writeChatIndexTo(chatsDir string, idx chatIndex) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(chatIndexPathFor(chatsDir), data, 0644)
+	return writeFileAtomic(chatIndexPathFor(chatsDir), data, 0644)
 }
 
 func (s *State) writeChatIndex(idx chatIndex) error {
@@ -89,6 +93,11 @@ func ensureChatIndexAt(chatsDir string) (chatIndex, error) {
 	}
 
 	changed := err != nil
+	if err == nil && idx.Version < chatIndexVersion {
+		// Keep the active chat; reload every summary.
+		idx.Chats = nil
+		changed = true
+	}
 	seen := make(map[string]ChatSummary, len(idx.Chats))
 	for _, chat := range idx.Chats {
 		if chat.ID == "" {
@@ -159,18 +168,13 @@ func updateChatIndexEntryAt(chatsDir string, chat *Chat) error {
 	found := false
 	for i := range idx.Chats {
 		if idx.Chats[i].ID == chat.ID {
-			idx.Chats[i].Name = chat.Name
-			idx.Chats[i].Created = chat.Created
+			idx.Chats[i] = summaryOf(chat)
 			found = true
 			break
 		}
 	}
 	if !found {
-		idx.Chats = append(idx.Chats, ChatSummary{
-			ID:      chat.ID,
-			Name:    chat.Name,
-			Created: chat.Created,
-		})
+		idx.Chats = append(idx.Chats, summaryOf(chat))
 	}
 
 	return writeChatIndexTo(chatsDir, idx)
@@ -213,11 +217,31 @@ func (s *State) saveActiveGlobalChatID(id string) {
 	s.writeChatIndex(idx)
 }
 
-// removeChatIndexEntryAt removes a chat from the index at a chats directory.
+// LastActiveChat returns the chat that was last active according to the
+// index, without selecting it. In global-only mode the global index is used.
+// Returns an empty ID if none is recorded.
+func (s *State) LastActiveChat() (id string, global bool) {
+	if s.GlobalOnly {
+		idx, err := loadChatIndexFrom(s.globalChatsDir())
+		if err != nil {
+			return "", false
+		}
+		return idx.ActiveChatID, idx.ActiveChatID != ""
+	}
+	idx, err := s.loadChatIndex()
+	if err != nil {
+		return "", false
+	}
+	return idx.ActiveChatID, idx.ActiveChatGlobal
+}
+
+// removeChatIndexEntryAt removes a chat from the index (and search index)
+// at a chats directory.
 func removeChatIndexEntryAt(chatsDir string, chatID string) error {
 	if chatID == "" {
 		return nil
 	}
+	removeSearchIndexEntryAt(chatsDir, chatID)
 
 	idx, err := ensureChatIndexAt(chatsDir)
 	if err != nil {
@@ -243,24 +267,69 @@ func (s *State) removeChatIndexEntry(chatID string) error {
 
 // loadChatSummaryFrom reads chat.json and extracts only summary fields.
 func loadChatSummaryFrom(chatJSONPath string) (ChatSummary, error) {
-	file, err := os.Open(chatJSONPath)
+	data, err := readChatFile(chatJSONPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return ChatSummary{}, ErrChatNotFound
-		}
 		return ChatSummary{}, err
 	}
-	defer file.Close()
 
 	var summary chatSummaryFile
-	dec := json.NewDecoder(file)
-	if err := dec.Decode(&summary); err != nil {
+	if err := json.Unmarshal(data, &summary); err != nil {
 		return ChatSummary{}, err
 	}
 
-	return ChatSummary{
-		ID:      summary.ID,
-		Name:    summary.Name,
-		Created: summary.Created,
-	}, nil
+	chat := Chat{
+		ID:        summary.ID,
+		Name:      summary.Name,
+		Created:   summary.Created,
+		ParentID:  summary.ParentID,
+		ForkIndex: summary.ForkIndex,
+		Archived:  summary.Archived,
+		Pinned:    summary.Pinned,
+		Tags:      summary.Tags,
+		Folder:    summary.Folder,
+	}
+	for _, msg := range summary.Messages {
+		chat.Messages = append(chat.Messages, Message{Role: msg.Role, Timestamp: msg.Timestamp, Usage: msg.Usage})
+	}
+	return summaryOf(&chat), nil
+}
+
+// summaryOf returns the index entry for a chat, with its usage totals.
+func summaryOf(chat *Chat) ChatSummary {
+	summary := ChatSummary{
+		ID:           chat.ID,
+		Name:         chat.Name,
+		Created:      chat.Created,
+		ParentID:     chat.ParentID,
+		ForkIndex:    chat.ForkIndex,
+		Archived:     chat.Archived,
+		Pinned:       chat.Pinned,
+		Tags:         chat.Tags,
+		Folder:       chat.Folder,
+		LastActivity: lastActivity(chat),
+	}
+	for _, msg := range chat.Messages {
+		if msg.Role == "user" || msg.Role == "assistant" {
+			summary.MessageCount++
+		}
+		if msg.Usage != nil {
+			summary.PromptTokens += msg.Usage.PromptTokens
+			summary.CompletionTokens += msg.Usage.CompletionTokens
+			summary.CachedTokens += msg.Usage.CachedTokens
+			summary.Cost += msg.Usage.Cost
+		}
+	}
+	summary.CacheHitRatio = cacheHitRatio(summary.CachedTokens, summary.PromptTokens)
+	return summary
+}
+
+// lastActivity returns the time of a chat's last message, or its creation.
+func lastActivity(chat *Chat) time.Time {
+	last := chat.Created
+	for _, msg := range chat.Messages {
+		if msg.Timestamp.After(last) {
+			last = msg.Timestamp
+		}
+	}
+	return last
 }
@@ -41,8 +41,8 @@ func TestChatNew(t *testing.T) {
 	if _, err := os.Stat(filepath.Join(chatDir, "chat.json")); err != nil {
 		t.Errorf("chat.json not created: %v", err)
 	}
-	if _, err := os.Stat(filepath.Join(chatDir, "context")); err != nil {
-		t.Errorf("context dir not created: %v", err)
+	if _, err := os.Stat(filepath.Join(chatDir, "context")); !os.IsNotExist(err) {
+		t.Errorf("context dir created, snapshots belong in the object store: %v", err)
 	}
 	if _, err := os.Stat(filepath.Join(chatDir, "output")); err != nil {
 		t.Errorf("output dir not created: %v", err)
@@ -1707,3 +1707,53 @@ func TestChatMoveRoundTripReadonlyToggle(t *testing.T) {
 		}
 	}
 }
+
+func TestForkChatKeepsURLDocument(t *testing.T) {
+	s := setupTestState(t)
+
+	url := "https://example.com/docs"
+	sourceChat, _ := s.ChatNew("source", "")
+	s.ContextAddURL(url, "# Docs")
+	s.AddUserMessage("Use the docs", "model-1")
+
+	// Fork from the user message (index 1: context_event, user)
+	result, err := s.ForkChat(sourceChat.ID, 1)
+	if err != nil {
+		t.Fatalf("ForkChat failed: %v", err)
+	}
+
+	// URL documents have no local file, so they must not be reported as deleted.
+	if len(result.ContextWarnings) != 0 {
+		t.Errorf("Expected no warnings, got %+v", result.ContextWarnings)
+	}
+	content, err := s.GetContextFile(url)
+	if err != nil {
+		t.Fatalf("GetContextFile failed: %v", err)
+	}
+	if content != "# Docs" {
+		t.Errorf("Expected '# Docs', got %q", content)
+	}
+}
+
+func TestChatNewWithContextCopiesURLDocument(t *testing.T) {
+	s := setupTestState(t)
+
+	url := "https://example.com/docs"
+	sourceChat, _ := s.ChatNew("source", "")
+	s.ContextAddURL(url, "# Docs")
+
+	if _, err := s.ChatNewWithContext(sourceChat.ID); err != nil {
+		t.Fatalf("ChatNewWithContext failed: %v", err)
+	}
+	cf := s.FindContextFile(url)
+	if cf == nil || !cf.External || !cf.ReadOnly {
+		t.Fatalf("Expected URL document in new chat, got %+v", cf)
+	}
+	content, err := s.GetContextFile(url)
+	if err != nil {
+		t.Fatalf("GetContextFile failed: %v", err)
+	}
+	if content != "# Docs" {
+		t.Errorf("Expected '# Docs', got %q", content)
+	}
+}
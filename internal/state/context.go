@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 )
 
@@ -32,16 +31,45 @@ func (s *State) ContextAddWithReadOnly(path, content string, readOnly bool) erro
 		return err
 	}
 
+	if IsURLPath(path) {
+		return s.ContextAddURL(path, content)
+	}
+
 	// Global chat guards
 	if s.ActiveChat.Global {
 		readOnly = true
-		if !filepath.IsAbs(path) {
-			if s.ProjectRoot == "" {
-				return errors.New("global chats require absolute paths when no project is set")
-			}
-			// Convert relative to absolute using project root
-			path = filepath.Join(s.ProjectRoot, path)
+	}
+
+	normalizedPath, isExternal, err := s.normalizeContextPath(path)
+	if err != nil {
+		return err
+	}
+	if err := s.CheckPathPolicy(PolicyRead, normalizedPath); err != nil {
+		return err
+	}
+
+	// Check if already in context after canonicalization.
+	if s.findContextFile(normalizedPath) != nil {
+		return ErrFileExists
+	}
+
+	if isExternal {
+		return s.addExternalFile(normalizedPath, content)
+	}
+
+	return s.addInternalFile(normalizedPath, content, readOnly)
+}
+
+// normalizeContextPath canonicalizes a path for the active chat's context.
+// Absolute paths inside the project become relative (internal); other absolute
+// paths are external. For global chats every path is absolute and external.
+func (s *State) normalizeContextPath(path string) (string, bool, error) {
+	if s.ActiveChat.Global && !filepath.IsAbs(path) {
+		if s.ProjectRoot == "" {
+			return "", false, errors.New("global chats require absolute paths when no project is set")
 		}
+		// Convert relative to absolute using project root
+		path = filepath.Join(s.ProjectRoot, path)
 	}
 
 	normalizedPath := path
@@ -51,13 +79,13 @@ func (s *State) ContextAddWithReadOnly(path, content string, readOnly bool) erro
 			// External file: verify it's actually outside project
 			within, err := IsWithinDir(s.ProjectRoot, path)
 			if err != nil {
-				return err
+				return "", false, err
 			}
 			if within && !s.ActiveChat.Global {
 				// It's inside the project - convert to relative and treat as internal.
 				relPath, err := RelativeToBase(s.ProjectRoot, path)
 				if err != nil {
-					return err
+					return "", false, err
 				}
 				normalizedPath = relPath
 				isExternal = false
@@ -67,7 +95,7 @@ func (s *State) ContextAddWithReadOnly(path, content string, readOnly bool) erro
 	} else {
 		// Internal file: validate relative path.
 		if err := ValidateRelativePath(path); err != nil {
-			return err
+			return "", false, err
 		}
 	}
 
@@ -77,16 +105,23 @@ func (s *State) ContextAddWithReadOnly(path, content string, readOnly bool) erro
 		normalizedPath = path // Keep absolute path
 	}
 
-	// Check if already in context after canonicalization.
-	if s.findContextFile(normalizedPath) != nil {
-		return ErrFileExists
-	}
+	return normalizedPath, isExternal, nil
+}
 
-	if isExternal {
-		return s.addExternalFile(normalizedPath, content)
+// ContextAddURL adds a fetched web document to context. The URL is used as the
+// path and the content is stored like an external file: always read-only and
+// snapshotted under _external. Works for both project and global chats.
+func (s *State) ContextAddURL(url, content string) error {
+	if err := s.requireActiveChat(); err != nil {
+		return err
 	}
-
-	return s.addInternalFile(normalizedPath, content, readOnly)
+	if !IsURLPath(url) {
+		return ErrInvalidPath
+	}
+	if s.findContextFile(url) != nil {
+		return ErrFileExists
+	}
+	return s.addExternalFile(url, content)
 }
 
 // activeContextDir returns the context directory for the active chat.
@@ -106,12 +141,7 @@ func (s *State) addInternalFile(relPath, content string, readOnly bool) error {
 		return err
 	}
 
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+	if err := s.activeSnapshots().write(fullPath, []byte(content)); err != nil {
 		return err
 	}
 
@@ -140,15 +170,12 @@ func (s *State) addInternalFile(relPath, content string, readOnly bool) error {
 func (s *State) addExternalFile(absPath, content string) error {
 	// Store in _external subdirectory with hashed filename to avoid conflicts
 	externalBase := filepath.Join(s.activeContextDir(), externalDir)
-	if err := os.MkdirAll(externalBase, 0755); err != nil {
-		return err
-	}
 
 	// Use hash of absolute path for unique filename, preserve extension
 	storageName := hashPath(absPath)
 	storagePath := filepath.Join(externalBase, storageName)
 
-	if err := os.WriteFile(storagePath, []byte(content), 0644); err != nil {
+	if err := s.activeSnapshots().write(storagePath, []byte(content)); err != nil {
 		return err
 	}
 
@@ -172,10 +199,14 @@ func (s *State) addExternalFile(absPath, content string) error {
 	})
 }
 
-// hashPath creates a storage-safe filename from an absolute path.
+// hashPath creates a storage-safe filename from an absolute path or URL.
 func hashPath(absPath string) string {
 	h := sha256.Sum256([]byte(absPath))
 	hash := hex.EncodeToString(h[:8]) // First 8 bytes = 16 hex chars
+	if IsURLPath(absPath) {
+		// URL "extensions" may carry query strings; documents are stored as markdown.
+		return hash + ".md"
+	}
 	ext := filepath.Ext(absPath)
 	return hash + ext
 }
@@ -240,6 +271,9 @@ func (s *State) ContextAddSection(path string, startLine, endLine int, content s
 		isExternal = true
 		normalizedPath = path
 	}
+	if err := s.CheckPathPolicy(PolicyRead, normalizedPath); err != nil {
+		return err
+	}
 
 	// Check if this exact section already exists after canonicalization.
 	for _, cf := range s.ActiveChat.ContextFiles {
@@ -250,14 +284,11 @@ func (s *State) ContextAddSection(path string, startLine, endLine int, content s
 
 	// Store in _sections subdirectory with hashed filename
 	sectionsBase := filepath.Join(s.activeContextDir(), sectionsDir)
-	if err := os.MkdirAll(sectionsBase, 0755); err != nil {
-		return err
-	}
 
 	storageName := hashSectionKey(normalizedPath, startLine, endLine)
 	storagePath := filepath.Join(sectionsBase, storageName)
 
-	if err := os.WriteFile(storagePath, []byte(content), 0644); err != nil {
+	if err := s.activeSnapshots().write(storagePath, []byte(content)); err != nil {
 		return err
 	}
 
@@ -382,6 +413,13 @@ func (s *State) ContextSetReadOnly(path string, readOnly bool) error {
 		return nil
 	}
 
+	if cf.IsImage() {
+		if !readOnly {
+			return ErrImageReadOnly
+		}
+		return nil
+	}
+
 	if readOnly {
 		if _, err := s.GetOutputFile(path); err == nil {
 			return ErrContextModified
@@ -425,6 +463,14 @@ func (s *State) ContextUpdate(path, content string) error {
 	if cf == nil {
 		return ErrFileNotFound
 	}
+	if cf.IsImage() {
+		// Image snapshots are replaced by removing and re-adding them.
+		return ErrImageReadOnly
+	}
+	// A file added before a rule denied it is not refreshed either.
+	if err := s.CheckPathPolicy(PolicyRead, cf.Path); err != nil {
+		return err
+	}
 
 	prevVersion := cf.Version
 	if prevVersion == "" {
@@ -440,7 +486,7 @@ func (s *State) ContextUpdate(path, content string) error {
 		return err
 	}
 
-	if err := os.WriteFile(storagePath, []byte(content), 0644); err != nil {
+	if err := s.activeSnapshots().write(storagePath, []byte(content)); err != nil {
 		return err
 	}
 
@@ -484,7 +530,7 @@ func (s *State) GetContextFile(path string) (string, error) {
 		return "", err
 	}
 
-	data, err := os.ReadFile(storagePath)
+	data, err := s.activeSnapshots().read(storagePath)
 	if err != nil {
 		return "", err
 	}
@@ -509,12 +555,22 @@ func (s *State) contextStoragePath(cf *ContextFile) (string, error) {
 	} else {
 		contextBase = s.contextDir(s.ActiveChat.ID)
 	}
+	return contextStoragePathIn(contextBase, cf)
+}
 
+// contextStoragePathIn returns the snapshot path for a context file under the
+// given context directory.
+func contextStoragePathIn(contextBase string, cf *ContextFile) (string, error) {
 	// Sections are stored in _sections subdirectory
 	if cf.StartLine > 0 && cf.EndLine > 0 {
 		return filepath.Join(contextBase, sectionsDir, hashSectionKey(cf.Path, cf.StartLine, cf.EndLine)), nil
 	}
 
+	// Images are stored in _images subdirectory
+	if cf.IsImage() {
+		return filepath.Join(contextBase, imagesDir, hashPath(cf.Path)), nil
+	}
+
 	if cf.External {
 		return filepath.Join(contextBase, externalDir, hashPath(cf.Path)), nil
 	}
@@ -581,23 +637,21 @@ func (s *State) HasContextFile(path string) bool {
 	return s.findContextFile(path) != nil
 }
 
-// contextFilePath returns the storage path for a context file given a chat ID and ContextFileRef.
-// This is used by ForkChat/EditUserMessage to read context files from snapshots.
-func (s *State) contextFilePath(chatID string, ref ContextFileRef) (string, error) {
-	var contextBase string
-	if s.ActiveChat != nil && s.ActiveChat.Global {
-		contextBase = s.globalContextDir(chatID)
-	} else {
-		contextBase = s.contextDir(chatID)
-	}
-
+// contextRefPathIn returns the storage path of a snapshot reference under a
+// chat's context directory.
+func contextRefPathIn(contextBase string, ref ContextFileRef) (string, error) {
 	// Sections are stored in _sections subdirectory
 	if ref.StartLine > 0 && ref.EndLine > 0 {
 		return filepath.Join(contextBase, sectionsDir, hashSectionKey(ref.Path, ref.StartLine, ref.EndLine)), nil
 	}
 
-	// External files are stored in _external subdirectory
-	if filepath.IsAbs(ref.Path) {
+	// Images are stored in _images subdirectory
+	if ref.MediaType != "" {
+		return filepath.Join(contextBase, imagesDir, hashPath(ref.Path)), nil
+	}
+
+	// External files and URL documents are stored in _external subdirectory
+	if isExternalRef(ref.Path) {
 		return filepath.Join(contextBase, externalDir, hashPath(ref.Path)), nil
 	}
 
@@ -761,3 +761,75 @@ func TestContextAddGlobalChatRejectsRelativeWithoutProject(t *testing.T) {
 		t.Error("Expected error for relative path in global chat without project root")
 	}
 }
+
+func TestContextAddURL(t *testing.T) {
+	s := setupTestState(t)
+	s.ChatNew("test", "")
+
+	url := "https://example.com/docs/api?v=2"
+	if err := s.ContextAddURL(url, "# API\n\nDocs"); err != nil {
+		t.Fatalf("ContextAddURL failed: %v", err)
+	}
+
+	cf := s.FindContextFile(url)
+	if cf == nil {
+		t.Fatal("Expected URL document in context")
+	}
+	if !cf.External || !cf.ReadOnly {
+		t.Errorf("Expected external read-only entry, got %+v", cf)
+	}
+	if cf.Version != HashFileVersion(url, "# API\n\nDocs") {
+		t.Errorf("Unexpected version %q", cf.Version)
+	}
+
+	content, err := s.GetContextFile(url)
+	if err != nil {
+		t.Fatalf("GetContextFile failed: %v", err)
+	}
+	if content != "# API\n\nDocs" {
+		t.Errorf("Expected stored document, got %q", content)
+	}
+
+	// Stored under _external as markdown, not in a path derived from the URL.
+	storage := filepath.Join(s.contextDir(s.ActiveChat.ID), externalDir, hashPath(url))
+	if filepath.Ext(storage) != ".md" {
+		t.Errorf("Expected .md storage name, got %q", storage)
+	}
+
+	if err := s.ContextAddURL(url, "again"); err != ErrFileExists {
+		t.Errorf("Expected ErrFileExists, got %v", err)
+	}
+	if err := s.ContextAddURL("ftp://example.com/x", "x"); err != ErrInvalidPath {
+		t.Errorf("Expected ErrInvalidPath for non-http URL, got %v", err)
+	}
+}
+
+func TestContextAddRoutesURLs(t *testing.T) {
+	s := setupTestState(t)
+	s.ChatNew("test", "")
+
+	// A URL passed to ContextAdd must not be treated as a relative project path.
+	if err := s.ContextAdd("https://example.com/page", "doc"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	cf := s.FindContextFile("https://example.com/page")
+	if cf == nil || !cf.External {
+		t.Fatalf("Expected external URL entry, got %+v", cf)
+	}
+}
+
+func TestContextAddURLGlobal(t *testing.T) {
+	s := setupGlobalTestState(t)
+	s.ChatNewGlobal("global", "")
+
+	if err := s.ContextAddURL("https://example.com/page", "doc"); err != nil {
+		t.Fatalf("ContextAddURL failed: %v", err)
+	}
+	content, err := s.GetContextFile("https://example.com/page")
+	if err != nil {
+		t.Fatalf("GetContextFile failed: %v", err)
+	}
+	if content != "doc" {
+		t.Errorf("Expected 'doc', got %q", content)
+	}
+}
@@ -0,0 +1,125 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory instructions. A BB7.md file in a project directory applies to
+// every context file at or below that directory, so a monorepo can keep
+// package-specific instructions next to the code. The files that apply are
+// sent after the project instructions, ordered from the project root to the
+// deepest directory. They support @@ comments, @include (relative to the
+// project root) and @when blocks like .bb7/instructions, and must resolve to
+// a file inside the project.
+
+const directoryInstructionsFilename = "BB7.md"
+
+// DirectoryInstructions is a BB7.md file that applies to the active chat.
+type DirectoryInstructions struct {
+	Path  string `json:"path"`            // relative to the project root
+	Error string `json:"error,omitempty"` // parse or path error; blocks sending
+}
+
+type directoryInstructionsFile struct {
+	rel      string // project-relative path
+	resolved string // absolute path with symlinks resolved
+	err      error
+}
+
+// directoryInstructionsFiles finds the BB7.md files in the directories that
+// contain the active chat's project context files, root to leaf. Files that
+// resolve to the same path are listed once.
+func (s *State) directoryInstructionsFiles() []directoryInstructionsFile {
+	if s.ProjectRoot == "" || s.GlobalOnly || s.ActiveChat == nil || s.ActiveChat.Global {
+		return nil
+	}
+
+	seenDirs := map[string]bool{}
+	for _, cf := range s.ActiveChat.ContextFiles {
+		if cf.External || filepath.IsAbs(cf.Path) {
+			continue
+		}
+		dir := filepath.Dir(filepath.Clean(cf.Path))
+		for !seenDirs[dir] {
+			seenDirs[dir] = true
+			if dir == "." || dir == ".." || strings.HasPrefix(dir, ".."+string(os.PathSeparator)) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	var files []directoryInstructionsFile
+	seenFiles := map[string]bool{}
+	for dir := range seenDirs {
+		rel := filepath.Join(dir, directoryInstructionsFilename)
+		if _, err := os.Lstat(filepath.Join(s.ProjectRoot, rel)); err != nil {
+			continue
+		}
+		resolved, err := resolveIncludePath(s.ProjectRoot, rel)
+		if err == nil {
+			if seenFiles[resolved] {
+				continue
+			}
+			seenFiles[resolved] = true
+		}
+		files = append(files, directoryInstructionsFile{rel: rel, resolved: resolved, err: err})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		di := strings.Count(files[i].rel, string(os.PathSeparator))
+		dj := strings.Count(files[j].rel, string(os.PathSeparator))
+		if di != dj {
+			return di < dj
+		}
+		return files[i].rel < files[j].rel
+	})
+	return files
+}
+
+// DirectoryInstructionsInfo lists the BB7.md files that apply to the active
+// chat, with the error of any that can't be used.
+func (s *State) DirectoryInstructionsInfo() []DirectoryInstructions {
+	var result []DirectoryInstructions
+	for _, f := range s.directoryInstructionsFiles() {
+		info := DirectoryInstructions{Path: filepath.ToSlash(f.rel)}
+		err := f.err
+		if err == nil {
+			_, _, err = s.loadProjectScopedFile("directory", f.resolved, InstructionScope{})
+		}
+		if err != nil {
+			info.Error = err.Error()
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// buildDirectoryInstructions renders the BB7.md files that apply, each in
+// its own tag.
+func (s *State) buildDirectoryInstructions(scope InstructionScope) (string, []InstructionBlock, error) {
+	var result string
+	var blocks []InstructionBlock
+	for _, f := range s.directoryInstructionsFiles() {
+		if f.err != nil {
+			return "", nil, &instructionsParseError{Path: filepath.Join(s.ProjectRoot, f.rel), Message: f.err.Error()}
+		}
+		content, fileBlocks, err := s.loadProjectScopedFile("directory", f.resolved, scope)
+		if err != nil {
+			return "", nil, err
+		}
+		blocks = append(blocks, fileBlocks...)
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		result += "<directory-instructions source=\"" + filepath.ToSlash(f.rel) + "\">\n"
+		result += content
+		if content[len(content)-1] != '\n' {
+			result += "\n"
+		}
+		result += "</directory-instructions>\n\n"
+	}
+	return result, blocks, nil
+}
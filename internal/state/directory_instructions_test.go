@@ -0,0 +1,106 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProjectFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir %s: %v", rel, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", rel, err)
+	}
+}
+
+func TestDirectoryInstructionsRootToLeaf(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	if _, err := s.ChatNew("test", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	root := s.ProjectRoot
+	writeProjectFile(t, root, "BB7.md", "root rules\n")
+	writeProjectFile(t, root, "services/BB7.md", "services rules\n@include services/STYLE.md\n")
+	writeProjectFile(t, root, "services/STYLE.md", "service style\n")
+	writeProjectFile(t, root, "services/api/BB7.md", "api rules\n")
+	writeProjectFile(t, root, "web/BB7.md", "web rules\n")
+	s.ActiveChat.ContextFiles = []ContextFile{
+		{Path: "services/api/handler.go"},
+		{Path: "services/worker.go"},
+	}
+
+	block, err := s.BuildInstructionsBlock()
+	if err != nil {
+		t.Fatalf("BuildInstructionsBlock failed: %v", err)
+	}
+	order := []string{
+		`<directory-instructions source="BB7.md">` + "\nroot rules\n",
+		`<directory-instructions source="services/BB7.md">` + "\nservices rules\nservice style\n",
+		`<directory-instructions source="services/api/BB7.md">` + "\napi rules\n",
+	}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(block, want)
+		if i < 0 || i < last {
+			t.Fatalf("block missing or out of order %q:\n%s", want, block)
+		}
+		last = i
+	}
+	if strings.Count(block, "services rules") != 1 {
+		t.Error("a directory shared by two context files should be included once")
+	}
+	if strings.Contains(block, "web rules") {
+		t.Error("BB7.md outside the context directories should not be included")
+	}
+
+	info := s.GetInstructionsInfo()
+	if len(info.Directories) != 3 || info.Directories[2].Path != "services/api/BB7.md" {
+		t.Errorf("info.Directories = %+v", info.Directories)
+	}
+}
+
+func TestDirectoryInstructionsErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	if _, err := s.ChatNew("test", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	writeProjectFile(t, s.ProjectRoot, "pkg/BB7.md", "@include ../../outside.md\n")
+	s.ActiveChat.ContextFiles = []ContextFile{{Path: "pkg/a.go"}}
+
+	if _, err := s.BuildInstructionsBlock(); err == nil || !strings.Contains(err.Error(), "escapes project root") {
+		t.Errorf("expected include error, got %v", err)
+	}
+	info := s.GetInstructionsInfo()
+	if len(info.Directories) != 1 || info.Directories[0].Error == "" {
+		t.Errorf("expected directory error in info, got %+v", info.Directories)
+	}
+
+	// A BB7.md symlinked to a file outside the project is rejected.
+	outside := filepath.Join(t.TempDir(), "BB7.md")
+	if err := os.WriteFile(outside, []byte("outside\n"), 0644); err != nil {
+		t.Fatalf("write outside: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(s.ProjectRoot, "lib"), 0755); err != nil {
+		t.Fatalf("mkdir lib: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(s.ProjectRoot, "lib", "BB7.md")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	s.ActiveChat.ContextFiles = []ContextFile{{Path: "lib/b.go"}}
+	if _, err := s.BuildInstructionsBlock(); err == nil || !strings.Contains(err.Error(), "escapes project root") {
+		t.Errorf("expected symlink escape error, got %v", err)
+	}
+
+	// Global chats never use directory instructions.
+	s.ActiveChat.Global = true
+	if _, err := s.BuildInstructionsBlock(); err != nil {
+		t.Errorf("global chat should ignore BB7.md files, got %v", err)
+	}
+}
@@ -51,6 +51,14 @@ func (s *State) EstimateTokens(systemPrompt string, inputText string) (*TokenEst
 	for _, cf := range s.ActiveChat.ContextFiles {
 		fileInfo := FileTokenInfo{Path: cf.Path}
 
+		if cf.IsImage() {
+			fileInfo.OriginalTokens = s.imageTokens(&cf)
+			fileInfo.Tokens = fileInfo.OriginalTokens
+			estimate.ContextFiles += fileInfo.Tokens
+			estimate.Files = append(estimate.Files, fileInfo)
+			continue
+		}
+
 		// Get original context content
 		originalContent, err := s.GetContextFile(cf.Path)
 		if err != nil {
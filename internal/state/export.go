@@ -0,0 +1,137 @@
+package state
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Bundle format identifiers. BundleVersion is bumped when the bundle layout
+// changes incompatibly; chat_import rejects newer versions.
+const (
+	BundleFormat  = "bb7-chat"
+	BundleVersion = 1
+)
+
+// ChatBundle is a self-contained copy of a chat: the chat record plus the
+// context and output snapshots it references. It is the JSON export format
+// and the input to chat import.
+type ChatBundle struct {
+	Format     string       `json:"format"`
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Global     bool         `json:"global,omitempty"` // Exported from global scope
+	Chat       Chat         `json:"chat"`
+	Context    []BundleFile `json:"context"`          // One entry per chat.ContextFiles item
+	Output     []BundleFile `json:"output,omitempty"` // Pending LLM output (project chats only)
+}
+
+// BundleFile is a snapshot stored in a bundle. Text content is stored as-is;
+// images are stored as bytes (base64 in JSON).
+type BundleFile struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Content   string `json:"content,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+// FindContext returns the bundled snapshot for a full (non-section) context
+// file, or nil.
+func (b *ChatBundle) FindContext(path string) *BundleFile {
+	for i := range b.Context {
+		f := &b.Context[i]
+		if f.Path == path && f.StartLine == 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+// ExportChat reads a chat and its snapshots from disk into a bundle. The chat
+// is not selected or locked, so chats open in another instance can be
+// exported. Missing snapshots are skipped rather than failing the export.
+func (s *State) ExportChat(id string, global bool) (*ChatBundle, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	if !global && s.ProjectRoot == "" {
+		return nil, ErrNotInitialized
+	}
+	chatDir, err := SafeJoin(s.chatsDirFor(global), id)
+	if err != nil {
+		return nil, ErrChatNotFound
+	}
+
+	chat, err := loadChatFrom(filepath.Join(chatDir, "chat.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &ChatBundle{
+		Format:     BundleFormat,
+		Version:    BundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Global:     global,
+		Chat:       *chat,
+	}
+	// Object hashes mean nothing outside this store; content travels below.
+	bundle.Chat.Snapshots = nil
+
+	snapshots := snapshotsOf(chat, chatDir)
+	for i := range chat.ContextFiles {
+		cf := &chat.ContextFiles[i]
+		storagePath, err := contextStoragePathIn(snapshots.contextBase, cf)
+		if err != nil {
+			continue
+		}
+		data, err := snapshots.read(storagePath)
+		if err != nil {
+			continue
+		}
+		f := BundleFile{
+			Path:      cf.Path,
+			StartLine: cf.StartLine,
+			EndLine:   cf.EndLine,
+			MediaType: cf.MediaType,
+		}
+		if cf.IsImage() {
+			f.Data = data
+		} else {
+			f.Content = string(data)
+		}
+		bundle.Context = append(bundle.Context, f)
+	}
+
+	outputBase := filepath.Join(chatDir, "output")
+	err = filepath.WalkDir(outputBase, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(outputBase, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		bundle.Output = append(bundle.Output, BundleFile{Path: filepath.ToSlash(rel), Content: string(data)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(bundle.Output, func(i, j int) bool { return bundle.Output[i].Path < bundle.Output[j].Path })
+
+	return bundle, nil
+}
@@ -0,0 +1,81 @@
+package state
+
+import (
+	"testing"
+)
+
+func TestExportChat(t *testing.T) {
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("export me", "test-model")
+	s.ContextAdd("main.go", "package main\n")
+	s.ContextAddSection("util.go", 2, 3, "func a() {}\nfunc b() {}")
+	s.ContextAddImage("shot.png", testPNG(t, 2, 2))
+	s.AddUserMessage("change it", "test-model")
+	s.WriteOutputFile("main.go", "package main\n\nfunc main() {}\n")
+
+	// Exporting does not require the chat to be active.
+	other, _ := s.ChatNew("other", "")
+	if s.ActiveChat.ID != other.ID {
+		t.Fatal("Expected other chat to be active")
+	}
+
+	bundle, err := s.ExportChat(chat.ID, false)
+	if err != nil {
+		t.Fatalf("ExportChat failed: %v", err)
+	}
+	if bundle.Format != BundleFormat || bundle.Version != BundleVersion || bundle.Global {
+		t.Errorf("Unexpected bundle header: %+v", bundle)
+	}
+	if bundle.Chat.ID != chat.ID || len(bundle.Chat.Messages) == 0 {
+		t.Errorf("Unexpected bundled chat: %+v", bundle.Chat)
+	}
+	if len(bundle.Context) != 3 {
+		t.Fatalf("Expected 3 context snapshots, got %d", len(bundle.Context))
+	}
+	if f := bundle.FindContext("main.go"); f == nil || f.Content != "package main\n" {
+		t.Errorf("Unexpected main.go snapshot: %+v", f)
+	}
+	var section, image *BundleFile
+	for i := range bundle.Context {
+		switch bundle.Context[i].Path {
+		case "util.go":
+			section = &bundle.Context[i]
+		case "shot.png":
+			image = &bundle.Context[i]
+		}
+	}
+	if section == nil || section.StartLine != 2 || section.Content != "func a() {}\nfunc b() {}" {
+		t.Errorf("Unexpected section snapshot: %+v", section)
+	}
+	if image == nil || image.MediaType != "image/png" || len(image.Data) == 0 || image.Content != "" {
+		t.Errorf("Unexpected image snapshot: %+v", image)
+	}
+	if len(bundle.Output) != 1 || bundle.Output[0].Path != "main.go" {
+		t.Errorf("Unexpected output: %+v", bundle.Output)
+	}
+
+	if _, err := s.ExportChat("missing", false); err != ErrChatNotFound {
+		t.Errorf("Expected ErrChatNotFound, got %v", err)
+	}
+	if _, err := s.ExportChat("../..", false); err != ErrChatNotFound {
+		t.Errorf("Expected ErrChatNotFound for escaping ID, got %v", err)
+	}
+}
+
+func TestExportChatGlobal(t *testing.T) {
+	s := setupGlobalTestState(t)
+	chat, _ := s.ChatNewGlobal("global export", "")
+	s.AddUserMessage("hello", "m")
+
+	bundle, err := s.ExportChat(chat.ID, true)
+	if err != nil {
+		t.Fatalf("ExportChat failed: %v", err)
+	}
+	if !bundle.Global || bundle.Chat.Name != "global export" || len(bundle.Output) != 0 {
+		t.Errorf("Unexpected bundle: %+v", bundle)
+	}
+
+	if _, err := s.ExportChat(chat.ID, false); err != ErrNotInitialized {
+		t.Errorf("Expected ErrNotInitialized for project export in global-only mode, got %v", err)
+	}
+}
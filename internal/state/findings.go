@@ -0,0 +1,149 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Review findings. In review mode the assistant reports findings through the
+// report_findings tool; each one is stored as a "finding" part of the
+// assistant message. A finding is tied to the version of the file its line
+// numbers refer to, and is identified by a key derived from its location and
+// message so the same issue reported again in a later turn is recognized.
+
+// Finding is a single code review finding.
+type Finding struct {
+	ID           string `json:"id"`                // stable across turns for the same issue
+	Path         string `json:"path"`              // relative to the project root
+	FileID       string `json:"file_id,omitempty"` // file version the lines refer to
+	StartLine    int    `json:"start_line"`
+	EndLine      int    `json:"end_line"`
+	Severity     string `json:"severity"` // "error", "warning", or "info"
+	Category     string `json:"category,omitempty"`
+	Message      string `json:"message"`
+	SuggestedFix string `json:"suggested_fix,omitempty"`
+}
+
+// FindingStatus is a finding as returned by Findings.
+type FindingStatus struct {
+	Finding
+	MessageIndex int  `json:"message_index"` // message that last reported it
+	Stale        bool `json:"stale"`         // the file changed since it was reported
+}
+
+// findingID derives a finding's ID from its path, lines, category and
+// message (case and whitespace insensitive).
+func findingID(f Finding) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+	key := strings.Join([]string{
+		f.Path,
+		strconv.Itoa(f.StartLine),
+		strconv.Itoa(f.EndLine),
+		normalize(f.Category),
+		normalize(f.Message),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// contextFileVersion returns the version of the full (non-section) context
+// file at path, or "" if it is not in context.
+func (s *State) contextFileVersion(path string) string {
+	for _, cf := range s.ActiveChat.ContextFiles {
+		if cf.Path == path && cf.StartLine == 0 {
+			return cf.Version
+		}
+	}
+	return ""
+}
+
+// NewFinding fills in a finding's ID and, when the reporter did not give
+// one, the file version from the active chat's context.
+func (s *State) NewFinding(f Finding) Finding {
+	if f.FileID == "" {
+		f.FileID = s.contextFileVersion(f.Path)
+	}
+	f.ID = findingID(f)
+	return f
+}
+
+// AppendFindingParts appends a part for each finding that the active chat
+// has not already recorded for the same file version, and returns the
+// extended parts and the number of findings dropped as duplicates.
+func (s *State) AppendFindingParts(parts []MessagePart, findings []Finding) ([]MessagePart, int) {
+	seen := make(map[string]bool)
+	key := func(f *Finding) string { return f.ID + "@" + f.FileID }
+	for _, msg := range s.ActiveChat.Messages {
+		for _, part := range msg.Parts {
+			if part.Type == PartTypeFinding && part.Finding != nil {
+				seen[key(part.Finding)] = true
+			}
+		}
+	}
+	dropped := 0
+	for i := range findings {
+		f := findings[i]
+		if seen[key(&f)] {
+			dropped++
+			continue
+		}
+		seen[key(&f)] = true
+		parts = append(parts, MessagePart{Type: PartTypeFinding, Finding: &f})
+	}
+	return parts, dropped
+}
+
+// Findings returns the active chat's findings, one per ID in the order they
+// were first reported. When an issue was reported more than once, the latest
+// report wins. A finding is stale when its file's context version has
+// changed since, or the file has left the context.
+func (s *State) Findings() ([]FindingStatus, error) {
+	if err := s.requireActiveChat(); err != nil {
+		return nil, err
+	}
+	var result []FindingStatus
+	index := make(map[string]int)
+	for i, msg := range s.ActiveChat.Messages {
+		for _, part := range msg.Parts {
+			if part.Type != PartTypeFinding || part.Finding == nil {
+				continue
+			}
+			status := FindingStatus{Finding: *part.Finding, MessageIndex: i}
+			if pos, ok := index[status.ID]; ok {
+				result[pos] = status
+				continue
+			}
+			index[status.ID] = len(result)
+			result = append(result, status)
+		}
+	}
+	for i := range result {
+		if result[i].FileID != "" {
+			result[i].Stale = s.contextFileVersion(result[i].Path) != result[i].FileID
+		}
+	}
+	return result, nil
+}
+
+// FormatFinding renders a finding as plain text: a "path:lines severity
+// [category]: message" line, followed by the suggested fix if there is one.
+func FormatFinding(f Finding) string {
+	var b strings.Builder
+	b.WriteString(f.Path + ":" + strconv.Itoa(f.StartLine))
+	if f.EndLine > f.StartLine {
+		b.WriteString("-" + strconv.Itoa(f.EndLine))
+	}
+	b.WriteString(" " + f.Severity)
+	if f.Category != "" {
+		b.WriteString(" [" + f.Category + "]")
+	}
+	b.WriteString(": " + f.Message)
+	if f.SuggestedFix != "" {
+		b.WriteString("\nSuggested fix:\n" + strings.TrimRight(f.SuggestedFix, "\n"))
+	}
+	return b.String()
+}
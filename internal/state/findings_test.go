@@ -0,0 +1,62 @@
+package state
+
+import "testing"
+
+func TestFindingsDedupAndStaleness(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	if _, err := s.ChatNew("test", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.ContextAdd("main.go", "package main\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	version := s.ActiveChat.ContextFiles[0].Version
+
+	race := s.NewFinding(Finding{Path: "main.go", StartLine: 3, EndLine: 5, Severity: "error", Category: "bug", Message: "Data race on counter"})
+	if race.FileID != version || race.ID == "" {
+		t.Fatalf("NewFinding = %+v, want file version %s", race, version)
+	}
+	// Same issue worded with different case and spacing.
+	again := s.NewFinding(Finding{Path: "main.go", StartLine: 3, EndLine: 5, Severity: "warning", Category: "Bug", Message: "data  race on counter"})
+	if again.ID != race.ID {
+		t.Errorf("rephrased finding got a new ID: %s vs %s", again.ID, race.ID)
+	}
+	style := s.NewFinding(Finding{Path: "main.go", StartLine: 1, EndLine: 1, Severity: "info", Message: "Add a package comment"})
+
+	parts, dropped := s.AppendFindingParts(nil, []Finding{race, again, style})
+	if len(parts) != 2 || dropped != 1 {
+		t.Fatalf("first turn: %d parts, %d dropped", len(parts), dropped)
+	}
+	if err := s.AddAssistantMessage(parts, nil, "m", nil); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	if parts, dropped := s.AppendFindingParts(nil, []Finding{again}); len(parts) != 0 || dropped != 1 {
+		t.Errorf("finding reported in an earlier turn should be dropped, got %d parts", len(parts))
+	}
+
+	// After the file changes the issue can be reported against the new version.
+	if err := s.ContextUpdate("main.go", "package main\n\nvar counter int\n"); err != nil {
+		t.Fatalf("ContextUpdate failed: %v", err)
+	}
+	findings, err := s.Findings()
+	if err != nil {
+		t.Fatalf("Findings failed: %v", err)
+	}
+	if len(findings) != 2 || !findings[0].Stale || !findings[1].Stale {
+		t.Fatalf("findings after change = %+v", findings)
+	}
+	firstReport := findings[0].MessageIndex
+	updated := s.NewFinding(Finding{Path: "main.go", StartLine: 3, EndLine: 5, Severity: "error", Category: "bug", Message: "Data race on counter"})
+	parts, _ = s.AppendFindingParts(nil, []Finding{updated})
+	if len(parts) != 1 {
+		t.Fatalf("re-report on a new file version should be kept")
+	}
+	if err := s.AddAssistantMessage(parts, nil, "m", nil); err != nil {
+		t.Fatalf("AddAssistantMessage failed: %v", err)
+	}
+	findings, _ = s.Findings()
+	if len(findings) != 2 || findings[0].Stale || findings[0].MessageIndex <= firstReport || !findings[1].Stale {
+		t.Errorf("latest report should win: %+v", findings)
+	}
+}
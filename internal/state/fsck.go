@@ -0,0 +1,261 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// Consistency checks for `bb7 fsck`. Fsck validates every chat file, the
+// chat index, and the context files, their objects and the snapshot
+// references of each chat, and with repair set fixes what it can: chat
+// files are restored from chat.json.bak, context directories left from
+// before the object store are migrated, unresolvable context entries and
+// references are dropped, leftover temporary files are removed, and the
+// index is rebuilt. Chats locked by another session are checked but not
+// repaired.
+
+// FsckIssue is a problem found by Fsck.
+type FsckIssue struct {
+	ChatID   string `json:"chat_id,omitempty"` // empty for the chat index
+	Problem  string `json:"problem"`
+	Repaired bool   `json:"repaired"`
+}
+
+// Fsck checks the chats of the project, or the global chats in global-only
+// mode.
+func (s *State) Fsck(repair bool) ([]FsckIssue, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	chatsDir := s.chatsDirFor(s.GlobalOnly)
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var issues []FsckIssue
+	summaries := make(map[string]ChatSummary)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if isTempFile(entry.Name()) {
+				issues = append(issues, removeTempFile(filepath.Join(chatsDir, entry.Name()), "", repair))
+			}
+			continue
+		}
+		id := entry.Name()
+		chatIssues, chat := fsckChat(filepath.Join(chatsDir, id), id, repair)
+		issues = append(issues, chatIssues...)
+		if chat != nil {
+			summaries[id] = summaryOf(chat)
+		}
+	}
+	issues = append(issues, fsckChatIndex(chatsDir, summaries, repair)...)
+	return issues, nil
+}
+
+// fsckChat checks one chat directory. It returns the chat as it is after
+// any repair, or nil when it cannot be read.
+func fsckChat(chatDir, id string, repair bool) ([]FsckIssue, *Chat) {
+	var issues []FsckIssue
+	report := func(repaired bool, format string, args ...any) {
+		issues = append(issues, FsckIssue{ChatID: id, Problem: fmt.Sprintf(format, args...), Repaired: repaired})
+	}
+	if IsLocked(chatDir) {
+		repair = false
+	}
+
+	filepath.WalkDir(chatDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && isTempFile(d.Name()) {
+			issues = append(issues, removeTempFile(path, id, repair))
+		}
+		return nil
+	})
+
+	chatPath := filepath.Join(chatDir, "chat.json")
+	chat, readErr := parseChatFile(chatPath)
+	if readErr != nil {
+		backup, backupErr := parseChatFile(chatPath + chatBackupSuffix)
+		if backupErr != nil {
+			report(false, "chat.json: %v, and there is no usable backup", readErr)
+			return issues, nil
+		}
+		repaired := false
+		if repair {
+			data, err := os.ReadFile(chatPath + chatBackupSuffix)
+			repaired = err == nil && writeFileAtomic(chatPath, data, 0644) == nil
+		}
+		report(repaired, "chat.json: %v; restorable from backup", readErr)
+		chat = backup
+	}
+
+	// Issues from here on are repaired by saving the chat.
+	saved := len(issues)
+	changed := false
+	if chat.ID != id {
+		report(repair, "chat.json has ID %q", chat.ID)
+		chat.ID = id
+		changed = true
+	}
+
+	snapshots := snapshotsOf(chat, chatDir)
+	contextBase := snapshots.contextBase
+	legacy, migrated := false, false
+	if _, err := os.Stat(contextBase); err == nil {
+		legacy = true
+		if repair {
+			moved, err := migrateContextDir(chatDir, chat)
+			changed = changed || moved
+			migrated = err == nil
+		}
+		report(migrated, "context directory not moved to the object store")
+	}
+	files := chat.ContextFiles[:0]
+	for _, cf := range chat.ContextFiles {
+		path, err := contextStoragePathIn(contextBase, &cf)
+		if err == nil {
+			_, err = snapshots.read(path)
+			if legacy && os.IsNotExist(err) {
+				_, err = os.Stat(path)
+			}
+		}
+		if err != nil {
+			report(repair, "context file %s: %v", cf.Path, err)
+			changed = true
+			continue
+		}
+		files = append(files, cf)
+	}
+	chat.ContextFiles = files
+
+	// Snapshot content can legitimately be missing (forks only reference
+	// the files they restore), so references are only checked for paths
+	// that cannot be resolved.
+	for i := range chat.Messages {
+		msg := &chat.Messages[i]
+		if len(msg.ContextSnapshot) == 0 {
+			continue
+		}
+		refs := msg.ContextSnapshot[:0]
+		for _, ref := range msg.ContextSnapshot {
+			if _, err := contextRefPathIn(contextBase, ref); err != nil {
+				report(repair, "message %d: snapshot reference %s: %v", i, ref.Path, err)
+				changed = true
+				continue
+			}
+			refs = append(refs, ref)
+		}
+		msg.ContextSnapshot = refs
+	}
+
+	if changed && repair {
+		if err := saveChatAt(chatDir, chat); err != nil {
+			report(false, "saving repaired chat: %v", err)
+			for i := saved; i < len(issues); i++ {
+				issues[i].Repaired = false
+			}
+			return issues, chat
+		}
+	}
+	if migrated {
+		os.RemoveAll(contextBase)
+	}
+	return issues, chat
+}
+
+// parseChatFile reads and decodes a chat file without falling back to its
+// backup.
+func parseChatFile(path string) (*Chat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("missing")
+		}
+		return nil, err
+	}
+	var chat Chat
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return nil, fmt.Errorf("corrupt (%v)", err)
+	}
+	return &chat, nil
+}
+
+// removeTempFile reports a temporary file left by an interrupted write and
+// removes it when repairing.
+func removeTempFile(path, chatID string, repair bool) FsckIssue {
+	repaired := repair && os.Remove(path) == nil
+	return FsckIssue{ChatID: chatID, Problem: "leftover temporary file " + filepath.Base(path), Repaired: repaired}
+}
+
+// fsckChatIndex compares index.json with the chats found on disk and
+// rebuilds it from them when repairing.
+func fsckChatIndex(chatsDir string, chats map[string]ChatSummary, repair bool) []FsckIssue {
+	var problems []string
+	idx, err := loadChatIndexFrom(chatsDir)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		if len(chats) > 0 {
+			problems = append(problems, "index.json is missing")
+		}
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("index.json: %v", err))
+	case idx.Version < chatIndexVersion:
+		problems = append(problems, fmt.Sprintf("index.json has old version %d", idx.Version))
+	default:
+		listed := make(map[string]bool, len(idx.Chats))
+		for _, entry := range idx.Chats {
+			listed[entry.ID] = true
+			summary, ok := chats[entry.ID]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("index.json lists missing chat %s", entry.ID))
+			case !sameSummary(entry, summary):
+				problems = append(problems, fmt.Sprintf("index.json entry for %s is out of date", entry.ID))
+			}
+		}
+		for id := range chats {
+			if !listed[id] {
+				problems = append(problems, fmt.Sprintf("index.json does not list chat %s", id))
+			}
+		}
+		if _, ok := chats[idx.ActiveChatID]; idx.ActiveChatID != "" && !idx.ActiveChatGlobal && !ok {
+			problems = append(problems, fmt.Sprintf("index.json points to missing active chat %s", idx.ActiveChatID))
+			idx.ActiveChatID = ""
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+
+	repaired := false
+	if repair {
+		idx.Chats = make([]ChatSummary, 0, len(chats))
+		for _, summary := range chats {
+			idx.Chats = append(idx.Chats, summary)
+		}
+		repaired = writeChatIndexTo(chatsDir, idx) == nil
+	}
+	issues := make([]FsckIssue, len(problems))
+	for i, problem := range problems {
+		issues[i] = FsckIssue{Problem: problem, Repaired: repaired}
+	}
+	return issues
+}
+
+// sameSummary reports whether an index entry matches a chat's summary.
+func sameSummary(a, b ChatSummary) bool {
+	return a.Name == b.Name && a.ParentID == b.ParentID && a.ForkIndex == b.ForkIndex &&
+		a.Archived == b.Archived && a.Pinned == b.Pinned && a.Folder == b.Folder &&
+		slices.Equal(a.Tags, b.Tags) && a.Cost == b.Cost && a.MessageCount == b.MessageCount &&
+		a.PromptTokens == b.PromptTokens && a.CompletionTokens == b.CompletionTokens && a.CachedTokens == b.CachedTokens &&
+		a.Created.Equal(b.Created) && a.LastActivity.Equal(b.LastActivity)
+}
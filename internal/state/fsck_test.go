@@ -0,0 +1,143 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadChatFallsBackToBackup(t *testing.T) {
+	s := setupTestState(t)
+	chat, err := s.ChatNew("first", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.ChatRename(chat.ID, "second"); err != nil {
+		t.Fatalf("ChatRename failed: %v", err)
+	}
+	chatPath := s.chatJSONPath(chat.ID)
+	if _, err := os.Stat(chatPath + chatBackupSuffix); err != nil {
+		t.Fatalf("expected a backup after saving twice: %v", err)
+	}
+
+	// A torn write leaves a truncated file; the backup is the previous save.
+	if err := os.WriteFile(chatPath, []byte(`{"id": "`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.loadChat(chat.ID)
+	if err != nil {
+		t.Fatalf("loadChat failed: %v", err)
+	}
+	if loaded.Name != "first" {
+		t.Errorf("loaded name = %q, want the backup's", loaded.Name)
+	}
+
+	// Saving over a corrupt file keeps the good backup.
+	loaded.Name = "third"
+	for i := 0; i < 2; i++ {
+		if err := s.saveChat(loaded); err != nil {
+			t.Fatalf("saveChat failed: %v", err)
+		}
+	}
+	loaded.Name = "fourth"
+	if err := os.WriteFile(chatPath, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.saveChat(loaded); err != nil {
+		t.Fatalf("saveChat failed: %v", err)
+	}
+	backup, _ := parseChatFile(chatPath + chatBackupSuffix)
+	if backup == nil || backup.Name != "third" {
+		t.Errorf("backup = %+v, want the last good save", backup)
+	}
+
+	os.WriteFile(chatPath, []byte("garbage"), 0644)
+	os.WriteFile(chatPath+chatBackupSuffix, []byte("garbage"), 0644)
+	if _, err := s.loadChat(chat.ID); !errors.Is(err, ErrChatCorrupt) {
+		t.Errorf("err = %v, want ErrChatCorrupt", err)
+	}
+}
+
+func TestFsckRepairs(t *testing.T) {
+	s := setupTestState(t)
+	good, err := s.ChatNew("good", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.ContextAdd("main.go", "package main\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	if err := s.ContextAdd("util.go", "package main\n\nfunc util() {}\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	utilObject, err := objectPath(filepath.Join(s.ProjectRoot, ".bb7", "objects"), s.ActiveChat.Snapshots["util.go"])
+	if err != nil {
+		t.Fatalf("objectPath failed: %v", err)
+	}
+	if err := s.AddUserMessage("hello", "m"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	broken, err := s.ChatNew("broken", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	s.ChatRename(broken.ID, "broken again")
+	s.releasePreviousLock()
+
+	if issues, err := s.Fsck(false); err != nil || len(issues) != 0 {
+		t.Fatalf("Fsck on a healthy project = %+v, %v", issues, err)
+	}
+
+	os.Remove(utilObject)
+	os.WriteFile(filepath.Join(s.chatDir(good.ID), ".chat.json.123"+tempFileSuffix), []byte("{"), 0644)
+	os.WriteFile(s.chatJSONPath(broken.ID), []byte("{"), 0644)
+	os.RemoveAll(s.chatDir("gone"))
+	idx, _ := s.loadChatIndex()
+	idx.Chats = append(idx.Chats, ChatSummary{ID: "gone", Name: "gone"})
+	s.writeChatIndex(idx)
+
+	issues, err := s.Fsck(false)
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	var problems []string
+	for _, issue := range issues {
+		if issue.Repaired {
+			t.Errorf("issue repaired without -repair: %+v", issue)
+		}
+		problems = append(problems, issue.ChatID+": "+issue.Problem)
+	}
+	got := strings.Join(problems, "\n")
+	for _, want := range []string{
+		broken.ID + ": chat.json: corrupt",
+		good.ID + ": leftover temporary file",
+		good.ID + ": context file util.go",
+		": index.json lists missing chat gone",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("issues missing %q:\n%s", want, got)
+		}
+	}
+
+	issues, err = s.Fsck(true)
+	if err != nil {
+		t.Fatalf("Fsck repair failed: %v", err)
+	}
+	for _, issue := range issues {
+		if !issue.Repaired {
+			t.Errorf("not repaired: %+v", issue)
+		}
+	}
+	if issues, _ := s.Fsck(false); len(issues) != 0 {
+		t.Errorf("issues after repair: %+v", issues)
+	}
+	chat, err := s.loadChat(good.ID)
+	if err != nil || len(chat.ContextFiles) != 1 || chat.ContextFiles[0].Path != "main.go" {
+		t.Errorf("repaired chat = %+v, %v", chat, err)
+	}
+	if chat, err := s.loadChat(broken.ID); err != nil || chat.Name != "broken" {
+		t.Errorf("restored chat = %+v, %v", chat, err)
+	}
+}
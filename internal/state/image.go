@@ -0,0 +1,208 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"path/filepath"
+
+	"github.com/youruser/bb7/internal/llm"
+)
+
+// imagesDir is the subdirectory for image snapshots.
+const imagesDir = "_images"
+
+// MaxImageBytes is the largest image accepted into context. Providers reject
+// larger payloads, and images are inlined as base64 on every send.
+const MaxImageBytes = 5 * 1024 * 1024
+
+// Image validation errors.
+var (
+	ErrImageTooLarge    = errors.New("image too large (max 5 MB)")
+	ErrUnsupportedImage = errors.New("unsupported image format (supported: PNG, JPEG, GIF, WebP)")
+	ErrImageReadOnly    = errors.New("images are always read-only")
+)
+
+// supportedImageTypes are the formats accepted by vision-capable providers.
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ImageInfo describes a validated image.
+type ImageInfo struct {
+	MediaType string
+	Width     int // 0 if unknown
+	Height    int // 0 if unknown
+}
+
+// InspectImage validates image data and returns its format and dimensions.
+// The format is sniffed from content, never trusted from the file extension.
+func InspectImage(data []byte) (ImageInfo, error) {
+	if len(data) > MaxImageBytes {
+		return ImageInfo{}, ErrImageTooLarge
+	}
+	mediaType := http.DetectContentType(data)
+	if !supportedImageTypes[mediaType] {
+		return ImageInfo{}, ErrUnsupportedImage
+	}
+
+	info := ImageInfo{MediaType: mediaType}
+	if mediaType == "image/webp" {
+		info.Width, info.Height, _ = webpDimensions(data)
+		return info, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// Sniffed as an image but the header is unreadable.
+		return ImageInfo{}, ErrUnsupportedImage
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+	return info, nil
+}
+
+// webpDimensions reads the canvas size from a WebP header (VP8, VP8L, or VP8X).
+func webpDimensions(data []byte) (int, int, bool) {
+	if len(data) < 30 {
+		return 0, 0, false
+	}
+	chunk := string(data[12:16])
+	switch chunk {
+	case "VP8 ":
+		// Lossy: 14-bit width/height after the 3-byte start code.
+		w := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return w, h, true
+	case "VP8L":
+		// Lossless: 14-bit width-1 and height-1 packed after the signature byte.
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		w := int(bits&0x3fff) + 1
+		h := int((bits>>14)&0x3fff) + 1
+		return w, h, true
+	case "VP8X":
+		// Extended: 24-bit canvas width-1 and height-1.
+		w := int(uint32(data[24])|uint32(data[25])<<8|uint32(data[26])<<16) + 1
+		h := int(uint32(data[27])|uint32(data[28])<<8|uint32(data[29])<<16) + 1
+		return w, h, true
+	}
+	return 0, 0, false
+}
+
+// IsImage returns true if the context file is an image.
+func (cf *ContextFile) IsImage() bool {
+	return cf.MediaType != ""
+}
+
+// ContextAddImage adds an image to the active chat's context. Images are
+// read-only snapshots stored in the _images subdirectory; path follows the
+// same rules as ContextAdd (relative or absolute, external if outside the
+// project).
+func (s *State) ContextAddImage(path string, data []byte) error {
+	if err := s.requireActiveChat(); err != nil {
+		return err
+	}
+
+	info, err := InspectImage(data)
+	if err != nil {
+		return err
+	}
+
+	normalizedPath, isExternal, err := s.normalizeContextPath(path)
+	if err != nil {
+		return err
+	}
+	if err := s.CheckPathPolicy(PolicyRead, normalizedPath); err != nil {
+		return err
+	}
+	if !isExternal {
+		// The snapshot is stored under a hashed name, so validate the
+		// project-relative path explicitly.
+		if _, err := SafeJoin(s.activeContextDir(), normalizedPath); err != nil {
+			return err
+		}
+	}
+	if s.findContextFile(normalizedPath) != nil {
+		return ErrFileExists
+	}
+
+	storageBase := filepath.Join(s.activeContextDir(), imagesDir)
+	if err := s.activeSnapshots().write(filepath.Join(storageBase, hashPath(normalizedPath)), data); err != nil {
+		return err
+	}
+
+	version := HashFileVersion(normalizedPath, string(data))
+	s.ActiveChat.ContextFiles = append(s.ActiveChat.ContextFiles, ContextFile{
+		Path:      normalizedPath,
+		ReadOnly:  true, // Images are never writable by the LLM
+		External:  isExternal,
+		Version:   version,
+		MediaType: info.MediaType,
+	})
+
+	ro := true
+	ext := isExternal
+	return s.addContextEvent(MessagePart{
+		Type:      PartTypeContextEvent,
+		Action:    ActionUserAddFile,
+		Path:      normalizedPath,
+		ReadOnly:  &ro,
+		External:  &ext,
+		Version:   version,
+		MediaType: info.MediaType,
+	})
+}
+
+// GetContextImage returns the raw bytes and media type of an image in context.
+func (s *State) GetContextImage(path string) ([]byte, string, error) {
+	if err := s.requireActiveChat(); err != nil {
+		return nil, "", err
+	}
+
+	cf := s.findContextFile(path)
+	if cf == nil || !cf.IsImage() {
+		return nil, "", ErrFileNotFound
+	}
+
+	storagePath, err := s.contextStoragePath(cf)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := s.activeSnapshots().read(storagePath)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, cf.MediaType, nil
+}
+
+// HasImages returns true if the active chat has any images in context.
+func (s *State) HasImages() bool {
+	if s.ActiveChat == nil {
+		return false
+	}
+	for i := range s.ActiveChat.ContextFiles {
+		if s.ActiveChat.ContextFiles[i].IsImage() {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTokens estimates the tokens an image in context costs per request.
+func (s *State) imageTokens(cf *ContextFile) int {
+	data, _, err := s.GetContextImage(cf.Path)
+	if err != nil {
+		return llm.ImageTokensUnknown
+	}
+	info, err := InspectImage(data)
+	if err != nil {
+		return llm.ImageTokensUnknown
+	}
+	return llm.EstimateImageTokens(info.Width, info.Height)
+}
@@ -0,0 +1,222 @@
+package state
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectImage(t *testing.T) {
+	info, err := InspectImage(testPNG(t, 30, 20))
+	if err != nil {
+		t.Fatalf("InspectImage failed: %v", err)
+	}
+	if info.MediaType != "image/png" || info.Width != 30 || info.Height != 20 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+
+	if _, err := InspectImage([]byte("package main")); err != ErrUnsupportedImage {
+		t.Errorf("Expected ErrUnsupportedImage for text, got %v", err)
+	}
+
+	// PNG signature with a corrupt header.
+	if _, err := InspectImage([]byte("\x89PNG\r\n\x1a\ngarbage")); err != ErrUnsupportedImage {
+		t.Errorf("Expected ErrUnsupportedImage for corrupt PNG, got %v", err)
+	}
+
+	big := make([]byte, MaxImageBytes+1)
+	copy(big, testPNG(t, 1, 1))
+	if _, err := InspectImage(big); err != ErrImageTooLarge {
+		t.Errorf("Expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestWebPDimensions(t *testing.T) {
+	// VP8X header for a 640x480 canvas.
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00")
+	data = append(data, 0x7f, 0x02, 0x00, 0xdf, 0x01, 0x00)
+	info, err := InspectImage(data)
+	if err != nil {
+		t.Fatalf("InspectImage failed: %v", err)
+	}
+	if info.MediaType != "image/webp" || info.Width != 640 || info.Height != 480 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+}
+
+func TestContextAddImage(t *testing.T) {
+	s := setupTestState(t)
+	s.ChatNew("test", "")
+
+	data := testPNG(t, 10, 10)
+	if err := s.ContextAddImage("docs/screenshot.png", data); err != nil {
+		t.Fatalf("ContextAddImage failed: %v", err)
+	}
+
+	cf := s.FindContextFile("docs/screenshot.png")
+	if cf == nil {
+		t.Fatal("Expected image in context")
+	}
+	if !cf.IsImage() || cf.MediaType != "image/png" || !cf.ReadOnly || cf.External {
+		t.Errorf("Unexpected context entry: %+v", cf)
+	}
+	msgs := s.ActiveChat.Messages
+	if ev := msgs[len(msgs)-1].Parts[0]; ev.Action != ActionUserAddFile || ev.MediaType != "image/png" {
+		t.Errorf("Unexpected context event: %+v", ev)
+	}
+
+	got, mediaType, err := s.GetContextImage("docs/screenshot.png")
+	if err != nil {
+		t.Fatalf("GetContextImage failed: %v", err)
+	}
+	if !bytes.Equal(got, data) || mediaType != "image/png" {
+		t.Error("Stored image does not round-trip")
+	}
+
+	// Stored under _images, not at the relative path.
+	key := imagesDir + "/" + hashPath("docs/screenshot.png")
+	if _, ok := s.ActiveChat.Snapshots[key]; !ok {
+		t.Errorf("Expected image snapshot %s, got %v", key, s.ActiveChat.Snapshots)
+	}
+
+	if err := s.ContextAddImage("docs/screenshot.png", data); err != ErrFileExists {
+		t.Errorf("Expected ErrFileExists, got %v", err)
+	}
+	if err := s.ContextAddImage("notes.txt", []byte("hello")); err != ErrUnsupportedImage {
+		t.Errorf("Expected ErrUnsupportedImage, got %v", err)
+	}
+	if err := s.ContextAddImage("../escape.png", data); err != ErrPathEscape {
+		t.Errorf("Expected ErrPathEscape, got %v", err)
+	}
+}
+
+func TestContextImageIsReadOnly(t *testing.T) {
+	s := setupTestState(t)
+	s.ChatNew("test", "")
+	s.ContextAddImage("shot.png", testPNG(t, 4, 4))
+
+	if err := s.ContextSetReadOnly("shot.png", false); err != ErrImageReadOnly {
+		t.Errorf("Expected ErrImageReadOnly, got %v", err)
+	}
+	if err := s.ContextUpdate("shot.png", "text"); err != ErrImageReadOnly {
+		t.Errorf("Expected ErrImageReadOnly from ContextUpdate, got %v", err)
+	}
+}
+
+func TestImageStatusAndEstimate(t *testing.T) {
+	s := setupTestState(t)
+	s.ChatNew("test", "")
+	s.ContextAdd("main.go", "package main")
+	s.ContextAddImage("shot.png", testPNG(t, 750, 10))
+
+	files, err := s.GetFileStatuses()
+	if err != nil {
+		t.Fatalf("GetFileStatuses failed: %v", err)
+	}
+	var img *FileInfo
+	for i := range files {
+		if files[i].Path == "shot.png" {
+			img = &files[i]
+		}
+	}
+	if img == nil {
+		t.Fatal("Expected image in file statuses")
+	}
+	if img.Status != StatusImage || img.ContextContent != "" || img.MediaType != "image/png" {
+		t.Errorf("Unexpected image status: %+v", img)
+	}
+	if img.Tokens != 10 {
+		t.Errorf("Expected 10 tokens for 750x10 image, got %d", img.Tokens)
+	}
+
+	estimate, err := s.EstimateTokens("", "")
+	if err != nil {
+		t.Fatalf("EstimateTokens failed: %v", err)
+	}
+	found := false
+	for _, f := range estimate.Files {
+		if f.Path == "shot.png" {
+			found = true
+			if f.Tokens != 10 {
+				t.Errorf("Expected 10 estimated tokens, got %d", f.Tokens)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected image in token estimate")
+	}
+}
+
+func TestForkChatKeepsImage(t *testing.T) {
+	s := setupTestState(t)
+
+	data := testPNG(t, 8, 8)
+	os.WriteFile(filepath.Join(s.ProjectRoot, "shot.png"), data, 0644)
+
+	sourceChat, _ := s.ChatNew("source", "")
+	s.ContextAddImage("shot.png", data)
+	s.AddUserMessage("What is wrong here?", "model-1")
+
+	if _, err := s.ForkChat(sourceChat.ID, 1); err != nil {
+		t.Fatalf("ForkChat failed: %v", err)
+	}
+	cf := s.FindContextFile("shot.png")
+	if cf == nil || !cf.IsImage() {
+		t.Fatalf("Expected image in forked chat, got %+v", cf)
+	}
+	got, _, err := s.GetContextImage("shot.png")
+	if err != nil {
+		t.Fatalf("GetContextImage failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Forked image content differs")
+	}
+
+	// New chat with context copies the snapshot even if the file changed on disk.
+	os.Remove(filepath.Join(s.ProjectRoot, "shot.png"))
+	if _, err := s.ChatNewWithContext(s.ActiveChat.ID); err != nil {
+		t.Fatalf("ChatNewWithContext failed: %v", err)
+	}
+	if got, _, err := s.GetContextImage("shot.png"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected image copied into new chat, err=%v", err)
+	}
+}
+
+func TestForkChatReportsMissingImage(t *testing.T) {
+	s := setupTestState(t)
+
+	data := testPNG(t, 8, 8)
+	os.WriteFile(filepath.Join(s.ProjectRoot, "shot.png"), data, 0644)
+
+	sourceChat, _ := s.ChatNew("source", "")
+	s.ContextAddImage("shot.png", data)
+	s.AddUserMessage("What is wrong here?", "model-1")
+	os.Remove(filepath.Join(s.ProjectRoot, "shot.png"))
+
+	result, err := s.ForkChat(sourceChat.ID, 1)
+	if err != nil {
+		t.Fatalf("ForkChat failed: %v", err)
+	}
+	if len(result.ContextWarnings) != 1 || result.ContextWarnings[0].Issue != "missing" {
+		t.Fatalf("Expected one missing warning, got %+v", result.ContextWarnings)
+	}
+	if s.FindContextFile("shot.png") != nil {
+		t.Error("Missing image should not be in forked context")
+	}
+	msgs := s.ActiveChat.Messages
+	if ev := msgs[len(msgs)-1].Parts[0]; ev.Action != ActionForkWarningMissing || ev.Path != "shot.png" {
+		t.Errorf("Unexpected fork warning: %+v", ev)
+	}
+}
@@ -0,0 +1,290 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MaxBundleBytes caps the size of an imported bundle file.
+const MaxBundleBytes = 64 * 1024 * 1024
+
+// ErrInvalidBundle is returned for bundles that are malformed or unsafe.
+var ErrInvalidBundle = errors.New("invalid chat bundle")
+
+// DecodeBundle parses and checks the header of an exported chat bundle.
+func DecodeBundle(data []byte) (*ChatBundle, error) {
+	var b ChatBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if b.Format != BundleFormat {
+		return nil, fmt.Errorf("%w: not a bb7 chat export", ErrInvalidBundle)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("%w: unsupported bundle version %d (this version of bb7 reads up to %d)", ErrInvalidBundle, b.Version, BundleVersion)
+	}
+	return &b, nil
+}
+
+// ReadBundle reads and decodes a bundle file.
+func ReadBundle(path string) (*ChatBundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxBundleBytes {
+		return nil, fmt.Errorf("%w: file too large", ErrInvalidBundle)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBundle(data)
+}
+
+// validateBundlePath checks that a path from a bundle is a safe context path:
+// a clean relative path for project files, or an absolute path or URL for
+// external files. Bundles may come from anywhere, so nothing is trusted.
+func validateBundlePath(path string) error {
+	if isExternalRef(path) {
+		if filepath.IsAbs(path) && filepath.Clean(path) != path {
+			return fmt.Errorf("%w: unclean path %q", ErrInvalidBundle, path)
+		}
+		return nil
+	}
+	if err := ValidateRelativePath(path); err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidBundle, path, err)
+	}
+	// Any relative path must stay inside its base directory.
+	if _, err := SafeJoin(string(filepath.Separator)+"base", path); err != nil {
+		return fmt.Errorf("%w: %q escapes its directory", ErrInvalidBundle, path)
+	}
+	return nil
+}
+
+// ImportChat creates a new chat from a bundle in project or global scope.
+// The chat gets a fresh ID, so importing the same bundle twice yields two
+// chats and never overwrites an existing one. Context snapshots missing from
+// the bundle are dropped from the chat's context. Output files are only kept
+// for project-scope imports (global chats cannot write files). The imported
+// chat is not selected.
+func (s *State) ImportChat(b *ChatBundle, global bool) (*Chat, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	global = global || s.GlobalOnly
+
+	chat := b.Chat
+	migrateChat(&chat)
+	if chat.Name == "" {
+		chat.Name = "Imported chat"
+	}
+	if chat.Messages == nil {
+		chat.Messages = []Message{}
+	}
+
+	// Validate every path before touching the filesystem.
+	for _, cf := range chat.ContextFiles {
+		if err := validateBundlePath(cf.Path); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range b.Context {
+		if err := validateBundlePath(f.Path); err != nil {
+			return nil, err
+		}
+	}
+	for i := range chat.Messages {
+		for _, ref := range chat.Messages[i].ContextSnapshot {
+			if err := validateBundlePath(ref.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range b.Output {
+		if isExternalRef(f.Path) {
+			return nil, fmt.Errorf("%w: output path %q must be relative", ErrInvalidBundle, f.Path)
+		}
+		if err := validateBundlePath(f.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if global {
+		if err := s.ensureGlobalChatsDir(); err != nil {
+			return nil, err
+		}
+	} else {
+		b = s.localizeBundlePaths(b, &chat)
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	chatDir := s.chatDirFor(id, global)
+	if _, err := os.Stat(chatDir); err == nil {
+		return nil, fmt.Errorf("chat ID collision, retry import")
+	}
+	chat.ID = id
+	chat.Global = global
+	// The parent chat is not part of the bundle.
+	chat.ParentID = ""
+	chat.ForkIndex = 0
+	chat.Snapshots = nil
+
+	if err := os.MkdirAll(chatDir, 0755); err != nil {
+		return nil, err
+	}
+	imported, err := importBundleFiles(b, &chat, chatDir, global)
+	if err != nil {
+		os.RemoveAll(chatDir)
+		return nil, err
+	}
+	chat.ContextFiles = imported
+
+	if err := saveChatAt(chatDir, &chat); err != nil {
+		os.RemoveAll(chatDir)
+		return nil, err
+	}
+	// Index is a cache; do not fail the import if it can't be updated.
+	_ = updateChatIndexEntryAt(s.chatsDirFor(global), &chat)
+
+	return &chat, nil
+}
+
+// localizeBundlePaths converts absolute paths inside the project root to
+// project-relative paths (as ChatMoveToProject does), so a chat exported from
+// global scope becomes an ordinary project chat. ContextSnapshot refs are
+// rewritten to the new paths so forks resolve against the imported context.
+// Returns a bundle whose context snapshots use the rewritten paths.
+func (s *State) localizeBundlePaths(b *ChatBundle, chat *Chat) *ChatBundle {
+	if s.ProjectRoot == "" {
+		return b
+	}
+	remap := make(map[string]string)
+	localize := func(path string) string {
+		if rel, ok := remap[path]; ok {
+			return rel
+		}
+		if !filepath.IsAbs(path) {
+			return path
+		}
+		within, err := IsWithinDir(s.ProjectRoot, path)
+		if err != nil || !within {
+			return path
+		}
+		rel, err := RelativeToBase(s.ProjectRoot, path)
+		if err != nil {
+			return path
+		}
+		remap[path] = rel
+		return rel
+	}
+
+	// Images keep their path: their snapshot is stored under a hash of it.
+	chat.ContextFiles = append([]ContextFile(nil), chat.ContextFiles...)
+	for i := range chat.ContextFiles {
+		if cf := &chat.ContextFiles[i]; !cf.IsImage() {
+			cf.Path = localize(cf.Path)
+		}
+	}
+	if len(remap) == 0 {
+		return b
+	}
+
+	localized := *b
+	localized.Context = append([]BundleFile(nil), b.Context...)
+	for i := range localized.Context {
+		if rel, ok := remap[localized.Context[i].Path]; ok && localized.Context[i].MediaType == "" {
+			localized.Context[i].Path = rel
+		}
+	}
+	chat.Messages = append([]Message(nil), chat.Messages...)
+	for i := range chat.Messages {
+		refs := append([]ContextFileRef(nil), chat.Messages[i].ContextSnapshot...)
+		for j := range refs {
+			if rel, ok := remap[refs[j].Path]; ok && refs[j].MediaType == "" {
+				refs[j].Path = rel
+			}
+		}
+		chat.Messages[i].ContextSnapshot = refs
+	}
+	return &localized
+}
+
+// importBundleFiles stores the bundle's snapshots for a new chat and returns
+// the context files that have a snapshot.
+func importBundleFiles(b *ChatBundle, chat *Chat, chatDir string, global bool) ([]ContextFile, error) {
+	snapshots := snapshotsOf(chat, chatDir)
+
+	files := make([]ContextFile, 0, len(chat.ContextFiles))
+	for _, cf := range chat.ContextFiles {
+		snapshot := findBundleSnapshot(b, cf)
+		if snapshot == nil {
+			continue
+		}
+
+		// Flags are derived from the path rather than trusted from the bundle.
+		cf.External = isExternalRef(cf.Path)
+		if cf.External || cf.StartLine > 0 || global {
+			cf.ReadOnly = true
+		}
+
+		data := []byte(snapshot.Content)
+		if cf.IsImage() {
+			info, err := InspectImage(snapshot.Data)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, cf.Path, err)
+			}
+			cf.MediaType = info.MediaType
+			cf.ReadOnly = true
+			data = snapshot.Data
+		}
+
+		storagePath, err := contextStoragePathIn(snapshots.contextBase, &cf)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if err := snapshots.write(storagePath, data); err != nil {
+			return nil, err
+		}
+		files = append(files, cf)
+	}
+
+	if global {
+		return files, nil
+	}
+
+	outputBase := filepath.Join(chatDir, "output")
+	if err := os.MkdirAll(outputBase, 0755); err != nil {
+		return nil, err
+	}
+	for _, f := range b.Output {
+		dst, err := SafeJoin(outputBase, f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(dst, []byte(f.Content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// findBundleSnapshot returns the bundled snapshot for a context file, or nil.
+func findBundleSnapshot(b *ChatBundle, cf ContextFile) *BundleFile {
+	for i := range b.Context {
+		f := &b.Context[i]
+		if f.Path == cf.Path && f.StartLine == cf.StartLine && f.EndLine == cf.EndLine && (f.MediaType != "") == cf.IsImage() {
+			return f
+		}
+	}
+	return nil
+}
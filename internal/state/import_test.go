@@ -0,0 +1,195 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func exportTestChat(t *testing.T, s *State) *ChatBundle {
+	t.Helper()
+	chat, _ := s.ChatNew("portable", "test-model")
+	s.ContextAdd("src/main.go", "package main\n")
+	s.ContextAddSection("util.go", 1, 2, "a\nb")
+	s.ContextAddImage("shot.png", testPNG(t, 3, 3))
+	s.AddUserMessage("update main", "test-model")
+	s.WriteOutputFile("src/main.go", "package main\n\nfunc main() {}\n")
+
+	bundle, err := s.ExportChat(chat.ID, false)
+	if err != nil {
+		t.Fatalf("ExportChat failed: %v", err)
+	}
+	return bundle
+}
+
+func TestImportChat(t *testing.T) {
+	src := setupTestState(t)
+	bundle := exportTestChat(t, src)
+
+	dst := setupTestState(t)
+	chat, err := dst.ImportChat(bundle, false)
+	if err != nil {
+		t.Fatalf("ImportChat failed: %v", err)
+	}
+	if chat.ID == bundle.Chat.ID || chat.ID == "" {
+		t.Errorf("Expected fresh ID, got %q", chat.ID)
+	}
+	if chat.Name != "portable" || len(chat.Messages) != len(bundle.Chat.Messages) {
+		t.Errorf("Unexpected imported chat: %+v", chat)
+	}
+	if dst.ActiveChat != nil {
+		t.Error("Import should not select the chat")
+	}
+
+	// Listed in the index.
+	chats, _ := dst.ChatList()
+	if len(chats) != 1 || chats[0].ID != chat.ID {
+		t.Errorf("Expected imported chat in list, got %+v", chats)
+	}
+
+	// Snapshots and output are readable once selected.
+	if _, err := dst.ChatSelect(chat.ID); err != nil {
+		t.Fatalf("ChatSelect failed: %v", err)
+	}
+	if content, err := dst.GetContextFile("src/main.go"); err != nil || content != "package main\n" {
+		t.Errorf("Unexpected context content %q, err=%v", content, err)
+	}
+	if _, _, err := dst.GetContextImage("shot.png"); err != nil {
+		t.Errorf("Expected imported image: %v", err)
+	}
+	if out, err := dst.GetOutputFile("src/main.go"); err != nil || out != "package main\n\nfunc main() {}\n" {
+		t.Errorf("Unexpected output %q, err=%v", out, err)
+	}
+
+	// Re-exporting yields the same snapshots.
+	again, err := dst.ExportChat(chat.ID, false)
+	if err != nil {
+		t.Fatalf("ExportChat after import failed: %v", err)
+	}
+	if len(again.Context) != len(bundle.Context) || len(again.Output) != len(bundle.Output) {
+		t.Errorf("Round trip changed snapshots: %d/%d context, %d/%d output",
+			len(again.Context), len(bundle.Context), len(again.Output), len(bundle.Output))
+	}
+
+	// Importing twice creates a second chat.
+	second, err := dst.ImportChat(bundle, false)
+	if err != nil || second.ID == chat.ID {
+		t.Errorf("Expected second independent import, got %v, err=%v", second, err)
+	}
+}
+
+func TestImportChatGlobalDropsOutput(t *testing.T) {
+	src := setupTestState(t)
+	bundle := exportTestChat(t, src)
+
+	dst := setupGlobalTestState(t)
+	chat, err := dst.ImportChat(bundle, false) // global-only mode forces global scope
+	if err != nil {
+		t.Fatalf("ImportChat failed: %v", err)
+	}
+	if !chat.Global {
+		t.Error("Expected global chat")
+	}
+	for _, cf := range chat.ContextFiles {
+		if !cf.ReadOnly {
+			t.Errorf("Expected %s to be read-only in global scope", cf.Path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst.globalChatDir(chat.ID), "output")); !os.IsNotExist(err) {
+		t.Error("Expected no output directory for global import")
+	}
+	chats, _ := dst.ChatListGlobal()
+	if len(chats) != 1 {
+		t.Errorf("Expected 1 global chat, got %d", len(chats))
+	}
+}
+
+func TestImportChatLocalizesPaths(t *testing.T) {
+	dst := setupTestState(t)
+	abs := filepath.Join(dst.ProjectRoot, "pkg", "lib.go")
+
+	bundle := &ChatBundle{
+		Format:  BundleFormat,
+		Version: BundleVersion,
+		Chat: Chat{
+			Name:         "from global",
+			ContextFiles: []ContextFile{{Path: abs, External: true, ReadOnly: true, Version: "v1"}},
+			Messages:     []Message{{Role: "user", ContextSnapshot: []ContextFileRef{{Path: abs, FileID: "v1"}}}},
+		},
+		Context: []BundleFile{{Path: abs, Content: "package pkg\n"}},
+	}
+
+	chat, err := dst.ImportChat(bundle, false)
+	if err != nil {
+		t.Fatalf("ImportChat failed: %v", err)
+	}
+	cf := chat.ContextFiles[0]
+	if cf.Path != "pkg/lib.go" || cf.External {
+		t.Errorf("Expected localized internal path, got %+v", cf)
+	}
+	if ref := chat.Messages[0].ContextSnapshot[0]; ref.Path != "pkg/lib.go" {
+		t.Errorf("Expected rewritten snapshot ref, got %+v", ref)
+	}
+	if bundle.Chat.Messages[0].ContextSnapshot[0].Path != abs {
+		t.Error("ImportChat must not modify the caller's bundle")
+	}
+	data, err := snapshotsOf(chat, dst.chatDir(chat.ID)).read(filepath.Join(dst.contextDir(chat.ID), "pkg", "lib.go"))
+	if err != nil || string(data) != "package pkg\n" {
+		t.Errorf("Expected snapshot at internal location, err=%v", err)
+	}
+}
+
+func TestImportChatRejectsTraversal(t *testing.T) {
+	dst := setupTestState(t)
+
+	cases := map[string]*ChatBundle{
+		"context": {
+			Chat:    Chat{ContextFiles: []ContextFile{{Path: "../../evil.go"}}},
+			Context: []BundleFile{{Path: "../../evil.go", Content: "x"}},
+		},
+		"output": {
+			Output: []BundleFile{{Path: "../../../.bashrc", Content: "x"}},
+		},
+		"absolute output": {
+			Output: []BundleFile{{Path: "/etc/passwd", Content: "x"}},
+		},
+		"snapshot ref": {
+			Chat: Chat{Messages: []Message{{Role: "user", ContextSnapshot: []ContextFileRef{{Path: "a/../../b"}}}}},
+		},
+		"unclean absolute": {
+			Chat:    Chat{ContextFiles: []ContextFile{{Path: "/tmp/../etc/passwd"}}},
+			Context: []BundleFile{{Path: "/tmp/../etc/passwd", Content: "x"}},
+		},
+	}
+	for name, bundle := range cases {
+		bundle.Format = BundleFormat
+		bundle.Version = BundleVersion
+		if _, err := dst.ImportChat(bundle, false); !errors.Is(err, ErrInvalidBundle) {
+			t.Errorf("%s: expected ErrInvalidBundle, got %v", name, err)
+		}
+	}
+
+	entries, _ := os.ReadDir(dst.chatsDir())
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("Expected no chat directories after rejected imports, found %s", e.Name())
+		}
+	}
+}
+
+func TestDecodeBundle(t *testing.T) {
+	if _, err := DecodeBundle([]byte(`{"format":"bb7-chat","version":1,"chat":{"name":"x"}}`)); err != nil {
+		t.Errorf("Expected valid bundle, got %v", err)
+	}
+	bad := []string{
+		`not json`,
+		`{"format":"other","version":1}`,
+		`{"format":"bb7-chat","version":99}`,
+	}
+	for _, data := range bad {
+		if _, err := DecodeBundle([]byte(data)); !errors.Is(err, ErrInvalidBundle) {
+			t.Errorf("DecodeBundle(%s): expected ErrInvalidBundle, got %v", data, err)
+		}
+	}
+}
@@ -21,6 +21,8 @@ type InstructionsInfo struct {
 	ProjectPath   string `json:"project_path,omitempty"`  // Path to project instructions file
 	ProjectExists bool   `json:"project_exists"`          // Whether project instructions file exists
 	ProjectError  string `json:"project_error,omitempty"` // Error parsing project instructions (if any)
+
+	Directories []DirectoryInstructions `json:"directories,omitempty"` // BB7.md files that apply to the active chat
 }
 
 type instructionsParseError struct {
@@ -54,49 +56,108 @@ func (s *State) GetInstructionsInfo() InstructionsInfo {
 		info.ProjectPath = filepath.Join(s.ProjectRoot, ".bb7", projectInstructionsFilename)
 		if _, err := os.Stat(info.ProjectPath); err == nil {
 			info.ProjectExists = true
-			if _, err := parseInstructionsFile(info.ProjectPath, s.ProjectRoot); err != nil {
+			if _, _, err := s.loadProjectInstructions(InstructionScope{}); err != nil {
 				info.ProjectError = err.Error()
 			}
 		}
 	}
 
+	info.Directories = s.DirectoryInstructionsInfo()
+
 	return info
 }
 
 // LoadGlobalInstructions reads the global instructions file content.
 // Strips @@ comments and returns empty string if file doesn't exist
-// or is empty after stripping.
+// or is empty after stripping. Scoped blocks are evaluated for the
+// active chat (see BuildInstructionsBlock).
 func (s *State) LoadGlobalInstructions() (string, error) {
+	content, _, err := s.loadGlobalInstructions(s.defaultInstructionScope())
+	return content, err
+}
+
+func (s *State) loadGlobalInstructions(scope InstructionScope) (string, []InstructionBlock, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", nil // Not an error, just no global instructions
+		return "", nil, nil // Not an error, just no global instructions
 	}
 
 	path := filepath.Join(homeDir, ".config", "bb7", globalInstructionsFilename)
 	content, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", nil
+			return "", nil, nil
 		}
-		return "", err
+		return "", nil, err
 	}
 
-	stripped := StripComments(string(content))
+	segments, err := splitInstructionSegments(path, string(content))
+	if err != nil {
+		return "", nil, err
+	}
+	stripped, blocks, err := s.renderInstructionSegments("global", path, segments, scope, func(seg instructionSegment) (string, error) {
+		return StripComments(seg.text), nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
 	if strings.TrimSpace(stripped) == "" {
-		return "", nil
+		return "", blocks, nil
 	}
-	return stripped, nil
+	return stripped, blocks, nil
 }
 
 // LoadProjectInstructions reads the project instructions file content.
-// Returns empty string if file doesn't exist.
+// Returns empty string if file doesn't exist. Scoped blocks are evaluated
+// for the active chat.
 func (s *State) LoadProjectInstructions() (string, error) {
+	content, _, err := s.loadProjectInstructions(s.defaultInstructionScope())
+	return content, err
+}
+
+func (s *State) loadProjectInstructions(scope InstructionScope) (string, []InstructionBlock, error) {
 	if s.ProjectRoot == "" {
-		return "", nil
+		return "", nil, nil
 	}
 
 	path := filepath.Join(s.ProjectRoot, ".bb7", projectInstructionsFilename)
-	return loadInstructionsFile(path, s.ProjectRoot)
+	return s.loadProjectScopedFile("project", path, scope)
+}
+
+// loadProjectScopedFile reads an instructions file that may use @include
+// (relative to the project root) and @when blocks. A missing file is empty.
+func (s *State) loadProjectScopedFile(source, path string, scope InstructionScope) (string, []InstructionBlock, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+
+	segments, err := splitInstructionSegments(path, string(content))
+	if err != nil {
+		return "", nil, err
+	}
+	return s.renderInstructionSegments(source, path, segments, scope, func(seg instructionSegment) (string, error) {
+		// Pad to the segment's first line so parse errors report file lines.
+		padding := seg.startLine - 1
+		parsed, err := parseInstructionsContent(path, s.ProjectRoot, []byte(strings.Repeat("\n", padding)+seg.text))
+		if err != nil {
+			return "", err
+		}
+		return parsed[padding:], nil
+	})
+}
+
+// defaultInstructionScope matches scoped blocks against the active chat's
+// model. Blocks conditioned on a diff mode don't apply.
+func (s *State) defaultInstructionScope() InstructionScope {
+	var scope InstructionScope
+	if s.ActiveChat != nil {
+		scope.Model = s.ActiveChat.Model
+	}
+	return scope
 }
 
 // PrepareInstructionsFile ensures the instructions file exists for the given level
@@ -137,7 +198,7 @@ func (s *State) PrepareInstructionsFile(level string, defaultSystemPrompt string
 
 	// Create file with default content if it doesn't exist
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if err := os.WriteFile(path, []byte(defaultContent), 0644); err != nil {
+		if err := writeFileAtomic(path, []byte(defaultContent), 0644); err != nil {
 			return "", err
 		}
 	}
@@ -148,13 +209,23 @@ func (s *State) PrepareInstructionsFile(level string, defaultSystemPrompt string
 // BuildInstructionsBlock returns the formatted instructions block for LLM injection.
 // Returns empty string if no instruction files exist.
 // For global chats, only global instructions are included (no project instructions).
+// Scoped blocks are evaluated for the active chat's model.
 func (s *State) BuildInstructionsBlock() (string, error) {
+	result, _, err := s.BuildScopedInstructionsBlock(s.defaultInstructionScope())
+	return result, err
+}
+
+// BuildScopedInstructionsBlock is BuildInstructionsBlock for a given model and
+// diff mode. It also returns every @when block with whether it applied.
+func (s *State) BuildScopedInstructionsBlock(scope InstructionScope) (string, []InstructionBlock, error) {
 	var result string
+	blocks := []InstructionBlock{}
 
-	globalContent, err := s.LoadGlobalInstructions()
+	globalContent, globalBlocks, err := s.loadGlobalInstructions(scope)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	blocks = append(blocks, globalBlocks...)
 	if strings.TrimSpace(globalContent) != "" {
 		result += "<user-instructions source=\"~/.config/bb7/instructions.md\">\n"
 		result += globalContent
@@ -166,13 +237,14 @@ func (s *State) BuildInstructionsBlock() (string, error) {
 
 	// Skip project instructions for global chats
 	if s.ActiveChat != nil && s.ActiveChat.Global {
-		return result, nil
+		return result, blocks, nil
 	}
 
-	projectContent, err := s.LoadProjectInstructions()
+	projectContent, projectBlocks, err := s.loadProjectInstructions(scope)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	blocks = append(blocks, projectBlocks...)
 	if strings.TrimSpace(projectContent) != "" {
 		result += "<project-instructions source=\".bb7/instructions\">\n"
 		result += projectContent
@@ -182,7 +254,14 @@ func (s *State) BuildInstructionsBlock() (string, error) {
 		result += "</project-instructions>\n\n"
 	}
 
-	return result, nil
+	directoryContent, directoryBlocks, err := s.buildDirectoryInstructions(scope)
+	if err != nil {
+		return "", nil, err
+	}
+	blocks = append(blocks, directoryBlocks...)
+	result += directoryContent
+
+	return result, blocks, nil
 }
 
 func defaultProjectInstructions() string {
@@ -203,6 +282,11 @@ func defaultProjectInstructions() string {
 		"@@",
 		"@@ Example:",
 		"@@ @include ARCHITECTURE.md",
+		"@@",
+		"@@ Lines between @when and @end are only sent when they apply:",
+		"@@ @when files=**/*_test.go    A context file matches a glob",
+		"@@ @when model=anthropic/*     The model ID matches",
+		"@@ @when diff_mode=anchored    The diff mode is one of those listed",
 		"",
 		"# Add project context here (Markdown ok)",
 		"",
@@ -254,26 +338,6 @@ func StripComments(content string) string {
 	return out.String()
 }
 
-func loadInstructionsFile(path string, projectRoot string) (string, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
-		}
-		return "", err
-	}
-
-	return parseInstructionsContent(path, projectRoot, content)
-}
-
-func parseInstructionsFile(path string, projectRoot string) (string, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-	return parseInstructionsContent(path, projectRoot, content)
-}
-
 func parseInstructionsContent(path string, projectRoot string, content []byte) (string, error) {
 	reader := bufio.NewReader(bytes.NewReader(content))
 	var out strings.Builder
@@ -0,0 +1,261 @@
+package state
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Scoped instruction blocks. An instruction file can wrap lines in
+//
+//	@when files=**/*_test.go,*.proto model=anthropic/* diff_mode=anchored
+//	...
+//	@end
+//
+// so they are sent only when every condition holds: a context file matches
+// one of the files globs, the model ID matches one of the model patterns, and
+// the diff mode is one of the listed modes. Like @include, the directives
+// must start at column 0 and are ignored inside fenced code blocks; blocks
+// don't nest. Included files are not scanned for directives.
+
+// InstructionScope is what scoped instruction blocks are matched against.
+// Context files come from the active chat.
+type InstructionScope struct {
+	Model    string
+	DiffMode string
+}
+
+// InstructionBlock describes one @when block and whether it applied.
+type InstructionBlock struct {
+	Source    string `json:"source"` // "global" or "project"
+	Path      string `json:"path"`
+	Line      int    `json:"line"`      // line of the @when directive
+	Condition string `json:"condition"` // directive text after @when
+	Active    bool   `json:"active"`
+}
+
+// instructionCondition is a parsed @when directive. Empty lists don't
+// constrain.
+type instructionCondition struct {
+	text      string
+	files     []string
+	models    []string
+	diffModes []string
+}
+
+// instructionSegment is a run of instruction lines: unconditional text, or
+// the body of one @when block.
+type instructionSegment struct {
+	cond      *instructionCondition
+	line      int // first line of the segment (the @when line for blocks)
+	startLine int // first line of text
+	text      string
+}
+
+// splitInstructionSegments splits raw instruction file content at @when and
+// @end directives.
+func splitInstructionSegments(path, content string) ([]instructionSegment, error) {
+	var segments []instructionSegment
+	current := instructionSegment{line: 1, startLine: 1}
+	var text strings.Builder
+	inFence := false
+	flush := func() {
+		current.text = text.String()
+		if current.cond != nil || current.text != "" {
+			segments = append(segments, current)
+		}
+		text.Reset()
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	for i, lineRaw := range lines {
+		lineNum := i + 1
+		line := strings.TrimRight(lineRaw, "\r\n")
+		if isFenceLine(line) {
+			inFence = !inFence
+		}
+		if !inFence {
+			if cond, ok, err := parseWhenDirective(line, path, lineNum); ok {
+				if err != nil {
+					return nil, err
+				}
+				if current.cond != nil {
+					return nil, &instructionsParseError{Path: path, Line: lineNum, Message: "@when blocks cannot be nested"}
+				}
+				flush()
+				current = instructionSegment{cond: cond, line: lineNum, startLine: lineNum + 1}
+				continue
+			}
+			if strings.TrimSpace(line) == "@end" {
+				if current.cond == nil {
+					return nil, &instructionsParseError{Path: path, Line: lineNum, Message: "@end without @when"}
+				}
+				flush()
+				current = instructionSegment{line: lineNum + 1, startLine: lineNum + 1}
+				continue
+			}
+		}
+		text.WriteString(lineRaw)
+	}
+	if current.cond != nil {
+		return nil, &instructionsParseError{Path: path, Line: current.line, Message: "@when block missing @end"}
+	}
+	flush()
+	return segments, nil
+}
+
+func parseWhenDirective(line, path string, lineNum int) (*instructionCondition, bool, error) {
+	if !strings.HasPrefix(line, "@when") {
+		return nil, false, nil
+	}
+	rest := line[len("@when"):]
+	if rest != "" && !isWhitespace(rune(rest[0])) {
+		return nil, false, nil
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return nil, true, &instructionsParseError{Path: path, Line: lineNum, Message: "@when missing condition"}
+	}
+	cond := &instructionCondition{text: rest}
+	for _, field := range strings.Fields(rest) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return nil, true, &instructionsParseError{Path: path, Line: lineNum, Message: fmt.Sprintf("@when condition must be key=value: %s", field)}
+		}
+		values := strings.Split(value, ",")
+		switch key {
+		case "files":
+			cond.files = append(cond.files, values...)
+		case "model":
+			cond.models = append(cond.models, values...)
+		case "diff_mode":
+			cond.diffModes = append(cond.diffModes, values...)
+		default:
+			return nil, true, &instructionsParseError{Path: path, Line: lineNum, Message: fmt.Sprintf("unknown @when key %q (want files, model, or diff_mode)", key)}
+		}
+	}
+	return cond, true, nil
+}
+
+// matches reports whether the condition holds for the scope and context files.
+func (c *instructionCondition) matches(scope InstructionScope, contextPaths []string) bool {
+	if len(c.files) > 0 && !anyPathMatches(c.files, contextPaths) {
+		return false
+	}
+	if len(c.models) > 0 {
+		matched := false
+		for _, pattern := range c.models {
+			if wildcardMatch(pattern, scope.Model) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(c.diffModes) > 0 && !containsString(c.diffModes, scope.DiffMode) {
+		return false
+	}
+	return true
+}
+
+func anyPathMatches(globs, paths []string) bool {
+	for _, glob := range globs {
+		for _, p := range paths {
+			if matchPathGlob(glob, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches a slash-separated path against a glob where ** spans
+// directories. A pattern without a slash matches the file name at any depth.
+func matchPathGlob(pattern, p string) bool {
+	p = filepath.ToSlash(p)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(strings.TrimPrefix(p, "/"), "/"))
+}
+
+func matchGlobParts(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlobParts(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// wildcardMatch matches s against a pattern where * matches any run of
+// characters, including slashes.
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// renderInstructionSegments joins the unconditional segments and the blocks
+// whose condition holds. parse turns a segment's raw text into instruction
+// text (comments stripped, includes expanded).
+func (s *State) renderInstructionSegments(source, path string, segments []instructionSegment, scope InstructionScope, parse func(instructionSegment) (string, error)) (string, []InstructionBlock, error) {
+	var contextPaths []string
+	if s.ActiveChat != nil {
+		for _, cf := range s.ActiveChat.ContextFiles {
+			contextPaths = append(contextPaths, cf.Path)
+		}
+	}
+	var out strings.Builder
+	var blocks []InstructionBlock
+	for _, seg := range segments {
+		active := seg.cond == nil || seg.cond.matches(scope, contextPaths)
+		if seg.cond != nil {
+			blocks = append(blocks, InstructionBlock{
+				Source:    source,
+				Path:      path,
+				Line:      seg.line,
+				Condition: seg.cond.text,
+				Active:    active,
+			})
+		}
+		// Parse inactive blocks too, so errors in them surface.
+		text, err := parse(seg)
+		if err != nil {
+			return "", nil, err
+		}
+		if active {
+			out.WriteString(text)
+		}
+	}
+	return out.String(), blocks, nil
+}
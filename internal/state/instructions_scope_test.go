@@ -0,0 +1,111 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildScopedInstructionsBlock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	if _, err := s.ChatNew("test", "test/model"); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	s.ActiveChat.ContextFiles = []ContextFile{{Path: "internal/state/chat_test.go"}}
+
+	instructions := strings.Join([]string{
+		"Always here.",
+		"@when files=**/*_test.go",
+		"Use table tests.",
+		"@end",
+		"@when files=*.proto",
+		"Keep field numbers.",
+		"@end",
+		"@when model=anthropic/* diff_mode=anchored",
+		"Anchored Claude.",
+		"@end",
+		"```",
+		"@when files=*.go",
+		"```",
+		"Tail.",
+		"",
+	}, "\n")
+	path := filepath.Join(s.ProjectRoot, ".bb7", projectInstructionsFilename)
+	if err := os.WriteFile(path, []byte(instructions), 0644); err != nil {
+		t.Fatalf("write instructions: %v", err)
+	}
+
+	block, blocks, err := s.BuildScopedInstructionsBlock(InstructionScope{Model: "anthropic/claude-sonnet-4", DiffMode: "anchored"})
+	if err != nil {
+		t.Fatalf("BuildScopedInstructionsBlock failed: %v", err)
+	}
+	want := "Always here.\nUse table tests.\nAnchored Claude.\n```\n@when files=*.go\n```\nTail.\n"
+	if !strings.Contains(block, want) {
+		t.Errorf("block = %q, want it to contain %q", block, want)
+	}
+	if strings.Contains(block, "field numbers") {
+		t.Error("proto block should not apply")
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %+v", blocks)
+	}
+	active := []bool{blocks[0].Active, blocks[1].Active, blocks[2].Active}
+	if !active[0] || active[1] || !active[2] {
+		t.Errorf("active = %v, want [true false true]", active)
+	}
+	if blocks[2].Line != 8 || blocks[2].Source != "project" || blocks[2].Condition != "model=anthropic/* diff_mode=anchored" {
+		t.Errorf("unexpected block: %+v", blocks[2])
+	}
+
+	block, _, err = s.BuildScopedInstructionsBlock(InstructionScope{Model: "openai/gpt-5", DiffMode: "anchored"})
+	if err != nil {
+		t.Fatalf("BuildScopedInstructionsBlock failed: %v", err)
+	}
+	if strings.Contains(block, "Anchored Claude.") {
+		t.Error("model block should not apply to another model")
+	}
+}
+
+func TestSplitInstructionSegmentsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing end", "@when files=*.go\ntext\n", "missing @end"},
+		{"stray end", "text\n@end\n", "@end without @when"},
+		{"nested", "@when files=*.go\n@when model=x\n@end\n@end\n", "cannot be nested"},
+		{"unknown key", "@when lang=go\n@end\n", "unknown @when key"},
+		{"no condition", "@when\n@end\n", "missing condition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := splitInstructionSegments("instructions", tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*_test.go", "a/b/c_test.go", true},
+		{"**/*_test.go", "c_test.go", true},
+		{"**/*_test.go", "a/b/c_test.go", true},
+		{"internal/**", "internal/state/chat.go", true},
+		{"internal/*.go", "internal/state/chat.go", false},
+		{"cmd/**/main.go", "cmd/bb7/main.go", true},
+		{"*.proto", "api/v1/service.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchPathGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youruser/bb7/internal/diff"
+)
+
+// Fork lineage. Forked chats record their parent's ID and the number of
+// messages they share with it (ForkIndex); index.json mirrors both so a chat
+// family can be assembled without loading every chat. A family is all chats
+// connected through parent links. If a chat in the middle of a family is
+// deleted, its children become the roots of their own families.
+
+// ErrNotRelated is returned when comparing chats from different families.
+var ErrNotRelated = errors.New("chats are not forks of each other")
+
+// ChatTreeNode is one chat in a fork family.
+type ChatTreeNode struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Created   time.Time       `json:"created"`
+	ParentID  string          `json:"parent_id,omitempty"`
+	ForkIndex int             `json:"fork_index"`
+	Global    bool            `json:"global,omitempty"`
+	Children  []*ChatTreeNode `json:"children,omitempty"`
+}
+
+// chatFamily is the index view of a chats directory used to walk lineage.
+type chatFamily struct {
+	byID     map[string]ChatSummary
+	children map[string][]ChatSummary
+}
+
+func loadChatFamilyAt(chatsDir string) (*chatFamily, error) {
+	idx, err := ensureChatIndexAt(chatsDir)
+	if err != nil {
+		return nil, err
+	}
+	f := &chatFamily{
+		byID:     make(map[string]ChatSummary, len(idx.Chats)),
+		children: make(map[string][]ChatSummary),
+	}
+	for _, c := range idx.Chats {
+		f.byID[c.ID] = c
+	}
+	for _, c := range idx.Chats {
+		if _, ok := f.byID[c.ParentID]; ok && c.ParentID != c.ID {
+			f.children[c.ParentID] = append(f.children[c.ParentID], c)
+		}
+	}
+	for _, kids := range f.children {
+		sort.Slice(kids, func(i, j int) bool {
+			return kids[i].Created.Before(kids[j].Created)
+		})
+	}
+	return f, nil
+}
+
+// root returns the topmost existing ancestor of a chat.
+func (f *chatFamily) root(id string) string {
+	seen := map[string]bool{id: true}
+	for {
+		parent := f.byID[id].ParentID
+		if _, ok := f.byID[parent]; !ok || seen[parent] {
+			return id
+		}
+		seen[parent] = true
+		id = parent
+	}
+}
+
+func (f *chatFamily) build(c ChatSummary, global bool, seen map[string]bool) *ChatTreeNode {
+	seen[c.ID] = true
+	node := &ChatTreeNode{
+		ID:        c.ID,
+		Name:      c.Name,
+		Created:   c.Created,
+		ParentID:  c.ParentID,
+		ForkIndex: c.ForkIndex,
+		Global:    global,
+	}
+	for _, child := range f.children[c.ID] {
+		if !seen[child.ID] {
+			node.Children = append(node.Children, f.build(child, global, seen))
+		}
+	}
+	return node
+}
+
+func (s *State) requireScope(global bool) error {
+	if global {
+		return s.ensureGlobalChatsDir()
+	}
+	return s.requireInit()
+}
+
+// ChatTree returns the fork family containing a chat, rooted at its oldest
+// surviving ancestor. Children are ordered by creation time.
+func (s *State) ChatTree(id string, global bool) (*ChatTreeNode, error) {
+	if err := s.requireScope(global); err != nil {
+		return nil, err
+	}
+	family, err := loadChatFamilyAt(s.chatsDirFor(global))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := family.byID[id]; !ok {
+		return nil, ErrChatNotFound
+	}
+	root := family.byID[family.root(id)]
+	return family.build(root, global, make(map[string]bool)), nil
+}
+
+// BranchReply is an assistant reply on one side of a comparison.
+type BranchReply struct {
+	MessageIndex int    `json:"message_index"`
+	Prompt       string `json:"prompt,omitempty"` // User message the reply answers
+	Model        string `json:"model,omitempty"`
+	Text         string `json:"text"`
+}
+
+// TurnComparison pairs the n-th assistant reply after the branch point in
+// each chat. Left or Right is nil when one branch has fewer replies.
+type TurnComparison struct {
+	Turn  int          `json:"turn"`
+	Left  *BranchReply `json:"left,omitempty"`
+	Right *BranchReply `json:"right,omitempty"`
+	Diff  string       `json:"diff,omitempty"` // Unified diff of the reply texts
+}
+
+// Output file comparison statuses.
+const (
+	CompareIdentical = "identical"
+	CompareModified  = "modified"
+	CompareLeftOnly  = "left_only"
+	CompareRightOnly = "right_only"
+)
+
+// FileComparison compares one pending output file between two chats.
+type FileComparison struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"` // Unified diff, for modified files
+}
+
+// ChatComparison is the result of ChatCompare.
+type ChatComparison struct {
+	Left           ChatSummary      `json:"left"`
+	Right          ChatSummary      `json:"right"`
+	CommonMessages int              `json:"common_messages"` // Messages shared before the branches diverge
+	Turns          []TurnComparison `json:"turns"`
+	Files          []FileComparison `json:"files"`
+}
+
+// ChatCompare diffs two chats from the same fork family: the assistant
+// replies after the point where their histories diverge, paired turn by
+// turn, and their pending output files. Neither chat is selected or locked.
+func (s *State) ChatCompare(leftID, rightID string, global bool) (*ChatComparison, error) {
+	if err := s.requireScope(global); err != nil {
+		return nil, err
+	}
+	chatsDir := s.chatsDirFor(global)
+	family, err := loadChatFamilyAt(chatsDir)
+	if err != nil {
+		return nil, err
+	}
+	leftSummary, okLeft := family.byID[leftID]
+	rightSummary, okRight := family.byID[rightID]
+	if !okLeft || !okRight {
+		return nil, ErrChatNotFound
+	}
+	if family.root(leftID) != family.root(rightID) {
+		return nil, ErrNotRelated
+	}
+
+	left, err := loadChatFrom(filepath.Join(chatsDir, leftID, "chat.json"))
+	if err != nil {
+		return nil, err
+	}
+	right, err := loadChatFrom(filepath.Join(chatsDir, rightID, "chat.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &ChatComparison{
+		Left:           leftSummary,
+		Right:          rightSummary,
+		CommonMessages: commonMessagePrefix(left.Messages, right.Messages),
+		Turns:          []TurnComparison{},
+		Files:          []FileComparison{},
+	}
+
+	leftReplies := branchReplies(left.Messages, cmp.CommonMessages)
+	rightReplies := branchReplies(right.Messages, cmp.CommonMessages)
+	for i := 0; i < max(len(leftReplies), len(rightReplies)); i++ {
+		turn := TurnComparison{Turn: i + 1}
+		oldText, newText := "", ""
+		if i < len(leftReplies) {
+			turn.Left = &leftReplies[i]
+			oldText = ensureTrailingNewline(turn.Left.Text)
+		}
+		if i < len(rightReplies) {
+			turn.Right = &rightReplies[i]
+			newText = ensureTrailingNewline(turn.Right.Text)
+		}
+		turn.Diff = diff.Unified(leftSummary.Name, rightSummary.Name, oldText, newText, 3)
+		cmp.Turns = append(cmp.Turns, turn)
+	}
+
+	if !global {
+		files, err := compareOutputDirs(filepath.Join(chatsDir, leftID, "output"), filepath.Join(chatsDir, rightID, "output"))
+		if err != nil {
+			return nil, err
+		}
+		cmp.Files = files
+	}
+	return cmp, nil
+}
+
+// commonMessagePrefix counts the leading messages two chats share. Forks copy
+// messages verbatim, so role, timestamp, and text identify a shared message.
+func commonMessagePrefix(a, b []Message) int {
+	n := 0
+	for n < len(a) && n < len(b) {
+		if a[n].Role != b[n].Role || !a[n].Timestamp.Equal(b[n].Timestamp) || MessageText(a[n]) != MessageText(b[n]) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// branchReplies returns the assistant replies from index start onward.
+// Messages that only record context events are skipped.
+func branchReplies(messages []Message, start int) []BranchReply {
+	var replies []BranchReply
+	prompt := ""
+	for i := start; i < len(messages); i++ {
+		msg := messages[i]
+		switch msg.Role {
+		case "user":
+			prompt = MessageText(msg)
+		case "assistant":
+			text := replyText(msg)
+			if text == "" {
+				continue
+			}
+			replies = append(replies, BranchReply{MessageIndex: i, Prompt: prompt, Model: msg.Model, Text: text})
+		}
+	}
+	return replies
+}
+
+// replyText joins the visible content of an assistant message, leaving out
+// thinking and context events.
+func replyText(msg Message) string {
+	var parts []string
+	for _, p := range msg.Parts {
+		switch p.Type {
+		case PartTypeText, PartTypeCode, PartTypeRaw:
+			if p.Content != "" {
+				parts = append(parts, p.Content)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func ensureTrailingNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+// compareOutputDirs compares the files in two output directories.
+func compareOutputDirs(leftDir, rightDir string) ([]FileComparison, error) {
+	leftFiles, err := listOutputFilesIn(leftDir)
+	if err != nil {
+		return nil, err
+	}
+	rightFiles, err := listOutputFilesIn(rightDir)
+	if err != nil {
+		return nil, err
+	}
+
+	inLeft := make(map[string]bool, len(leftFiles))
+	for _, f := range leftFiles {
+		inLeft[f] = true
+	}
+	inRight := make(map[string]bool, len(rightFiles))
+	paths := append([]string(nil), leftFiles...)
+	for _, f := range rightFiles {
+		inRight[f] = true
+		if !inLeft[f] {
+			paths = append(paths, f)
+		}
+	}
+	sort.Strings(paths)
+
+	files := make([]FileComparison, 0, len(paths))
+	for _, p := range paths {
+		fc := FileComparison{Path: filepath.ToSlash(p)}
+		switch {
+		case !inRight[p]:
+			fc.Status = CompareLeftOnly
+		case !inLeft[p]:
+			fc.Status = CompareRightOnly
+		default:
+			a, err := os.ReadFile(filepath.Join(leftDir, p))
+			if err != nil {
+				return nil, err
+			}
+			b, err := os.ReadFile(filepath.Join(rightDir, p))
+			if err != nil {
+				return nil, err
+			}
+			if string(a) == string(b) {
+				fc.Status = CompareIdentical
+			} else {
+				fc.Status = CompareModified
+				fc.Diff = diff.Unified("a/"+fc.Path, "b/"+fc.Path, string(a), string(b), 3)
+			}
+		}
+		files = append(files, fc)
+	}
+	return files, nil
+}
+
+// BranchChat creates a child of a project chat that continues from its last
+// message. The branch copies every message, the context files, and the
+// pending output, so a new turn in it sees exactly what the source chat
+// would. It is not selected; use OpenChat to work on it. An empty model
+// keeps the source chat's model.
+func (s *State) BranchChat(sourceID, name, model string) (*Chat, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+
+	var source *Chat
+	if s.ActiveChat != nil && s.ActiveChat.ID == sourceID && !s.ActiveChat.Global {
+		source = s.ActiveChat
+	} else {
+		var err error
+		source, err = s.loadChat(sourceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = source.Name
+	}
+	if model == "" {
+		model = source.Model
+	}
+	chat := &Chat{
+		Version:         CurrentChatVersion,
+		ID:              id,
+		Name:            name,
+		Created:         time.Now().UTC(),
+		Model:           model,
+		ReasoningEffort: source.ReasoningEffort,
+		Persona:         source.Persona,
+		Generation:      source.Generation,
+		ParentID:        source.ID,
+		ForkIndex:       len(source.Messages),
+		ContextFiles:    append([]ContextFile{}, source.ContextFiles...),
+		Messages:        append([]Message{}, source.Messages...),
+		Snapshots:       cloneSnapshots(source.Snapshots),
+	}
+
+	err = copyDirRecursive(s.outputDir(sourceID), s.outputDir(id))
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(s.outputDir(id), 0755)
+	}
+	if err != nil {
+		os.RemoveAll(s.chatDir(id))
+		return nil, err
+	}
+
+	if err := s.saveChat(chat); err != nil {
+		os.RemoveAll(s.chatDir(id))
+		return nil, err
+	}
+	if err := s.updateChatIndexEntry(chat); err != nil {
+		// Index is a cache; do not fail branch creation if it can't be updated.
+	}
+	return chat, nil
+}
+
+// OpenChat returns a separate State whose active chat is the given project
+// chat, locked for this process. The receiver's selection and the project's
+// last active chat are left alone, so a caller can drive several chats at
+// once. Call Cleanup on the returned State to release the lock.
+func (s *State) OpenChat(id string) (*State, error) {
+	return s.openChatFor(id, false)
+}
+
+// OpenGlobalChat is OpenChat for a global chat.
+func (s *State) OpenGlobalChat(id string) (*State, error) {
+	return s.openChatFor(id, true)
+}
+
+func (s *State) openChatFor(id string, global bool) (*State, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	chatDir := s.chatDirFor(id, global)
+	if err := lockChatDir(chatDir); err != nil {
+		return nil, err
+	}
+	chat, err := loadChatFrom(filepath.Join(chatDir, "chat.json"))
+	if err != nil {
+		dropLock(chatDir)
+		return nil, err
+	}
+	chat.Global = global
+	return &State{ProjectRoot: s.ProjectRoot, GlobalOnly: s.GlobalOnly, ActiveChat: chat, lockedChatDir: chatDir}, nil
+}
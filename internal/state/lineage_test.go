@@ -0,0 +1,213 @@
+package state
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// forkFamily creates root -> (a, b) -> a1, where a and b fork root at its
+// second user message and a1 forks a.
+func forkFamily(t *testing.T, s *State) (root, a, b, a1 string) {
+	t.Helper()
+	chat, _ := s.ChatNew("root", "")
+	root = chat.ID
+	s.AddUserMessage("First question", "model-a")
+	s.AddAssistantMessage([]MessagePart{{Type: PartTypeText, Content: "First answer"}}, nil, "model-a", nil)
+	s.AddUserMessage("Write hello", "model-a")
+	s.AddAssistantMessage([]MessagePart{{Type: PartTypeText, Content: "Root reply"}}, nil, "model-a", nil)
+
+	fork := func(id string, idx int, model, reply, output string) string {
+		t.Helper()
+		result, err := s.ForkChat(id, idx)
+		if err != nil {
+			t.Fatalf("ForkChat failed: %v", err)
+		}
+		s.AddUserMessage("Write hello", model)
+		s.AddAssistantMessage([]MessagePart{
+			{Type: PartTypeThinking, Content: "thinking differs"},
+			{Type: PartTypeText, Content: reply},
+		}, nil, model, nil)
+		if output != "" {
+			s.WriteOutputFile("hello.go", output)
+		}
+		return result.NewChatID
+	}
+	a = fork(root, 2, "model-a", "package main\nfunc main() {}\n", "package main\n\nfunc main() {}\n")
+	b = fork(root, 2, "model-b", "package main\nfunc main() { println() }\n", "package main\n\nfunc main() { println() }\n")
+	a1 = fork(a, 2, "model-c", "Third take", "")
+	return root, a, b, a1
+}
+
+func TestForkRecordsLineage(t *testing.T) {
+	s := setupTestState(t)
+	root, a, _, _ := forkFamily(t, s)
+
+	chat, err := s.loadChat(a)
+	if err != nil {
+		t.Fatalf("loadChat failed: %v", err)
+	}
+	if chat.ParentID != root || chat.ForkIndex != 2 {
+		t.Errorf("lineage = %q/%d, want %q/2", chat.ParentID, chat.ForkIndex, root)
+	}
+
+	idx, _ := s.loadChatIndex()
+	for _, c := range idx.Chats {
+		if c.ID == a && c.ParentID != root {
+			t.Errorf("index lineage = %q, want %q", c.ParentID, root)
+		}
+	}
+}
+
+func TestChatTree(t *testing.T) {
+	s := setupTestState(t)
+	root, a, b, a1 := forkFamily(t, s)
+	s.ChatNew("unrelated", "")
+
+	tree, err := s.ChatTree(a1, false)
+	if err != nil {
+		t.Fatalf("ChatTree failed: %v", err)
+	}
+	if tree.ID != root || len(tree.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", tree)
+	}
+	if tree.Children[0].ID != a || tree.Children[1].ID != b {
+		t.Errorf("children not ordered by creation: %s, %s", tree.Children[0].ID, tree.Children[1].ID)
+	}
+	if len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].ID != a1 {
+		t.Errorf("grandchild missing: %+v", tree.Children[0])
+	}
+
+	// Deleting a middle chat detaches its subtree.
+	if err := s.ChatDelete(a); err != nil {
+		t.Fatalf("ChatDelete failed: %v", err)
+	}
+	tree, _ = s.ChatTree(a1, false)
+	if tree.ID != a1 || tree.ParentID != a {
+		t.Errorf("orphan should become its own root: %+v", tree)
+	}
+
+	if _, err := s.ChatTree("missing", false); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("expected ErrChatNotFound, got %v", err)
+	}
+}
+
+func TestChatCompare(t *testing.T) {
+	s := setupTestState(t)
+	_, a, b, _ := forkFamily(t, s)
+
+	cmp, err := s.ChatCompare(a, b, false)
+	if err != nil {
+		t.Fatalf("ChatCompare failed: %v", err)
+	}
+	if cmp.CommonMessages != 2 {
+		t.Errorf("common messages = %d, want 2", cmp.CommonMessages)
+	}
+	if len(cmp.Turns) != 1 {
+		t.Fatalf("expected 1 turn, got %+v", cmp.Turns)
+	}
+	turn := cmp.Turns[0]
+	if turn.Left.Model != "model-a" || turn.Right.Model != "model-b" || turn.Left.Prompt != "Write hello" {
+		t.Errorf("unexpected turn: %+v / %+v", turn.Left, turn.Right)
+	}
+	if strings.Contains(turn.Diff, "thinking") {
+		t.Error("thinking should not be compared")
+	}
+	if !strings.Contains(turn.Diff, "-func main() {}\n+func main() { println() }\n") {
+		t.Errorf("unexpected reply diff:\n%s", turn.Diff)
+	}
+
+	if len(cmp.Files) != 1 || cmp.Files[0].Status != CompareModified {
+		t.Fatalf("unexpected files: %+v", cmp.Files)
+	}
+	if !strings.Contains(cmp.Files[0].Diff, "+++ b/hello.go") {
+		t.Errorf("unexpected file diff:\n%s", cmp.Files[0].Diff)
+	}
+}
+
+func TestChatCompareUnevenBranches(t *testing.T) {
+	s := setupTestState(t)
+	root, a, _, a1 := forkFamily(t, s)
+
+	// a1 shares the first exchange with root; each then has one reply.
+	cmp, err := s.ChatCompare(root, a1, false)
+	if err != nil {
+		t.Fatalf("ChatCompare failed: %v", err)
+	}
+	if cmp.CommonMessages != 2 || len(cmp.Turns) != 1 {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+
+	// Output only exists on one side.
+	cmp, _ = s.ChatCompare(a, a1, false)
+	if len(cmp.Files) != 1 || cmp.Files[0].Status != CompareLeftOnly {
+		t.Errorf("unexpected files: %+v", cmp.Files)
+	}
+
+	other, _ := s.ChatNew("other", "")
+	if _, err := s.ChatCompare(a, other.ID, false); !errors.Is(err, ErrNotRelated) {
+		t.Errorf("expected ErrNotRelated, got %v", err)
+	}
+}
+
+func TestImportClearsLineage(t *testing.T) {
+	s := setupTestState(t)
+	_, a, _, _ := forkFamily(t, s)
+
+	bundle, err := s.ExportChat(a, false)
+	if err != nil {
+		t.Fatalf("ExportChat failed: %v", err)
+	}
+	chat, err := s.ImportChat(bundle, false)
+	if err != nil {
+		t.Fatalf("ImportChat failed: %v", err)
+	}
+	if chat.ParentID != "" || chat.ForkIndex != 0 {
+		t.Errorf("imported chat kept lineage: %q/%d", chat.ParentID, chat.ForkIndex)
+	}
+}
+
+func TestBranchChat(t *testing.T) {
+	s := setupTestState(t)
+
+	parent, _ := s.ChatNew("parent", "model-a")
+	s.ContextAdd("main.go", "package main\n")
+	s.AddUserMessage("Question", "model-a")
+	s.AddAssistantMessage([]MessagePart{{Type: PartTypeText, Content: "Answer"}}, nil, "model-a", nil)
+	s.WriteOutputFile("main.go", "package main\n\nfunc main() {}\n")
+
+	branch, err := s.BranchChat(parent.ID, "", "model-b")
+	if err != nil {
+		t.Fatalf("BranchChat failed: %v", err)
+	}
+	if s.ActiveChat.ID != parent.ID {
+		t.Error("BranchChat should not change the selection")
+	}
+	if branch.ParentID != parent.ID || branch.ForkIndex != len(s.ActiveChat.Messages) || branch.Model != "model-b" || branch.Name != "parent" {
+		t.Errorf("unexpected branch: %+v", branch)
+	}
+
+	view, err := s.OpenChat(branch.ID)
+	if err != nil {
+		t.Fatalf("OpenChat failed: %v", err)
+	}
+	defer view.Cleanup()
+	if len(view.ActiveChat.Messages) != len(s.ActiveChat.Messages) {
+		t.Errorf("branch should carry the parent's messages, got %d", len(view.ActiveChat.Messages))
+	}
+	if got, _ := view.GetContextFile("main.go"); got != "package main\n" {
+		t.Errorf("branch context = %q", got)
+	}
+	if got, _ := view.GetOutputFile("main.go"); got != "package main\n\nfunc main() {}\n" {
+		t.Errorf("branch output = %q", got)
+	}
+
+	// Writes in the branch stay out of the parent.
+	view.WriteOutputFile("extra.go", "package main\n")
+	if _, err := s.GetOutputFile("extra.go"); err == nil {
+		t.Error("branch output leaked into the parent")
+	}
+	if id, _ := s.LastActiveChat(); id != parent.ID {
+		t.Errorf("last active chat = %q, want parent", id)
+	}
+}
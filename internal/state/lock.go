@@ -1,114 +1,291 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 )
 
+// Chat locks are advisory file locks on chatDir/lock (flock(2), or
+// LockFileEx on Windows; see tryLockFile), held through the open lock file
+// for as long as the chat is locked. The OS drops them when the process
+// exits, so a crashed editor never leaves a chat locked and a reused PID
+// cannot keep one locked. The file holds the owner's PID and hostname for
+// diagnostics only.
+
 // lockFilePath returns the path to the lock file for a chat directory.
 func lockFilePath(chatDir string) string {
 	return filepath.Join(chatDir, "lock")
 }
 
-// AcquireLock creates a lock file containing the current PID.
-// Returns ErrChatLocked if the chat is already locked by a live process.
-func AcquireLock(chatDir string) error {
-	lockPath := lockFilePath(chatDir)
+// Lock attempts that find the file locked are retried briefly, since
+// IsLocked probes by taking the lock for a moment.
+const (
+	lockAttempts   = 5
+	lockRetryDelay = 5 * time.Millisecond
+)
+
+// errLockBusy is returned by tryLockFile when another open file holds the
+// lock.
+var errLockBusy = errors.New("lock held by another file")
 
-	// Check for existing lock
-	if isLockedByOther(lockPath) {
-		return ErrChatLocked
+// ownLocks holds the open lock files of the chats this process has locked.
+var ownLocks = struct {
+	sync.Mutex
+	files map[string]*os.File
+}{files: make(map[string]*os.File)}
+
+// lockPathFile takes an exclusive flock on the file at lockPath, creating
+// it if needed. It returns ErrChatLocked if another open file holds it.
+func lockPathFile(lockPath string) (*os.File, error) {
+	for attempt := 1; ; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := tryLockFile(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLockBusy) {
+				return nil, err
+			}
+			if attempt == lockAttempts {
+				return nil, ErrChatLocked
+			}
+			time.Sleep(lockRetryDelay)
+			continue
+		}
+		// The previous holder removes the file on release. If that happened
+		// between our open and flock, we locked a file no one else will
+		// open; start over on the current one.
+		if held, err := f.Stat(); err == nil {
+			if current, err := os.Stat(lockPath); err == nil && os.SameFile(held, current) {
+				return f, nil
+			}
+		}
+		f.Close()
 	}
+}
 
-	// Write current PID
-	pid := os.Getpid()
-	return os.WriteFile(lockPath, []byte(strconv.Itoa(pid)), 0644)
+// AcquireLock locks a chat directory for this process and records the PID
+// and hostname in the lock file. Returns ErrChatLocked if another process
+// holds the lock. Acquiring a lock this process already holds succeeds.
+func AcquireLock(chatDir string) error {
+	ownLocks.Lock()
+	defer ownLocks.Unlock()
+	if _, ok := ownLocks.files[chatDir]; ok {
+		return nil
+	}
+	f, err := lockPathFile(lockFilePath(chatDir))
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), host)), 0)
+	}
+	ownLocks.files[chatDir] = f
+	return nil
 }
 
-// ReleaseLock removes the lock file. Best-effort: ignores ENOENT.
+// ReleaseLock releases this process's lock on a chat directory and removes
+// the lock file. Best-effort: ignores ENOENT.
 func ReleaseLock(chatDir string) error {
+	ownLocks.Lock()
+	defer ownLocks.Unlock()
+	// Remove the file before unlocking so that no one locks it in between.
 	err := os.Remove(lockFilePath(chatDir))
+	if f, ok := ownLocks.files[chatDir]; ok {
+		f.Close()
+		delete(ownLocks.files, chatDir)
+		if err != nil && !os.IsNotExist(err) {
+			// Windows can't remove a file that is still open.
+			err = os.Remove(lockFilePath(chatDir))
+		}
+	}
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-// IsLocked checks if a chat directory is locked by another process.
-// Auto-removes stale locks (dead PID).
-func IsLocked(chatDir string) bool {
-	return isLockedByOther(lockFilePath(chatDir))
-}
+// A chat can be held by more than one State in this process, e.g. the active
+// chat and a View streaming into it. holdLock and dropLock count the holders
+// so the lock file is only removed when the last one lets go.
+var heldLocks = struct {
+	sync.Mutex
+	refs map[string]int
+}{refs: make(map[string]int)}
 
-// ForceUnlock removes the lock file unconditionally.
-func ForceUnlock(chatDir string) error {
-	return ReleaseLock(chatDir)
+// holdLock acquires the lock for chatDir, or adds a holder if this process
+// already holds it.
+func holdLock(chatDir string) error {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	if heldLocks.refs[chatDir] > 0 {
+		heldLocks.refs[chatDir]++
+		return nil
+	}
+	if err := AcquireLock(chatDir); err != nil {
+		return err
+	}
+	heldLocks.refs[chatDir] = 1
+	return nil
 }
 
-// isLockedByOther checks the lock file and returns true if locked by a live
-// process other than the current one. Removes stale locks.
-func isLockedByOther(lockPath string) bool {
-	data, err := os.ReadFile(lockPath)
-	if err != nil {
-		return false // No lock file or can't read it
+// lockChatDir takes a holder on the lock of an existing chat directory. It is
+// the only check for other processes: taking the lock fails with
+// ErrChatLocked if one holds it, so the chat can be read once this returns.
+func lockChatDir(chatDir string) error {
+	err := holdLock(chatDir)
+	if os.IsNotExist(err) {
+		return ErrChatNotFound
 	}
+	return err
+}
 
-	pidStr := strings.TrimSpace(string(data))
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		// Corrupt lock file — remove it
-		os.Remove(lockPath)
-		return false
+// dropLock removes a holder and releases the lock with the last one.
+func dropLock(chatDir string) {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+	if heldLocks.refs[chatDir] > 1 {
+		heldLocks.refs[chatDir]--
+		return
 	}
+	delete(heldLocks.refs, chatDir)
+	ReleaseLock(chatDir)
+}
 
-	// Our own lock
-	if pid == os.Getpid() {
+// IsLocked checks if a chat directory is locked by another process. A lock
+// file left behind without a holder is removed.
+func IsLocked(chatDir string) bool {
+	ownLocks.Lock()
+	_, own := ownLocks.files[chatDir]
+	ownLocks.Unlock()
+	if own {
 		return false
 	}
+	return lockFileHeld(lockFilePath(chatDir))
+}
 
-	// Check if process is alive
-	if !isProcessAlive(pid) {
-		// Stale lock — remove it
-		os.Remove(lockPath)
-		return false
+// lockFileHeld reports whether another open file holds the lock at
+// lockPath. A lock file left behind without a holder is removed.
+func lockFileHeld(lockPath string) bool {
+	if _, err := os.Stat(lockPath); err != nil {
+		return false // No lock file
 	}
+	f, err := lockPathFile(lockPath)
+	if err != nil {
+		return errors.Is(err, ErrChatLocked)
+	}
+	os.Remove(lockPath)
+	f.Close()
+	return false
+}
+
+// Backends own queue entries (see QueuedSend) through an instance ID rather
+// than their PID, which the OS may hand to another process once they exit.
+// A backend holds a lock on backends/<instance ID> next to each queue it
+// writes for as long as it runs, so its entries are orphaned exactly when
+// nothing holds that lock.
 
-	return true
+var instance struct {
+	once sync.Once
+	id   string
 }
 
-// isProcessAlive checks if a process with the given PID exists.
-func isProcessAlive(pid int) bool {
-	proc, err := os.FindProcess(pid)
+// instanceID returns this process's backend instance ID.
+func instanceID() string {
+	instance.once.Do(func() {
+		id, err := generateID()
+		if err != nil {
+			id = fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+		}
+		instance.id = id
+	})
+	return instance.id
+}
+
+// instanceLockPath returns the lock file of a backend instance for the
+// queue in dir.
+func instanceLockPath(dir, id string) string {
+	return filepath.Join(dir, "backends", id)
+}
+
+// holdInstanceLock locks this process's instance file in dir until the
+// process exits. Locking a dir again is a no-op.
+func holdInstanceLock(dir string) error {
+	path := instanceLockPath(dir, instanceID())
+	ownLocks.Lock()
+	defer ownLocks.Unlock()
+	if _, ok := ownLocks.files[path]; ok {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := lockPathFile(path)
 	if err != nil {
+		return err
+	}
+	ownLocks.files[path] = f
+	return nil
+}
+
+// instanceAlive reports whether the backend instance id still runs, i.e.
+// still holds its lock in dir. The lock file of an exited instance is
+// removed.
+func instanceAlive(dir, id string) bool {
+	if id == "" {
 		return false
 	}
-	// Signal 0 checks existence without actually sending a signal
-	err = proc.Signal(syscall.Signal(0))
-	return err == nil
+	if id == instanceID() {
+		return true
+	}
+	return lockFileHeld(instanceLockPath(dir, id))
 }
 
-// lockOwnerPID returns the PID from a lock file, or 0 if not locked.
-func lockOwnerPID(chatDir string) int {
+// ForceUnlock removes the lock file unconditionally. A process still
+// holding the old file keeps it locked, but the next AcquireLock creates a
+// new file and succeeds.
+func ForceUnlock(chatDir string) error {
+	return ReleaseLock(chatDir)
+}
+
+// lockOwner returns the PID and hostname recorded in a lock file, or 0 if
+// there is none.
+func lockOwner(chatDir string) (int, string) {
 	data, err := os.ReadFile(lockFilePath(chatDir))
 	if err != nil {
-		return 0
+		return 0, ""
 	}
-	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, ""
+	}
+	pid, err := strconv.Atoi(fields[0])
 	if err != nil {
-		return 0
+		return 0, ""
+	}
+	host := ""
+	if len(fields) > 1 {
+		host = fields[1]
 	}
-	return pid
+	return pid, host
 }
 
 // lockInfo returns a human-readable description of the lock state.
 func lockInfo(chatDir string) string {
-	pid := lockOwnerPID(chatDir)
+	pid, host := lockOwner(chatDir)
 	if pid == 0 {
 		return ""
 	}
-	return fmt.Sprintf("locked by PID %d", pid)
+	if host == "" {
+		return fmt.Sprintf("locked by PID %d", pid)
+	}
+	return fmt.Sprintf("locked by PID %d on %s", pid, host)
 }
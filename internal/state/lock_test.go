@@ -1,9 +1,17 @@
 package state
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -17,12 +25,14 @@ func TestAcquireReleaseLock(t *testing.T) {
 		t.Fatalf("AcquireLock failed: %v", err)
 	}
 
-	// Lock file should exist with our PID
-	data, err := os.ReadFile(lockFilePath(chatDir))
-	if err != nil {
+	// Lock file should exist with our PID and hostname
+	if _, err := os.Stat(lockFilePath(chatDir)); err != nil {
 		t.Fatalf("Lock file not created: %v", err)
 	}
-	pid, _ := strconv.Atoi(string(data))
+	pid, host := lockOwner(chatDir)
+	if wantHost, _ := os.Hostname(); host != wantHost {
+		t.Errorf("Lock file host = %q, want %q", host, wantHost)
+	}
 	if pid != os.Getpid() {
 		t.Errorf("Lock file PID = %d, want %d", pid, os.Getpid())
 	}
@@ -126,11 +136,10 @@ func TestChatSelectAcquiresLock(t *testing.T) {
 
 	// Chat should be locked by us
 	chatDir := s.chatDir(chat.ID)
-	data, err := os.ReadFile(lockFilePath(chatDir))
-	if err != nil {
+	if _, err := os.Stat(lockFilePath(chatDir)); err != nil {
 		t.Fatalf("Lock file not created after ChatNew: %v", err)
 	}
-	pid, _ := strconv.Atoi(string(data))
+	pid, _ := lockOwner(chatDir)
 	if pid != os.Getpid() {
 		t.Errorf("Lock PID = %d, want %d", pid, os.Getpid())
 	}
@@ -190,3 +199,292 @@ func TestCleanupReleasesLock(t *testing.T) {
 		t.Error("Lock should be released after Cleanup")
 	}
 }
+
+func TestViewKeepsLockAfterChatSwitch(t *testing.T) {
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("first", "")
+	chatDir := s.chatDir(chat.ID)
+
+	view, err := s.View()
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	if _, err := s.ChatNew("second", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+
+	// The view still holds the first chat after the switch.
+	if view.ActiveChat.ID != chat.ID {
+		t.Errorf("view chat = %s, want %s", view.ActiveChat.ID, chat.ID)
+	}
+	if _, err := os.Stat(lockFilePath(chatDir)); err != nil {
+		t.Fatal("Lock should be kept while the view holds the chat")
+	}
+	if err := view.AddUserMessage("hi", ""); err != nil {
+		t.Fatalf("AddUserMessage on view failed: %v", err)
+	}
+
+	view.Cleanup()
+	if _, err := os.Stat(lockFilePath(chatDir)); !os.IsNotExist(err) {
+		t.Error("Lock should be released when the last holder drops it")
+	}
+	reopened, err := s.OpenChat(chat.ID)
+	if err != nil {
+		t.Fatalf("OpenChat failed: %v", err)
+	}
+	defer reopened.Cleanup()
+	if len(reopened.ActiveChat.Messages) != 1 {
+		t.Errorf("expected view's message to be saved, got %+v", reopened.ActiveChat.Messages)
+	}
+}
+
+func TestLockStressGoroutines(t *testing.T) {
+	lockPath := lockFilePath(t.TempDir())
+
+	// Each goroutine locks through its own file, like separate processes
+	// do, and releases the way ReleaseLock does: remove, then close.
+	var holders, acquired int32
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				f, err := lockPathFile(lockPath)
+				if errors.Is(err, ErrChatLocked) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n := atomic.AddInt32(&holders, 1); n != 1 {
+					t.Errorf("%d holders at once", n)
+				}
+				atomic.AddInt32(&acquired, 1)
+				atomic.AddInt32(&holders, -1)
+				os.Remove(lockPath)
+				f.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired == 0 {
+		t.Fatal("lock was never acquired")
+	}
+}
+
+func TestHoldLockConcurrentHolders(t *testing.T) {
+	chatDir := t.TempDir()
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := holdLock(chatDir); err != nil {
+					t.Errorf("holdLock failed: %v", err)
+					return
+				}
+				dropLock(chatDir)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := os.Stat(lockFilePath(chatDir)); !os.IsNotExist(err) {
+		t.Error("lock file left behind after the last holder dropped it")
+	}
+	ownLocks.Lock()
+	defer ownLocks.Unlock()
+	if _, ok := ownLocks.files[chatDir]; ok {
+		t.Error("lock file still open after the last holder dropped it")
+	}
+}
+
+// TestLockHelperProcess is run as a separate process by the tests below. It
+// tries to lock the chat directory and reports the result; a holder keeps
+// the lock until its stdin is closed.
+func TestLockHelperProcess(t *testing.T) {
+	chatDir := os.Getenv("BB7_LOCK_HELPER_DIR")
+	if chatDir == "" {
+		return
+	}
+	if err := AcquireLock(chatDir); err != nil {
+		fmt.Println("result:", err)
+		os.Exit(0)
+	}
+	fmt.Println("result: locked")
+	io.ReadAll(os.Stdin)
+	ReleaseLock(chatDir)
+	os.Exit(0)
+}
+
+type lockHelper struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Scanner
+}
+
+func startLockHelper(t *testing.T, chatDir string) *lockHelper {
+	t.Helper()
+	return startHelperProcess(t, "TestLockHelperProcess", "BB7_LOCK_HELPER_DIR="+chatDir)
+}
+
+// startHelperProcess runs the helper test name in a new process with env
+// added to its environment.
+func startHelperProcess(t *testing.T, name string, env ...string) *lockHelper {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(), env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return &lockHelper{cmd: cmd, stdin: stdin, out: bufio.NewScanner(stdout)}
+}
+
+// result waits for the helper's lock attempt.
+func (h *lockHelper) result() string {
+	for h.out.Scan() {
+		if line, ok := strings.CutPrefix(h.out.Text(), "result: "); ok {
+			return line
+		}
+	}
+	return "no result"
+}
+
+func (h *lockHelper) finish() {
+	h.stdin.Close()
+	h.cmd.Wait()
+}
+
+func TestLockStressProcesses(t *testing.T) {
+	chatDir := t.TempDir()
+	helpers := make([]*lockHelper, 8)
+	for i := range helpers {
+		helpers[i] = startLockHelper(t, chatDir)
+	}
+	locked := 0
+	for _, h := range helpers {
+		switch r := h.result(); r {
+		case "locked":
+			locked++
+		case ErrChatLocked.Error():
+		default:
+			t.Errorf("unexpected helper result %q", r)
+		}
+	}
+	if locked != 1 {
+		t.Errorf("%d processes hold the lock, want 1", locked)
+	}
+	if !IsLocked(chatDir) {
+		t.Error("IsLocked = false while a helper holds the lock")
+	}
+	if !strings.HasPrefix(lockInfo(chatDir), "locked by PID ") {
+		t.Errorf("lockInfo = %q", lockInfo(chatDir))
+	}
+	for _, h := range helpers {
+		h.finish()
+	}
+	if IsLocked(chatDir) {
+		t.Error("IsLocked = true after all helpers exited")
+	}
+}
+
+func TestLockReleasedWhenHolderDies(t *testing.T) {
+	chatDir := t.TempDir()
+	h := startLockHelper(t, chatDir)
+	if r := h.result(); r != "locked" {
+		t.Fatalf("helper result = %q", r)
+	}
+	if err := AcquireLock(chatDir); !errors.Is(err, ErrChatLocked) {
+		t.Fatalf("AcquireLock while held = %v, want ErrChatLocked", err)
+	}
+	h.cmd.Process.Kill()
+	h.finish()
+
+	// The lock file is still there, but nothing holds it.
+	if err := AcquireLock(chatDir); err != nil {
+		t.Fatalf("AcquireLock after the holder died: %v", err)
+	}
+	ReleaseLock(chatDir)
+}
+
+// TestChatOpenHelperProcess is run as a separate process by
+// TestChatSelectStressProcesses. It selects or opens a chat of the project
+// and reports the result; a holder keeps the chat until stdin is closed.
+func TestChatOpenHelperProcess(t *testing.T) {
+	root := os.Getenv("BB7_OPEN_HELPER_ROOT")
+	if root == "" {
+		return
+	}
+	// Set up the State by hand; Init would restore the last active chat.
+	s := New()
+	s.ProjectRoot = root
+	id := os.Getenv("BB7_OPEN_HELPER_CHAT")
+	var err error
+	if os.Getenv("BB7_OPEN_HELPER_MODE") == "open" {
+		var view *State
+		view, err = s.OpenChat(id)
+		if err == nil {
+			defer view.Cleanup()
+		}
+	} else {
+		_, err = s.ChatSelect(id)
+		defer s.Cleanup()
+	}
+	if err != nil {
+		fmt.Println("result:", err)
+		return
+	}
+	fmt.Println("result: locked")
+	io.ReadAll(os.Stdin)
+}
+
+func TestChatSelectStressProcesses(t *testing.T) {
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("contested", "")
+	s.Cleanup()
+
+	helpers := make([]*lockHelper, 8)
+	for i := range helpers {
+		mode := "select"
+		if i%2 == 1 {
+			mode = "open"
+		}
+		helpers[i] = startHelperProcess(t, "TestChatOpenHelperProcess",
+			"BB7_OPEN_HELPER_ROOT="+s.ProjectRoot, "BB7_OPEN_HELPER_CHAT="+chat.ID, "BB7_OPEN_HELPER_MODE="+mode)
+	}
+	locked := 0
+	for _, h := range helpers {
+		switch r := h.result(); r {
+		case "locked":
+			locked++
+		case ErrChatLocked.Error():
+		default:
+			t.Errorf("unexpected helper result %q", r)
+		}
+	}
+	if locked != 1 {
+		t.Errorf("%d processes hold the chat, want 1", locked)
+	}
+	if _, err := s.ChatSelect(chat.ID); !errors.Is(err, ErrChatLocked) {
+		t.Errorf("ChatSelect while held = %v, want ErrChatLocked", err)
+	}
+	if _, err := s.OpenChat(chat.ID); !errors.Is(err, ErrChatLocked) {
+		t.Errorf("OpenChat while held = %v, want ErrChatLocked", err)
+	}
+	for _, h := range helpers {
+		h.finish()
+	}
+	if _, err := s.ChatSelect(chat.ID); err != nil {
+		t.Errorf("ChatSelect after the holders exited: %v", err)
+	}
+}
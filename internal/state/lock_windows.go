@@ -0,0 +1,34 @@
+//go:build windows
+
+package state
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// tryLockFile takes an exclusive LockFileEx lock on f without blocking.
+// Windows locks are mandatory for the locked range, so the lock covers one
+// byte far past the end of the file and the PID it holds stays readable.
+func tryLockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: 0x40000000}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if errors.Is(err, errorLockViolation) {
+		return errLockBusy
+	}
+	return err
+}
@@ -0,0 +1,292 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Content-addressed object store. Context snapshots are stored once under
+// .bb7/objects/ (~/.bb7/objects/ for global chats), named by HashContent of
+// their content, so identical files in many chats and forks take the space
+// of one. A chat maps each snapshot path to an object in Chat.Snapshots;
+// the paths are the ones contextStoragePathIn and contextRefPathIn compute
+// under the chat's context directory, which no longer exists on disk.
+// Forking a chat copies the map, not the content.
+//
+// Output files are not stored here: they are working copies that the
+// editor opens for diffs.
+
+// ErrInvalidObject is returned for a snapshot that names a malformed hash.
+var ErrInvalidObject = errors.New("invalid object hash")
+
+// gcGracePeriod protects objects written so recently that the chat
+// referencing them may not be saved yet.
+const gcGracePeriod = time.Hour
+
+// objectsDirForChat returns the object store of a chat directory: objects/
+// next to the chats directory holding it.
+func objectsDirForChat(chatDir string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(chatDir)), "objects")
+}
+
+// objectPath returns where an object is stored, fanned out by the first two
+// hash characters.
+func objectPath(objectsDir, hash string) (string, error) {
+	if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObject, hash)
+	}
+	return filepath.Join(objectsDir, hash[:2], hash[2:]), nil
+}
+
+// putObject stores data and returns its hash. Existing objects are not
+// rewritten.
+func putObject(objectsDir string, data []byte) (string, error) {
+	hash := HashContent(string(data))
+	path, err := objectPath(objectsDir, hash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		// Reset its age so GC keeps it until the chat using it is saved.
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err == nil {
+			return hash, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return hash, writeFileAtomic(path, data, 0644)
+}
+
+// readObject returns the content of an object.
+func readObject(objectsDir, hash string) ([]byte, error) {
+	path, err := objectPath(objectsDir, hash)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// snapshotStore reads and writes the context snapshots of one chat.
+type snapshotStore struct {
+	chat        *Chat
+	contextBase string
+	objectsDir  string
+}
+
+// snapshotsOf returns the snapshot store of a chat in chatDir.
+func snapshotsOf(chat *Chat, chatDir string) snapshotStore {
+	return snapshotStore{
+		chat:        chat,
+		contextBase: filepath.Join(chatDir, "context"),
+		objectsDir:  objectsDirForChat(chatDir),
+	}
+}
+
+// activeSnapshots returns the snapshot store of the active chat.
+func (s *State) activeSnapshots() snapshotStore {
+	return snapshotsOf(s.ActiveChat, s.chatDirFor(s.ActiveChat.ID, s.ActiveChat.Global))
+}
+
+// key returns the Snapshots key of a path under the context directory.
+func (st snapshotStore) key(path string) (string, error) {
+	rel, err := filepath.Rel(st.contextBase, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathEscape
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// read returns the content of a snapshot. A missing snapshot yields an
+// error satisfying os.IsNotExist, as reading a missing file does.
+func (st snapshotStore) read(path string) ([]byte, error) {
+	key, err := st.key(path)
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := st.chat.Snapshots[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return readObject(st.objectsDir, hash)
+}
+
+// write stores data as the snapshot at path. The caller saves the chat.
+func (st snapshotStore) write(path string, data []byte) error {
+	key, err := st.key(path)
+	if err != nil {
+		return err
+	}
+	hash, err := putObject(st.objectsDir, data)
+	if err != nil {
+		return err
+	}
+	if st.chat.Snapshots == nil {
+		st.chat.Snapshots = make(map[string]string)
+	}
+	st.chat.Snapshots[key] = hash
+	return nil
+}
+
+// copyObjects makes sure every object a chat references exists in dstDir,
+// for chats moving between the project and global stores.
+func copyObjects(srcDir, dstDir string, snapshots map[string]string) error {
+	for _, hash := range snapshots {
+		dst, err := objectPath(dstDir, hash)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		data, err := readObject(srcDir, hash)
+		if err != nil {
+			return err
+		}
+		if _, err := putObject(dstDir, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateContextDir moves the files of a chat's old per-chat context
+// directory into the object store. It returns true if the chat changed.
+func migrateContextDir(chatDir string, chat *Chat) (bool, error) {
+	st := snapshotsOf(chat, chatDir)
+	if _, err := os.Stat(st.contextBase); err != nil {
+		return false, nil
+	}
+	changed := false
+	err := filepath.WalkDir(st.contextBase, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isTempFile(d.Name()) {
+			return err
+		}
+		key, err := st.key(path)
+		if err != nil {
+			return err
+		}
+		if _, ok := chat.Snapshots[key]; ok {
+			return nil // migrated before the directory could be removed
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		changed = true
+		return st.write(path, data)
+	})
+	return changed, err
+}
+
+// migrateLoadedChat brings a chat read from chatDir up to date: migrateChat
+// plus moving its context directory into the object store. If anything
+// changed the chat is saved with save, and the context directory is removed
+// only once the chat referencing its content is on disk.
+func migrateLoadedChat(chatDir string, chat *Chat, save func(*Chat) error) {
+	changed := migrateChat(chat)
+	moved, err := migrateContextDir(chatDir, chat)
+	if err != nil {
+		log.Warn("%s: moving context snapshots to the object store: %v", chatDir, err)
+	}
+	if changed || moved {
+		if saveErr := save(chat); saveErr != nil {
+			return
+		}
+	}
+	if err == nil {
+		os.RemoveAll(filepath.Join(chatDir, "context"))
+	}
+}
+
+// cloneSnapshots copies a Snapshots map for a new chat.
+func cloneSnapshots(snapshots map[string]string) map[string]string {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return maps.Clone(snapshots)
+}
+
+// GCResult reports what GC removed.
+type GCResult struct {
+	Objects int   `json:"objects"` // objects removed
+	Bytes   int64 `json:"bytes"`   // their total size
+	Kept    int   `json:"kept"`    // objects still referenced or too new
+}
+
+// GC removes objects no chat references from the project's object store, or
+// the global one in global-only mode. Chats in the trash and backups of chat
+// files count as references, and objects written or reused in the last hour
+// are kept because a running session may not have saved the chat using them
+// yet. GC refuses to run if a chat cannot be read, since its references are
+// unknown.
+func (s *State) GC() (GCResult, error) {
+	var result GCResult
+	if err := s.requireInit(); err != nil {
+		return result, err
+	}
+	chatsDir := s.chatsDirFor(s.GlobalOnly)
+	objectsDir := filepath.Join(filepath.Dir(chatsDir), "objects")
+
+	referenced := make(map[string]bool)
+	for _, dir := range []string{chatsDir, s.trashDirFor(s.GlobalOnly)} {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			chatPath := filepath.Join(dir, entry.Name(), "chat.json")
+			for _, path := range []string{chatPath, chatPath + chatBackupSuffix} {
+				chat, err := parseChatFile(path)
+				if err != nil {
+					if path != chatPath {
+						continue // a missing or bad backup references nothing
+					}
+					return result, fmt.Errorf("%s: %v (run bb7 fsck)", entry.Name(), err)
+				}
+				for _, hash := range chat.Snapshots {
+					referenced[hash] = true
+				}
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-gcGracePeriod)
+	err := filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		hash := filepath.Base(filepath.Dir(path)) + d.Name()
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if referenced[hash] || info.ModTime().After(cutoff) {
+			result.Kept++
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.Objects++
+		result.Bytes += info.Size()
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,187 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countObjects returns the number of objects in a project's object store.
+func countObjects(t *testing.T, s *State) int {
+	t.Helper()
+	n := 0
+	filepath.WalkDir(filepath.Join(s.ProjectRoot, ".bb7", "objects"), func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !isTempFile(d.Name()) {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func TestSnapshotsShareObjects(t *testing.T) {
+	s := setupTestState(t)
+	source, err := s.ChatNew("source", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	for _, name := range []string{"a.go", "b.go"} {
+		if err := os.WriteFile(filepath.Join(s.ProjectRoot, name), []byte("package shared\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.ContextAdd("a.go", "package shared\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	if err := s.ContextAdd("b.go", "package shared\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	if err := s.AddUserMessage("hello", "m"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	if n := countObjects(t, s); n != 1 {
+		t.Fatalf("identical files stored as %d objects, want 1", n)
+	}
+
+	forkIndex := len(s.ActiveChat.Messages) - 1
+	result, err := s.ForkChat(source.ID, forkIndex)
+	if err != nil {
+		t.Fatalf("ForkChat failed: %v", err)
+	}
+	if n := countObjects(t, s); n != 1 {
+		t.Errorf("fork copied content: %d objects, want 1", n)
+	}
+	fork, err := s.loadChat(result.NewChatID)
+	if err != nil {
+		t.Fatalf("loadChat failed: %v", err)
+	}
+	if len(fork.ContextFiles) != 2 || fork.Snapshots["a.go"] != source.Snapshots["a.go"] {
+		t.Errorf("fork snapshots = %v, want those of the source %v", fork.Snapshots, source.Snapshots)
+	}
+	if _, err := os.Stat(filepath.Join(s.chatDir(fork.ID), "context")); !os.IsNotExist(err) {
+		t.Errorf("fork has a context directory: %v", err)
+	}
+}
+
+func TestLoadChatMigratesContextDir(t *testing.T) {
+	s := setupTestState(t)
+	chat, err := s.ChatNew("old", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	// Lay the chat out as older versions did: snapshots as plain files.
+	chat.ContextFiles = []ContextFile{
+		{Path: "main.go", Version: HashFileVersion("main.go", "package main\n")},
+		{Path: "https://example.com/doc", ReadOnly: true, External: true},
+	}
+	if err := s.saveChat(chat); err != nil {
+		t.Fatalf("saveChat failed: %v", err)
+	}
+	contextBase := s.contextDir(chat.ID)
+	urlPath := filepath.Join(contextBase, externalDir, hashPath("https://example.com/doc"))
+	for path, content := range map[string]string{
+		filepath.Join(contextBase, "main.go"): "package main\n",
+		urlPath:                               "# Doc\n",
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.releasePreviousLock()
+	s.ActiveChat = nil
+
+	if _, err := s.ChatSelect(chat.ID); err != nil {
+		t.Fatalf("ChatSelect failed: %v", err)
+	}
+	if content, err := s.GetContextFile("main.go"); err != nil || content != "package main\n" {
+		t.Errorf("GetContextFile = %q, %v", content, err)
+	}
+	if content, err := s.GetContextFile("https://example.com/doc"); err != nil || content != "# Doc\n" {
+		t.Errorf("GetContextFile(url) = %q, %v", content, err)
+	}
+	if _, err := os.Stat(contextBase); !os.IsNotExist(err) {
+		t.Errorf("context directory not removed after migration: %v", err)
+	}
+	saved, err := parseChatFile(s.chatJSONPath(chat.ID))
+	if err != nil || len(saved.Snapshots) != 2 {
+		t.Errorf("migrated snapshots not saved: %+v, %v", saved, err)
+	}
+}
+
+func TestGCRemovesUnreferencedObjects(t *testing.T) {
+	s := setupTestState(t)
+	if _, err := s.ChatNew("gc", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.ContextAdd("kept.go", "package kept\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	if err := s.ContextAdd("dropped.go", "package dropped\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	objectsDir := filepath.Join(s.ProjectRoot, ".bb7", "objects")
+	dropped, _ := objectPath(objectsDir, s.ActiveChat.Snapshots["dropped.go"])
+	kept, _ := objectPath(objectsDir, s.ActiveChat.Snapshots["kept.go"])
+
+	// Drop the reference from the chat and its backup.
+	for i := 0; i < 2; i++ {
+		delete(s.ActiveChat.Snapshots, "dropped.go")
+		if err := s.SaveActiveChat(); err != nil {
+			t.Fatalf("SaveActiveChat failed: %v", err)
+		}
+	}
+	recent, err := putObject(objectsDir, []byte("written by a session that has not saved yet"))
+	if err != nil {
+		t.Fatalf("putObject failed: %v", err)
+	}
+	old := time.Now().Add(-2 * gcGracePeriod)
+	os.Chtimes(dropped, old, old)
+	os.Chtimes(kept, old, old)
+
+	result, err := s.GC()
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if result.Objects != 1 || result.Kept != 2 {
+		t.Errorf("GC = %+v, want 1 removed and 2 kept", result)
+	}
+	if _, err := os.Stat(dropped); !os.IsNotExist(err) {
+		t.Errorf("unreferenced object not removed: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("referenced object removed: %v", err)
+	}
+	if _, err := readObject(objectsDir, recent); err != nil {
+		t.Errorf("recent object removed: %v", err)
+	}
+
+	os.WriteFile(s.chatJSONPath(s.ActiveChat.ID), []byte("{"), 0644)
+	if _, err := s.GC(); err == nil {
+		t.Error("GC ran with an unreadable chat")
+	}
+}
+
+func TestGCKeepsReusedObject(t *testing.T) {
+	s := setupTestState(t)
+	objectsDir := filepath.Join(s.ProjectRoot, ".bb7", "objects")
+	hash, err := putObject(objectsDir, []byte("orphaned, then added to a chat again"))
+	if err != nil {
+		t.Fatalf("putObject failed: %v", err)
+	}
+	path, _ := objectPath(objectsDir, hash)
+	old := time.Now().Add(-2 * gcGracePeriod)
+	os.Chtimes(path, old, old)
+
+	// A session references it again but has not saved the chat yet.
+	if _, err := putObject(objectsDir, []byte("orphaned, then added to a chat again")); err != nil {
+		t.Fatalf("putObject failed: %v", err)
+	}
+	if _, err := s.GC(); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("reused object removed: %v", err)
+	}
+}
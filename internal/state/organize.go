@@ -0,0 +1,327 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Organizing chats: tags, folders, and pinning. All three are stored in
+// chat.json and mirrored in index.json, so ChatListFiltered can filter and
+// sort without loading the chats. Tags are lowercase words; a folder is a
+// slash-separated path such as "work/parser".
+
+const maxTagLength = 32
+
+var (
+	ErrInvalidTag    = errors.New("tags must be 1-32 characters without spaces, commas, or slashes")
+	ErrInvalidFolder = errors.New("folder must be a relative path without empty, '.', or '..' parts")
+	ErrInvalidSort   = errors.New("sort must be \"created\", \"activity\", \"cost\", or \"tag\"")
+)
+
+// NormalizeTag trims and lowercases a tag and checks it.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+	if tag == "" || len(tag) > maxTagLength || strings.ContainsAny(tag, " \t\n,/") {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// normalizeFolder cleans a folder path; the empty string means no folder.
+func normalizeFolder(folder string) (string, error) {
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	if folder == "" {
+		return "", nil
+	}
+	for _, part := range strings.Split(folder, "/") {
+		if strings.TrimSpace(part) == "" || part == "." || part == ".." {
+			return "", ErrInvalidFolder
+		}
+	}
+	return folder, nil
+}
+
+// updateChat applies change to a project or global chat and saves it when
+// change reports a modification. The active chat is changed in memory;
+// other chats must not be locked by another session.
+func (s *State) updateChat(id string, global bool, change func(*Chat) bool) (*Chat, error) {
+	if !global {
+		if err := s.requireInit(); err != nil {
+			return nil, err
+		}
+	}
+	if s.ActiveChat != nil && s.ActiveChat.ID == id && s.ActiveChat.Global == global {
+		if !change(s.ActiveChat) {
+			return s.ActiveChat, nil
+		}
+		return s.ActiveChat, s.SaveActiveChat()
+	}
+
+	chatsDir := s.chatsDirFor(global)
+	chatDir, err := SafeJoin(chatsDir, id)
+	if err != nil {
+		return nil, ErrChatNotFound
+	}
+	if IsLocked(chatDir) {
+		return nil, ErrChatLocked
+	}
+	chat, err := loadChatFrom(filepath.Join(chatDir, "chat.json"))
+	if err != nil {
+		return nil, err
+	}
+	if !change(chat) {
+		return chat, nil
+	}
+	if err := saveChatAt(chatDir, chat); err != nil {
+		return nil, err
+	}
+	// Index is a cache; do not fail the change if it can't be updated.
+	updateChatIndexEntryAt(chatsDir, chat)
+	return chat, nil
+}
+
+// ChatTag adds tags to a chat and returns its tags.
+func (s *State) ChatTag(id string, global bool, tags []string) ([]string, error) {
+	add, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	chat, err := s.updateChat(id, global, func(chat *Chat) bool {
+		merged := mergeTags(chat.Tags, add)
+		if slices.Equal(merged, chat.Tags) {
+			return false
+		}
+		chat.Tags = merged
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chat.Tags, nil
+}
+
+// ChatUntag removes tags from a chat and returns its remaining tags.
+func (s *State) ChatUntag(id string, global bool, tags []string) ([]string, error) {
+	remove, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	chat, err := s.updateChat(id, global, func(chat *Chat) bool {
+		kept := slices.DeleteFunc(slices.Clone(chat.Tags), func(tag string) bool {
+			return slices.Contains(remove, tag)
+		})
+		if len(kept) == len(chat.Tags) {
+			return false
+		}
+		if len(kept) == 0 {
+			kept = nil
+		}
+		chat.Tags = kept
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chat.Tags, nil
+}
+
+// ChatMoveFolder puts a chat in a folder, or takes it out of any folder
+// when folder is empty. It returns the cleaned folder path.
+func (s *State) ChatMoveFolder(id string, global bool, folder string) (string, error) {
+	folder, err := normalizeFolder(folder)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.updateChat(id, global, func(chat *Chat) bool {
+		if chat.Folder == folder {
+			return false
+		}
+		chat.Folder = folder
+		return true
+	})
+	return folder, err
+}
+
+// ChatPin sets whether a chat is pinned.
+func (s *State) ChatPin(id string, global, pinned bool) error {
+	_, err := s.updateChat(id, global, func(chat *Chat) bool {
+		if chat.Pinned == pinned {
+			return false
+		}
+		chat.Pinned = pinned
+		return true
+	})
+	return err
+}
+
+// normalizeTags normalizes tags, dropping duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, ErrInvalidTag
+	}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tag)
+	}
+	return mergeTags(nil, out), nil
+}
+
+// mergeTags returns the sorted union of two tag lists.
+func mergeTags(a, b []string) []string {
+	merged := append(slices.Clone(a), b...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// ChatListOptions filters and orders ChatListFiltered.
+type ChatListOptions struct {
+	Tag      string // Only chats with this tag
+	Folder   string // Only chats in this folder or below it
+	Sort     string // "created" (default), "activity", "cost", or "tag"
+	Archived bool   // List archived chats instead of the others
+}
+
+// ChatListFiltered returns the project or global chats that match opts.
+// "activity" and "cost" sort the most recent and most expensive first;
+// "tag" groups chats by their first tag, untagged last, most recent first
+// within a group. Ties go to the newest chat.
+func (s *State) ChatListFiltered(global bool, opts ChatListOptions) ([]ChatSummary, error) {
+	var tag string
+	if opts.Tag != "" {
+		var err error
+		if tag, err = NormalizeTag(opts.Tag); err != nil {
+			return nil, err
+		}
+	}
+	folder, err := normalizeFolder(opts.Folder)
+	if err != nil {
+		return nil, err
+	}
+	less := func(a, b ChatSummary) bool { return a.Created.After(b.Created) }
+	switch opts.Sort {
+	case "", "created":
+	case "activity":
+		less = func(a, b ChatSummary) bool {
+			if !a.LastActivity.Equal(b.LastActivity) {
+				return a.LastActivity.After(b.LastActivity)
+			}
+			return a.Created.After(b.Created)
+		}
+	case "cost":
+		less = func(a, b ChatSummary) bool {
+			if a.Cost != b.Cost {
+				return a.Cost > b.Cost
+			}
+			return a.Created.After(b.Created)
+		}
+	case "tag":
+		less = func(a, b ChatSummary) bool {
+			if (len(a.Tags) == 0) != (len(b.Tags) == 0) {
+				return len(a.Tags) > 0
+			}
+			if len(a.Tags) > 0 && a.Tags[0] != b.Tags[0] {
+				return a.Tags[0] < b.Tags[0]
+			}
+			if !a.LastActivity.Equal(b.LastActivity) {
+				return a.LastActivity.After(b.LastActivity)
+			}
+			return a.Created.After(b.Created)
+		}
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	var chats []ChatSummary
+	if opts.Archived {
+		chats, err = s.ChatListArchived(global)
+	} else if global {
+		chats, err = s.ChatListGlobal()
+	} else {
+		chats, err = s.ChatList()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := chats[:0]
+	for _, chat := range chats {
+		if tag != "" && !slices.Contains(chat.Tags, tag) {
+			continue
+		}
+		if folder != "" && chat.Folder != folder && !strings.HasPrefix(chat.Folder, folder+"/") {
+			continue
+		}
+		filtered = append(filtered, chat)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return less(filtered[i], filtered[j]) })
+	return filtered, nil
+}
+
+// ChatTags returns every tag used by the project or global chats, with the
+// number of chats carrying it.
+func (s *State) ChatTags(global bool) (map[string]int, error) {
+	chats, err := s.ChatListFiltered(global, ChatListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	archived, err := s.ChatListArchived(global)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, chat := range append(chats, archived...) {
+		for _, tag := range chat.Tags {
+			counts[tag]++
+		}
+	}
+	return counts, nil
+}
+
+// MigratePinnedChats moves pins from pinned_chats.json, where the plugin
+// used to keep them, into the chats and removes the file. It handles the
+// project's file (unless in global-only mode) and the global one.
+func (s *State) MigratePinnedChats() error {
+	var errs []error
+	for _, global := range []bool{false, true} {
+		if !global && s.GlobalOnly {
+			continue
+		}
+		path := filepath.Join(filepath.Dir(s.chatsDirFor(global)), "pinned_chats.json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		var pinned struct {
+			Chats []string `json:"chats"`
+		}
+		if err := json.Unmarshal(data, &pinned); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		failed := false
+		for _, id := range pinned.Chats {
+			err := s.ChatPin(id, global, true)
+			if err != nil && !errors.Is(err, ErrChatNotFound) {
+				errs = append(errs, err)
+				failed = true
+			}
+		}
+		// A locked chat is pinned on a later start.
+		if !failed {
+			os.Remove(path)
+		}
+	}
+	return errors.Join(errs...)
+}
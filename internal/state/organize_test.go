@@ -0,0 +1,186 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChatTagFolderPin(t *testing.T) {
+	s := setupTestState(t)
+	chat, err := s.ChatNew("tagged", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	other, err := s.ChatNew("other", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+
+	tags, err := s.ChatTag(chat.ID, false, []string{"#Parser", "bugs", "parser"})
+	if err != nil || !slices.Equal(tags, []string{"bugs", "parser"}) {
+		t.Fatalf("ChatTag = %v, %v", tags, err)
+	}
+	if tags, err = s.ChatUntag(chat.ID, false, []string{"BUGS"}); err != nil || !slices.Equal(tags, []string{"parser"}) {
+		t.Fatalf("ChatUntag = %v, %v", tags, err)
+	}
+	if _, err := s.ChatTag(chat.ID, false, []string{"two words"}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("invalid tag err = %v, want ErrInvalidTag", err)
+	}
+
+	if folder, err := s.ChatMoveFolder(chat.ID, false, "/work/parser/"); err != nil || folder != "work/parser" {
+		t.Fatalf("ChatMoveFolder = %q, %v", folder, err)
+	}
+	if _, err := s.ChatMoveFolder(chat.ID, false, "work/../x"); !errors.Is(err, ErrInvalidFolder) {
+		t.Errorf("invalid folder err = %v, want ErrInvalidFolder", err)
+	}
+	// The active chat is changed in memory as well.
+	if err := s.ChatPin(other.ID, false, true); err != nil {
+		t.Fatalf("ChatPin failed: %v", err)
+	}
+	if !s.ActiveChat.Pinned {
+		t.Error("active chat not pinned")
+	}
+
+	idx, err := s.loadChatIndex()
+	if err != nil {
+		t.Fatalf("loadChatIndex failed: %v", err)
+	}
+	for _, entry := range idx.Chats {
+		switch entry.ID {
+		case chat.ID:
+			if !slices.Equal(entry.Tags, []string{"parser"}) || entry.Folder != "work/parser" || entry.Pinned {
+				t.Errorf("index entry = %+v", entry)
+			}
+		case other.ID:
+			if !entry.Pinned {
+				t.Errorf("index entry = %+v, want pinned", entry)
+			}
+		}
+	}
+	if issues, _ := s.Fsck(false); len(issues) != 0 {
+		t.Errorf("Fsck = %+v", issues)
+	}
+}
+
+func TestChatListFiltered(t *testing.T) {
+	s := setupTestState(t)
+	now := time.Now()
+	newChat := func(name string, created, active time.Time, cost float64, folder string, tags ...string) string {
+		t.Helper()
+		chat, err := s.ChatNew(name, "")
+		if err != nil {
+			t.Fatalf("ChatNew failed: %v", err)
+		}
+		chat.Created = created
+		chat.Tags = tags
+		chat.Folder = folder
+		chat.Messages = append(chat.Messages, Message{Role: "assistant", Timestamp: active, Usage: &MessageUsage{Cost: cost}})
+		if err := s.SaveActiveChat(); err != nil {
+			t.Fatalf("SaveActiveChat failed: %v", err)
+		}
+		return chat.ID
+	}
+	a := newChat("a", now.Add(-3*time.Hour), now, 0.5, "work", "parser")
+	b := newChat("b", now.Add(-2*time.Hour), now.Add(-2*time.Hour), 2, "work/api", "api", "parser")
+	c := newChat("c", now.Add(-1*time.Hour), now.Add(-1*time.Hour), 1, "")
+
+	for _, tc := range []struct {
+		name string
+		opts ChatListOptions
+		want []string
+	}{
+		{"created", ChatListOptions{}, []string{c, b, a}},
+		{"activity", ChatListOptions{Sort: "activity"}, []string{a, c, b}},
+		{"cost", ChatListOptions{Sort: "cost"}, []string{b, c, a}},
+		{"tag", ChatListOptions{Sort: "tag"}, []string{b, a, c}},
+		{"by tag", ChatListOptions{Tag: "Parser"}, []string{b, a}},
+		{"by folder", ChatListOptions{Folder: "work"}, []string{b, a}},
+		{"by subfolder", ChatListOptions{Folder: "work/api"}, []string{b}},
+	} {
+		chats, err := s.ChatListFiltered(false, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: ChatListFiltered failed: %v", tc.name, err)
+		}
+		var got []string
+		for _, chat := range chats {
+			got = append(got, chat.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if _, err := s.ChatListFiltered(false, ChatListOptions{Sort: "name"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("bad sort err = %v, want ErrInvalidSort", err)
+	}
+
+	chats, _ := s.ChatListFiltered(false, ChatListOptions{Tag: "api"})
+	if len(chats) != 1 || chats[0].Cost != 2 || !chats[0].LastActivity.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("summary = %+v", chats)
+	}
+	if counts, err := s.ChatTags(false); err != nil || counts["parser"] != 2 || counts["api"] != 1 {
+		t.Errorf("ChatTags = %v, %v", counts, err)
+	}
+}
+
+func TestChatIndexUpgrade(t *testing.T) {
+	s := setupTestState(t)
+	chat, err := s.ChatNew("old", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	chat.Tags = []string{"legacy"}
+	if err := s.saveChat(chat); err != nil {
+		t.Fatalf("saveChat failed: %v", err)
+	}
+	old := map[string]any{
+		"version":        1,
+		"active_chat_id": chat.ID,
+		"chats":          []map[string]any{{"id": chat.ID, "name": "old", "created": chat.Created}},
+	}
+	data, _ := json.Marshal(old)
+	if err := os.WriteFile(s.chatIndexPath(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chats, err := s.ChatListFiltered(false, ChatListOptions{Tag: "legacy"})
+	if err != nil || len(chats) != 1 {
+		t.Fatalf("ChatListFiltered after upgrade = %+v, %v", chats, err)
+	}
+	if id, _ := s.LastActiveChat(); id != chat.ID {
+		t.Errorf("active chat lost in upgrade: %q", id)
+	}
+}
+
+func TestMigratePinnedChats(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	chat, err := s.ChatNew("pinned", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if _, err := s.ChatNew("active", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	path := filepath.Join(s.ProjectRoot, ".bb7", "pinned_chats.json")
+	if err := os.WriteFile(path, []byte(`{"chats":["`+chat.ID+`","deleted-chat"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigratePinnedChats(); err != nil {
+		t.Fatalf("MigratePinnedChats failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pinned_chats.json not removed: %v", err)
+	}
+	chats, _ := s.ChatList()
+	for _, summary := range chats {
+		if summary.Pinned != (summary.ID == chat.ID) {
+			t.Errorf("chat %s pinned = %v", summary.Name, summary.Pinned)
+		}
+	}
+}
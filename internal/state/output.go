@@ -23,6 +23,7 @@ func fatalProjectEscape(projectRoot, dest string) {
 // WriteOutputFile writes an LLM-generated file to the output directory.
 // Returns ErrReadOnly if the file is marked as read-only in context.
 // Returns ErrGlobalReadOnly if the active chat is global.
+// Returns a *PolicyError if .bb7/policy denies writing the path.
 func (s *State) WriteOutputFile(path, content string) error {
 	if err := s.requireActiveChat(); err != nil {
 		return err
@@ -61,6 +62,9 @@ func (s *State) WriteOutputFile(path, content string) error {
 		}
 		path = relPath
 	}
+	if err := s.CheckPathPolicy(PolicyWrite, path); err != nil {
+		return err
+	}
 
 	// Validate and resolve path
 	outputBase := s.outputDir(s.ActiveChat.ID)
@@ -85,7 +89,45 @@ func (s *State) WriteOutputFile(path, content string) error {
 		return err
 	}
 
-	return os.WriteFile(outputPath, []byte(content), 0644)
+	return writeFileAtomic(outputPath, []byte(content), 0644)
+}
+
+// CommitOutputFiles writes a reply's files to the output directory. The
+// output files they replace are kept until the next commit, so that
+// regenerating the reply can restore them. Files that fail to write are
+// skipped and reported in the returned error.
+func (s *State) CommitOutputFiles(files map[string]string) error {
+	if err := s.requireActiveChat(); err != nil {
+		return err
+	}
+	priorBase := s.priorOutputDir(s.ActiveChat.ID)
+	if err := os.RemoveAll(priorBase); err != nil {
+		return err
+	}
+	var errs []error
+	for path, content := range files {
+		if prev, err := s.GetOutputFile(path); err == nil {
+			if err := writeUnder(priorBase, path, prev); err != nil {
+				errs = append(errs, fmt.Errorf("%s: keeping previous output: %w", path, err))
+			}
+		}
+		if err := s.WriteOutputFile(path, content); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeUnder writes content to path inside base, creating parent directories.
+func writeUnder(base, path, content string) error {
+	fullPath, err := SafeJoin(base, path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(fullPath, []byte(content), 0644)
 }
 
 // GetOutputFile returns the content of an output file.
@@ -156,7 +198,12 @@ func (s *State) ListOutputFiles() ([]string, error) {
 		return nil, err
 	}
 
-	outputBase := s.outputDir(s.ActiveChat.ID)
+	return listOutputFilesIn(s.outputDir(s.ActiveChat.ID))
+}
+
+// listOutputFilesIn returns the files under an output directory as relative
+// paths. A missing directory has no files.
+func listOutputFilesIn(outputBase string) ([]string, error) {
 	var files []string
 
 	err := filepath.WalkDir(outputBase, func(path string, d fs.DirEntry, err error) error {
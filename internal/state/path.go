@@ -177,3 +177,15 @@ func RelativeToBase(baseDir, targetPath string) (string, error) {
 
 	return rel, nil
 }
+
+// IsURLPath reports whether a context path refers to a fetched web document
+// (http:// or https://) rather than a file on disk.
+func IsURLPath(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// isExternalRef reports whether a context path is stored as an external
+// snapshot: an absolute filesystem path or a URL.
+func isExternalRef(path string) bool {
+	return filepath.IsAbs(path) || IsURLPath(path)
+}
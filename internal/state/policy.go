@@ -0,0 +1,178 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Project path policy. .bb7/policy lists paths that must never be sent to
+// the model (read) or written by it (write), one rule per line:
+//
+//	# comments and blank lines are ignored
+//	deny secrets/**
+//	deny-read *.pem
+//	deny-write vendor/**
+//
+// "deny" covers both. Globs work like @when files (see matchPathGlob): **
+// spans directories and a glob without a slash matches the file name at any
+// depth. A path is checked as given and, after following symlinks, as the
+// file it points to, so a link can't reach a denied file under another name.
+
+// PolicyOp is what a path is used for.
+type PolicyOp string
+
+const (
+	PolicyRead  PolicyOp = "read"  // Sent to the model as context
+	PolicyWrite PolicyOp = "write" // Written as output or applied
+)
+
+// policyFile is the policy's path inside .bb7.
+const policyFile = "policy"
+
+var (
+	ErrPathDenied    = errors.New("path denied by project policy")
+	ErrInvalidPolicy = errors.New("invalid .bb7/policy rule")
+)
+
+// PolicyError is returned for a path a policy rule denies. It matches
+// ErrPathDenied with errors.Is.
+type PolicyError struct {
+	Op   PolicyOp
+	Path string
+	Rule string // The rule as written
+	Line int    // Line of the rule in .bb7/policy
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s of %s denied by .bb7/policy line %d: %s", e.Op, e.Path, e.Line, e.Rule)
+}
+
+func (e *PolicyError) Is(target error) bool { return target == ErrPathDenied }
+
+// policyRule is one parsed line of .bb7/policy.
+type policyRule struct {
+	read, write bool
+	glob        string
+	text        string
+	line        int
+}
+
+// parsePolicy parses the content of a policy file.
+func parsePolicy(content string) ([]policyRule, error) {
+	var rules []policyRule
+	for i, line := range strings.Split(content, "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w on line %d: want \"deny <glob>\", got %q", ErrInvalidPolicy, i+1, text)
+		}
+		rule := policyRule{glob: strings.TrimPrefix(fields[1], "./"), text: text, line: i + 1}
+		switch fields[0] {
+		case "deny":
+			rule.read, rule.write = true, true
+		case "deny-read":
+			rule.read = true
+		case "deny-write":
+			rule.write = true
+		default:
+			return nil, fmt.Errorf("%w on line %d: unknown action %q (want deny, deny-read, or deny-write)", ErrInvalidPolicy, i+1, fields[0])
+		}
+		if strings.HasSuffix(rule.glob, "/") {
+			rule.glob += "**" // A directory covers everything below it
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadPolicy reads the project's policy. No project or no file means no
+// rules.
+func (s *State) loadPolicy() ([]policyRule, error) {
+	if s.ProjectRoot == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.bb7Dir(), policyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parsePolicy(string(data))
+}
+
+// CheckPathPolicy returns a *PolicyError when the project policy denies op
+// on path. path is relative to the project root or absolute; absolute paths
+// outside the project only match globs that fit them, such as "*.pem".
+// URLs are not checked.
+func (s *State) CheckPathPolicy(op PolicyOp, path string) error {
+	if IsURLPath(path) {
+		return nil
+	}
+	rules, err := s.loadPolicy()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	candidates, err := s.policyCandidates(path)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if (op == PolicyRead && !rule.read) || (op == PolicyWrite && !rule.write) {
+			continue
+		}
+		for _, candidate := range candidates {
+			if matchPathGlob(rule.glob, candidate) {
+				return &PolicyError{Op: op, Path: path, Rule: rule.text, Line: rule.line}
+			}
+		}
+	}
+	return nil
+}
+
+// policyCandidates returns the names rules are matched against: the path
+// as given, relative to the project when inside it, and the path with
+// symlinks resolved.
+func (s *State) policyCandidates(path string) ([]string, error) {
+	absPath := path
+	if !filepath.IsAbs(path) {
+		absPath = filepath.Join(s.ProjectRoot, path)
+	}
+	logical, err := projectRelative(s.ProjectRoot, filepath.Clean(absPath))
+	if err != nil {
+		return nil, err
+	}
+
+	realRoot, err := resolvePathForContainment(s.ProjectRoot)
+	if err != nil {
+		return nil, err
+	}
+	realPath, err := resolvePathForContainment(absPath)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := projectRelative(realRoot, realPath)
+	if err != nil {
+		return nil, err
+	}
+	if resolved == logical {
+		return []string{logical}, nil
+	}
+	return []string{logical, resolved}, nil
+}
+
+// projectRelative returns path relative to root when it is inside root,
+// and path itself otherwise.
+func projectRelative(root, path string) (string, error) {
+	within, err := IsWithinDir(root, path)
+	if err != nil || !within {
+		return path, err
+	}
+	return RelativeToBase(root, path)
+}
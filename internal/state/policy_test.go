@@ -0,0 +1,189 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePolicy(t *testing.T, s *State, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(s.ProjectRoot, ".bb7", "policy"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	rules, err := parsePolicy("# secrets\ndeny secrets/\n\ndeny-read *.pem\ndeny-write ./vendor/**\n")
+	if err != nil {
+		t.Fatalf("parsePolicy failed: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if r := rules[0]; r.glob != "secrets/**" || !r.read || !r.write || r.line != 2 {
+		t.Errorf("deny rule = %+v", r)
+	}
+	if r := rules[1]; !r.read || r.write {
+		t.Errorf("deny-read rule = %+v", r)
+	}
+	if r := rules[2]; r.glob != "vendor/**" || r.read || !r.write {
+		t.Errorf("deny-write rule = %+v", r)
+	}
+
+	for _, bad := range []string{"allow src/**", "deny", "deny a b"} {
+		if _, err := parsePolicy(bad); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("parsePolicy(%q) err = %v, want ErrInvalidPolicy", bad, err)
+		}
+	}
+}
+
+func TestCheckPathPolicy(t *testing.T) {
+	s := setupTestState(t)
+	if err := s.CheckPathPolicy(PolicyRead, "secrets/key"); err != nil {
+		t.Fatalf("no policy: %v", err)
+	}
+	writePolicy(t, s, "deny secrets/**\ndeny-read *.pem\ndeny-write vendor/**\n")
+
+	for _, tc := range []struct {
+		op     PolicyOp
+		path   string
+		denied bool
+	}{
+		{PolicyRead, "secrets/prod/key.txt", true},
+		{PolicyWrite, "secrets", true},
+		{PolicyRead, "certs/server.pem", true},
+		{PolicyWrite, "certs/server.pem", false},
+		{PolicyWrite, "vendor/lib/a.go", true},
+		{PolicyRead, "vendor/lib/a.go", false},
+		{PolicyRead, "src/secrets.go", false},
+		{PolicyRead, "src/../secrets/key", true},
+		{PolicyRead, filepath.Join(s.ProjectRoot, "secrets", "key"), true},
+		{PolicyRead, "/etc/ssl/private/host.pem", true},
+		{PolicyRead, "https://example.com/key.pem", false},
+	} {
+		err := s.CheckPathPolicy(tc.op, tc.path)
+		if got := errors.Is(err, ErrPathDenied); got != tc.denied {
+			t.Errorf("CheckPathPolicy(%s, %q) = %v, want denied=%v", tc.op, tc.path, err, tc.denied)
+		}
+	}
+
+	var policyErr *PolicyError
+	if err := s.CheckPathPolicy(PolicyRead, "ca.pem"); !errors.As(err, &policyErr) || policyErr.Line != 2 {
+		t.Errorf("error = %v, want rule on line 2", err)
+	}
+
+	writePolicy(t, s, "block secrets/**\n")
+	if err := s.CheckPathPolicy(PolicyRead, "src/main.go"); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("invalid policy err = %v, want ErrInvalidPolicy", err)
+	}
+}
+
+func TestCheckPathPolicySymlinks(t *testing.T) {
+	s := setupTestState(t)
+	writePolicy(t, s, "deny secrets/**\ndeny-read *.pem\n")
+	writeProjectFile(t, s.ProjectRoot, "secrets/token.txt", "x\n")
+	writeProjectFile(t, s.ProjectRoot, "src/main.go", "x\n")
+	outside := t.TempDir()
+	writeProjectFile(t, outside, "notes.txt", "x\n")
+	writeProjectFile(t, outside, "server.pem", "x\n")
+	links := map[string]string{
+		"token-link":   filepath.Join(s.ProjectRoot, "secrets", "token.txt"), // file link into a denied dir
+		"config":       filepath.Join(s.ProjectRoot, "secrets"),              // directory link to a denied dir
+		"main-link.go": filepath.Join(s.ProjectRoot, "src", "main.go"),
+		"notes.txt":    filepath.Join(outside, "notes.txt"),  // link out of the project
+		"cert.txt":     filepath.Join(outside, "server.pem"), // link to a denied name outside
+		"loop":         filepath.Join(s.ProjectRoot, "loop"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(s.ProjectRoot, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path   string
+		denied bool
+	}{
+		{"token-link", true},
+		{"config/token.txt", true},
+		{"config/new-file.txt", true}, // not yet created, below a linked dir
+		{"main-link.go", false},
+		{"notes.txt", false},
+		{"cert.txt", true},
+	} {
+		err := s.CheckPathPolicy(PolicyRead, tc.path)
+		if got := errors.Is(err, ErrPathDenied); got != tc.denied {
+			t.Errorf("CheckPathPolicy(%q) = %v, want denied=%v", tc.path, err, tc.denied)
+		}
+	}
+	// A symlink loop can't be resolved; the check fails rather than allow it.
+	if err := s.CheckPathPolicy(PolicyRead, "loop"); err == nil {
+		t.Error("symlink loop: want an error")
+	}
+}
+
+func TestPathPolicyEnforced(t *testing.T) {
+	s := setupTestState(t)
+	if _, err := s.ChatNew("policy", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.ContextAdd("vendor/lib.go", "package lib\n"); err != nil {
+		t.Fatalf("ContextAdd failed: %v", err)
+	}
+	if err := s.WriteOutputFile("vendor/lib.go", "package lib // changed\n"); err != nil {
+		t.Fatalf("WriteOutputFile failed: %v", err)
+	}
+	writePolicy(t, s, "deny secrets/**\ndeny-read *.pem\ndeny-write vendor/**\n")
+
+	for name, err := range map[string]error{
+		"ContextAdd":        s.ContextAdd("secrets/db.txt", "x"),
+		"ContextAdd abs":    s.ContextAdd(filepath.Join(s.ProjectRoot, "secrets", "db.txt"), "x"),
+		"ContextAdd extern": s.ContextAdd("/etc/ssl/host.pem", "x"),
+		"ContextAddSection": s.ContextAddSection("certs/ca.pem", 1, 2, "x"),
+		"ContextAddImage":   s.ContextAddImage("secrets/diagram.png", testPNG(t, 2, 2)),
+		"WriteOutputFile":   s.WriteOutputFile("vendor/new.go", "package lib\n"),
+	} {
+		if !errors.Is(err, ErrPathDenied) {
+			t.Errorf("%s err = %v, want ErrPathDenied", name, err)
+		}
+	}
+	if _, err := s.ApplyFile("vendor/lib.go"); !errors.Is(err, ErrPathDenied) {
+		t.Errorf("ApplyFile err = %v, want ErrPathDenied", err)
+	}
+	if _, err := s.ApplyFileAs("vendor/lib.go", "secrets/lib.go"); !errors.Is(err, ErrPathDenied) {
+		t.Errorf("ApplyFileAs err = %v, want ErrPathDenied", err)
+	}
+	if _, err := s.ApplyFileAs("vendor/lib.go", "lib/lib.go"); err != nil {
+		t.Errorf("ApplyFileAs to an allowed path: %v", err)
+	}
+	// Reading vendor/ is still allowed.
+	if err := s.ContextUpdate("vendor/lib.go", "package lib\n\n"); err != nil {
+		t.Errorf("ContextUpdate failed: %v", err)
+	}
+}
+
+func TestChatNewWithContextSkipsDeniedFiles(t *testing.T) {
+	s := setupTestState(t)
+	source, err := s.ChatNew("source", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	writeProjectFile(t, s.ProjectRoot, "src/main.go", "package main\n")
+	writeProjectFile(t, s.ProjectRoot, "secrets/db.txt", "password\n")
+	for _, path := range []string{"src/main.go", "secrets/db.txt"} {
+		if err := s.ContextAdd(path, ""); err != nil {
+			t.Fatalf("ContextAdd(%s) failed: %v", path, err)
+		}
+	}
+	writePolicy(t, s, "deny secrets/**\n")
+
+	chat, err := s.ChatNewWithContext(source.ID)
+	if err != nil {
+		t.Fatalf("ChatNewWithContext failed: %v", err)
+	}
+	if len(chat.ContextFiles) != 1 || chat.ContextFiles[0].Path != "src/main.go" {
+		t.Errorf("context files = %+v, want only src/main.go", chat.ContextFiles)
+	}
+}
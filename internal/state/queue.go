@@ -0,0 +1,268 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Send queue. Every send is recorded in queue.json next to the chats
+// directory (.bb7/queue.json for project chats, ~/.bb7/queue.json for global
+// chats) while it runs, so a send cut off by a backend exit survives as an
+// "interrupted" entry. Sends queued behind a chat's running stream are
+// recorded the same way until they start. Entries carry the instance ID of
+// the backend that owns them (see instanceID); entries of a backend that no
+// longer holds its instance lock are never started automatically and must
+// be resumed.
+
+// QueueStatus is the state of a queued send.
+type QueueStatus string
+
+const (
+	QueueQueued      QueueStatus = "queued"      // waiting for its chat to finish streaming
+	QueueRunning     QueueStatus = "running"     // streaming now
+	QueueInterrupted QueueStatus = "interrupted" // the backend exited while it streamed
+)
+
+// ErrQueueEntryNotFound is returned for an unknown queue entry ID.
+var ErrQueueEntryNotFound = errors.New("queued send not found")
+
+// QueuedSend is a send request recorded in the queue.
+type QueuedSend struct {
+	ID              string         `json:"id"`
+	ChatID          string         `json:"chat_id"`
+	Global          bool           `json:"global,omitempty"`
+	Content         string         `json:"content"`
+	Model           string         `json:"model,omitempty"`
+	ReasoningEffort string         `json:"reasoning_effort,omitempty"`
+	DiffMode        string         `json:"diff_mode,omitempty"`
+	Generation      map[string]any `json:"generation,omitempty"` // per-send generation parameters
+	Review          bool           `json:"review,omitempty"`     // review mode (report_findings)
+	Status          QueueStatus    `json:"status"`
+	Recorded        bool           `json:"recorded,omitempty"`   // user message already added to the chat
+	RequestID       string         `json:"request_id,omitempty"` // protocol request streaming it
+	Owner           string         `json:"owner,omitempty"`      // instance ID of the backend that owns the entry
+	PID             int            `json:"pid,omitempty"`        // its process ID, for diagnostics
+	Created         time.Time      `json:"created"`
+
+	orphaned bool // Set by loadQueue
+}
+
+// Owned reports whether this backend process owns the entry.
+func (q QueuedSend) Owned() bool {
+	return q.Owner == instanceID()
+}
+
+// Orphaned reports whether the backend that owned the entry has exited.
+func (q QueuedSend) Orphaned() bool {
+	return q.orphaned
+}
+
+// Claim makes this backend process the entry's owner. The lock that keeps
+// it from looking orphaned is taken when the entry is saved.
+func (q *QueuedSend) Claim() {
+	q.Owner = instanceID()
+	q.PID = os.Getpid()
+	q.orphaned = false
+}
+
+type queueFile struct {
+	Items []QueuedSend `json:"items"`
+}
+
+// queuePathFor returns the queue file for project or global chats.
+func (s *State) queuePathFor(global bool) string {
+	return filepath.Join(filepath.Dir(s.chatsDirFor(global)), "queue.json")
+}
+
+// queueScopes returns the scopes (global flags) whose queues are visible.
+func (s *State) queueScopes() []bool {
+	if s.GlobalOnly || s.ProjectRoot == "" {
+		return []bool{true}
+	}
+	return []bool{false, true}
+}
+
+// loadQueue reads one scope's queue. Running entries whose backend has died
+// are reported as interrupted.
+func (s *State) loadQueue(global bool) ([]QueuedSend, error) {
+	data, err := os.ReadFile(s.queuePathFor(global))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var qf queueFile
+	if err := json.Unmarshal(data, &qf); err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(s.queuePathFor(global))
+	for i := range qf.Items {
+		item := &qf.Items[i]
+		item.Global = global
+		item.orphaned = !instanceAlive(dir, item.Owner)
+		if item.Status == QueueRunning && item.Orphaned() {
+			item.Status = QueueInterrupted
+		}
+	}
+	return qf.Items, nil
+}
+
+func (s *State) writeQueue(global bool, items []QueuedSend) error {
+	path := s.queuePathFor(global)
+	if len(items) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(queueFile{Items: items}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// QueueAdd records a send. Status defaults to queued. The entry is owned by
+// this backend.
+func (s *State) QueueAdd(q QueuedSend) (QueuedSend, error) {
+	if err := s.requireInit(); err != nil {
+		return QueuedSend{}, err
+	}
+	items, err := s.loadQueue(q.Global)
+	if err != nil {
+		return QueuedSend{}, err
+	}
+	id, err := generateID()
+	if err != nil {
+		return QueuedSend{}, err
+	}
+	q.ID = id
+	if q.Status == "" {
+		q.Status = QueueQueued
+	}
+	q.Claim()
+	q.Created = time.Now()
+	if err := holdInstanceLock(filepath.Dir(s.queuePathFor(q.Global))); err != nil {
+		return QueuedSend{}, err
+	}
+	if err := s.writeQueue(q.Global, append(items, q)); err != nil {
+		return QueuedSend{}, err
+	}
+	return q, nil
+}
+
+// QueueList returns all visible entries, oldest first within each scope
+// (project before global).
+func (s *State) QueueList() ([]QueuedSend, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	result := []QueuedSend{}
+	for _, global := range s.queueScopes() {
+		items, err := s.loadQueue(global)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+	}
+	return result, nil
+}
+
+// QueueGet returns the entry with the given ID.
+func (s *State) QueueGet(id string) (QueuedSend, error) {
+	items, err := s.QueueList()
+	if err != nil {
+		return QueuedSend{}, err
+	}
+	for _, item := range items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return QueuedSend{}, ErrQueueEntryNotFound
+}
+
+// QueueUpdate applies fn to the entry with the given ID and saves it.
+func (s *State) QueueUpdate(id string, fn func(*QueuedSend)) (QueuedSend, error) {
+	if err := s.requireInit(); err != nil {
+		return QueuedSend{}, err
+	}
+	for _, global := range s.queueScopes() {
+		items, err := s.loadQueue(global)
+		if err != nil {
+			return QueuedSend{}, err
+		}
+		for i := range items {
+			if items[i].ID != id {
+				continue
+			}
+			fn(&items[i])
+			if items[i].Owned() {
+				if err := holdInstanceLock(filepath.Dir(s.queuePathFor(global))); err != nil {
+					return QueuedSend{}, err
+				}
+			}
+			if err := s.writeQueue(global, items); err != nil {
+				return QueuedSend{}, err
+			}
+			return items[i], nil
+		}
+	}
+	return QueuedSend{}, ErrQueueEntryNotFound
+}
+
+// QueueRemove deletes the entry with the given ID.
+func (s *State) QueueRemove(id string) error {
+	if err := s.requireInit(); err != nil {
+		return err
+	}
+	for _, global := range s.queueScopes() {
+		items, err := s.loadQueue(global)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if items[i].ID == id {
+				return s.writeQueue(global, append(items[:i], items[i+1:]...))
+			}
+		}
+	}
+	return ErrQueueEntryNotFound
+}
+
+// QueueNext returns the oldest entry this backend queued for a chat.
+func (s *State) QueueNext(chatID string, global bool) (QueuedSend, bool) {
+	items, err := s.loadQueue(global)
+	if err != nil {
+		return QueuedSend{}, false
+	}
+	for _, item := range items {
+		if item.ChatID == chatID && item.Status == QueueQueued && item.Owned() {
+			return item, true
+		}
+	}
+	return QueuedSend{}, false
+}
+
+// QueueResumable counts entries no running backend will start on its own:
+// interrupted sends and sends queued by a backend that has exited.
+func (s *State) QueueResumable() int {
+	items, err := s.QueueList()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, item := range items {
+		if item.Status == QueueInterrupted || (item.Status == QueueQueued && item.Orphaned()) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueueAddListRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("test", "")
+
+	first, err := s.QueueAdd(QueuedSend{ChatID: chat.ID, Content: "first"})
+	if err != nil {
+		t.Fatalf("QueueAdd failed: %v", err)
+	}
+	if first.ID == "" || first.Status != QueueQueued || !first.Owned() {
+		t.Errorf("unexpected entry: %+v", first)
+	}
+	second, _ := s.QueueAdd(QueuedSend{ChatID: chat.ID, Content: "second", Status: QueueRunning})
+
+	items, err := s.QueueList()
+	if err != nil || len(items) != 2 || items[0].ID != first.ID {
+		t.Fatalf("QueueList = %+v, %v", items, err)
+	}
+	if next, ok := s.QueueNext(chat.ID, false); !ok || next.ID != first.ID {
+		t.Errorf("QueueNext = %+v, %v", next, ok)
+	}
+
+	if _, err := s.QueueUpdate(first.ID, func(q *QueuedSend) { q.Recorded = true }); err != nil {
+		t.Fatalf("QueueUpdate failed: %v", err)
+	}
+	if got, _ := s.QueueGet(first.ID); !got.Recorded {
+		t.Errorf("update not saved: %+v", got)
+	}
+
+	if err := s.QueueRemove(first.ID); err != nil {
+		t.Fatalf("QueueRemove failed: %v", err)
+	}
+	if err := s.QueueRemove(first.ID); !errors.Is(err, ErrQueueEntryNotFound) {
+		t.Errorf("second remove = %v, want ErrQueueEntryNotFound", err)
+	}
+	s.QueueRemove(second.ID)
+	if _, err := os.Stat(s.queuePathFor(false)); !os.IsNotExist(err) {
+		t.Error("empty queue file should be removed")
+	}
+}
+
+func TestQueueRunningEntryOfDeadBackendIsInterrupted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("test", "")
+
+	entry, _ := s.QueueAdd(QueuedSend{ChatID: chat.ID, Content: "hi", Status: QueueRunning})
+	queued, _ := s.QueueAdd(QueuedSend{ChatID: chat.ID, Content: "later"})
+	// Hand both entries to a backend that no longer exists.
+	for _, id := range []string{entry.ID, queued.ID} {
+		s.QueueUpdate(id, func(q *QueuedSend) { q.Owner = "exited-backend" })
+	}
+
+	got, err := s.QueueGet(entry.ID)
+	if err != nil || got.Status != QueueInterrupted {
+		t.Fatalf("status = %q, %v; want interrupted", got.Status, err)
+	}
+	if _, ok := s.QueueNext(chat.ID, false); ok {
+		t.Error("entries of another backend must not be started automatically")
+	}
+	if n := s.QueueResumable(); n != 2 {
+		t.Errorf("QueueResumable = %d, want 2", n)
+	}
+}
+
+// TestQueueOwnerHelperProcess is run as a separate process by
+// TestQueueEntryOrphanedWhenOwnerExits. It takes its instance lock for a
+// queue directory, prints its instance ID, and runs until stdin is closed.
+func TestQueueOwnerHelperProcess(t *testing.T) {
+	dir := os.Getenv("BB7_QUEUE_HELPER_DIR")
+	if dir == "" {
+		return
+	}
+	if err := holdInstanceLock(dir); err != nil {
+		fmt.Println("result:", err)
+		os.Exit(0)
+	}
+	fmt.Println("result:", instanceID())
+	io.ReadAll(os.Stdin)
+	os.Exit(0)
+}
+
+func TestQueueEntryOrphanedWhenOwnerExits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	chat, _ := s.ChatNew("test", "")
+	entry, _ := s.QueueAdd(QueuedSend{ChatID: chat.ID, Content: "hi", Status: QueueRunning})
+
+	h := startHelperProcess(t, "TestQueueOwnerHelperProcess", "BB7_QUEUE_HELPER_DIR="+filepath.Dir(s.queuePathFor(false)))
+	owner := h.result()
+	s.QueueUpdate(entry.ID, func(q *QueuedSend) { q.Owner = owner })
+
+	got, _ := s.QueueGet(entry.ID)
+	if got.Orphaned() || got.Status != QueueRunning {
+		t.Errorf("entry of a running backend = %+v, orphaned %v", got, got.Orphaned())
+	}
+	// Its PID may be reused after it exits; only the lock counts.
+	h.cmd.Process.Kill()
+	h.finish()
+	got, _ = s.QueueGet(entry.ID)
+	if !got.Orphaned() || got.Status != QueueInterrupted {
+		t.Errorf("entry of an exited backend = %+v, orphaned %v", got, got.Orphaned())
+	}
+}
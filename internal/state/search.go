@@ -0,0 +1,904 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Full-text chat search.
+//
+// Each chats directory has a search.json beside index.json holding an
+// inverted index (term -> chat ID -> frequency) plus the per-chat metadata
+// needed for field filters and BM25 length normalization. saveChatAt keeps
+// it current when a save changes anything searchable; searches also
+// reconcile it against chat.json modification times, so chats written by
+// older versions or other processes, and saves that skipped the index, are
+// picked up lazily. Like index.json it is a cache and can be deleted at any
+// time.
+
+const searchIndexVersion = 1
+
+const (
+	// maxTermBytes skips tokens that are unlikely to be searched for
+	// (base64 blobs, hashes, minified code).
+	maxTermBytes = 64
+	// maxPrefixExpansions caps how many index terms a prefix query expands to.
+	maxPrefixExpansions = 64
+	// maxExcerptResults limits excerpt extraction (which loads chat.json) to
+	// the best-ranked results.
+	maxExcerptResults = 50
+	// maxExcerptsPerChat is the number of excerpts returned for one chat.
+	maxExcerptsPerChat = 3
+
+	excerptBefore = 40
+	excerptAfter  = 80
+
+	// BM25 parameters.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// titleBoost is added per query clause that matches the chat title.
+	titleBoost = 2.0
+)
+
+// SearchScope selects which chat stores a search covers.
+type SearchScope int
+
+const (
+	SearchAll     SearchScope = iota // project and global chats
+	SearchProject                    // project chats only
+	SearchGlobal                     // global chats only
+)
+
+// ParseSearchScope converts a protocol scope name to a SearchScope.
+// An empty name means SearchAll.
+func ParseSearchScope(name string) (SearchScope, error) {
+	switch name {
+	case "", "all":
+		return SearchAll, nil
+	case "project":
+		return SearchProject, nil
+	case "global":
+		return SearchGlobal, nil
+	}
+	return SearchAll, fmt.Errorf("unknown search scope %q (expected all, project, or global)", name)
+}
+
+type searchIndex struct {
+	Version  int                       `json:"version"`
+	Docs     map[string]*searchDoc     `json:"docs"`
+	Postings map[string]map[string]int `json:"postings"`
+}
+
+type searchDoc struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Models  []string  `json:"models,omitempty"`
+	Files   []string  `json:"files,omitempty"`
+	Length  int       `json:"length"`
+	ModTime int64     `json:"mtime"`
+	Size    int64     `json:"size"`
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		Version:  searchIndexVersion,
+		Docs:     make(map[string]*searchDoc),
+		Postings: make(map[string]map[string]int),
+	}
+}
+
+// searchIndexPathFor returns the search.json path for a given chats directory.
+func searchIndexPathFor(chatsDir string) string {
+	return filepath.Join(chatsDir, "search.json")
+}
+
+// loadSearchIndexFrom reads the search index from a chats directory.
+func loadSearchIndexFrom(chatsDir string) (*searchIndex, error) {
+	data, err := os.ReadFile(searchIndexPathFor(chatsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	var idx searchIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != searchIndexVersion {
+		return nil, errors.New("unsupported search index version")
+	}
+	if idx.Docs == nil {
+		idx.Docs = make(map[string]*searchDoc)
+	}
+	if idx.Postings == nil {
+		idx.Postings = make(map[string]map[string]int)
+	}
+	return &idx, nil
+}
+
+// writeSearchIndexTo writes the search index to a chats directory.
+func writeSearchIndexTo(chatsDir string, idx *searchIndex) error {
+	idx.Version = searchIndexVersion
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(searchIndexPathFor(chatsDir), data, 0644)
+}
+
+// remove drops a chat from the index.
+func (idx *searchIndex) remove(id string) {
+	if _, ok := idx.Docs[id]; !ok {
+		return
+	}
+	delete(idx.Docs, id)
+	for term, docs := range idx.Postings {
+		if _, ok := docs[id]; !ok {
+			continue
+		}
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.Postings, term)
+		}
+	}
+}
+
+// add indexes a chat, replacing any previous entry. info is the stat of its
+// chat.json, used to detect later out-of-band changes.
+func (idx *searchIndex) add(chat *Chat, info os.FileInfo) {
+	idx.remove(chat.ID)
+
+	doc := &searchDoc{
+		Name:    chat.Name,
+		Created: chat.Created,
+		Models:  chatModels(chat),
+		Files:   chatFiles(chat),
+	}
+	if info != nil {
+		doc.ModTime = info.ModTime().UnixNano()
+		doc.Size = info.Size()
+	}
+
+	freq := make(map[string]int)
+	count := func(text string) {
+		for _, tok := range tokenize(text) {
+			freq[tok.term]++
+			doc.Length++
+		}
+	}
+	count(chat.Name)
+	for _, msg := range chat.Messages {
+		count(MessageText(msg))
+	}
+
+	for term, n := range freq {
+		docs := idx.Postings[term]
+		if docs == nil {
+			docs = make(map[string]int)
+			idx.Postings[term] = docs
+		}
+		docs[chat.ID] = n
+	}
+	idx.Docs[chat.ID] = doc
+}
+
+// chatModels returns the distinct models used for a chat's messages, or the
+// chat's selected model if no message records one.
+func chatModels(chat *Chat) []string {
+	seen := make(map[string]bool)
+	var models []string
+	for _, msg := range chat.Messages {
+		if msg.Model != "" && !seen[msg.Model] {
+			seen[msg.Model] = true
+			models = append(models, msg.Model)
+		}
+	}
+	if len(models) == 0 && chat.Model != "" {
+		models = append(models, chat.Model)
+	}
+	return models
+}
+
+// chatFiles returns the distinct file paths a chat has referenced, from its
+// current context and from context events in its history.
+func chatFiles(chat *Chat) []string {
+	seen := make(map[string]bool)
+	var files []string
+	addFile := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+	for _, cf := range chat.ContextFiles {
+		addFile(cf.Path)
+	}
+	for _, msg := range chat.Messages {
+		for _, part := range msg.Parts {
+			if part.Type == PartTypeContextEvent {
+				addFile(part.Path)
+			}
+		}
+	}
+	return files
+}
+
+// indexedDigests holds, per chat directory, the searchDigest this process
+// last wrote to the search index. Saves that change nothing searchable,
+// such as drafts and annotations, leave the index alone; searches still
+// refresh the entry's modification time when they reconcile.
+var indexedDigests = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// searchDigest hashes the parts of a chat the search index holds.
+func searchDigest(chat *Chat) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write(chat.Name)
+	write(chat.Created.String())
+	write(strings.Join(chatModels(chat), "\x00"))
+	write(strings.Join(chatFiles(chat), "\x00"))
+	for _, msg := range chat.Messages {
+		write(MessageText(msg))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// updateSearchIndexAt re-indexes one chat after it was saved. The index is
+// only updated if it already exists; the first search builds it.
+func updateSearchIndexAt(chatsDir string, chat *Chat) {
+	key := filepath.Join(chatsDir, chat.ID)
+	digest := searchDigest(chat)
+	indexedDigests.Lock()
+	unchanged := indexedDigests.m[key] == digest
+	indexedDigests.Unlock()
+	if unchanged {
+		return
+	}
+
+	idx, err := loadSearchIndexFrom(chatsDir)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(filepath.Join(chatsDir, chat.ID, "chat.json"))
+	if err != nil {
+		return
+	}
+	idx.add(chat, info)
+	if writeSearchIndexTo(chatsDir, idx) == nil {
+		indexedDigests.Lock()
+		indexedDigests.m[key] = digest
+		indexedDigests.Unlock()
+	}
+}
+
+// removeSearchIndexEntryAt drops a chat from the search index, if present.
+func removeSearchIndexEntryAt(chatsDir string, chatID string) {
+	indexedDigests.Lock()
+	delete(indexedDigests.m, filepath.Join(chatsDir, chatID))
+	indexedDigests.Unlock()
+
+	idx, err := loadSearchIndexFrom(chatsDir)
+	if err != nil {
+		return
+	}
+	if _, ok := idx.Docs[chatID]; !ok {
+		return
+	}
+	idx.remove(chatID)
+	_ = writeSearchIndexTo(chatsDir, idx)
+}
+
+// syncSearchIndexAt loads the search index for a chats directory and brings
+// it up to date with the chats on disk, (re)building it if needed.
+func syncSearchIndexAt(chatsDir string) (*searchIndex, error) {
+	idx, err := loadSearchIndexFrom(chatsDir)
+	changed := false
+	if err != nil {
+		idx = newSearchIndex()
+		changed = true
+	}
+
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newSearchIndex(), nil
+		}
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id := entry.Name()
+		chatPath := filepath.Join(chatsDir, id, "chat.json")
+		info, err := os.Stat(chatPath)
+		if err != nil {
+			continue
+		}
+		present[id] = true
+		if doc, ok := idx.Docs[id]; ok && doc.ModTime == info.ModTime().UnixNano() && doc.Size == info.Size() {
+			continue
+		}
+		chat, err := loadChatFrom(chatPath)
+		if err != nil {
+			continue
+		}
+		// A lazy migration in loadChatFrom may have rewritten the file.
+		if fresh, err := os.Stat(chatPath); err == nil {
+			info = fresh
+		}
+		chat.ID = id
+		idx.add(chat, info)
+		changed = true
+	}
+	for id := range idx.Docs {
+		if !present[id] {
+			idx.remove(id)
+			changed = true
+		}
+	}
+
+	if changed {
+		// The index is a cache; searching still works if it can't be written.
+		_ = writeSearchIndexTo(chatsDir, idx)
+	}
+	return idx, nil
+}
+
+// token is a lowercased term with its byte range in the source text.
+type token struct {
+	term       string
+	start, end int
+}
+
+func isTermRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokenize splits text into lowercase terms of letters, digits, and
+// underscores. Overlong tokens are skipped.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	flush := func(end int) {
+		if start >= 0 && end-start <= maxTermBytes {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:end]), start: start, end: end})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if isTermRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// queryClause is one required element of a query: a single term or a phrase.
+// If prefix is set, the last term also matches index terms it is a prefix of.
+type queryClause struct {
+	terms  []string
+	prefix bool
+}
+
+func (c queryClause) matchesTerm(i int, term string) bool {
+	if c.prefix && i == len(c.terms)-1 {
+		return strings.HasPrefix(term, c.terms[i])
+	}
+	return term == c.terms[i]
+}
+
+// matchAt reports whether the clause matches tokens starting at i.
+func (c queryClause) matchAt(tokens []token, i int) bool {
+	if i+len(c.terms) > len(tokens) {
+		return false
+	}
+	for j := range c.terms {
+		if !c.matchesTerm(j, tokens[i+j].term) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the clause occurs anywhere in tokens.
+func (c queryClause) matches(tokens []token) bool {
+	for i := range tokens {
+		if c.matchAt(tokens, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchQuery is a parsed search string.
+type searchQuery struct {
+	clauses []queryClause
+	models  []string
+	files   []string
+	before  time.Time
+	after   time.Time
+}
+
+func (q searchQuery) hasFilters() bool {
+	return len(q.models) > 0 || len(q.files) > 0 || !q.before.IsZero() || !q.after.IsZero()
+}
+
+// parseSearchQuery parses a query string. Supported syntax:
+//
+//	word          term (case-insensitive, whole word)
+//	wor*          prefix
+//	"two words"   phrase
+//	model:name    chat used a model containing name
+//	file:path     chat referenced a file whose path contains path
+//	before:DATE   created before DATE (YYYY-MM-DD, local time)
+//	after:DATE    created on or after DATE
+//
+// All clauses must match. The last bare word is also treated as a prefix
+// unless the query ends in whitespace, so results update sensibly while the
+// user is still typing.
+func parseSearchQuery(query string) (searchQuery, error) {
+	var q searchQuery
+	lastBare := -1
+
+	for _, word := range splitQueryWords(query) {
+		if key, value, ok := strings.Cut(word, ":"); ok && value != "" {
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(key) {
+			case "model":
+				q.models = append(q.models, strings.ToLower(value))
+				continue
+			case "file":
+				q.files = append(q.files, strings.ToLower(value))
+				continue
+			case "before", "after":
+				t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+				if err != nil {
+					return q, fmt.Errorf("invalid date in %q (expected YYYY-MM-DD)", word)
+				}
+				if strings.ToLower(key) == "before" {
+					q.before = t
+				} else {
+					q.after = t
+				}
+				continue
+			}
+		}
+
+		quoted := strings.HasPrefix(word, `"`)
+		prefix := !quoted && strings.HasSuffix(word, "*")
+		var terms []string
+		for _, tok := range tokenize(strings.Trim(word, `"*`)) {
+			terms = append(terms, tok.term)
+		}
+		if len(terms) == 0 {
+			continue
+		}
+		q.clauses = append(q.clauses, queryClause{terms: terms, prefix: prefix})
+		if quoted {
+			lastBare = -1
+		} else {
+			lastBare = len(q.clauses) - 1
+		}
+	}
+
+	trimmed := strings.TrimRightFunc(query, unicode.IsSpace)
+	if lastBare >= 0 && lastBare == len(q.clauses)-1 && trimmed == query {
+		q.clauses[lastBare].prefix = true
+	}
+	return q, nil
+}
+
+// splitQueryWords splits on whitespace, keeping double-quoted runs together.
+// An unterminated quote extends to the end of the query.
+func splitQueryWords(query string) []string {
+	var words []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if cur.Len() > 0 {
+				words = append(words, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words
+}
+
+// searchScopeIndex is one synced chats directory taking part in a search.
+type searchScopeIndex struct {
+	chatsDir string
+	global   bool
+	idx      *searchIndex
+}
+
+// searchCorpus combines the statistics of all indexes in a search so scores
+// are comparable across scopes.
+type searchCorpus struct {
+	scopes   []searchScopeIndex
+	docCount int
+	avgLen   float64
+}
+
+func newSearchCorpus(scopes []searchScopeIndex) *searchCorpus {
+	c := &searchCorpus{scopes: scopes}
+	total := 0
+	for _, sc := range scopes {
+		c.docCount += len(sc.idx.Docs)
+		for _, doc := range sc.idx.Docs {
+			total += doc.Length
+		}
+	}
+	if c.docCount > 0 {
+		c.avgLen = float64(total) / float64(c.docCount)
+	}
+	return c
+}
+
+func (c *searchCorpus) docFreq(term string) int {
+	n := 0
+	for _, sc := range c.scopes {
+		n += len(sc.idx.Postings[term])
+	}
+	return n
+}
+
+// expand returns the index terms a clause term matches.
+func (c *searchCorpus) expand(clause queryClause, i int) []string {
+	term := clause.terms[i]
+	if !clause.prefix || i != len(clause.terms)-1 {
+		return []string{term}
+	}
+	seen := make(map[string]bool)
+	var terms []string
+	for _, sc := range c.scopes {
+		for t := range sc.idx.Postings {
+			if strings.HasPrefix(t, term) && !seen[t] {
+				seen[t] = true
+				terms = append(terms, t)
+			}
+		}
+	}
+	// Prefer the exact term and the most common completions.
+	sort.Slice(terms, func(a, b int) bool {
+		if (terms[a] == term) != (terms[b] == term) {
+			return terms[a] == term
+		}
+		da, db := c.docFreq(terms[a]), c.docFreq(terms[b])
+		if da != db {
+			return da > db
+		}
+		return terms[a] < terms[b]
+	})
+	if len(terms) > maxPrefixExpansions {
+		terms = terms[:maxPrefixExpansions]
+	}
+	return terms
+}
+
+// bm25 scores one term occurrence count in a document.
+func (c *searchCorpus) bm25(tf, df, docLen int) float64 {
+	if tf == 0 || c.docCount == 0 {
+		return 0
+	}
+	idf := math.Log(1 + (float64(c.docCount)-float64(df)+0.5)/(float64(df)+0.5))
+	norm := 1 - bm25B
+	if c.avgLen > 0 {
+		norm += bm25B * float64(docLen) / c.avgLen
+	}
+	return idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+}
+
+// searchHit is a candidate result before excerpts are extracted.
+type searchHit struct {
+	scope  *searchScopeIndex
+	id     string
+	doc    *searchDoc
+	score  float64
+	title  bool // every clause matches the title
+	verify bool // a phrase clause must be checked against the text
+}
+
+// Search finds chats matching query in the given scope, best matches first.
+// An empty query (or one with only field filters) lists matching chats,
+// newest first. See parseSearchQuery for the query syntax.
+func (s *State) Search(query string, scope SearchScope) ([]ChatSearchResult, error) {
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []searchScopeIndex
+	if scope != SearchGlobal && !s.GlobalOnly {
+		if err := s.requireInit(); err != nil {
+			if scope == SearchProject {
+				return nil, err
+			}
+		} else {
+			idx, err := syncSearchIndexAt(s.chatsDir())
+			if err != nil {
+				return nil, err
+			}
+			scopes = append(scopes, searchScopeIndex{chatsDir: s.chatsDir(), idx: idx})
+		}
+	}
+	if scope != SearchProject {
+		if err := s.ensureGlobalChatsDir(); err != nil {
+			return nil, err
+		}
+		idx, err := syncSearchIndexAt(s.globalChatsDir())
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, searchScopeIndex{chatsDir: s.globalChatsDir(), global: true, idx: idx})
+	}
+
+	corpus := newSearchCorpus(scopes)
+	hits := corpus.match(q)
+
+	if len(q.clauses) == 0 {
+		sort.Slice(hits, func(i, j int) bool {
+			return hits[i].doc.Created.After(hits[j].doc.Created)
+		})
+	} else {
+		sort.Slice(hits, func(i, j int) bool {
+			if hits[i].score != hits[j].score {
+				return hits[i].score > hits[j].score
+			}
+			return hits[i].doc.Created.After(hits[j].doc.Created)
+		})
+	}
+
+	results := make([]ChatSearchResult, 0, len(hits))
+	excerpted := 0
+	for _, hit := range hits {
+		result := ChatSearchResult{
+			ID:        hit.id,
+			Name:      hit.doc.Name,
+			Created:   hit.doc.Created,
+			MatchType: "title",
+			Global:    hit.scope.global,
+		}
+		if len(q.clauses) > 0 {
+			result.Score = math.Round(hit.score*1000) / 1000
+			if !hit.title {
+				result.MatchType = "content"
+			}
+		}
+
+		needText := hit.verify || (len(q.clauses) > 0 && excerpted < maxExcerptResults)
+		if needText {
+			chat, err := loadChatFrom(filepath.Join(hit.scope.chatsDir, hit.id, "chat.json"))
+			if err != nil {
+				continue
+			}
+			msgTokens := make([][]token, len(chat.Messages))
+			texts := make([]string, len(chat.Messages))
+			for i, msg := range chat.Messages {
+				texts[i] = MessageText(msg)
+				msgTokens[i] = tokenize(texts[i])
+			}
+			if hit.verify && !hit.title && !phrasesMatch(q.clauses, msgTokens) {
+				continue
+			}
+			if excerpted < maxExcerptResults {
+				result.Excerpts = buildExcerpts(q.clauses, texts, msgTokens)
+				if len(result.Excerpts) > 0 {
+					result.Excerpt = result.Excerpts[0].Text
+				}
+				excerpted++
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// match returns the documents satisfying every clause and filter, scored.
+func (c *searchCorpus) match(q searchQuery) []searchHit {
+	// Expand each clause's terms once.
+	expanded := make([][][]string, len(q.clauses))
+	for i, clause := range q.clauses {
+		expanded[i] = make([][]string, len(clause.terms))
+		for j := range clause.terms {
+			expanded[i][j] = c.expand(clause, j)
+		}
+	}
+
+	var hits []searchHit
+	for si := range c.scopes {
+		sc := &c.scopes[si]
+		for id, doc := range sc.idx.Docs {
+			if !q.filtersMatch(doc) {
+				continue
+			}
+			titleTokens := tokenize(doc.Name)
+			hit := searchHit{scope: sc, id: id, doc: doc, title: len(q.clauses) > 0}
+			ok := true
+			for ci, clause := range q.clauses {
+				inTitle := clause.matches(titleTokens)
+				if !inTitle {
+					hit.title = false
+				}
+				clauseScore := 0.0
+				for ti := range clause.terms {
+					termScore := 0.0
+					for _, term := range expanded[ci][ti] {
+						if tf := sc.idx.Postings[term][id]; tf > 0 {
+							termScore += c.bm25(tf, c.docFreq(term), doc.Length)
+						}
+					}
+					if termScore == 0 {
+						ok = false
+						break
+					}
+					clauseScore += termScore
+				}
+				if !ok {
+					break
+				}
+				if len(clause.terms) > 1 {
+					hit.verify = true
+				}
+				if inTitle {
+					clauseScore += titleBoost
+				}
+				hit.score += clauseScore
+			}
+			if ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+	return hits
+}
+
+func (q searchQuery) filtersMatch(doc *searchDoc) bool {
+	if !q.before.IsZero() && !doc.Created.Before(q.before) {
+		return false
+	}
+	if !q.after.IsZero() && doc.Created.Before(q.after) {
+		return false
+	}
+	for _, want := range q.models {
+		if !containsFold(doc.Models, want) {
+			return false
+		}
+	}
+	for _, want := range q.files {
+		if !containsFold(doc.Files, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether any value contains the lowercase substring.
+func containsFold(values []string, lowerSub string) bool {
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), lowerSub) {
+			return true
+		}
+	}
+	return false
+}
+
+// phrasesMatch reports whether every multi-term clause occurs within a
+// single message. Single terms were already matched by the index.
+func phrasesMatch(clauses []queryClause, msgTokens [][]token) bool {
+	for _, clause := range clauses {
+		if len(clause.terms) < 2 {
+			continue
+		}
+		found := false
+		for _, tokens := range msgTokens {
+			if clause.matches(tokens) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// buildExcerpts extracts up to maxExcerptsPerChat non-overlapping snippets
+// around query matches, in message order, with highlight ranges.
+func buildExcerpts(clauses []queryClause, texts []string, msgTokens [][]token) []SearchExcerpt {
+	var excerpts []SearchExcerpt
+	for mi, tokens := range msgTokens {
+		text := texts[mi]
+		spans := matchSpans(clauses, tokens)
+		windowEnd := -1
+		for _, span := range spans {
+			if len(excerpts) >= maxExcerptsPerChat {
+				return excerpts
+			}
+			if span[0] < windowEnd {
+				continue
+			}
+			start := max(span[0]-excerptBefore, 0)
+			end := min(span[1]+excerptAfter, len(text))
+			for start > 0 && !utf8.RuneStart(text[start]) {
+				start++
+			}
+			for end < len(text) && !utf8.RuneStart(text[end]) {
+				end--
+			}
+			windowEnd = end
+
+			var ex SearchExcerpt
+			offset := 0
+			if start > 0 {
+				ex.Text = "..."
+				offset = len(ex.Text)
+			}
+			ex.Text += strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(text[start:end])
+			if end < len(text) {
+				ex.Text += "..."
+			}
+			for _, sp := range spans {
+				if sp[0] >= start && sp[1] <= end {
+					ex.Highlights = append(ex.Highlights, [2]int{sp[0] - start + offset, sp[1] - start + offset})
+				}
+			}
+			excerpts = append(excerpts, ex)
+		}
+	}
+	return excerpts
+}
+
+// matchSpans returns the byte ranges of clause matches in a message,
+// in order and without overlaps.
+func matchSpans(clauses []queryClause, tokens []token) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(tokens); i++ {
+		for _, clause := range clauses {
+			if clause.matchAt(tokens, i) {
+				last := i + len(clause.terms) - 1
+				spans = append(spans, [2]int{tokens[i].start, tokens[last].end})
+				i = last
+				break
+			}
+		}
+	}
+	return spans
+}
@@ -0,0 +1,283 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Fix parse_args() in Café.go")
+	var terms []string
+	for _, tok := range tokens {
+		terms = append(terms, tok.term)
+	}
+	if got := strings.Join(terms, ","); got != "fix,parse_args,in,café,go" {
+		t.Errorf("terms = %s", got)
+	}
+	if tok := tokens[3]; tok.start != 20 || tok.end != 25 {
+		t.Errorf("café offsets = %d-%d, want 20-25", tok.start, tok.end)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := parseSearchQuery(`"race condition" lock* model:claude file:main.go before:2026-02-01 after:2026-01-01 mutex`)
+	if err != nil {
+		t.Fatalf("parseSearchQuery failed: %v", err)
+	}
+	if len(q.clauses) != 3 {
+		t.Fatalf("expected 3 clauses, got %+v", q.clauses)
+	}
+	if strings.Join(q.clauses[0].terms, " ") != "race condition" || q.clauses[0].prefix {
+		t.Errorf("phrase clause = %+v", q.clauses[0])
+	}
+	if q.clauses[1].terms[0] != "lock" || !q.clauses[1].prefix {
+		t.Errorf("prefix clause = %+v", q.clauses[1])
+	}
+	if !q.clauses[2].prefix {
+		t.Error("last bare word should match as a prefix while typing")
+	}
+	if q.models[0] != "claude" || q.files[0] != "main.go" {
+		t.Errorf("filters = %v %v", q.models, q.files)
+	}
+	if q.before.Format("2006-01-02") != "2026-02-01" || q.after.Format("2006-01-02") != "2026-01-01" {
+		t.Errorf("dates = %v %v", q.before, q.after)
+	}
+
+	q, _ = parseSearchQuery("mutex ")
+	if q.clauses[0].prefix {
+		t.Error("trailing space should end prefix matching")
+	}
+	if _, err := parseSearchQuery("before:yesterday"); err == nil {
+		t.Error("expected error for invalid date")
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	s := setupTestState(t)
+
+	s.ChatNew("Passing mention", "")
+	s.AddUserMessage("The cache is fine, but let's talk about logging and metrics and tracing.", "")
+	s.ChatNew("Deep dive", "")
+	s.AddUserMessage("Why does the cache miss? Cache eviction empties the cache too early.", "")
+
+	results, err := s.Search("cache ", SearchProject)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Name != "Deep dive" {
+		t.Errorf("expected the chat with more matches first, got %q", results[0].Name)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("scores not descending: %v, %v", results[0].Score, results[1].Score)
+	}
+
+	// Title matches are boosted above content matches.
+	s.ChatNew("Cache design", "")
+	results, _ = s.Search("cache ", SearchProject)
+	if results[0].Name != "Cache design" || results[0].MatchType != "title" {
+		t.Errorf("expected title match first, got %+v", results[0])
+	}
+}
+
+func TestSearchPhraseAndPrefix(t *testing.T) {
+	s := setupTestState(t)
+
+	s.ChatNew("a", "")
+	s.AddUserMessage("We hit a race condition in the scheduler.", "")
+	s.ChatNew("b", "")
+	s.AddUserMessage("The condition for the race is unclear.", "")
+
+	results, _ := s.Search(`"race condition"`, SearchProject)
+	if len(results) != 1 || results[0].Name != "a" {
+		t.Errorf("phrase should match only adjacent terms, got %+v", results)
+	}
+
+	results, _ = s.Search("sched* ", SearchProject)
+	if len(results) != 1 || results[0].Name != "a" {
+		t.Errorf("prefix query failed, got %+v", results)
+	}
+
+	results, _ = s.Search("sched", SearchProject)
+	if len(results) != 1 {
+		t.Errorf("last word should match as prefix, got %+v", results)
+	}
+
+	results, _ = s.Search("sched ", SearchProject)
+	if len(results) != 0 {
+		t.Errorf("complete word should not match as prefix, got %+v", results)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	s := setupTestState(t)
+
+	s.ChatNew("alpha", "")
+	s.ContextAdd("src/server.go", "package src\n")
+	s.AddUserMessage("deploy notes", "openai/gpt-5")
+	s.ChatNew("beta", "")
+	s.AddUserMessage("deploy notes", "anthropic/claude-sonnet")
+
+	results, _ := s.Search("deploy model:claude", SearchProject)
+	if len(results) != 1 || results[0].Name != "beta" {
+		t.Errorf("model filter failed: %+v", results)
+	}
+	results, _ = s.Search("file:server.go", SearchProject)
+	if len(results) != 1 || results[0].Name != "alpha" {
+		t.Errorf("file filter failed: %+v", results)
+	}
+	if results[0].Score != 0 || results[0].MatchType != "title" {
+		t.Errorf("filter-only query should list without scores: %+v", results[0])
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	results, _ = s.Search("before:"+tomorrow, SearchProject)
+	if len(results) != 2 {
+		t.Errorf("before filter should keep both chats, got %d", len(results))
+	}
+	results, _ = s.Search("after:"+tomorrow, SearchProject)
+	if len(results) != 0 {
+		t.Errorf("after filter should drop both chats, got %d", len(results))
+	}
+}
+
+func TestSearchExcerpts(t *testing.T) {
+	s := setupTestState(t)
+
+	s.ChatNew("notes", "")
+	filler := strings.Repeat("lorem ipsum ", 20)
+	s.AddUserMessage("First token here. "+filler+"Second token there. "+filler+"Third token.", "")
+	s.AddAssistantMessage([]MessagePart{{Type: PartTypeText, Content: "A token\nin the reply"}}, nil, "", nil)
+
+	results, _ := s.Search("token ", SearchProject)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	r := results[0]
+	if len(r.Excerpts) != maxExcerptsPerChat {
+		t.Fatalf("expected %d excerpts, got %+v", maxExcerptsPerChat, r.Excerpts)
+	}
+	if r.Excerpt != r.Excerpts[0].Text {
+		t.Error("excerpt should mirror the first excerpt")
+	}
+	for _, ex := range r.Excerpts {
+		if strings.Contains(ex.Text, "\n") {
+			t.Errorf("excerpt contains newline: %q", ex.Text)
+		}
+		if len(ex.Highlights) == 0 {
+			t.Errorf("excerpt has no highlights: %q", ex.Text)
+		}
+		for _, h := range ex.Highlights {
+			if got := ex.Text[h[0]:h[1]]; got != "token" {
+				t.Errorf("highlight %v covers %q in %q", h, got, ex.Text)
+			}
+		}
+	}
+	if !strings.HasPrefix(r.Excerpts[1].Text, "...") {
+		t.Errorf("later excerpt should be marked as truncated: %q", r.Excerpts[1].Text)
+	}
+}
+
+func TestSearchIndexIncremental(t *testing.T) {
+	s := setupTestState(t)
+
+	s.ChatNew("chat", "")
+	s.AddUserMessage("first message", "")
+	if _, err := s.Search("first", SearchProject); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Saving updates the existing index directly.
+	s.AddUserMessage("xylophone", "")
+	idx, err := loadSearchIndexFrom(s.chatsDir())
+	if err != nil {
+		t.Fatalf("loadSearchIndexFrom failed: %v", err)
+	}
+	if idx.Postings["xylophone"][s.ActiveChat.ID] != 1 {
+		t.Error("save did not update the search index")
+	}
+
+	// Saves that change nothing searchable don't rewrite it.
+	before, _ := os.Stat(filepath.Join(s.chatsDir(), "search.json"))
+	s.ActiveChat.Draft = "half-typed question"
+	if err := s.SaveActiveChat(); err != nil {
+		t.Fatalf("SaveActiveChat failed: %v", err)
+	}
+	if after, _ := os.Stat(filepath.Join(s.chatsDir(), "search.json")); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("draft save rewrote the search index")
+	}
+	if results, _ := s.Search("xylophone", SearchProject); len(results) != 1 {
+		t.Errorf("search after draft save = %+v", results)
+	}
+
+	// Changes made behind the index's back are picked up by mtime.
+	chat := *s.ActiveChat
+	chat.Name = "renamed outside"
+	data, _ := json.Marshal(&chat)
+	later := time.Now().Add(time.Minute)
+	path := s.chatJSONPath(chat.ID)
+	os.WriteFile(path, data, 0644)
+	os.Chtimes(path, later, later)
+	results, _ := s.Search("outside", SearchProject)
+	if len(results) != 1 {
+		t.Errorf("out-of-band change not reindexed: %+v", results)
+	}
+
+	// Deleted chats leave the index.
+	id := chat.ID
+	s.ChatDelete(id)
+	idx, _ = loadSearchIndexFrom(s.chatsDir())
+	if _, ok := idx.Docs[id]; ok {
+		t.Error("deleted chat still indexed")
+	}
+	if _, ok := idx.Postings["xylophone"]; ok {
+		t.Error("deleted chat's terms still indexed")
+	}
+
+	// A corrupt index is rebuilt.
+	os.WriteFile(filepath.Join(s.chatsDir(), "search.json"), []byte("{"), 0644)
+	if _, err := s.Search("anything", SearchProject); err != nil {
+		t.Errorf("corrupt index should be rebuilt, got %v", err)
+	}
+}
+
+func TestSearchAllScopes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+
+	s.ChatNew("project kubernetes", "")
+	if _, err := s.ChatNewGlobal("global kubernetes", ""); err != nil {
+		t.Fatalf("ChatNewGlobal failed: %v", err)
+	}
+
+	results, err := s.Search("kubernetes", SearchAll)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected results from both scopes, got %+v", results)
+	}
+	globals := 0
+	for _, r := range results {
+		if r.Global {
+			globals++
+			if r.Name != "global kubernetes" {
+				t.Errorf("wrong chat marked global: %q", r.Name)
+			}
+		}
+	}
+	if globals != 1 {
+		t.Errorf("expected 1 global result, got %d", globals)
+	}
+
+	results, _ = s.Search("kubernetes", SearchProject)
+	if len(results) != 1 || results[0].Global {
+		t.Errorf("project scope leaked global chats: %+v", results)
+	}
+}
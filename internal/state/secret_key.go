@@ -0,0 +1,74 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretKeyFile holds the key secret placeholders are derived from, next to
+// the chats directory (.bb7/secret_key, or ~/.bb7/secret_key for global
+// chats).
+const secretKeyFile = "secret_key"
+
+// SecretKey returns the key for secret placeholders of the active chat's
+// scope, creating it on first use. Placeholders keyed with it stay the same
+// across sessions, but no one without the file can test guesses against
+// them. The file is readable only by the user.
+func (s *State) SecretKey() ([]byte, error) {
+	if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+	global := s.GlobalOnly
+	if s.ActiveChat != nil {
+		global = s.ActiveChat.Global
+	}
+	path := filepath.Join(filepath.Dir(s.chatsDirFor(global)), secretKeyFile)
+	if key, err := readSecretKey(path); err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// Write the key under a temporary name and link it into place, so that
+	// of two backends creating it at once, both end up with the winner's.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+secretKeyFile+".*"+tempFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return readSecretKey(path)
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func readSecretKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("invalid secret key in %s", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,32 @@
+package state
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretKeyIsStablePerScope(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	key, err := s.SecretKey()
+	if err != nil || len(key) != 32 {
+		t.Fatalf("SecretKey = %x, %v", key, err)
+	}
+	again, _ := s.SecretKey()
+	if !bytes.Equal(key, again) {
+		t.Error("second SecretKey returned a different key")
+	}
+	info, err := os.Stat(filepath.Join(s.ProjectRoot, ".bb7", secretKeyFile))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file: %v, %v", info, err)
+	}
+
+	if _, err := s.ChatNewGlobal("global", ""); err != nil {
+		t.Fatalf("ChatNewGlobal failed: %v", err)
+	}
+	if global, _ := s.SecretKey(); bytes.Equal(key, global) {
+		t.Error("global chats share the project's key")
+	}
+}
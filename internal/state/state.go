@@ -142,6 +142,25 @@ func (s *State) Init(projectRoot string) error {
 	return nil
 }
 
+// Open sets the project root like Init but does not restore or lock the last
+// active chat. Used by command-line tools that must not disturb a running
+// editor session. If projectRoot is empty, enters global-only mode.
+func (s *State) Open(projectRoot string) error {
+	if projectRoot == "" {
+		s.GlobalOnly = true
+		return s.ensureGlobalChatsDir()
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, ".bb7")); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotBB7Project
+		}
+		return err
+	}
+	s.ProjectRoot = projectRoot
+	s.GlobalOnly = false
+	return nil
+}
+
 // Initialized returns true if Init has been called (project mode or global-only mode).
 func (s *State) Initialized() bool {
 	return s.ProjectRoot != "" || s.GlobalOnly
@@ -169,6 +188,16 @@ func (s *State) outputDir(chatID string) string {
 	return filepath.Join(s.chatDir(chatID), "output")
 }
 
+// priorOutputDir holds the output files the latest reply overwrote.
+func (s *State) priorOutputDir(chatID string) string {
+	return filepath.Join(s.chatDir(chatID), "prior_output")
+}
+
+// variantsDir holds the output files of replies kept as alternates.
+func (s *State) variantsDir(chatID string) string {
+	return filepath.Join(s.chatDir(chatID), "variants")
+}
+
 func (s *State) chatJSONPath(chatID string) string {
 	return filepath.Join(s.chatDir(chatID), "chat.json")
 }
@@ -223,11 +252,26 @@ func (s *State) chatsDirFor(global bool) string {
 // Cleanup releases any locks held by this instance.
 func (s *State) Cleanup() {
 	if s.lockedChatDir != "" {
-		ReleaseLock(s.lockedChatDir)
+		dropLock(s.lockedChatDir)
 		s.lockedChatDir = ""
 	}
 }
 
+// View returns a State bound to the active chat. The view shares the chat
+// with s, so changes through either are visible to both, but it keeps the
+// chat after s selects another one. The chat stays locked until the view's
+// Cleanup. Callers must serialize access to s and its views.
+func (s *State) View() (*State, error) {
+	if err := s.requireActiveChat(); err != nil {
+		return nil, err
+	}
+	chatDir := s.chatDirFor(s.ActiveChat.ID, s.ActiveChat.Global)
+	if err := holdLock(chatDir); err != nil {
+		return nil, err
+	}
+	return &State{ProjectRoot: s.ProjectRoot, GlobalOnly: s.GlobalOnly, ActiveChat: s.ActiveChat, lockedChatDir: chatDir}, nil
+}
+
 // Guard functions
 
 func (s *State) requireInit() error {
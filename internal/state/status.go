@@ -17,6 +17,7 @@ const (
 	StatusAdded          FileStatus = "A"  // Not in context, has output (LLM created new file)
 	StatusConflictAdded  FileStatus = "!A" // Not in context, has output, but file exists locally
 	StatusSection        FileStatus = "S"  // Section (partial file, immutable)
+	StatusImage          FileStatus = "I"  // Image (immutable, sent as image input)
 )
 
 // FileInfo represents a file with its status and content info.
@@ -34,6 +35,7 @@ type FileInfo struct {
 	OutputTokens   int        `json:"output_tokens,omitempty"`   // Tokens in output version (if M status)
 	StartLine      int        `json:"start_line,omitempty"`      // For sections: 1-indexed start line
 	EndLine        int        `json:"end_line,omitempty"`        // For sections: 1-indexed end line (inclusive)
+	MediaType      string     `json:"media_type,omitempty"`      // For images: MIME type
 }
 
 // GetFileStatuses returns status information for all files in context and output.
@@ -57,6 +59,22 @@ func (s *State) GetFileStatuses() ([]FileInfo, error) {
 
 	// Process context files
 	for _, cf := range s.ActiveChat.ContextFiles {
+		// Images carry no text content; they are never out of sync or modified.
+		if cf.IsImage() {
+			tokens := s.imageTokens(&cf)
+			files = append(files, FileInfo{
+				Path:           cf.Path,
+				Status:         StatusImage,
+				InContext:      true,
+				ReadOnly:       true,
+				External:       cf.External,
+				Tokens:         tokens,
+				OriginalTokens: tokens,
+				MediaType:      cf.MediaType,
+			})
+			continue
+		}
+
 		contextContent, _ := s.GetContextFile(cf.Path)
 
 		// Handle sections (partial files) - always read-only, no output
@@ -161,6 +179,9 @@ func (s *State) ApplyFile(path string) (string, error) {
 	if err := s.requireActiveChat(); err != nil {
 		return "", err
 	}
+	if err := s.CheckPathPolicy(PolicyWrite, path); err != nil {
+		return "", err
+	}
 
 	// Get output content
 	content, err := s.GetOutputFile(path)
@@ -185,7 +206,7 @@ func (s *State) ApplyFile(path string) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		if err := os.WriteFile(storagePath, []byte(content), 0644); err != nil {
+		if err := s.activeSnapshots().write(storagePath, []byte(content)); err != nil {
 			return "", err
 		}
 		cf.Version = HashFileVersion(cf.Path, content)
@@ -199,10 +220,7 @@ func (s *State) ApplyFile(path string) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			return "", err
-		}
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		if err := s.activeSnapshots().write(fullPath, []byte(content)); err != nil {
 			return "", err
 		}
 
@@ -258,6 +276,9 @@ func (s *State) ApplyFileAs(originalPath, destPath string) (string, error) {
 	if err := ValidateRelativePath(destPath); err != nil {
 		return "", err
 	}
+	if err := s.CheckPathPolicy(PolicyWrite, destPath); err != nil {
+		return "", err
+	}
 
 	// Add destination to context
 	contextBase := s.contextDir(s.ActiveChat.ID)
@@ -265,10 +286,7 @@ func (s *State) ApplyFileAs(originalPath, destPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		return "", err
-	}
-	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+	if err := s.activeSnapshots().write(fullPath, []byte(content)); err != nil {
 		return "", err
 	}
 
@@ -379,7 +397,7 @@ func (s *State) DiffLocalDone(path string) (*DiffLocalDoneResult, error) {
 			if err != nil {
 				return nil, err
 			}
-			if err := os.WriteFile(storagePath, []byte(localContent), 0644); err != nil {
+			if err := s.activeSnapshots().write(storagePath, []byte(localContent)); err != nil {
 				return nil, err
 			}
 			cf.Version = HashFileVersion(cf.Path, localContent)
@@ -408,10 +426,7 @@ func (s *State) DiffLocalDone(path string) (*DiffLocalDoneResult, error) {
 			if err != nil {
 				return nil, err
 			}
-			if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-				return nil, err
-			}
-			if err := os.WriteFile(fullPath, []byte(localContent), 0644); err != nil {
+			if err := s.activeSnapshots().write(fullPath, []byte(localContent)); err != nil {
 				return nil, err
 			}
 
@@ -485,7 +500,7 @@ func (s *State) SyncContextToLocal(path string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(storagePath, []byte(localContent), 0644); err != nil {
+	if err := s.activeSnapshots().write(storagePath, []byte(localContent)); err != nil {
 		return err
 	}
 	cf.Version = HashFileVersion(cf.Path, localContent)
@@ -0,0 +1,242 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Prompt templates. A template is a Markdown file in
+// ~/.config/bb7/templates/ (global) or .bb7/templates/ (project); its name is
+// the file name without the .md extension, and a project template hides a
+// global one with the same name. An optional front-matter block sets the
+// description, model, reasoning effort and diff mode used when the template is
+// sent:
+//
+//	---
+//	description: Review for concurrency bugs
+//	model: anthropic/claude-sonnet-4
+//	reasoning_effort: high
+//	diff_mode: off
+//	---
+//	Review {{file}} ({{language}}) for data races:
+//
+//	{{selection}}
+//
+// The body is parsed like an instructions file (@@ comments, @include), then
+// {{variable}} placeholders are filled in when the template is rendered.
+
+const templatesDirname = "templates"
+
+// TemplateVariables are the placeholders a template body may use. input is
+// the text typed after a /name slash command; it is appended to the rendered
+// body when the template doesn't place it itself.
+var TemplateVariables = []string{"selection", "file", "language", "clipboard", "input"}
+
+// ErrTemplateNotFound is returned for an unknown template name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Template is a prompt template found on disk.
+type Template struct {
+	Name            string   `json:"name"`
+	Source          string   `json:"source"` // "project" or "global"
+	Path            string   `json:"path"`
+	Description     string   `json:"description,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+	DiffMode        string   `json:"diff_mode,omitempty"`
+	Variables       []string `json:"variables"`       // placeholders used by the body
+	Error           string   `json:"error,omitempty"` // parse error; the template can't be rendered
+	body            string
+}
+
+// RenderedTemplate is a template filled in with variable values.
+type RenderedTemplate struct {
+	Content         string `json:"content"`
+	Model           string `json:"model,omitempty"`
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	DiffMode        string `json:"diff_mode,omitempty"`
+}
+
+type templateDir struct {
+	source string
+	dir    string
+}
+
+// templateDirs returns the template directories, lowest precedence first.
+func (s *State) templateDirs() []templateDir {
+	var dirs []templateDir
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, templateDir{"global", filepath.Join(homeDir, ".config", "bb7", templatesDirname)})
+	}
+	if s.ProjectRoot != "" && !s.GlobalOnly {
+		dirs = append(dirs, templateDir{"project", filepath.Join(s.ProjectRoot, ".bb7", templatesDirname)})
+	}
+	return dirs
+}
+
+// ListTemplates returns the available templates sorted by name. A template
+// that fails to parse is listed with Error set.
+func (s *State) ListTemplates() ([]Template, error) {
+	byName := map[string]Template{}
+	for _, d := range s.templateDirs() {
+		entries, err := os.ReadDir(d.dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+				continue
+			}
+			path := filepath.Join(d.dir, entry.Name())
+			tmpl, err := s.loadTemplate(path)
+			if err != nil {
+				tmpl = Template{Path: path, Variables: []string{}, Error: err.Error()}
+			}
+			tmpl.Name = strings.TrimSuffix(entry.Name(), ".md")
+			tmpl.Source = d.source
+			byName[tmpl.Name] = tmpl
+		}
+	}
+	result := make([]Template, 0, len(byName))
+	for _, tmpl := range byName {
+		result = append(result, tmpl)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// GetTemplate returns the template with the given name.
+func (s *State) GetTemplate(name string) (Template, error) {
+	templates, err := s.ListTemplates()
+	if err != nil {
+		return Template{}, err
+	}
+	for _, tmpl := range templates {
+		if tmpl.Name != name {
+			continue
+		}
+		if tmpl.Error != "" {
+			return Template{}, errors.New(tmpl.Error)
+		}
+		return tmpl, nil
+	}
+	return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// RenderTemplate fills in the named template. Missing variables render as
+// empty text.
+func (s *State) RenderTemplate(name string, vars map[string]string) (RenderedTemplate, error) {
+	tmpl, err := s.GetTemplate(name)
+	if err != nil {
+		return RenderedTemplate{}, err
+	}
+	content := templateVarPattern.ReplaceAllStringFunc(tmpl.body, func(match string) string {
+		return vars[templateVarPattern.FindStringSubmatch(match)[1]]
+	})
+	content = strings.TrimSpace(content)
+	if input := strings.TrimSpace(vars["input"]); input != "" && !containsString(tmpl.Variables, "input") {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += input
+	}
+	return RenderedTemplate{
+		Content:         content,
+		Model:           tmpl.Model,
+		ReasoningEffort: tmpl.ReasoningEffort,
+		DiffMode:        tmpl.DiffMode,
+	}, nil
+}
+
+// loadTemplate reads and parses a template file.
+func (s *State) loadTemplate(path string) (Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, err
+	}
+	tmpl := Template{Path: path}
+	body, bodyLine, err := parseTemplateFrontMatter(path, string(data), &tmpl)
+	if err != nil {
+		return Template{}, err
+	}
+	// Keep line numbers in parse errors relative to the file.
+	padded := strings.Repeat("\n", bodyLine-1) + body
+	parsed, err := parseInstructionsContent(path, s.ProjectRoot, []byte(padded))
+	if err != nil {
+		return Template{}, err
+	}
+	tmpl.body = parsed
+
+	tmpl.Variables = []string{}
+	for _, m := range templateVarPattern.FindAllStringSubmatch(parsed, -1) {
+		name := m[1]
+		if !containsString(TemplateVariables, name) {
+			return Template{}, &instructionsParseError{Path: path, Message: fmt.Sprintf("unknown template variable {{%s}}", name)}
+		}
+		if !containsString(tmpl.Variables, name) {
+			tmpl.Variables = append(tmpl.Variables, name)
+		}
+	}
+	return tmpl, nil
+}
+
+// parseTemplateFrontMatter reads a leading --- block of key: value lines into
+// tmpl and returns the body and the line it starts on.
+func parseTemplateFrontMatter(path, content string, tmpl *Template) (string, int, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], "\r\n") != "---" {
+		return content, 1, nil
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" {
+			return strings.Join(lines[i+1:], ""), i + 2, nil
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return "", 0, &instructionsParseError{Path: path, Line: i + 1, Message: "front-matter line must be key: value"}
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch key {
+		case "description":
+			tmpl.Description = value
+		case "model":
+			tmpl.Model = value
+		case "reasoning_effort":
+			tmpl.ReasoningEffort = value
+		case "diff_mode":
+			switch value {
+			case "search_replace", "search_replace_multi", "anchored", "off":
+			default:
+				return "", 0, &instructionsParseError{Path: path, Line: i + 1, Message: fmt.Sprintf("invalid diff_mode %q", value)}
+			}
+			tmpl.DiffMode = value
+		default:
+			return "", 0, &instructionsParseError{Path: path, Line: i + 1, Message: fmt.Sprintf("unknown front-matter key %q", key)}
+		}
+	}
+	return "", 0, &instructionsParseError{Path: path, Line: 1, Message: "front-matter is not closed with ---"}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestListTemplatesProjectOverridesGlobal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	s := setupTestState(t)
+	globalDir := filepath.Join(home, ".config", "bb7", "templates")
+	projectDir := filepath.Join(s.ProjectRoot, ".bb7", "templates")
+
+	writeTemplate(t, globalDir, "review", "Global review")
+	writeTemplate(t, globalDir, "tests", "---\ndescription: Table tests\n---\nWrite table tests for {{file}}")
+	writeTemplate(t, projectDir, "review", "Project review of {{selection}}")
+	writeTemplate(t, projectDir, "broken", "Uses {{unknown}}")
+
+	templates, err := s.ListTemplates()
+	if err != nil {
+		t.Fatalf("ListTemplates failed: %v", err)
+	}
+	if len(templates) != 3 {
+		t.Fatalf("expected 3 templates, got %+v", templates)
+	}
+	byName := map[string]Template{}
+	for _, tmpl := range templates {
+		byName[tmpl.Name] = tmpl
+	}
+	if byName["review"].Source != "project" {
+		t.Errorf("project template should hide the global one: %+v", byName["review"])
+	}
+	if tests := byName["tests"]; tests.Source != "global" || tests.Description != "Table tests" || len(tests.Variables) != 1 || tests.Variables[0] != "file" {
+		t.Errorf("unexpected global template: %+v", tests)
+	}
+	if !strings.Contains(byName["broken"].Error, "unknown template variable") {
+		t.Errorf("expected parse error for broken template, got %+v", byName["broken"])
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	s := setupTestState(t)
+	projectDir := filepath.Join(s.ProjectRoot, ".bb7", "templates")
+	if err := os.WriteFile(filepath.Join(s.ProjectRoot, "STYLE.md"), []byte("Use tabs.\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	writeTemplate(t, projectDir, "review", strings.Join([]string{
+		"---",
+		"model: test/reviewer",
+		"reasoning_effort: high",
+		"diff_mode: off",
+		"---",
+		"@@ not sent",
+		"Review {{file}} ({{ language }}) for races:",
+		"{{selection}}",
+		"@include STYLE.md",
+		"",
+	}, "\n"))
+
+	rendered, err := s.RenderTemplate("review", map[string]string{
+		"file":      "main.go",
+		"language":  "go",
+		"selection": "go f()",
+		"input":     "Focus on the channel.",
+	})
+	if err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	want := "Review main.go (go) for races:\ngo f()\nUse tabs.\n\nFocus on the channel."
+	if rendered.Content != want {
+		t.Errorf("content = %q, want %q", rendered.Content, want)
+	}
+	if rendered.Model != "test/reviewer" || rendered.ReasoningEffort != "high" || rendered.DiffMode != "off" {
+		t.Errorf("front-matter not applied: %+v", rendered)
+	}
+
+	if _, err := s.RenderTemplate("missing", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("missing template error = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestTemplateFrontMatterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unclosed", "---\nmodel: x\n", "not closed"},
+		{"unknown key", "---\ncolor: red\n---\nbody", "unknown front-matter key"},
+		{"bad diff mode", "---\ndiff_mode: patch\n---\nbody", "invalid diff_mode"},
+		{"not key value", "---\nmodel\n---\nbody", "key: value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmpl Template
+			_, _, err := parseTemplateFrontMatter("t.md", tt.content, &tmpl)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Trash and archive. ChatDelete moves a chat directory to .bb7/trash/
+// (~/.bb7/trash/ for global chats) with a trashed.json recording when;
+// ChatRestore moves it back and PurgeTrash removes what has been in the
+// trash longer than the retention period. Archived chats stay where they
+// are and in the search index, but ChatList leaves them out.
+
+const trashInfoFile = "trashed.json"
+
+var (
+	ErrChatExists  = errors.New("a chat with this ID already exists")
+	ErrEmptyFilter = errors.New("filter matches every chat: give an age, a name pattern, or empty")
+)
+
+// TrashedChat describes a chat in the trash.
+type TrashedChat struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Trashed time.Time `json:"trashed"`
+	Global  bool      `json:"global,omitempty"`
+}
+
+type trashInfo struct {
+	Trashed time.Time `json:"trashed"`
+}
+
+// trashDirFor returns the trash directory next to the project or global
+// chats directory.
+func (s *State) trashDirFor(global bool) string {
+	return filepath.Join(filepath.Dir(s.chatsDirFor(global)), "trash")
+}
+
+// trashChatDir moves a chat directory into trashDir. The caller has
+// released or checked its lock and updates the chat index.
+func trashChatDir(chatDir, trashDir string) error {
+	if err := os.MkdirAll(trashDir, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(trashDir, filepath.Base(chatDir))
+	// A chat deleted before, restored, and deleted again.
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := moveDir(chatDir, dst); err != nil {
+		return err
+	}
+	os.Remove(lockFilePath(dst))
+	data, err := json.Marshal(trashInfo{Trashed: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	// Without the record the directory's modification time is used.
+	writeFileAtomic(filepath.Join(dst, trashInfoFile), data, 0644)
+	return nil
+}
+
+// trashedAt returns when a trashed chat directory was deleted.
+func trashedAt(dir string) time.Time {
+	if data, err := os.ReadFile(filepath.Join(dir, trashInfoFile)); err == nil {
+		var info trashInfo
+		if json.Unmarshal(data, &info) == nil && !info.Trashed.IsZero() {
+			return info.Trashed
+		}
+	}
+	if fi, err := os.Stat(dir); err == nil {
+		return fi.ModTime()
+	}
+	return time.Time{}
+}
+
+// TrashList returns the chats in the project trash, or the global trash,
+// most recently deleted first.
+func (s *State) TrashList(global bool) ([]TrashedChat, error) {
+	if !global {
+		if err := s.requireInit(); err != nil {
+			return nil, err
+		}
+	}
+	trashDir := s.trashDirFor(global)
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrashedChat{}, nil
+		}
+		return nil, err
+	}
+	chats := []TrashedChat{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(trashDir, entry.Name())
+		summary, err := loadChatSummaryFrom(filepath.Join(dir, "chat.json"))
+		if err != nil {
+			continue
+		}
+		chats = append(chats, TrashedChat{
+			ID:      entry.Name(),
+			Name:    summary.Name,
+			Created: summary.Created,
+			Trashed: trashedAt(dir),
+			Global:  global,
+		})
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].Trashed.After(chats[j].Trashed)
+	})
+	return chats, nil
+}
+
+// ChatRestore moves a chat out of the trash.
+func (s *State) ChatRestore(id string, global bool) error {
+	if global {
+		if err := s.ensureGlobalChatsDir(); err != nil {
+			return err
+		}
+	} else if err := s.requireInit(); err != nil {
+		return err
+	}
+	trashed, err := SafeJoin(s.trashDirFor(global), id)
+	if err != nil {
+		return ErrChatNotFound
+	}
+	if _, err := os.Stat(filepath.Join(trashed, "chat.json")); err != nil {
+		return ErrChatNotFound
+	}
+	chatsDir := s.chatsDirFor(global)
+	chatDir := filepath.Join(chatsDir, id)
+	if _, err := os.Stat(chatDir); err == nil {
+		return ErrChatExists
+	}
+
+	if err := moveDir(trashed, chatDir); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(chatDir, trashInfoFile))
+
+	chat, err := loadChatFrom(filepath.Join(chatDir, "chat.json"))
+	if err != nil {
+		return err
+	}
+	// Indexes are caches; do not fail the restore if they can't be updated.
+	updateChatIndexEntryAt(chatsDir, chat)
+	updateSearchIndexAt(chatsDir, chat)
+	return nil
+}
+
+// PurgeTrash permanently removes chats that have been in the trash for at
+// least retention (everything when it is zero) and returns their IDs.
+func (s *State) PurgeTrash(global bool, retention time.Duration) ([]string, error) {
+	if !global {
+		if err := s.requireInit(); err != nil {
+			return nil, err
+		}
+	}
+	trashDir := s.trashDirFor(global)
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cutoff := time.Now().Add(-retention)
+	var purged []string
+	for _, entry := range entries {
+		dir := filepath.Join(trashDir, entry.Name())
+		if !entry.IsDir() || trashedAt(dir).After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return purged, err
+		}
+		purged = append(purged, entry.Name())
+	}
+	return purged, nil
+}
+
+// ChatArchive sets whether a chat is archived.
+func (s *State) ChatArchive(id string, global, archived bool) error {
+	_, err := s.updateChat(id, global, func(chat *Chat) bool {
+		if chat.Archived == archived {
+			return false
+		}
+		chat.Archived = archived
+		return true
+	})
+	return err
+}
+
+// ChatListArchived returns summaries of the archived project chats, or the
+// archived global chats, sorted by creation time (newest first).
+func (s *State) ChatListArchived(global bool) ([]ChatSummary, error) {
+	if global {
+		if err := s.ensureGlobalChatsDir(); err != nil {
+			return nil, err
+		}
+	} else if err := s.requireInit(); err != nil {
+		return nil, err
+	}
+
+	idx, err := ensureChatIndexAt(s.chatsDirFor(global))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ChatSummary{}, nil
+		}
+		return nil, err
+	}
+	chats := filterArchived(idx.Chats, true)
+	for i := range chats {
+		chats[i].Global = global
+		chats[i].Locked = IsLocked(s.chatDirFor(chats[i].ID, global))
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].Created.After(chats[j].Created)
+	})
+	return chats, nil
+}
+
+// filterArchived returns the chats whose archived flag equals archived.
+func filterArchived(chats []ChatSummary, archived bool) []ChatSummary {
+	filtered := make([]ChatSummary, 0, len(chats))
+	for _, chat := range chats {
+		if chat.Archived == archived {
+			filtered = append(filtered, chat)
+		}
+	}
+	return filtered
+}
+
+// ChatFilter selects chats for bulk operations. All set criteria must
+// match.
+type ChatFilter struct {
+	OlderThan time.Duration // No message (or creation) for at least this long
+	Name      string        // Glob matched against the name, ignoring case
+	Empty     bool          // No user messages
+	Archived  bool          // Match archived chats instead of listed ones
+}
+
+// MatchChats returns the project or global chats a filter selects, newest
+// first. A filter without criteria is rejected rather than matching
+// everything.
+func (s *State) MatchChats(global bool, f ChatFilter) ([]ChatSummary, error) {
+	if f.OlderThan <= 0 && f.Name == "" && !f.Empty {
+		return nil, ErrEmptyFilter
+	}
+	pattern := strings.ToLower(f.Name)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var chats []ChatSummary
+	var err error
+	if f.Archived {
+		chats, err = s.ChatListArchived(global)
+	} else if global {
+		chats, err = s.ChatListGlobal()
+	} else {
+		chats, err = s.ChatList()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-f.OlderThan)
+	matched := []ChatSummary{}
+	for _, summary := range chats {
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, strings.ToLower(summary.Name)); !ok {
+				continue
+			}
+		}
+		if f.OlderThan > 0 && summary.LastActivity.After(cutoff) {
+			continue
+		}
+		if f.Empty {
+			chat, err := loadChatFrom(filepath.Join(s.chatDirFor(summary.ID, global), "chat.json"))
+			if err != nil || hasUserMessage(chat) {
+				continue
+			}
+		}
+		summary.Global = global
+		matched = append(matched, summary)
+	}
+	return matched, nil
+}
+
+// hasUserMessage reports whether a chat has been sent anything.
+func hasUserMessage(chat *Chat) bool {
+	for _, msg := range chat.Messages {
+		if msg.Role == "user" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatDeleteMovesToTrash(t *testing.T) {
+	s := setupTestState(t)
+	chat, err := s.ChatNew("doomed", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.AddUserMessage("findme", "m"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	if err := s.ChatDelete(chat.ID); err != nil {
+		t.Fatalf("ChatDelete failed: %v", err)
+	}
+	if chats, _ := s.ChatList(); len(chats) != 0 {
+		t.Errorf("deleted chat still listed: %+v", chats)
+	}
+	if results, _ := s.Search("findme", SearchProject); len(results) != 0 {
+		t.Errorf("deleted chat still searchable: %+v", results)
+	}
+
+	trashed, err := s.TrashList(false)
+	if err != nil || len(trashed) != 1 || trashed[0].ID != chat.ID || trashed[0].Name != "doomed" {
+		t.Fatalf("TrashList = %+v, %v", trashed, err)
+	}
+	if time.Since(trashed[0].Trashed) > time.Minute {
+		t.Errorf("trashed time = %v", trashed[0].Trashed)
+	}
+
+	if err := s.ChatRestore(chat.ID, false); err != nil {
+		t.Fatalf("ChatRestore failed: %v", err)
+	}
+	if chats, _ := s.ChatList(); len(chats) != 1 || chats[0].ID != chat.ID {
+		t.Errorf("restored chat not listed: %+v", chats)
+	}
+	if results, _ := s.Search("findme", SearchProject); len(results) != 1 {
+		t.Errorf("restored chat not searchable: %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(s.chatDir(chat.ID), trashInfoFile)); !os.IsNotExist(err) {
+		t.Errorf("trash record left in restored chat: %v", err)
+	}
+	if err := s.ChatRestore(chat.ID, false); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("second restore err = %v, want ErrChatNotFound", err)
+	}
+	if err := s.ChatRestore("../chats", false); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("restore outside the trash err = %v, want ErrChatNotFound", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := setupTestState(t)
+	var ids []string
+	for _, name := range []string{"old", "new"} {
+		chat, err := s.ChatNew(name, "")
+		if err != nil {
+			t.Fatalf("ChatNew failed: %v", err)
+		}
+		if err := s.ChatDelete(chat.ID); err != nil {
+			t.Fatalf("ChatDelete failed: %v", err)
+		}
+		ids = append(ids, chat.ID)
+	}
+	data, _ := json.Marshal(trashInfo{Trashed: time.Now().Add(-40 * 24 * time.Hour)})
+	os.WriteFile(filepath.Join(s.trashDirFor(false), ids[0], trashInfoFile), data, 0644)
+
+	purged, err := s.PurgeTrash(false, 30*24*time.Hour)
+	if err != nil || len(purged) != 1 || purged[0] != ids[0] {
+		t.Fatalf("PurgeTrash = %v, %v; want only the old chat", purged, err)
+	}
+	if trashed, _ := s.TrashList(false); len(trashed) != 1 || trashed[0].ID != ids[1] {
+		t.Errorf("trash after purge = %+v", trashed)
+	}
+	if purged, _ := s.PurgeTrash(false, 0); len(purged) != 1 {
+		t.Errorf("emptying the trash purged %v", purged)
+	}
+}
+
+func TestChatArchive(t *testing.T) {
+	s := setupTestState(t)
+	kept, err := s.ChatNew("kept", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	archived, err := s.ChatNew("archived", "")
+	if err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	if err := s.AddUserMessage("needle", "m"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	if _, err := s.ChatSelect(kept.ID); err != nil {
+		t.Fatalf("ChatSelect failed: %v", err)
+	}
+
+	if err := s.ChatArchive(archived.ID, false, true); err != nil {
+		t.Fatalf("ChatArchive failed: %v", err)
+	}
+	if chats, _ := s.ChatList(); len(chats) != 1 || chats[0].ID != kept.ID {
+		t.Errorf("ChatList = %+v, want the archived chat hidden", chats)
+	}
+	if chats, _ := s.ChatListArchived(false); len(chats) != 1 || chats[0].ID != archived.ID || !chats[0].Archived {
+		t.Errorf("ChatListArchived = %+v", chats)
+	}
+	if results, _ := s.Search("needle", SearchProject); len(results) != 1 || results[0].ID != archived.ID {
+		t.Errorf("archived chat not searchable: %+v", results)
+	}
+	if issues, _ := s.Fsck(false); len(issues) != 0 {
+		t.Errorf("Fsck after archiving = %+v", issues)
+	}
+
+	// Archiving the active chat keeps it open.
+	if err := s.ChatArchive(kept.ID, false, true); err != nil {
+		t.Fatalf("ChatArchive(active) failed: %v", err)
+	}
+	if s.ActiveChat == nil || !s.ActiveChat.Archived {
+		t.Errorf("active chat = %+v", s.ActiveChat)
+	}
+	if err := s.ChatArchive(archived.ID, false, false); err != nil {
+		t.Fatalf("unarchive failed: %v", err)
+	}
+	if chats, _ := s.ChatList(); len(chats) != 1 || chats[0].ID != archived.ID {
+		t.Errorf("ChatList after unarchive = %+v", chats)
+	}
+}
+
+func TestMatchChats(t *testing.T) {
+	s := setupTestState(t)
+	newChat := func(name string, message bool) *Chat {
+		t.Helper()
+		chat, err := s.ChatNew(name, "")
+		if err != nil {
+			t.Fatalf("ChatNew failed: %v", err)
+		}
+		if message {
+			if err := s.AddUserMessage("hi", "m"); err != nil {
+				t.Fatalf("AddUserMessage failed: %v", err)
+			}
+		}
+		return chat
+	}
+	stale := newChat("Scratch 1", true)
+	stale.Created = time.Now().Add(-60 * 24 * time.Hour)
+	stale.Messages[len(stale.Messages)-1].Timestamp = stale.Created
+	if err := s.saveChat(stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.updateChatIndexEntry(stale); err != nil {
+		t.Fatal(err)
+	}
+	empty := newChat("Scratch 2", false)
+	newChat("Design notes", true)
+
+	ids := func(chats []ChatSummary) string {
+		var out []string
+		for _, chat := range chats {
+			out = append(out, chat.ID)
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	for _, tc := range []struct {
+		name   string
+		filter ChatFilter
+		want   []string
+	}{
+		{"by age", ChatFilter{OlderThan: 30 * 24 * time.Hour}, []string{stale.ID}},
+		{"by name", ChatFilter{Name: "scratch*"}, []string{empty.ID, stale.ID}},
+		{"empty", ChatFilter{Empty: true}, []string{empty.ID}},
+		{"combined", ChatFilter{Name: "scratch*", Empty: true}, []string{empty.ID}},
+	} {
+		got, err := s.MatchChats(false, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: MatchChats failed: %v", tc.name, err)
+		}
+		sort.Strings(tc.want)
+		if got, want := ids(got), strings.Join(tc.want, ","); got != want {
+			t.Errorf("%s: matched %s, want %s", tc.name, got, want)
+		}
+	}
+
+	if _, err := s.MatchChats(false, ChatFilter{}); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("empty filter err = %v, want ErrEmptyFilter", err)
+	}
+	if _, err := s.MatchChats(false, ChatFilter{Name: "["}); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
+
+func TestGlobalTrashRestore(t *testing.T) {
+	s := setupGlobalTestState(t)
+	chat, err := s.ChatNewGlobal("global", "")
+	if err != nil {
+		t.Fatalf("ChatNewGlobal failed: %v", err)
+	}
+	if err := s.ChatDeleteGlobal(chat.ID); err != nil {
+		t.Fatalf("ChatDeleteGlobal failed: %v", err)
+	}
+	trashed, err := s.TrashList(true)
+	if err != nil || len(trashed) != 1 || !trashed[0].Global {
+		t.Fatalf("TrashList(global) = %+v, %v", trashed, err)
+	}
+	if err := s.ChatRestore(chat.ID, true); err != nil {
+		t.Fatalf("ChatRestore failed: %v", err)
+	}
+	if chats, _ := s.ChatListGlobal(); len(chats) != 1 || chats[0].ID != chat.ID {
+		t.Errorf("restored global chat not listed: %+v", chats)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/youruser/bb7/internal/llm"
 )
 
 // PartType identifies the kind of a MessagePart.
@@ -17,6 +19,7 @@ const (
 	PartTypeThinking     PartType = "thinking"
 	PartTypeContextEvent PartType = "context_event"
 	PartTypeFile         PartType = "file"
+	PartTypeFinding      PartType = "finding"
 )
 
 // ContextAction identifies the action recorded in a context_event part.
@@ -36,6 +39,7 @@ const (
 	ActionAssistantWriteFile  ContextAction = "AssistantWriteFile"
 	ActionForkWarningModified ContextAction = "ForkWarningModified"
 	ActionForkWarningDeleted  ContextAction = "ForkWarningDeleted"
+	ActionForkWarningMissing  ContextAction = "ForkWarningMissing"
 )
 
 // MessagePart represents a structured piece of message content.
@@ -53,6 +57,8 @@ type MessagePart struct {
 	OriginalPath string        `json:"original_path,omitempty"` // for "context_event" type: original path when saved elsewhere
 	StartLine    int           `json:"start_line,omitempty"`    // for "context_event" type: section start line
 	EndLine      int           `json:"end_line,omitempty"`      // for "context_event" type: section end line
+	MediaType    string        `json:"media_type,omitempty"`    // for "context_event" type: image MIME type
+	Finding      *Finding      `json:"finding,omitempty"`       // for "finding" type
 }
 
 // MessageUsage contains token counts and cost for a message.
@@ -74,7 +80,10 @@ type Message struct {
 	OutputFiles     []string         `json:"output_files,omitempty"`     // assistant only
 	Usage           *MessageUsage    `json:"usage,omitempty"`            // token usage and cost (assistant only)
 	ReasoningEffort string           `json:"reasoning_effort,omitempty"` // "low", "medium", "high" (assistant only)
+	Persona         string           `json:"persona,omitempty"`          // persona that produced the reply (assistant only)
+	FinishReason    string           `json:"finish_reason,omitempty"`    // why the reply ended, e.g. "length" (assistant only)
 	ContextSnapshot []ContextFileRef `json:"context_snapshot,omitempty"` // context state at send time (user messages only)
+	Alternates      []Message        `json:"alternates,omitempty"`       // earlier replies replaced by regenerate (user messages only)
 }
 
 // UnmarshalJSON handles backward compatibility with the legacy Content field.
@@ -124,6 +133,14 @@ func MessageText(m Message) string {
 				b.WriteString("\n")
 			}
 			b.WriteString(formatted)
+		case PartTypeFinding:
+			if part.Finding == nil {
+				continue
+			}
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(FormatFinding(*part.Finding))
 		}
 	}
 
@@ -178,6 +195,7 @@ type ContextFileRef struct {
 	FileID    string `json:"file_id"`
 	StartLine int    `json:"start_line,omitempty"` // 1-indexed start line for sections, 0 = full file
 	EndLine   int    `json:"end_line,omitempty"`   // 1-indexed inclusive end line for sections, 0 = full file
+	MediaType string `json:"media_type,omitempty"` // MIME type for image entries, empty for text files
 }
 
 // ContextFile represents a file in the chat's context.
@@ -188,6 +206,7 @@ type ContextFile struct {
 	Version   string `json:"version,omitempty"`    // Hash of context snapshot content
 	StartLine int    `json:"start_line,omitempty"` // 1-indexed start line for sections, 0 = full file
 	EndLine   int    `json:"end_line,omitempty"`   // 1-indexed inclusive end line for sections, 0 = full file
+	MediaType string `json:"media_type,omitempty"` // MIME type for image entries, empty for text files
 }
 
 // Chat represents a single chat session with its messages and context.
@@ -198,26 +217,58 @@ type Chat struct {
 	Created         time.Time     `json:"created"`
 	Model           string        `json:"model"`
 	ReasoningEffort string        `json:"reasoning_effort,omitempty"`
-	Global          bool          `json:"-"` // Runtime-only: true when loaded via a Global function (not persisted)
-	Draft           string        `json:"draft,omitempty"`  // Unsent message draft
+	Persona         string        `json:"persona,omitempty"`    // Selected persona (see config.Persona)
+	Generation      *llm.GenerationParams `json:"generation,omitempty"` // Output limit and sampling overrides
+	Global          bool          `json:"-"`                    // Runtime-only: true when loaded via a Global function (not persisted)
+	Draft           string        `json:"draft,omitempty"`      // Unsent message draft
+	ParentID        string        `json:"parent_id,omitempty"`  // Chat this one was forked from
+	ForkIndex       int           `json:"fork_index,omitempty"` // Messages shared with the parent (valid when ParentID is set)
+	Archived        bool          `json:"archived,omitempty"`   // Hidden from ChatList, still searchable
+	Pinned          bool          `json:"pinned,omitempty"`     // Listed before unpinned chats
+	Tags            []string      `json:"tags,omitempty"`       // Sorted, lowercase (see organize.go)
+	Folder          string        `json:"folder,omitempty"`     // Slash-separated folder path, empty for none
 	ContextFiles    []ContextFile `json:"context_files"`
+	Snapshots       map[string]string `json:"snapshots,omitempty"` // Context snapshot path -> object hash (see objects.go)
 	Messages        []Message     `json:"messages"`
 }
 
 // ChatSummary is a lightweight representation for listing chats.
 type ChatSummary struct {
-	ID      string    `json:"id"`
-	Name    string    `json:"name"`
-	Created time.Time `json:"created"`
-	Global  bool      `json:"-"` // Runtime-only: true when listed via ChatListGlobal (not persisted)
-	Locked  bool      `json:"locked,omitempty"` // If true, chat is locked by another process
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Created   time.Time `json:"created"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	ForkIndex int       `json:"fork_index,omitempty"`
+	Archived  bool      `json:"archived,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Folder    string    `json:"folder,omitempty"`
+	LastActivity time.Time `json:"last_activity"`       // Last message, or creation
+	MessageCount int       `json:"message_count"`       // User and assistant messages
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`     // Summed over the replies, like the fields below
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	CacheHitRatio    float64 `json:"cache_hit_ratio,omitempty"` // CachedTokens / PromptTokens
+	Cost      float64   `json:"cost,omitempty"`
+	Global    bool      `json:"-"`                // Runtime-only: true when listed via ChatListGlobal (not persisted)
+	Locked    bool      `json:"locked,omitempty"` // If true, chat is locked by another process
 }
 
 // ChatSearchResult represents a chat that matched a search query.
 type ChatSearchResult struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Created   time.Time `json:"created"`
-	MatchType string    `json:"match_type"`          // "title" or "content"
-	Excerpt   string    `json:"excerpt,omitempty"`   // For content matches, snippet with context
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Created   time.Time       `json:"created"`
+	MatchType string          `json:"match_type"`         // "title" or "content"
+	Excerpt   string          `json:"excerpt,omitempty"`  // First excerpt text, for simple displays
+	Excerpts  []SearchExcerpt `json:"excerpts,omitempty"` // Snippets around matches
+	Score     float64         `json:"score,omitempty"`    // BM25 relevance; zero for listings
+	Global    bool            `json:"global,omitempty"`
+}
+
+// SearchExcerpt is a snippet of chat text around a search match.
+// Highlights are [start, end) byte offsets into Text.
+type SearchExcerpt struct {
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights,omitempty"`
 }
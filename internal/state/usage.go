@@ -0,0 +1,55 @@
+package state
+
+import "time"
+
+// UsageTotals sums the usage of a set of chats.
+type UsageTotals struct {
+	Chats            int       `json:"chats"`
+	Messages         int       `json:"messages"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CachedTokens     int       `json:"cached_tokens"`
+	CacheHitRatio    float64   `json:"cache_hit_ratio"`
+	Cost             float64   `json:"cost"`
+	LastActivity     time.Time `json:"last_activity"`
+}
+
+// cacheHitRatio returns the share of prompt tokens served from the cache.
+func cacheHitRatio(cached, prompt int) float64 {
+	if prompt <= 0 {
+		return 0
+	}
+	return float64(cached) / float64(prompt)
+}
+
+// ProjectUsage totals the usage of every project chat, or every global
+// chat, archived ones included, from the index. Chats in the trash are
+// not counted.
+func (s *State) ProjectUsage(global bool) (UsageTotals, error) {
+	if global {
+		if err := s.ensureGlobalChatsDir(); err != nil {
+			return UsageTotals{}, err
+		}
+	} else if err := s.requireInit(); err != nil {
+		return UsageTotals{}, err
+	}
+
+	idx, err := ensureChatIndexAt(s.chatsDirFor(global))
+	if err != nil {
+		return UsageTotals{}, err
+	}
+	var totals UsageTotals
+	for _, chat := range idx.Chats {
+		totals.Chats++
+		totals.Messages += chat.MessageCount
+		totals.PromptTokens += chat.PromptTokens
+		totals.CompletionTokens += chat.CompletionTokens
+		totals.CachedTokens += chat.CachedTokens
+		totals.Cost += chat.Cost
+		if chat.LastActivity.After(totals.LastActivity) {
+			totals.LastActivity = chat.LastActivity
+		}
+	}
+	totals.CacheHitRatio = cacheHitRatio(totals.CachedTokens, totals.PromptTokens)
+	return totals, nil
+}
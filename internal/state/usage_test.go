@@ -0,0 +1,57 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectUsage(t *testing.T) {
+	s := setupTestState(t)
+	add := func(name string, usages ...MessageUsage) {
+		t.Helper()
+		if _, err := s.ChatNew(name, ""); err != nil {
+			t.Fatalf("ChatNew failed: %v", err)
+		}
+		for i := range usages {
+			if err := s.AddUserMessage("q", "m"); err != nil {
+				t.Fatalf("AddUserMessage failed: %v", err)
+			}
+			if err := s.AddAssistantMessage([]MessagePart{{Type: "text", Content: "a"}}, nil, "m", &usages[i]); err != nil {
+				t.Fatalf("AddAssistantMessage failed: %v", err)
+			}
+		}
+	}
+	add("cheap", MessageUsage{PromptTokens: 100, CompletionTokens: 10, Cost: 0.01})
+	add("expensive",
+		MessageUsage{PromptTokens: 1000, CompletionTokens: 200, CachedTokens: 0, Cost: 0.5},
+		MessageUsage{PromptTokens: 1000, CompletionTokens: 100, CachedTokens: 900, Cost: 0.25})
+	add("empty")
+	if err := s.ChatArchive(s.ActiveChat.ID, false, true); err != nil {
+		t.Fatalf("ChatArchive failed: %v", err)
+	}
+
+	chats, err := s.ChatListFiltered(false, ChatListOptions{Sort: "cost"})
+	if err != nil || len(chats) != 2 {
+		t.Fatalf("ChatListFiltered = %+v, %v", chats, err)
+	}
+	top := chats[0]
+	if top.Name != "expensive" || top.MessageCount != 4 || top.PromptTokens != 2000 || top.CompletionTokens != 300 ||
+		top.CachedTokens != 900 || top.CacheHitRatio != 0.45 || top.Cost != 0.75 {
+		t.Errorf("expensive chat summary = %+v", top)
+	}
+	if time.Since(top.LastActivity) > time.Minute {
+		t.Errorf("last activity = %v", top.LastActivity)
+	}
+
+	totals, err := s.ProjectUsage(false)
+	if err != nil {
+		t.Fatalf("ProjectUsage failed: %v", err)
+	}
+	if totals.Chats != 3 || totals.Messages != 6 || totals.PromptTokens != 2100 || totals.CompletionTokens != 310 ||
+		totals.CachedTokens != 900 || totals.Cost != 0.76 {
+		t.Errorf("ProjectUsage = %+v", totals)
+	}
+	if issues, _ := s.Fsck(false); len(issues) != 0 {
+		t.Errorf("Fsck = %+v", issues)
+	}
+}
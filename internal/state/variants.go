@@ -0,0 +1,174 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Response variants. Regenerating the last reply keeps the replaced reply as
+// an alternate on the user message it answered, together with the output
+// files it wrote, and restores the output files to their state before the
+// reply. Selecting an alternate swaps it back in the same way.
+
+var (
+	ErrNoReplyToRegenerate = errors.New("the chat does not end with a user message and its reply")
+	ErrContextChangedSince = errors.New("the context changed after the last reply; edit the message instead")
+	ErrVariantNotFound     = errors.New("variant not found")
+)
+
+// variantKey names the directory holding a reply's files while it is an
+// alternate.
+func variantKey(msg Message) string {
+	return strconv.FormatInt(msg.Timestamp.UnixNano(), 10)
+}
+
+// lastExchange returns the index of the active chat's last user message and
+// of the reply after it (-1 when there is none). Only system messages may
+// follow besides the reply; a context event means the user acted on the
+// reply, which regenerating would undo.
+func (s *State) lastExchange() (int, int, error) {
+	msgs := s.ActiveChat.Messages
+	user := -1
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			user = i
+			break
+		}
+	}
+	if user < 0 {
+		return -1, -1, ErrNoReplyToRegenerate
+	}
+	reply := -1
+	for i := user + 1; i < len(msgs); i++ {
+		switch {
+		case msgs[i].Role == "system":
+			// Errors from the previous attempt
+		case msgs[i].Role == "assistant" && msgs[i].Model != "" && reply < 0:
+			reply = i
+		default:
+			return -1, -1, ErrContextChangedSince
+		}
+	}
+	return user, reply, nil
+}
+
+// stashReply saves the output files reply wrote as a variant and restores
+// the output files it replaced.
+func (s *State) stashReply(reply Message) error {
+	chatID := s.ActiveChat.ID
+	variantBase := filepath.Join(s.variantsDir(chatID), variantKey(reply))
+	priorBase := s.priorOutputDir(chatID)
+	for _, path := range reply.OutputFiles {
+		content, err := s.GetOutputFile(path)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeUnder(variantBase, path, content); err != nil {
+			return err
+		}
+		priorPath, err := SafeJoin(priorBase, path)
+		if err != nil {
+			return err
+		}
+		prior, err := os.ReadFile(priorPath)
+		switch {
+		case err == nil:
+			err = s.WriteOutputFile(path, string(prior))
+		case os.IsNotExist(err):
+			err = s.DeleteOutputFile(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(priorBase)
+}
+
+// RegenerateLast prepares the active chat for answering its last user
+// message again. The reply, if any, becomes an alternate of the message and
+// is removed along with any errors after it; the message and its context
+// snapshot stay. A non-empty model replaces the model recorded on the
+// message. It returns the message text to send again.
+func (s *State) RegenerateLast(model string) (string, error) {
+	if err := s.requireActiveChat(); err != nil {
+		return "", err
+	}
+	user, reply, err := s.lastExchange()
+	if err != nil {
+		return "", err
+	}
+	msgs := s.ActiveChat.Messages
+	if reply >= 0 {
+		if err := s.stashReply(msgs[reply]); err != nil {
+			return "", err
+		}
+		msgs[user].Alternates = append(msgs[user].Alternates, msgs[reply])
+	}
+	if model != "" {
+		msgs[user].Model = model
+	}
+	s.ActiveChat.Messages = msgs[:user+1]
+	return MessageText(msgs[user]), s.SaveActiveChat()
+}
+
+// SelectVariant makes alternate variant of the user message at msgIndex its
+// reply again. The message must be the chat's last user message; its
+// current reply becomes an alternate in turn.
+func (s *State) SelectVariant(msgIndex, variant int) error {
+	if err := s.requireActiveChat(); err != nil {
+		return err
+	}
+	user, reply, err := s.lastExchange()
+	if err != nil {
+		return err
+	}
+	if msgIndex != user {
+		return errors.New("only the last message's replies can be switched")
+	}
+	msgs := s.ActiveChat.Messages
+	alternates := msgs[user].Alternates
+	if variant < 0 || variant >= len(alternates) {
+		return ErrVariantNotFound
+	}
+	chosen := alternates[variant]
+
+	// Read the chosen reply's files before its directory can be reused.
+	variantBase := filepath.Join(s.variantsDir(s.ActiveChat.ID), variantKey(chosen))
+	files := make(map[string]string)
+	for _, path := range chosen.OutputFiles {
+		fullPath, err := SafeJoin(variantBase, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(fullPath)
+		if os.IsNotExist(err) {
+			continue // was not in output when the reply was replaced
+		}
+		if err != nil {
+			return err
+		}
+		files[path] = string(data)
+	}
+
+	rest := append(append([]Message(nil), alternates[:variant]...), alternates[variant+1:]...)
+	if reply >= 0 {
+		if err := s.stashReply(msgs[reply]); err != nil {
+			return err
+		}
+		rest = append(rest, msgs[reply])
+	}
+	if err := s.CommitOutputFiles(files); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(variantBase); err != nil {
+		return err
+	}
+	msgs[user].Alternates = rest
+	s.ActiveChat.Messages = append(msgs[:user+1], chosen)
+	return s.SaveActiveChat()
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegenerateAndSelectVariant(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := setupTestState(t)
+	if _, err := s.ChatNew("test", ""); err != nil {
+		t.Fatalf("ChatNew failed: %v", err)
+	}
+	reply := func(model string, files map[string]string) {
+		t.Helper()
+		if err := s.CommitOutputFiles(files); err != nil {
+			t.Fatalf("CommitOutputFiles failed: %v", err)
+		}
+		var paths []string
+		for path := range files {
+			paths = append(paths, path)
+		}
+		if err := s.AddAssistantMessage([]MessagePart{{Type: PartTypeText, Content: "reply from " + model}}, paths, model, nil); err != nil {
+			t.Fatalf("AddAssistantMessage failed: %v", err)
+		}
+	}
+	output := func(path string) string {
+		t.Helper()
+		content, err := s.GetOutputFile(path)
+		if errors.Is(err, ErrFileNotFound) {
+			return "<none>"
+		}
+		if err != nil {
+			t.Fatalf("GetOutputFile(%s) failed: %v", path, err)
+		}
+		return content
+	}
+
+	if err := s.AddUserMessage("write a.go", "m1"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	reply("m1", map[string]string{"a.go": "v1"})
+	if err := s.AddUserMessage("change a.go, add b.go", "m1"); err != nil {
+		t.Fatalf("AddUserMessage failed: %v", err)
+	}
+	if err := s.AddSystemMessage("Request timed out."); err != nil {
+		t.Fatalf("AddSystemMessage failed: %v", err)
+	}
+	reply("m1", map[string]string{"a.go": "v2", "b.go": "new"})
+
+	content, err := s.RegenerateLast("m2")
+	if err != nil {
+		t.Fatalf("RegenerateLast failed: %v", err)
+	}
+	if content != "change a.go, add b.go" {
+		t.Errorf("content = %q", content)
+	}
+	msgs := s.ActiveChat.Messages
+	last := msgs[len(msgs)-1]
+	if last.Role != "user" || last.Model != "m2" || len(last.Alternates) != 1 || last.Alternates[0].Model != "m1" {
+		t.Fatalf("last message after regenerate = %+v", last)
+	}
+	if got := output("a.go"); got != "v1" {
+		t.Errorf("a.go = %q, want the output before the reply", got)
+	}
+	if got := output("b.go"); got != "<none>" {
+		t.Errorf("b.go = %q, want it removed", got)
+	}
+
+	reply("m2", map[string]string{"a.go": "v3"})
+	userIdx := len(s.ActiveChat.Messages) - 2
+	if err := s.SelectVariant(userIdx, 0); err != nil {
+		t.Fatalf("SelectVariant failed: %v", err)
+	}
+	msgs = s.ActiveChat.Messages
+	if msgs[len(msgs)-1].Model != "m1" {
+		t.Errorf("selected reply model = %q, want m1", msgs[len(msgs)-1].Model)
+	}
+	if alts := msgs[userIdx].Alternates; len(alts) != 1 || alts[0].Model != "m2" {
+		t.Errorf("alternates = %+v", alts)
+	}
+	if output("a.go") != "v2" || output("b.go") != "new" {
+		t.Errorf("outputs after switching back: a.go=%q b.go=%q", output("a.go"), output("b.go"))
+	}
+
+	// And back again.
+	if err := s.SelectVariant(userIdx, 0); err != nil {
+		t.Fatalf("SelectVariant failed: %v", err)
+	}
+	if output("a.go") != "v3" || output("b.go") != "<none>" {
+		t.Errorf("outputs after switching: a.go=%q b.go=%q", output("a.go"), output("b.go"))
+	}
+	if err := s.SelectVariant(userIdx, 5); !errors.Is(err, ErrVariantNotFound) {
+		t.Errorf("err = %v, want ErrVariantNotFound", err)
+	}
+
+	// Acting on the reply rules out regenerating it.
+	if err := s.AssistantWriteFile("c.go", "x", true); err != nil {
+		t.Fatalf("AssistantWriteFile failed: %v", err)
+	}
+	if _, err := s.RegenerateLast(""); !errors.Is(err, ErrContextChangedSince) {
+		t.Errorf("err = %v, want ErrContextChangedSince", err)
+	}
+}
@@ -0,0 +1,622 @@
+package webdoc
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// skippedElements are elements whose content never contributes readable text.
+var skippedElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"iframe":   true,
+	"head":     true,
+	"nav":      true,
+	"form":     true,
+	"button":   true,
+	"select":   true,
+	"canvas":   true,
+}
+
+// voidElements never have a closing tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// blockElements start and end on their own line.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "footer": true, "aside": true, "figure": true,
+	"figcaption": true, "dl": true, "dt": true, "dd": true, "table": true,
+	"details": true, "summary": true, "address": true,
+}
+
+var (
+	multiBlankLines = regexp.MustCompile(`\n{3,}`)
+	languageClass   = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([A-Za-z0-9_+#.-]+)`)
+)
+
+type listState struct {
+	ordered bool
+	counter int
+}
+
+// capture marks the start of a region of output that is rewritten when its
+// element closes (links and blockquotes).
+type capture struct {
+	tag   string
+	start int
+	href  string
+}
+
+type converter struct {
+	base     *url.URL
+	out      []byte
+	title    string
+	inTitle  bool
+	preDepth int
+	codeLang string
+	lists    []listState
+	captures []capture
+	rowCells int
+	rowHead  bool
+	rowIndex int
+}
+
+// HTMLToMarkdown converts an HTML document to readable markdown-like text.
+// It returns the document title (from <title> or the first <h1>) and the body.
+// baseURL is used to resolve relative links; it may be nil.
+//
+// The conversion is deliberately forgiving: it never fails, unknown tags are
+// dropped, and only structure that helps a reader (headings, lists, code
+// blocks, links, tables, emphasis) is preserved.
+func HTMLToMarkdown(src string, baseURL *url.URL) (title, markdown string) {
+	c := &converter{base: baseURL}
+	c.run(src)
+
+	text := string(c.out)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text = strings.Join(lines, "\n")
+	text = multiBlankLines.ReplaceAllString(text, "\n\n")
+	text = strings.TrimSpace(text)
+
+	title = strings.TrimSpace(collapseSpace(c.title))
+	if title == "" {
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(line, "# ") {
+				title = strings.TrimSpace(line[2:])
+				break
+			}
+		}
+	}
+	return title, text
+}
+
+func (c *converter) run(src string) {
+	// Tag names are ASCII, so the lowered copy keeps byte offsets aligned.
+	lower := asciiLower(src)
+	i := 0
+	for i < len(src) {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			c.text(src[i:])
+			return
+		}
+		if lt > 0 {
+			c.text(src[i : i+lt])
+		}
+		i += lt
+
+		rest := src[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+			continue
+		}
+
+		if len(rest) < 2 || !(isLetter(rest[1]) || (rest[1] == '/' && len(rest) > 2 && isLetter(rest[2]))) {
+			// A stray '<' is literal text.
+			c.text("<")
+			i++
+			continue
+		}
+
+		end := tagEnd(rest)
+		if end < 0 {
+			c.text(rest)
+			return
+		}
+		raw := rest[1:end]
+		i += end + 1
+
+		closing := strings.HasPrefix(raw, "/")
+		if closing {
+			raw = raw[1:]
+		}
+		name, attrs := parseTag(raw)
+		if name == "" {
+			continue
+		}
+
+		if !closing && skippedElements[name] {
+			if name == "head" {
+				// Keep the title from <head>, drop everything else.
+				closeIdx := strings.Index(lower[i:], "</head")
+				if closeIdx < 0 {
+					closeIdx = len(src) - i
+				}
+				c.extractTitle(src[i : i+closeIdx])
+				i += closeIdx
+				if gt := strings.IndexByte(src[i:], '>'); gt >= 0 {
+					i += gt + 1
+				} else {
+					i = len(src)
+				}
+				continue
+			}
+			if strings.HasSuffix(strings.TrimSpace(raw), "/") {
+				continue
+			}
+			i = skipElement(lower, i, name)
+			continue
+		}
+
+		if closing {
+			c.endTag(name)
+		} else {
+			c.startTag(name, attrs)
+		}
+	}
+}
+
+// extractTitle pulls the <title> text out of a head fragment.
+func (c *converter) extractTitle(head string) {
+	start := indexFold(head, "<title")
+	if start < 0 {
+		return
+	}
+	gt := strings.IndexByte(head[start:], '>')
+	if gt < 0 {
+		return
+	}
+	body := head[start+gt+1:]
+	end := indexFold(body, "</title")
+	if end < 0 {
+		end = len(body)
+	}
+	c.title = html.UnescapeString(body[:end])
+}
+
+func (c *converter) startTag(name string, attrs map[string]string) {
+	if c.preDepth > 0 {
+		switch name {
+		case "pre":
+			c.preDepth++
+		case "br":
+			c.write("\n")
+		case "code":
+			if c.codeLang == "" {
+				c.codeLang = classLanguage(attrs["class"])
+			}
+		}
+		return
+	}
+
+	switch name {
+	case "title":
+		c.inTitle = true
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(name[1] - '0')
+		c.block()
+		c.write(strings.Repeat("#", level) + " ")
+	case "br":
+		c.write("\n")
+	case "hr":
+		c.block()
+		c.write("---")
+		c.block()
+	case "pre":
+		c.block()
+		c.preDepth = 1
+		c.codeLang = classLanguage(attrs["class"])
+		c.write("```")
+		// The language is filled in when the fence closes, since it may only
+		// be known from a nested <code class="language-x">.
+		c.captures = append(c.captures, capture{tag: "pre", start: len(c.out)})
+		c.write("\n")
+	case "code", "kbd", "samp", "tt":
+		c.write("`")
+	case "strong", "b":
+		c.write("**")
+	case "em", "i":
+		c.write("*")
+	case "a":
+		c.captures = append(c.captures, capture{tag: "a", start: len(c.out), href: c.resolve(attrs["href"])})
+	case "blockquote":
+		c.block()
+		c.captures = append(c.captures, capture{tag: "blockquote", start: len(c.out)})
+	case "ul", "ol":
+		c.lineBreak()
+		c.lists = append(c.lists, listState{ordered: name == "ol"})
+	case "li":
+		c.lineBreak()
+		depth := len(c.lists)
+		if depth == 0 {
+			c.write("- ")
+			return
+		}
+		indent := strings.Repeat("  ", depth-1)
+		l := &c.lists[depth-1]
+		if l.ordered {
+			l.counter++
+			c.write(indent + strconv.Itoa(l.counter) + ". ")
+		} else {
+			c.write(indent + "- ")
+		}
+	case "tr":
+		c.lineBreak()
+		c.rowCells = 0
+		c.rowHead = false
+		c.write("|")
+	case "th", "td":
+		if name == "th" {
+			c.rowHead = true
+		}
+		c.rowCells++
+		c.write(" ")
+	case "img":
+		if alt := strings.TrimSpace(attrs["alt"]); alt != "" {
+			c.write("[image: " + collapseSpace(alt) + "]")
+		}
+	default:
+		if blockElements[name] {
+			c.block()
+		}
+	}
+}
+
+func (c *converter) endTag(name string) {
+	if c.preDepth > 0 {
+		if name != "pre" {
+			return
+		}
+		c.preDepth--
+		if c.preDepth > 0 {
+			return
+		}
+		if cp, ok := c.popCapture("pre"); ok {
+			body := strings.TrimRight(string(c.out[cp.start:]), "\n")
+			c.out = append(c.out[:cp.start], []byte(c.codeLang+body+"\n```")...)
+		}
+		c.codeLang = ""
+		c.block()
+		return
+	}
+
+	switch name {
+	case "title":
+		c.inTitle = false
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.block()
+	case "code", "kbd", "samp", "tt":
+		c.write("`")
+	case "strong", "b":
+		c.write("**")
+	case "em", "i":
+		c.write("*")
+	case "a":
+		cp, ok := c.popCapture("a")
+		if !ok {
+			return
+		}
+		text := strings.TrimSpace(string(c.out[cp.start:]))
+		if cp.href == "" || text == "" || strings.HasPrefix(cp.href, "#") || cp.href == text {
+			return
+		}
+		c.out = append(c.out[:cp.start], []byte("["+text+"]("+cp.href+")")...)
+	case "blockquote":
+		cp, ok := c.popCapture("blockquote")
+		if !ok {
+			return
+		}
+		body := strings.TrimSpace(string(c.out[cp.start:]))
+		lines := strings.Split(body, "\n")
+		for i, line := range lines {
+			if line == "" {
+				lines[i] = ">"
+			} else {
+				lines[i] = "> " + line
+			}
+		}
+		c.out = append(c.out[:cp.start], []byte(strings.Join(lines, "\n"))...)
+		c.block()
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		if len(c.lists) == 0 {
+			c.block()
+		} else {
+			c.lineBreak()
+		}
+	case "th", "td":
+		c.write(" |")
+	case "tr":
+		if c.rowHead && c.rowIndex == 0 && c.rowCells > 0 {
+			c.write("\n|" + strings.Repeat(" --- |", c.rowCells))
+		}
+		c.rowIndex++
+		c.lineBreak()
+	case "table":
+		c.rowIndex = 0
+		c.block()
+	default:
+		if blockElements[name] {
+			c.block()
+		}
+	}
+}
+
+func (c *converter) popCapture(tag string) (capture, bool) {
+	for i := len(c.captures) - 1; i >= 0; i-- {
+		if c.captures[i].tag == tag {
+			cp := c.captures[i]
+			c.captures = append(c.captures[:i], c.captures[i+1:]...)
+			return cp, true
+		}
+	}
+	return capture{}, false
+}
+
+func (c *converter) text(s string) {
+	if c.inTitle {
+		c.title += html.UnescapeString(s)
+		return
+	}
+	s = html.UnescapeString(s)
+	if c.preDepth > 0 {
+		c.write(s)
+		return
+	}
+	s = collapseSpace(s)
+	if s == "" {
+		return
+	}
+	if s == " " || strings.HasPrefix(s, " ") {
+		if len(c.out) == 0 || c.out[len(c.out)-1] == '\n' || c.out[len(c.out)-1] == ' ' {
+			s = strings.TrimLeft(s, " ")
+		}
+	}
+	c.write(s)
+}
+
+func (c *converter) write(s string) {
+	c.out = append(c.out, s...)
+}
+
+// lineBreak ensures the output ends with a newline.
+func (c *converter) lineBreak() {
+	c.trimTrailingSpace()
+	if len(c.out) > 0 && c.out[len(c.out)-1] != '\n' {
+		c.out = append(c.out, '\n')
+	}
+}
+
+// block ensures the output ends with a blank line.
+func (c *converter) block() {
+	c.trimTrailingSpace()
+	if len(c.out) == 0 {
+		return
+	}
+	if !strings.HasSuffix(string(c.out), "\n\n") {
+		if c.out[len(c.out)-1] == '\n' {
+			c.out = append(c.out, '\n')
+		} else {
+			c.out = append(c.out, '\n', '\n')
+		}
+	}
+}
+
+func (c *converter) trimTrailingSpace() {
+	for len(c.out) > 0 && c.out[len(c.out)-1] == ' ' {
+		c.out = c.out[:len(c.out)-1]
+	}
+}
+
+func (c *converter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	if c.base == nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return c.base.ResolveReference(ref).String()
+}
+
+func classLanguage(class string) string {
+	if m := languageClass.FindStringSubmatch(class); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// collapseSpace replaces runs of whitespace with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch r {
+		case ' ', '\t', '\n', '\r', '\f', '\u00a0':
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+		default:
+			b.WriteRune(r)
+			space = false
+		}
+	}
+	return b.String()
+}
+
+// tagEnd returns the index of the '>' closing the tag at the start of s,
+// honoring quoted attribute values. Returns -1 if the tag is unterminated.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag splits raw tag text (without angle brackets) into a lowercase
+// name and its attributes.
+func parseTag(raw string) (string, map[string]string) {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "/")
+	n := 0
+	for n < len(raw) && !isSpace(raw[n]) && raw[n] != '/' {
+		n++
+	}
+	name := strings.ToLower(raw[:n])
+	attrs := map[string]string{}
+	s := raw[n:]
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f/")
+		if s == "" {
+			break
+		}
+		k := 0
+		for k < len(s) && !isSpace(s[k]) && s[k] != '=' {
+			k++
+		}
+		key := strings.ToLower(s[:k])
+		s = strings.TrimLeft(s[k:], " \t\n\r\f")
+		if !strings.HasPrefix(s, "=") {
+			attrs[key] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\n\r\f")
+		var val string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			q := s[0]
+			end := strings.IndexByte(s[1:], q)
+			if end < 0 {
+				val, s = s[1:], ""
+			} else {
+				val, s = s[1:1+end], s[2+end:]
+			}
+		} else {
+			v := 0
+			for v < len(s) && !isSpace(s[v]) {
+				v++
+			}
+			val, s = s[:v], s[v:]
+		}
+		attrs[key] = html.UnescapeString(val)
+	}
+	return name, attrs
+}
+
+// skipElement returns the index just past the closing tag of name, starting
+// the search at i. Nested elements of the same name are accounted for.
+func skipElement(lower string, i int, name string) int {
+	src := lower
+	depth := 1
+	for depth > 0 {
+		next := indexTag(src[i:], "<"+name)
+		close := indexTag(src[i:], "</"+name)
+		if close < 0 {
+			return len(src)
+		}
+		if next >= 0 && next < close && !voidElements[name] && name != "script" && name != "style" {
+			depth++
+			i += next + 1
+			continue
+		}
+		depth--
+		i += close
+		gt := strings.IndexByte(src[i:], '>')
+		if gt < 0 {
+			return len(src)
+		}
+		i += gt + 1
+	}
+	return i
+}
+
+func indexFold(s, substr string) int {
+	return strings.Index(asciiLower(s), substr)
+}
+
+// indexTag finds prefix (e.g. "<nav") in s where it is not the start of a
+// longer tag name such as "<navbar".
+func indexTag(s, prefix string) int {
+	offset := 0
+	for {
+		idx := strings.Index(s[offset:], prefix)
+		if idx < 0 {
+			return -1
+		}
+		end := offset + idx + len(prefix)
+		if end >= len(s) || !isLetter(s[end]) && s[end] != '-' && !(s[end] >= '0' && s[end] <= '9') {
+			return offset + idx
+		}
+		offset = end
+	}
+}
+
+// asciiLower lowercases ASCII letters only, preserving byte offsets.
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, ch := range b {
+		if ch >= 'A' && ch <= 'Z' {
+			b[i] = ch + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,261 @@
+// Package webdoc fetches external documentation pages and converts them to
+// readable text for use as chat context. Fetched documents are cached on disk
+// so the same page can be reused across chats without refetching.
+package webdoc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidURL         = errors.New("invalid URL: only http and https are supported")
+	ErrUnsupportedContent = errors.New("unsupported content type")
+	ErrTooLarge           = errors.New("document too large")
+	ErrFetchFailed        = errors.New("fetch failed")
+)
+
+const (
+	// DefaultMaxAge is how long a cached document is used without revalidation.
+	DefaultMaxAge = 24 * time.Hour
+	// DefaultMaxBytes caps the size of a downloaded response body.
+	DefaultMaxBytes = 5 * 1024 * 1024
+
+	defaultTimeout = 30 * time.Second
+	userAgent      = "bb7 (documentation fetcher)"
+)
+
+// Document is a fetched page converted to readable text.
+type Document struct {
+	URL          string    `json:"url"`
+	Title        string    `json:"title,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Content      string    `json:"-"`
+	FromCache    bool      `json:"-"`
+}
+
+// Fetcher downloads documents and keeps a disk cache of converted results.
+type Fetcher struct {
+	cacheDir   string
+	httpClient *http.Client
+	maxAge     time.Duration
+	maxBytes   int64
+}
+
+// NewFetcher creates a fetcher that caches documents in cacheDir.
+// An empty cacheDir disables caching.
+func NewFetcher(cacheDir string) *Fetcher {
+	return &Fetcher{
+		cacheDir:   cacheDir,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxAge:     DefaultMaxAge,
+		maxBytes:   DefaultMaxBytes,
+	}
+}
+
+// DefaultCacheDir returns the shared cache directory (~/.bb7/webcache).
+func DefaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), ".bb7", "webcache")
+	}
+	return filepath.Join(home, ".bb7", "webcache")
+}
+
+// NormalizeURL validates rawURL and returns its canonical form used for
+// context paths and cache keys. The fragment is dropped since it never
+// changes the fetched document.
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+// Fetch returns the document at rawURL. A fresh cached copy is returned
+// without network access unless refresh is set. Stale copies are revalidated
+// with conditional request headers when the server provided them.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, refresh bool) (*Document, error) {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, _ := f.loadCached(normalized)
+	if cached != nil && !refresh && time.Since(cached.FetchedAt) < f.maxAge {
+		cached.FromCache = true
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, normalized, nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html, text/markdown, text/plain;q=0.9, */*;q=0.1")
+	if cached != nil && !refresh {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.FetchedAt = time.Now().UTC()
+		cached.FromCache = true
+		f.storeCached(cached)
+		return cached, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrFetchFailed, normalized, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	if int64(len(body)) > f.maxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrTooLarge, f.maxBytes)
+	}
+
+	// Redirects may land on a different page; resolve relative links against it.
+	finalURL := resp.Request.URL
+	contentType := resp.Header.Get("Content-Type")
+	title, content, err := convert(contentType, body, finalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		URL:          normalized,
+		Title:        title,
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+		Content:      content,
+	}
+	f.storeCached(doc)
+	return doc, nil
+}
+
+// convert turns a response body into readable text based on its content type.
+func convert(contentType string, body []byte, base *url.URL) (string, string, error) {
+	mediaType := ""
+	if contentType != "" {
+		if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+			mediaType = mt
+		}
+	}
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		title, text := HTMLToMarkdown(string(body), base)
+		if title != "" && !strings.HasPrefix(text, "# ") {
+			text = "# " + title + "\n\n" + text
+		}
+		return title, text, nil
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return "", strings.TrimSpace(string(body)), nil
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedContent, mediaType)
+	}
+}
+
+// cacheKey returns the storage basename for a normalized URL.
+func cacheKey(normalizedURL string) string {
+	h := sha256.Sum256([]byte(normalizedURL))
+	return hex.EncodeToString(h[:16])
+}
+
+func (f *Fetcher) cachePaths(normalizedURL string) (meta, content string) {
+	base := filepath.Join(f.cacheDir, cacheKey(normalizedURL))
+	return base + ".json", base + ".md"
+}
+
+// loadCached returns the cached document for a normalized URL, or nil.
+func (f *Fetcher) loadCached(normalizedURL string) (*Document, error) {
+	if f.cacheDir == "" {
+		return nil, nil
+	}
+	metaPath, contentPath := f.cachePaths(normalizedURL)
+	metaData, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	var doc Document
+	if err := json.Unmarshal(metaData, &doc); err != nil {
+		return nil, err
+	}
+	if doc.URL != normalizedURL {
+		return nil, nil
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return nil, err
+	}
+	doc.Content = string(content)
+	return &doc, nil
+}
+
+// storeCached writes a document to the cache. Failures are ignored: the cache
+// only saves refetches.
+func (f *Fetcher) storeCached(doc *Document) {
+	if f.cacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(f.cacheDir, 0755); err != nil {
+		return
+	}
+	metaPath, contentPath := f.cachePaths(doc.URL)
+	metaData, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return
+	}
+	// Content first so a readable meta file always has its content alongside.
+	if err := os.WriteFile(contentPath, []byte(doc.Content), 0644); err != nil {
+		return
+	}
+	os.WriteFile(metaPath, metaData, 0644)
+}
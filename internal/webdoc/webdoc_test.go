@@ -0,0 +1,248 @@
+package webdoc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const samplePage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Widget API &amp; Guide</title>
+  <style>body { color: red; }</style>
+  <script>var x = "<p>not text</p>";</script>
+</head>
+<body>
+  <nav><a href="/">Home</a></nav>
+  <h1>Widgets</h1>
+  <p>Widgets are <strong>small</strong> and <em>useful</em>. See <a href="/docs/more">more docs</a>.</p>
+  <h2>Install</h2>
+  <pre><code class="language-go">go get example.com/widget
+if a &lt; b {
+}</code></pre>
+  <ul>
+    <li>First</li>
+    <li>Second
+      <ol><li>Nested</li></ol>
+    </li>
+  </ul>
+  <table>
+    <tr><th>Name</th><th>Type</th></tr>
+    <tr><td>size</td><td>int</td></tr>
+  </table>
+  <blockquote><p>Quoted line</p></blockquote>
+</body>
+</html>`
+
+func TestHTMLToMarkdown(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/widgets")
+	title, md := HTMLToMarkdown(samplePage, base)
+
+	if title != "Widget API & Guide" {
+		t.Errorf("title = %q, want %q", title, "Widget API & Guide")
+	}
+
+	wants := []string{
+		"# Widgets",
+		"Widgets are **small** and *useful*. See [more docs](https://example.com/docs/more).",
+		"## Install",
+		"```go\ngo get example.com/widget\nif a < b {\n}\n```",
+		"- First",
+		"- Second\n  1. Nested",
+		"| Name | Type |\n| --- | --- |\n| size | int |",
+		"> Quoted line",
+	}
+	for _, want := range wants {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q\n--- got ---\n%s", want, md)
+		}
+	}
+
+	for _, unwanted := range []string{"color: red", "not text", "Home"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("markdown should not contain %q\n--- got ---\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestHTMLToMarkdownMalformed(t *testing.T) {
+	inputs := []string{
+		"",
+		"<",
+		"a < b and c > d",
+		"<p>unterminated",
+		"<div><span attr=\"unterminated>text",
+		"<!-- comment without end",
+		"<script>never closed",
+		"</p></div>stray closers",
+	}
+	for _, in := range inputs {
+		// Must not panic.
+		HTMLToMarkdown(in, nil)
+	}
+
+	_, md := HTMLToMarkdown("a < b and c > d", nil)
+	if md != "a < b and c > d" {
+		t.Errorf("literal angle brackets = %q", md)
+	}
+}
+
+func TestHTMLToMarkdownSkipsOnlyMatchingTag(t *testing.T) {
+	_, md := HTMLToMarkdown("<navbar>kept</navbar><nav>dropped</nav><p>after</p>", nil)
+	if !strings.Contains(md, "kept") || strings.Contains(md, "dropped") || !strings.Contains(md, "after") {
+		t.Errorf("unexpected output: %q", md)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"https://Example.com/docs#section", "https://example.com/docs", false},
+		{"http://example.com", "http://example.com/", false},
+		{"  https://example.com/a?b=c  ", "https://example.com/a?b=c", false},
+		{"ftp://example.com/file", "", true},
+		{"file:///etc/passwd", "", true},
+		{"/relative/path", "", true},
+		{"https://", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("NormalizeURL(%q) error = %v, want ErrInvalidURL", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeURL(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFetchConvertsAndCaches(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(samplePage))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	f := NewFetcher(cacheDir)
+
+	doc, err := f.Fetch(context.Background(), server.URL+"/docs/widgets#install", false)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if doc.FromCache {
+		t.Error("first fetch should not come from cache")
+	}
+	if doc.URL != server.URL+"/docs/widgets" {
+		t.Errorf("URL = %q, want fragment stripped", doc.URL)
+	}
+	if !strings.Contains(doc.Content, "[more docs]("+server.URL+"/docs/more)") {
+		t.Errorf("relative link not resolved against server URL:\n%s", doc.Content)
+	}
+
+	// A second fetcher sharing the cache dir (as another chat would) reuses it.
+	doc2, err := NewFetcher(cacheDir).Fetch(context.Background(), server.URL+"/docs/widgets", false)
+	if err != nil {
+		t.Fatalf("cached Fetch failed: %v", err)
+	}
+	if !doc2.FromCache {
+		t.Error("second fetch should come from cache")
+	}
+	if doc2.Content != doc.Content {
+		t.Error("cached content differs from fetched content")
+	}
+	if hits.Load() != 1 {
+		t.Errorf("server hits = %d, want 1", hits.Load())
+	}
+
+	// refresh bypasses the cache.
+	if _, err := f.Fetch(context.Background(), server.URL+"/docs/widgets", true); err != nil {
+		t.Fatalf("refresh Fetch failed: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("server hits after refresh = %d, want 2", hits.Load())
+	}
+}
+
+func TestFetchRevalidatesStaleCache(t *testing.T) {
+	var conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("plain docs"))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(t.TempDir())
+	if _, err := f.Fetch(context.Background(), server.URL+"/a.txt", false); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	f.maxAge = -time.Second // everything is stale
+	doc, err := f.Fetch(context.Background(), server.URL+"/a.txt", false)
+	if err != nil {
+		t.Fatalf("revalidating Fetch failed: %v", err)
+	}
+	if conditional.Load() != 1 {
+		t.Errorf("conditional requests = %d, want 1", conditional.Load())
+	}
+	if !doc.FromCache || doc.Content != "plain docs" {
+		t.Errorf("doc = %+v, want cached plain docs", doc)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0, 1, 2, 3})
+		case "/big":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(strings.Repeat("x", 2048)))
+		}
+	}))
+	defer server.Close()
+
+	f := NewFetcher("")
+	f.maxBytes = 1024
+
+	if _, err := f.Fetch(context.Background(), server.URL+"/missing", false); !errors.Is(err, ErrFetchFailed) {
+		t.Errorf("404 error = %v, want ErrFetchFailed", err)
+	}
+	if _, err := f.Fetch(context.Background(), server.URL+"/binary", false); !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("binary error = %v, want ErrUnsupportedContent", err)
+	}
+	if _, err := f.Fetch(context.Background(), server.URL+"/big", false); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("big error = %v, want ErrTooLarge", err)
+	}
+	if _, err := f.Fetch(context.Background(), "ftp://example.com", false); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("ftp error = %v, want ErrInvalidURL", err)
+	}
+}
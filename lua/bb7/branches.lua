@@ -0,0 +1,212 @@
+-- Fork lineage: browse a chat's fork family and compare sibling branches
+
+local M = {}
+
+local log = require('bb7.log')
+
+-- Flatten a chat_tree node into picker items, depth-first
+local function flatten(node, depth, items, active_id)
+  local indent = string.rep('  ', depth)
+  local marker = node.id == active_id and '* ' or '  '
+  local label = marker .. indent .. (node.name ~= '' and node.name or node.id)
+  if node.parent_id then
+    label = label .. '  (from message ' .. (node.fork_index + 1) .. ')'
+  end
+  table.insert(items, { label = label, node = node })
+  for _, child in ipairs(node.children or {}) do
+    flatten(child, depth + 1, items, active_id)
+  end
+  return items
+end
+
+-- Fetch the active chat's family as picker items
+local function family_items(callback)
+  local client = require('bb7.client')
+  client.request({ action = 'chat_tree' }, function(resp, err)
+    if err then
+      log.error(err)
+      return
+    end
+    vim.schedule(function()
+      callback(flatten(resp.root, 0, {}, resp.chat_id), resp.chat_id)
+    end)
+  end)
+end
+
+local function select_chat(node)
+  local client = require('bb7.client')
+  local req = { action = 'chat_select', id = node.id }
+  if node.global then req.global = true end
+  require('bb7.ui').open()
+  client.request(req, function(_, err)
+    if err then
+      log.error('Failed to select chat: ' .. err)
+      return
+    end
+    vim.schedule(function()
+      require('bb7.panes.chats').refresh()
+    end)
+  end)
+end
+
+-- Pick a chat from the active chat's fork family and switch to it
+function M.pick()
+  family_items(function(items)
+    vim.ui.select(items, {
+      prompt = 'Chat branches',
+      format_item = function(item) return item.label end,
+    }, function(item)
+      if item then select_chat(item.node) end
+    end)
+  end)
+end
+
+-- Render a chat_compare response as diff-highlightable lines
+local function render_comparison(resp)
+  local lines = {
+    '# ' .. resp.left.name .. ' (left) vs ' .. resp.right.name .. ' (right)',
+    '# Shared messages: ' .. resp.common_messages,
+    '',
+  }
+  local function add_text(text)
+    for line in (text .. '\n'):gmatch('(.-)\n') do
+      table.insert(lines, line)
+    end
+  end
+
+  for _, turn in ipairs(resp.turns) do
+    local left_model = turn.left and turn.left.model or '(none)'
+    local right_model = turn.right and turn.right.model or '(none)'
+    table.insert(lines, '## Reply ' .. turn.turn .. ': ' .. left_model .. ' vs ' .. right_model)
+    if turn.diff and turn.diff ~= '' then
+      add_text(vim.trim(turn.diff))
+    else
+      table.insert(lines, '(identical)')
+    end
+    table.insert(lines, '')
+  end
+  if #resp.turns == 0 then
+    table.insert(lines, 'No replies after the branch point.')
+    table.insert(lines, '')
+  end
+
+  if #resp.files > 0 then
+    table.insert(lines, '## Output files')
+    for _, file in ipairs(resp.files) do
+      table.insert(lines, file.path .. ': ' .. file.status:gsub('_', ' '))
+      if file.diff and file.diff ~= '' then
+        add_text(vim.trim(file.diff))
+      end
+    end
+  end
+  return lines
+end
+
+local function open_comparison(resp)
+  vim.cmd('tabnew')
+  local buf = vim.api.nvim_get_current_buf()
+  vim.bo[buf].buftype = 'nofile'
+  vim.bo[buf].bufhidden = 'wipe'
+  vim.bo[buf].swapfile = false
+  vim.api.nvim_buf_set_lines(buf, 0, -1, false, render_comparison(resp))
+  vim.bo[buf].modifiable = false
+  vim.bo[buf].filetype = 'diff'
+  pcall(vim.api.nvim_buf_set_name, buf, 'bb7://compare/' .. resp.left.id .. '..' .. resp.right.id)
+end
+
+-- Compare the active chat with another chat of its family (picked if nil)
+function M.compare(other_id)
+  local client = require('bb7.client')
+  local function run(id)
+    client.request({ action = 'chat_compare', right = id }, function(resp, err)
+      if err then
+        log.error(err)
+        return
+      end
+      vim.schedule(function() open_comparison(resp) end)
+    end)
+  end
+
+  if other_id and other_id ~= '' then
+    run(other_id)
+    return
+  end
+  family_items(function(items, active_id)
+    local others = vim.tbl_filter(function(item) return item.node.id ~= active_id end, items)
+    if #others == 0 then
+      log.info('This chat has no forks to compare with')
+      return
+    end
+    vim.ui.select(others, {
+      prompt = 'Compare with',
+      format_item = function(item) return item.label end,
+    }, function(item)
+      if item then run(item.node.id) end
+    end)
+  end)
+end
+
+local compare_request_id = nil
+
+local function format_compare_result(res)
+  if res.error then
+    return res.model .. ': ' .. res.error
+  end
+  local cost = res.usage and res.usage.cost or 0
+  local line = string.format('%s: %d file(s), $%.4f, %.1fs', res.model, #res.output_files, cost, res.duration)
+  if res.diff_errors then
+    line = line .. ', ' .. #res.diff_errors .. ' edit error(s)'
+  end
+  return line
+end
+
+-- Send one prompt to several models at once. Each model answers in its own
+-- fork of the active chat; compare them afterwards with :BB7Compare.
+function M.send_compare(models, prompt)
+  local client = require('bb7.client')
+  if compare_request_id then
+    log.warn('A comparison is already running')
+    return
+  end
+  local function run(content)
+    if not content or vim.trim(content) == '' then return end
+    log.info('Sending to ' .. table.concat(models, ', ') .. '...')
+    compare_request_id = client.request({ action = 'send_compare', content = content, models = models }, function(resp, err)
+      compare_request_id = nil
+      if err then
+        log.error(err)
+        return
+      end
+      local lines = { string.format('Comparison finished ($%.4f, %.1fs)', resp.cost, resp.duration) }
+      for _, res in ipairs(resp.results) do
+        table.insert(lines, format_compare_result(res))
+      end
+      log.info(table.concat(lines, '\n'))
+      vim.schedule(function()
+        local ok, ui = pcall(require, 'bb7.ui')
+        if ok and ui.is_open() then
+          require('bb7.panes.chats').refresh()
+        end
+      end)
+    end)
+  end
+
+  if prompt and prompt ~= '' then
+    run(prompt)
+  else
+    vim.ui.input({ prompt = 'Prompt for ' .. table.concat(models, ', ') .. ': ' }, run)
+  end
+end
+
+-- Cancel a running comparison (all models)
+function M.cancel_compare()
+  if not compare_request_id then
+    log.info('No comparison is running')
+    return
+  end
+  require('bb7.client').request({ action = 'cancel', target_request_id = compare_request_id }, function(_, err)
+    if err then log.error(err) end
+  end)
+end
+
+return M
@@ -11,6 +11,7 @@ local state = {
   stream_handlers = nil,  -- { on_chunk, on_done, on_error } for streaming
   stream_request_id = nil,
   stream_buffer = nil,  -- { content, reasoning, user_message }
+  background_streams = {}, -- request_id -> { on_done, on_error, on_diff_error } for chats switched away from
   event_handlers = {},    -- { title_updated = fn, ... } for async events
   response_buffer = '',   -- buffer for partial JSON lines
   initialized = false,
@@ -56,6 +57,34 @@ local function handle_output(line)
   local msg_type = data.type
   local resp_id = data.request_id and tostring(data.request_id) or nil
 
+  -- Background streams only report how they ended; their text is saved to
+  -- their own chat by the backend.
+  local background = resp_id and state.background_streams[resp_id]
+  if background then
+    if msg_type == 'chunk' or msg_type == 'thinking' then
+      return
+    end
+    local handler = ({ done = 'on_done', diff_error = 'on_diff_error', error = 'on_error' })[msg_type]
+    if handler then
+      state.background_streams[resp_id] = nil
+      local fn = background[handler]
+      if fn then
+        local ok, err
+        if msg_type == 'done' then
+          ok, err = pcall(fn, data.output_files or {}, data.usage)
+        elseif msg_type == 'error' then
+          ok, err = pcall(fn, data.message)
+        else
+          ok, err = pcall(fn, data)
+        end
+        if not ok then
+          log.error('Error in background stream handler: ' .. tostring(err))
+        end
+      end
+      return
+    end
+  end
+
   -- Handle streaming responses
   if msg_type == 'chunk' then
     if resp_id and state.stream_request_id == resp_id then
@@ -81,6 +110,22 @@ local function handle_output(line)
     return
   end
 
+  -- Possible secrets in a send's request; a blocked send ends with an error
+  if msg_type == 'secrets_detected' then
+    local where = {}
+    for _, finding in ipairs(data.findings or {}) do
+      local loc = finding.path and (finding.path .. ':' .. (finding.line or 1)) or 'message'
+      table.insert(where, finding.rule .. ' in ' .. loc)
+    end
+    local prefix = ({
+      warn = 'Sent possible secrets: ',
+      redact = 'Redacted possible secrets: ',
+      block = 'Possible secrets: ',
+    })[data.mode] or 'Possible secrets: '
+    log.warn(prefix .. table.concat(where, ', '))
+    return
+  end
+
   if msg_type == 'done' then
     if state.stream_handlers and state.stream_request_id == resp_id and state.stream_handlers.on_done then
       local ok, err = pcall(state.stream_handlers.on_done, data.output_files or {}, data.usage)
@@ -114,6 +159,12 @@ local function handle_output(line)
     end
     return
   end
+  if msg_type == 'tags_updated' then
+    if state.event_handlers.on_tags_updated then
+      state.event_handlers.on_tags_updated(data.chat_id, data.tags)
+    end
+    return
+  end
 
   -- Handle errors
   if msg_type == 'error' then
@@ -237,6 +288,7 @@ function M.start()
       state.pending_queue = {}
       state.stream_handlers = nil
       state.stream_request_id = nil
+      state.background_streams = {}
       if code ~= 0 then
         log.warn('Process exited with code ' .. code)
       end
@@ -330,6 +382,9 @@ function M.init(project_root, callback)
     end
     state.initialized = true
     state.global_only = response.global_only or false
+    if response.resumable_sends then
+      log.info(response.resumable_sends .. ' interrupted or queued send(s); use :BB7Queue to resume')
+    end
     if callback then callback(response, nil) end
   end)
 end
@@ -383,6 +438,27 @@ function M.set_stream_handlers(handlers)
   return true
 end
 
+-- Follow a stream in the background (a queued or resumed send). Only its
+-- done, diff_error and error events reach handlers.
+function M.watch_stream(request_id, handlers)
+  if request_id then
+    state.background_streams[request_id] = handlers or {}
+  end
+end
+
+-- Move the active stream to the background so another chat can take the
+-- stream slot
+function M.detach_stream(handlers)
+  if not state.stream_request_id then
+    return false
+  end
+  M.watch_stream(state.stream_request_id, handlers)
+  state.stream_handlers = nil
+  state.stream_request_id = nil
+  state.stream_buffer = nil
+  return true
+end
+
 function M.get_stream_buffer()
   return state.stream_buffer
 end
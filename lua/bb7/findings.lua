@@ -0,0 +1,56 @@
+-- Review mode and findings (:BB7Review, :BB7Findings)
+
+local M = {}
+
+local log = require('bb7.log')
+
+local QF_TYPES = { error = 'E', warning = 'W', info = 'I' }
+
+-- :BB7Review: toggle review mode for the following sends
+function M.toggle()
+  require('bb7.panes.input').toggle_review()
+end
+
+-- Convert backend findings into quickfix items
+local function to_qf_items(findings)
+  local root = require('bb7.client').get_project_root() or vim.fn.getcwd()
+  local items = {}
+  for _, f in ipairs(findings) do
+    local text = f.message
+    if f.category and f.category ~= '' then
+      text = '[' .. f.category .. '] ' .. text
+    end
+    if f.stale then
+      text = text .. ' (stale)'
+    end
+    table.insert(items, {
+      filename = root .. '/' .. f.path,
+      lnum = f.start_line,
+      end_lnum = f.end_line,
+      type = QF_TYPES[f.severity] or 'I',
+      text = text,
+    })
+  end
+  return items
+end
+
+-- :BB7Findings: load the active chat's findings into the quickfix list
+function M.quickfix()
+  require('bb7.client').request({ action = 'get_findings' }, function(resp, err)
+    if err then
+      log.error('Failed to get findings: ' .. err)
+      return
+    end
+    vim.schedule(function()
+      local findings = resp.findings or {}
+      if #findings == 0 then
+        log.info('No findings in this chat')
+        return
+      end
+      vim.fn.setqflist({}, ' ', { title = 'BB7 findings', items = to_qf_items(findings) })
+      vim.cmd('copen')
+    end)
+  end)
+end
+
+return M
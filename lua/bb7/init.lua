@@ -435,6 +435,22 @@ function M.setup(opts)
       path = path:sub(#project_root + 2)  -- +2 to skip the trailing slash
     end
 
+    -- Images are read and validated by the backend (always read-only)
+    local ext = (path:match('%.(%w+)$') or ''):lower()
+    if not start_line and (ext == 'png' or ext == 'jpg' or ext == 'jpeg' or ext == 'gif' or ext == 'webp') then
+      client.request({ action = 'context_add_image', path = path }, function(_, err)
+        if err then
+          if err:match('already exists') then
+            return
+          end
+          log.error(err)
+          return
+        end
+        log.info('Added image ' .. path)
+      end)
+      return
+    end
+
     -- Check for binary file
     local utils = require('bb7.utils')
     if utils.is_binary_file(full_path) then
@@ -553,6 +569,219 @@ function M.setup(opts)
     desc = 'Add file to BB7 context as read-only',
   })
 
+  -- BB7AddURL[!] <url> - Fetch a documentation page into context (read-only)
+  -- With !, refetch the page even if cached and refresh an existing entry
+  vim.api.nvim_create_user_command('BB7AddURL', function(opts)
+    local client = require('bb7.client')
+    local url = vim.trim(opts.args)
+    if not url:match('^https?://') then
+      log.warn('Usage: :BB7AddURL https://...')
+      return
+    end
+    ensure_initialized(function()
+      log.info('Fetching ' .. url .. '...')
+      client.request({ action = 'context_add_url', url = url, refresh = opts.bang }, function(resp, err)
+        if err then
+          if err:match('already exists') then
+            log.info('Already in context (use :BB7AddURL! to refresh)')
+            return
+          end
+          log.error(err)
+          return
+        end
+        local label = (resp and resp.title and resp.title ~= '') and resp.title or url
+        log.info('Added ' .. label .. ((resp and resp.cached) and ' (cached)' or ''))
+      end)
+    end)
+  end, {
+    nargs = 1,
+    bang = true,
+    desc = 'Add a documentation URL to BB7 context',
+  })
+
+  -- BB7Export [format] [path] - Export the active chat (markdown, html, json)
+  -- Without a path, writes <chat-name>.<ext> to the current directory
+  vim.api.nvim_create_user_command('BB7Export', function(opts)
+    local client = require('bb7.client')
+    local format = opts.fargs[1] or 'markdown'
+    local path = opts.fargs[2]
+    ensure_initialized(function()
+      client.request({ action = 'chat_get' }, function(chat, get_err)
+        if get_err then
+          log.info('No active chat - select a chat first')
+          return
+        end
+        if not path then
+          local ext = ({ markdown = 'md', md = 'md', html = 'html', json = 'json' })[format] or format
+          local name = (chat.name ~= '' and chat.name or chat.id):gsub('[^%w%-_]+', '-')
+          path = vim.fn.getcwd() .. '/' .. name .. '.' .. ext
+        end
+        path = vim.fn.fnamemodify(path, ':p')
+        client.request({ action = 'chat_export', format = format, path = path }, function(resp, err)
+          if err then
+            log.error(err)
+            return
+          end
+          log.info('Exported chat to ' .. resp.path)
+        end)
+      end)
+    end)
+  end, {
+    nargs = '*',
+    complete = function(_, line)
+      if #vim.split(line, '%s+') <= 2 then
+        return { 'markdown', 'html', 'json' }
+      end
+      return vim.fn.getcompletion('', 'file')
+    end,
+    desc = 'Export the active BB7 chat',
+  })
+
+  -- BB7Import[!] <path> - Import a chat from a JSON bundle written by :BB7Export
+  -- With !, imports as a global chat
+  vim.api.nvim_create_user_command('BB7Import', function(opts)
+    local client = require('bb7.client')
+    local path = vim.fn.fnamemodify(opts.args, ':p')
+    ensure_initialized(function()
+      client.request({ action = 'chat_import', path = path, global = opts.bang or nil }, function(resp, err)
+        if err then
+          log.error(err)
+          return
+        end
+        log.info('Imported chat "' .. resp.name .. '"')
+        local ok, ui = pcall(require, 'bb7.ui')
+        if ok and ui.is_open() then
+          require('bb7.panes.chats').refresh()
+        end
+      end)
+    end)
+  end, {
+    nargs = 1,
+    bang = true,
+    complete = 'file',
+    desc = 'Import a BB7 chat from a JSON export',
+  })
+
+  -- BB7Tree - Show the active chat's fork family and switch branches
+  vim.api.nvim_create_user_command('BB7Tree', function()
+    ensure_initialized(function()
+      require('bb7.branches').pick()
+    end)
+  end, {
+    desc = 'Browse forks of the active BB7 chat',
+  })
+
+  -- BB7Compare [chat-id] - Diff the active chat against another branch
+  vim.api.nvim_create_user_command('BB7Compare', function(opts)
+    ensure_initialized(function()
+      require('bb7.branches').compare(opts.args)
+    end)
+  end, {
+    nargs = '?',
+    desc = 'Compare the active BB7 chat with a fork',
+  })
+
+  -- BB7SendCompare model1 model2 ... - Send a prompt to several models at once
+  -- With !, cancels the running comparison
+  vim.api.nvim_create_user_command('BB7SendCompare', function(opts)
+    if opts.bang then
+      require('bb7.branches').cancel_compare()
+      return
+    end
+    if #opts.fargs < 2 then
+      log.error('Usage: :BB7SendCompare <model> <model> ...')
+      return
+    end
+    ensure_initialized(function()
+      require('bb7.branches').send_compare(opts.fargs)
+    end)
+  end, {
+    nargs = '*',
+    bang = true,
+    desc = 'Send a prompt to several models in parallel forks',
+  })
+
+  -- BB7Queue - Resume or cancel queued and interrupted sends
+  vim.api.nvim_create_user_command('BB7Queue', function()
+    ensure_initialized(function()
+      require('bb7.queue').pick()
+    end)
+  end, {
+    desc = 'Resume or cancel queued and interrupted sends',
+  })
+
+  -- BB7Template [name] - Start a /name template message (range: selection)
+  vim.api.nvim_create_user_command('BB7Template', function(opts)
+    ensure_initialized(function()
+      require('bb7.templates').start(opts.args, opts)
+    end)
+  end, {
+    nargs = '?',
+    range = true,
+    complete = function()
+      return require('bb7.templates').names()
+    end,
+    desc = 'Start a BB7 message from a prompt template',
+  })
+
+  -- BB7Persona [name] - Select the active chat's persona ('none' clears it)
+  vim.api.nvim_create_user_command('BB7Persona', function(opts)
+    ensure_initialized(function()
+      require('bb7.personas').pick(opts.args)
+    end)
+  end, {
+    nargs = '?',
+    desc = 'Select a persona for the active BB7 chat',
+  })
+
+  -- BB7Params [key=value ...] - Show or set the active chat's generation parameters
+  vim.api.nvim_create_user_command('BB7Params', function(opts)
+    ensure_initialized(function()
+      require('bb7.params').command(opts.fargs)
+    end)
+  end, {
+    nargs = '*',
+    complete = function(arg_lead)
+      return require('bb7.params').complete(arg_lead)
+    end,
+    desc = 'Show or set max tokens, temperature, top_p and reasoning budget for the active BB7 chat',
+  })
+
+  -- BB7Regenerate [model] - Answer the last message again, keeping the old reply
+  vim.api.nvim_create_user_command('BB7Regenerate', function(opts)
+    ensure_initialized(function()
+      require('bb7.variants').regenerate(opts.args)
+    end)
+  end, {
+    nargs = '?',
+    desc = 'Regenerate the last BB7 reply (optionally with another model)',
+  })
+
+  -- BB7Variants - Switch the last message's reply to an earlier variant
+  vim.api.nvim_create_user_command('BB7Variants', function()
+    ensure_initialized(function()
+      require('bb7.variants').pick()
+    end)
+  end, {
+    desc = 'Switch to an earlier reply to the last BB7 message',
+  })
+
+  -- BB7Review - Toggle review mode (sends report findings via report_findings)
+  vim.api.nvim_create_user_command('BB7Review', function()
+    require('bb7.findings').toggle()
+  end, {
+    desc = 'Toggle BB7 code review mode',
+  })
+
+  -- BB7Findings - Load the active chat's review findings into the quickfix list
+  vim.api.nvim_create_user_command('BB7Findings', function()
+    ensure_initialized(function()
+      require('bb7.findings').quickfix()
+    end)
+  end, {
+    desc = 'Load BB7 review findings into the quickfix list',
+  })
+
   -- BB7Remove [path] - Remove file from context (default: current buffer)
   -- Requires an active chat - user must select one first
   vim.api.nvim_create_user_command('BB7Remove', function(opts)
@@ -894,6 +1123,78 @@ function M.setup(opts)
     desc = 'Open vim native diff for partial apply (local vs LLM output)',
   })
 
+  -- BB7Trash[!] - Restore a deleted chat (! for global chats)
+  vim.api.nvim_create_user_command('BB7Trash', function(opts)
+    ensure_initialized(function()
+      require('bb7.trash').pick_trash(opts.bang)
+    end)
+  end, {
+    bang = true,
+    desc = 'Restore a BB7 chat from the trash',
+  })
+
+  -- BB7Archived[!] - Unarchive a chat (! for global chats)
+  vim.api.nvim_create_user_command('BB7Archived', function(opts)
+    ensure_initialized(function()
+      require('bb7.trash').pick_archived(opts.bang)
+    end)
+  end, {
+    bang = true,
+    desc = 'Unarchive a BB7 chat',
+  })
+
+  -- BB7Cleanup[!] {archive|unarchive|delete} [older=DAYS] [name=GLOB] [empty]
+  vim.api.nvim_create_user_command('BB7Cleanup', function(opts)
+    ensure_initialized(function()
+      require('bb7.trash').cleanup(opts.fargs, opts.bang)
+    end)
+  end, {
+    bang = true,
+    nargs = '+',
+    complete = function(arg_lead)
+      return vim.tbl_filter(function(item)
+        return item:find(arg_lead, 1, true) == 1
+      end, { 'archive', 'unarchive', 'delete', 'older=', 'name=', 'empty' })
+    end,
+    desc = 'Archive, unarchive, or delete BB7 chats by age, name, or emptiness',
+  })
+
+  -- BB7Usage[!] - Show token and cost totals of the project's chats (! for global chats)
+  vim.api.nvim_create_user_command('BB7Usage', function(opts)
+    ensure_initialized(function()
+      require('bb7.usage').show(opts.bang)
+    end)
+  end, {
+    bang = true,
+    desc = 'Show token and cost totals of BB7 chats',
+  })
+
+  -- BB7ChatFilter [tag=TAG] [folder=PATH] [sort=ORDER] - Filter and sort the chat list
+  vim.api.nvim_create_user_command('BB7ChatFilter', function(opts)
+    local filter = {}
+    for _, arg in ipairs(opts.fargs) do
+      local key, value = arg:match('^(%w+)=(.+)$')
+      if key == 'tag' or key == 'folder' or key == 'sort' then
+        filter[key] = value
+      else
+        log.error('Usage: BB7ChatFilter [tag=TAG] [folder=PATH] [sort=created|activity|cost|tag]')
+        return
+      end
+    end
+    require('bb7.panes.chats').set_filter(filter)
+    if filter.tag or filter.folder then
+      log.info('Chat list filtered (:BB7ChatFilter to clear)')
+    end
+  end, {
+    nargs = '*',
+    complete = function(arg_lead)
+      return vim.tbl_filter(function(item)
+        return item:find(arg_lead, 1, true) == 1
+      end, { 'tag=', 'folder=', 'sort=created', 'sort=activity', 'sort=cost', 'sort=tag' })
+    end,
+    desc = 'Filter the BB7 chat list by tag or folder and set its sort order',
+  })
+
   -- BB7Search - Search chats using snacks.nvim picker or Telescope
   local has_snacks_picker = pcall(require, 'snacks')
   local has_telescope = pcall(require, 'telescope')
@@ -949,6 +1250,16 @@ function M.setup(opts)
         return
       end
       vim.cmd('edit ' .. vim.fn.fnameescape(response.path))
+      -- Report which @when blocks in this file applied to the last send
+      local report = response.instruction_blocks
+      if report and report ~= vim.NIL and #report.blocks > 0 then
+        local applied, skipped = {}, {}
+        for _, block in ipairs(report.blocks) do
+          table.insert(block.active and applied or skipped, tostring(block.line))
+        end
+        log.info(string.format('Last send (%s): @when blocks applied at lines [%s], skipped at [%s]',
+          report.model, table.concat(applied, ', '), table.concat(skipped, ', ')))
+      end
     end)
   end, {
     nargs = '?',
@@ -4,8 +4,6 @@ local M = {}
 local client = require('bb7.client')
 local log = require('bb7.log')
 
--- Pinned chats set (chat_id -> true), per-project
-local pinned_chats = {}
 local current_project_root = nil
 local viewing_global = false  -- true when viewing global chats
 
@@ -15,81 +13,43 @@ local mode_state = {
   [false] = { selected_idx = 1, topline = 1 },  -- project
 }
 
--- Get pinned chats path for current project or global
-local function get_pinned_path()
-  if viewing_global then
-    local home = os.getenv('HOME')
-    if not home then return nil end
-    return home .. '/.bb7/pinned_chats.json'
-  end
-  local project_root = current_project_root or client.get_project_root()
-  if not project_root then
-    return nil
-  end
-  return project_root .. '/.bb7/pinned_chats.json'
-end
-
--- Load pinned chats from disk (per-project)
-local function load_pinned()
-  pinned_chats = {}
-  local path = get_pinned_path()
-  if not path then
-    return
-  end
-
-  local file = io.open(path, 'r')
-  if not file then
-    return
-  end
+-- chat_list sort orders cycled with 's'
+local sort_orders = { 'created', 'activity', 'cost', 'tag' }
 
-  local content = file:read('*a')
-  file:close()
+-- chat_list options: sort order and tag/folder filter (see :BB7ChatFilter)
+local list_opts = { sort = 'created', tag = nil, folder = nil }
 
-  local ok, data = pcall(vim.json.decode, content)
-  if ok and data and data.chats then
-    for _, id in ipairs(data.chats) do
-      pinned_chats[id] = true
-    end
-  end
+-- Check if a chat is pinned (stored by the backend)
+local function is_pinned(chat)
+  return chat.pinned == true
 end
 
--- Save pinned chats to disk (per-project)
-local function save_pinned()
-  local path = get_pinned_path()
-  if not path then
-    return
-  end
-
-  -- Convert set to list
-  local list = {}
-  for id, _ in pairs(pinned_chats) do
-    table.insert(list, id)
+-- Chat cost for the list ('' when nothing was spent)
+local function format_cost(cost)
+  if type(cost) ~= 'number' or cost <= 0 then
+    return ''
   end
-  table.sort(list)
-
-  local data = { chats = list }
-  local json = vim.json.encode(data)
-
-  local file = io.open(path, 'w')
-  if file then
-    file:write(json)
-    file:close()
+  if cost < 0.01 then
+    return '<$0.01'
   end
+  return string.format('$%.2f', cost)
 end
 
--- Check if a chat is pinned
-local function is_pinned(chat_id)
-  return pinned_chats[chat_id] == true
-end
-
--- Toggle pinned status for a chat
-local function toggle_pin(chat_id)
-  if pinned_chats[chat_id] then
-    pinned_chats[chat_id] = nil
-  else
-    pinned_chats[chat_id] = true
+-- Tags and folder shown after the chat name
+local function chat_suffix(chat)
+  local parts = {}
+  if type(chat.folder) == 'string' and chat.folder ~= '' then
+    table.insert(parts, chat.folder .. '/')
   end
-  save_pinned()
+  if type(chat.tags) == 'table' then
+    for _, tag in ipairs(chat.tags) do
+      table.insert(parts, '#' .. tag)
+    end
+  end
+  if #parts == 0 then
+    return ''
+  end
+  return ' ' .. table.concat(parts, ' ')
 end
 
 -- Pane state
@@ -169,13 +129,40 @@ local function render()
     local is_active = state.active_idx and i == state.active_idx
     local is_locked = chat.locked
     local marker = is_active and '●' or ' '
-    local pin = is_pinned(chat.id) and '!' or ' '
+    local pin = is_pinned(chat) and '!' or ' '
     local lock = is_locked and '⊘' or ' '
     local prefix = pin .. marker .. lock .. ' '
     local prefix_width = vim.fn.strwidth(prefix)
-    local name_max_width = win_width - prefix_width
+    -- Cost right-aligned, when there is room for it next to a short name
+    local cost = format_cost(chat.cost)
+    if cost ~= '' and win_width - prefix_width - #cost < 12 then
+      cost = ''
+    end
+    local name_max_width = win_width - prefix_width - (cost ~= '' and #cost + 1 or 0)
+    -- Tags and folder only when the name still fits beside them
+    local suffix = chat_suffix(chat)
+    if vim.fn.strwidth(chat.name .. suffix) > name_max_width then
+      suffix = ''
+    end
     local name = truncate(chat.name, name_max_width)
-    local line = prefix .. name
+    local line = prefix .. name .. suffix
+    if suffix ~= '' then
+      table.insert(highlights, {
+        line = i - 1,
+        col_start = #prefix + #name,
+        col_end = #line,
+        hl = 'Comment',
+      })
+    end
+    if cost ~= '' then
+      line = line .. string.rep(' ', win_width - vim.fn.strwidth(line) - #cost) .. cost
+      table.insert(highlights, {
+        line = i - 1,
+        col_start = #line - #cost,
+        col_end = #line,
+        hl = 'Comment',
+      })
+    end
     table.insert(lines, line)
 
     -- Highlight the active marker (no background so cursorline shows through)
@@ -188,7 +175,7 @@ local function render()
       })
     end
     -- Highlight the pin indicator
-    if is_pinned(chat.id) then
+    if is_pinned(chat) then
       table.insert(highlights, {
         line = i - 1,
         col_start = 0,
@@ -264,13 +251,6 @@ local function select_chat(callback)
   local chat = state.chats[state.selected_idx]
   if not chat then return end
 
-  -- Block switching while streaming
-  local panes_input = require('bb7.panes.input')
-  if panes_input.is_sending() then
-    log.error('Cannot switch chats while streaming')
-    return
-  end
-
   -- Flush draft before switching
   if state.on_before_chat_switch then
     state.on_before_chat_switch()
@@ -457,7 +437,7 @@ local function regenerate_title()
   select_chat(do_regenerate)
 end
 
--- Delete the selected chat
+-- Move the selected chat to the trash (:BB7Trash restores it)
 local function delete_chat()
   if #state.chats == 0 then return end
   sync_selection_with_cursor()
@@ -466,7 +446,7 @@ local function delete_chat()
 
   local function prompt_delete(target_chat)
     local display_name = truncate_prompt(target_chat.name or '', 50)
-    local prompt = string.format('Delete chat "%s"?', display_name)
+    local prompt = string.format('Move chat "%s" to the trash?', display_name)
     local confirmed = vim.fn.confirm(prompt, '&Yes\n&No', 2)
     if confirmed ~= 1 then
       return
@@ -497,14 +477,134 @@ local function delete_chat()
   select_chat(prompt_delete)
 end
 
+-- Archive the selected chat: hidden from the list, still searchable
+local function archive_chat()
+  if #state.chats == 0 then return end
+  sync_selection_with_cursor()
+  local chat = state.chats[state.selected_idx]
+  if not chat then return end
+
+  local req = { action = 'chat_archive', id = chat.id }
+  if viewing_global then req.global = true end
+  client.request(req, function(_, err)
+    if err then
+      log.error('Failed to archive chat: ' .. tostring(err))
+      return
+    end
+    log.info('Archived "' .. (chat.name or '') .. '" (:BB7Archived to list)')
+    M.refresh()
+  end)
+end
+
 -- Toggle pin status for selected chat
 local function toggle_pin_selected()
   if #state.chats == 0 then return end
+  sync_selection_with_cursor()
   local chat = state.chats[state.selected_idx]
   if not chat then return end
 
-  toggle_pin(chat.id)
-  -- Re-sort and re-render
+  local req = { action = 'chat_pin', id = chat.id, pinned = not is_pinned(chat) }
+  if viewing_global then req.global = true end
+  client.request(req, function(_, err)
+    if err then
+      log.error('Failed to pin chat: ' .. tostring(err))
+      return
+    end
+    -- Re-sort and re-render
+    M.refresh()
+  end)
+end
+
+-- Edit the selected chat's tags (space-separated; removed words are untagged)
+local function edit_tags()
+  if #state.chats == 0 then return end
+  sync_selection_with_cursor()
+  local chat = state.chats[state.selected_idx]
+  if not chat then return end
+
+  local current = type(chat.tags) == 'table' and chat.tags or {}
+  vim.fn.inputsave()
+  local input = vim.fn.input({ prompt = 'Tags: ', default = table.concat(current, ' '), cancelreturn = '\n' })
+  vim.fn.inputrestore()
+  if input == '\n' then
+    return
+  end
+
+  local wanted = {}
+  for tag in input:gmatch('[^%s,]+') do
+    wanted[tag:lower():gsub('^#', '')] = true
+  end
+  local add, remove = {}, {}
+  for tag in pairs(wanted) do
+    if not vim.tbl_contains(current, tag) then
+      table.insert(add, tag)
+    end
+  end
+  for _, tag in ipairs(current) do
+    if not wanted[tag] then
+      table.insert(remove, tag)
+    end
+  end
+
+  local function request(action, tags, next_step)
+    if #tags == 0 then
+      next_step()
+      return
+    end
+    local req = { action = action, id = chat.id, tags = tags }
+    if viewing_global then req.global = true end
+    client.request(req, function(_, err)
+      if err then
+        log.error('Failed to update tags: ' .. tostring(err))
+        M.refresh()
+        return
+      end
+      next_step()
+    end)
+  end
+  request('chat_untag', remove, function()
+    request('chat_tag', add, function()
+      M.refresh()
+    end)
+  end)
+end
+
+-- Move the selected chat to a folder (empty input removes it from its folder)
+local function move_to_folder()
+  if #state.chats == 0 then return end
+  sync_selection_with_cursor()
+  local chat = state.chats[state.selected_idx]
+  if not chat then return end
+
+  vim.fn.inputsave()
+  local folder = vim.fn.input({ prompt = 'Folder: ', default = chat.folder or '', cancelreturn = '\n' })
+  vim.fn.inputrestore()
+  if folder == '\n' or folder == (chat.folder or '') then
+    return
+  end
+
+  local req = { action = 'chat_move_folder', id = chat.id, folder = folder }
+  if viewing_global then req.global = true end
+  client.request(req, function(_, err)
+    if err then
+      log.error('Failed to move chat to folder: ' .. tostring(err))
+      return
+    end
+    M.refresh()
+  end)
+end
+
+-- Cycle the chat list's sort order
+local function cycle_sort()
+  local next_idx = 1
+  for i, order in ipairs(sort_orders) do
+    if order == list_opts.sort then
+      next_idx = i % #sort_orders + 1
+      break
+    end
+  end
+  list_opts.sort = sort_orders[next_idx]
+  log.info('Chats sorted by ' .. list_opts.sort)
   M.refresh()
 end
 
@@ -521,8 +621,6 @@ local function toggle_mode()
   end
 
   viewing_global = not viewing_global
-  -- Reload pinned chats for the new mode
-  load_pinned()
   M.refresh(function()
     -- Restore cursor and scroll position for destination mode
     local saved = mode_state[viewing_global]
@@ -557,30 +655,14 @@ local function move_chat()
     return
   end
 
-  -- Check pinned status before move (while still in source scope)
-  local was_pinned = is_pinned(chat.id)
-
   client.request({ action = 'chat_move', id = chat.id, to = target }, function(_, err)
     if err then
       log.error('Failed to move chat: ' .. tostring(err))
       return
     end
 
-    -- Remove from source pinned list
-    if was_pinned then
-      pinned_chats[chat.id] = nil
-      save_pinned()
-    end
-
-    -- Switch to destination scope
+    -- Switch to destination scope (the pin moves with the chat)
     viewing_global = (target == 'global')
-    load_pinned()
-
-    -- Add to destination pinned list
-    if was_pinned then
-      pinned_chats[chat.id] = true
-      save_pinned()
-    end
 
     log.info('Moved "' .. (chat.name or '') .. '" to ' .. target .. ' chats')
 
@@ -651,7 +733,7 @@ function M.refresh(callback)
     active_chat_id = state.chats[state.active_idx].id
   end
 
-  local req = { action = 'chat_list' }
+  local req = { action = 'chat_list', sort = list_opts.sort, tag = list_opts.tag, folder = list_opts.folder }
   if viewing_global then req.global = true end
   client.request(req, function(response, err)
     if err then
@@ -663,14 +745,14 @@ function M.refresh(callback)
     -- Handle null/nil from JSON (becomes vim.NIL userdata)
     state.chats = (type(response.chats) == 'table') and response.chats or {}
 
-    -- Sort chats: pinned first, then preserve backend order (usually by modified date)
+    -- Sort chats: pinned first, then preserve backend order (see list_opts.sort)
     -- Add original index for stable sorting
     for i, chat in ipairs(state.chats) do
       chat._sort_idx = i
     end
     table.sort(state.chats, function(a, b)
-      local a_pinned = is_pinned(a.id)
-      local b_pinned = is_pinned(b.id)
+      local a_pinned = is_pinned(a)
+      local b_pinned = is_pinned(b)
       if a_pinned ~= b_pinned then
         return a_pinned  -- pinned chats come first
       end
@@ -737,7 +819,11 @@ function M.setup_keymaps(buf)
   vim.keymap.set('n', 'r', rename_chat, opts)
   vim.keymap.set('n', 'R', regenerate_title, opts)
   vim.keymap.set('n', 'd', delete_chat, opts)
+  vim.keymap.set('n', 'a', archive_chat, opts)
   vim.keymap.set('n', 'p', toggle_pin_selected, opts)
+  vim.keymap.set('n', 't', edit_tags, opts)
+  vim.keymap.set('n', 'f', move_to_folder, opts)
+  vim.keymap.set('n', 's', cycle_sort, opts)
   vim.keymap.set('n', '<C-s>', toggle_mode, opts)
   vim.keymap.set('n', 'u', force_unlock, opts)
   vim.keymap.set('n', 'm', move_chat, opts)
@@ -782,7 +868,8 @@ end
 
 -- Auto-create a chat if none exist
 function M.ensure_chat_exists(callback)
-  if #state.chats > 0 then
+  -- A filtered list may be empty while chats exist
+  if #state.chats > 0 or list_opts.tag or list_opts.folder then
     if callback then callback(false) end -- false = didn't create new
     return
   end
@@ -847,7 +934,9 @@ function M.get_hints()
   table.insert(parts, 'Select: <CR>')
   table.insert(parts, 'New: n')
   table.insert(parts, 'Pin: p')
+  table.insert(parts, 'Tags: t')
   table.insert(parts, 'Rename: r')
+  table.insert(parts, 'Archive: a')
   table.insert(parts, 'Delete: d')
   -- Show unlock hint if any chat in view is locked
   for _, chat in ipairs(state.chats) do
@@ -918,16 +1007,30 @@ function M.set_active_by_id(chat_id)
   return false
 end
 
--- Set project root and load pinned chats (called when project is initialized)
+-- Set project root (called when project is initialized)
 function M.set_project_root(project_root)
   current_project_root = project_root
-  load_pinned()
 end
 
 -- Set global mode (for global-only init)
 function M.set_global_mode(global)
   viewing_global = global
-  load_pinned()
+end
+
+-- Filter the chat list by tag and/or folder (nil clears) and optionally
+-- change its sort order
+function M.set_filter(opts)
+  list_opts.tag = opts.tag
+  list_opts.folder = opts.folder
+  if opts.sort then
+    list_opts.sort = opts.sort
+  end
+  M.refresh()
+end
+
+-- Current chat list options (sort order, tag and folder filter)
+function M.get_filter()
+  return vim.deepcopy(list_opts)
 end
 
 -- Check if viewing global chats
@@ -940,12 +1043,9 @@ function M.set_mock_chats(chats_list, active_idx, mock_pinned_ids)
   state.chats = chats_list or {}
   state.active_idx = active_idx
   state.selected_idx = active_idx or 1
-  -- Inject pinned set
-  pinned_chats = {}
-  if mock_pinned_ids then
-    for _, id in ipairs(mock_pinned_ids) do
-      pinned_chats[id] = true
-    end
+  -- Mark pinned chats
+  for _, chat in ipairs(state.chats) do
+    chat.pinned = mock_pinned_ids and vim.tbl_contains(mock_pinned_ids, chat.id) or nil
   end
   render()
   -- Position cursor
@@ -253,6 +253,11 @@ end
 -- Check if a file is out of sync (local differs from context)
 -- This is the ONLY status check done in frontend (needs buffer access)
 local function is_out_of_sync(path, context_content, is_external)
+  -- URL documents have no local copy to compare against
+  if path:match('^https?://') then
+    return false
+  end
+
   -- Find buffer for this file
   local project_root = client.get_project_root() or vim.fn.getcwd()
   local full_path = is_external and path or (project_root .. '/' .. path)
@@ -864,6 +869,11 @@ local function toggle_readonly()
     return
   end
 
+  if file.status == 'I' then
+    log.info('Images are always read-only')
+    return
+  end
+
   if file.external then
     log.info('External files are always read-only')
     return
@@ -1037,7 +1047,7 @@ local function put_all()
     -- Use backend's apply_file
     client.request({ action = 'apply_file', path = file.path }, function(response, err)
       if err then
-        log.error('Failed to apply ' .. file.path)
+        log.error('Failed to apply ' .. file.path .. ': ' .. tostring(err))
         applied = applied + 1
         if applied == total then
           M.refresh()
@@ -18,6 +18,7 @@ local state = {
   win = nil,
   mode = 'normal',   -- 'normal' or 'insert'
   sending = false,   -- Whether we're currently sending/streaming
+  queued = 0,        -- Follow-ups queued behind the current response
   chat_active = false, -- Whether a chat is selected/active
   on_message_sent = nil,  -- Callback when message is sent
   on_stream_chunk = nil,  -- Callback for streaming chunks
@@ -34,6 +35,7 @@ local state = {
   estimate_timer = nil,  -- Debounce timer for input-based re-estimation
   last_estimate_len = 0, -- Character length at last estimate
   reasoning_level = 'none', -- Current reasoning effort: 'none', 'low', 'medium', 'high'
+  review = false,    -- Review mode: sends ask for report_findings findings
   augroup = nil,     -- Autocmd group
   draft_timer = nil, -- Debounce timer for draft saving
   last_saved_draft = nil, -- Track last saved draft to avoid redundant saves
@@ -97,11 +99,65 @@ local function build_stream_handlers()
   }
 end
 
-local function send_message()
-  if state.sending then
+-- Build a send request for content with the current model and reasoning level.
+-- Template front-matter overrides the model and reasoning level in the backend.
+local function build_send_request(content)
+  local request = { action = 'send', content = content }
+  -- "/name rest" sends through a template; the backend renders it
+  local templates = require('bb7.templates')
+  local template, rest = templates.parse(content)
+  if template then
+    request.template = template
+    request.content = rest
+    request.variables = templates.variables()
+  end
+  local models = require('bb7.models')
+  local current_model = models.get_current()
+  if current_model then
+    request.model = current_model
+  end
+  -- The backend rejects reasoning for known models that don't support it
+  local known = current_model and models.get_model_info(current_model)
+  if state.reasoning_level ~= 'none' and (not known or models.supports_reasoning(current_model)) then
+    request.reasoning_effort = state.reasoning_level
+  end
+  if state.review then
+    request.review = true
+  end
+  return request
+end
+
+-- Line up a follow-up behind the running response; the backend sends it when
+-- the response finishes
+local function queue_message()
+  local content = vim.trim(get_content())
+  if content == '' then
     log.warn('Already sending')
     return
   end
+  local chat = require('bb7.panes.preview').get_chat()
+  clear_input()
+  state.last_saved_draft = ''
+  client.request({ action = 'save_draft', draft = '' }, function() end)
+  if vim.fn.mode() == 'i' then
+    vim.cmd('stopinsert')
+  end
+  local chat_id = chat and chat.id
+  state.queued = state.queued + 1
+  require('bb7.queue').send(build_send_request(content), chat_id, function()
+    -- The count belongs to the chat on screen
+    local current = require('bb7.panes.preview').get_chat()
+    if current and current.id == chat_id then
+      state.queued = math.max(state.queued - 1, 0)
+    end
+  end)
+end
+
+local function send_message()
+  if state.sending or state.queued > 0 then
+    queue_message()
+    return
+  end
 
   if not client.is_running() then
     log.error('BB-7 process not running')
@@ -166,18 +222,38 @@ local function send_message()
     vim.cmd('stopinsert')
   end
 
-  -- Send to backend (with applied files note if any, and current model)
-  local request = { action = 'send', content = content }
+  -- Send to backend (with retry context if any, current model and reasoning)
+  local request = build_send_request(content)
   if retry then
     request.retry_context = retry
   end
-  local current_model = require('bb7.models').get_current()
-  if current_model then
-    request.model = current_model
+  client.stream(request, build_stream_handlers())
+end
+
+-- Answer the last message again, optionally with another model. The backend
+-- keeps the previous reply as an alternate (:BB7Variants switches back).
+function M.regenerate(model)
+  if state.sending then
+    log.warn('Wait for the current response to finish')
+    return
   end
-  -- Include reasoning effort if enabled
-  if state.reasoning_level ~= 'none' then
-    request.reasoning_effort = state.reasoning_level
+  if not client.is_initialized() or not state.chat_active then
+    log.warn('No active chat yet')
+    return
+  end
+  local request = build_send_request('')
+  request.action = 'regenerate'
+  request.content = nil
+  request.template = nil
+  request.variables = nil
+  if model and model ~= '' then
+    request.model = model
+  end
+  state.retry_context = nil
+  state.sending = true
+  require('bb7.panes.preview').drop_last_reply()
+  if state.on_message_sent then
+    state.on_message_sent(nil)
   end
   client.stream(request, build_stream_handlers())
 end
@@ -544,6 +620,43 @@ function M.focus_insert()
   end
 end
 
+-- Keep the running stream going in the background after switching away from
+-- its chat. The backend saves the reply to that chat when it finishes.
+function M.detach_stream(chat)
+  state.queued = 0
+  if not state.sending then return end
+  state.sending = false
+  local name = (chat.name and chat.name ~= '') and chat.name or chat.id
+  local function finished(usage)
+    if usage then
+      require('bb7.panes.provider').update_usage(usage)
+    end
+    vim.schedule(function()
+      if require('bb7.ui').is_open() then
+        require('bb7.panes.chats').refresh()
+      end
+    end)
+  end
+  local detached = client.detach_stream({
+    on_done = function(_, usage)
+      finished(usage)
+      log.info('Response finished in "' .. name .. '"')
+    end,
+    on_diff_error = function(data)
+      finished(data.usage)
+      log.warn('Response in "' .. name .. '" has edit errors')
+    end,
+    on_error = function(err)
+      if err ~= 'Response aborted by user.' then
+        log.error(name .. ': ' .. err)
+      end
+    end,
+  })
+  if detached then
+    log.info('Response continues in the background in "' .. name .. '"')
+  end
+end
+
 -- Check if currently sending
 function M.is_sending()
   return state.sending
@@ -566,7 +679,7 @@ function M.get_hints()
   end
 
   if state.sending then
-    return 'Streaming... | Cancel: <C-x>'
+    return 'Streaming... | Send queues a follow-up | Cancel: <C-x>'
   end
 
   if state.retry_context then
@@ -656,6 +769,7 @@ function M.cleanup()
   state.win = nil
   state.mode = 'normal'
   state.sending = false
+  state.queued = 0
   state.estimate = nil
   state.estimate_timer = nil
   state.last_estimate_len = 0
@@ -712,6 +826,19 @@ function M.get_reasoning_level()
   return state.reasoning_level
 end
 
+-- Toggle review mode for the following sends
+function M.toggle_review()
+  state.review = not state.review
+  log.info('Review mode: ' .. (state.review and 'on' or 'off'))
+  if state.on_footer_changed then
+    state.on_footer_changed()
+  end
+end
+
+function M.is_review()
+  return state.review
+end
+
 -- Get footer text for display (shows reasoning indicator and current model)
 function M.get_footer()
   local models = require('bb7.models')
@@ -722,6 +849,10 @@ function M.get_footer()
 
   local parts = {}
 
+  if state.review then
+    table.insert(parts, 'review')
+  end
+
   -- Add reasoning indicator if model supports it
   if models.supports_reasoning(current_model) then
     local indicator = REASONING_DISPLAY[state.reasoning_level] or '▱▱▱'
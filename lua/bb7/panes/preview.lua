@@ -173,6 +173,14 @@ function M.set_chat(chat)
       and chat.instructions_info.project_error ~= '' then
     instr_error = chat.instructions_info.project_error
   end
+  if not instr_error and chat and chat.instructions_info then
+    for _, dir in ipairs(chat.instructions_info.directories or {}) do
+      if dir.error and dir.error ~= '' then
+        instr_error = dir.error
+        break
+      end
+    end
+  end
   local had_error = state.send_error ~= nil
   state.send_error = instr_error
   state.diff_error = nil -- Clear diff error on chat refresh
@@ -197,6 +205,22 @@ function M.get_chat()
   return state.chat
 end
 
+-- Remove the reply to the last user message from the display while it is
+-- regenerated
+function M.drop_last_reply()
+  local messages = state.chat and state.chat.messages
+  if not messages then return end
+  for i = #messages, 1, -1 do
+    if messages[i].role == 'user' then
+      for j = #messages, i + 1, -1 do
+        table.remove(messages, j)
+      end
+      break
+    end
+  end
+  shared.stream_cache = nil
+end
+
 -- Start streaming mode (optionally with user message to show immediately)
 function M.start_streaming(user_message)
   stream.start_streaming(user_message)
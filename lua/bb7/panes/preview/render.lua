@@ -304,6 +304,9 @@ local function render_header(lines)
         table.insert(instr_parts, 'project')
       end
     end
+    for _, dir in ipairs(instructions_info.directories or {}) do
+      table.insert(instr_parts, dir.error and (dir.path .. ' (!)') or dir.path)
+    end
     if #instr_parts > 0 then
       format.add_styled_line(lines, 'Instructions: ' .. table.concat(instr_parts, ', '), 'BB7UserActionBar', 'BB7UserActionText', true, nil, nil)
     end
@@ -467,6 +470,12 @@ function M.render_text_part(lines, role, content)
   render_text_part({ content = content }, lines, role)
 end
 
+-- Finish reasons shown after a stored reply that ended early
+local STOP_REASONS = {
+  length = 'output limit reached',
+  content_filter = 'content filter',
+}
+
 local function render_meta_line(text, lines)
   local icon, icon_fg = format.get_prefix_icon('BB7UserAction')
   format.add_styled_line(lines, text, 'BB7UserActionBar', 'BB7UserActionText', true, icon, icon_fg)
@@ -614,10 +623,41 @@ local function render_reasoning_part(part, lines, collapsed, reasoning_id, msg_i
   end
 end
 
+-- Render a review finding: "severity path:lines [category]: message",
+-- followed by the suggested fix if there is one
+local function render_finding_part(part, lines)
+  local f = part.finding
+  if not f then return false end
+  local icon, icon_fg = format.get_prefix_icon('BB7AssistantAction')
+  local loc = (f.path or 'unknown') .. ':' .. tostring(f.start_line or 0)
+  if f.end_line and f.start_line and f.end_line > f.start_line then
+    loc = loc .. '-' .. tostring(f.end_line)
+  end
+  local header = (f.severity or 'info') .. ' ' .. loc
+  if f.category and f.category ~= '' then
+    header = header .. ' [' .. f.category .. ']'
+  end
+  local width = format.get_text_width(2)
+  for i, line in ipairs(format.wrap_text(header .. ': ' .. (f.message or ''), width)) do
+    if i == 1 then
+      format.add_styled_line(lines, line, 'BB7AssistantActionBar', 'BB7AssistantActionText', true, icon, icon_fg)
+    else
+      format.add_styled_line(lines, '  ' .. line, 'BB7AssistantActionBar', 'BB7AssistantActionText', true, nil, nil)
+    end
+  end
+  if f.suggested_fix and f.suggested_fix ~= '' then
+    format.add_styled_line(lines, '  Suggested fix:', 'BB7AssistantActionBar', 'BB7AssistantActionText', true, nil, nil)
+    for _, line in ipairs(vim.split(vim.trim(f.suggested_fix), '\n', { plain = true })) do
+      format.add_styled_line(lines, '    ' .. line, 'BB7AssistantActionBar', 'BB7AssistantActionText', true, nil, nil)
+    end
+  end
+  return true
+end
+
 -- Render message parts (structured format)
 -- msg_idx is used to create unique IDs for thinking blocks
 -- role is 'user' or 'assistant' for text styling
--- Returns the last rendered part type ('text', 'context_event', 'thinking', or nil)
+-- Returns the last rendered part type ('text', 'context_event', 'finding', 'thinking', or nil)
 local function render_parts(parts, lines, msg_idx, role)
   local prev_type = shared.state.last_rendered_type  -- Continue from previous message
 
@@ -660,6 +700,10 @@ local function render_parts(parts, lines, msg_idx, role)
       -- Only empty line if previous was different type (group consecutive actions)
       if prev_type and prev_type ~= 'context_event' then format.add_empty_line(lines) end
       rendered = render_context_event(part, lines)
+    elseif part_type == 'finding' then
+      -- Consecutive findings are grouped like context events
+      if prev_type and prev_type ~= 'finding' then format.add_empty_line(lines) end
+      rendered = render_finding_part(part, lines)
     elseif part_type == 'thinking' then
       -- Empty line before thinking (separates from previous content)
       if prev_type then format.add_empty_line(lines) end
@@ -699,7 +743,7 @@ local function render_system_message(msg, lines)
     -- Collect fork warnings
     local fork_warnings = {}
     for _, part in ipairs(msg.parts) do
-      if part.type == 'context_event' and (part.action == 'ForkWarningModified' or part.action == 'ForkWarningDeleted') then
+      if part.type == 'context_event' and (part.action == 'ForkWarningModified' or part.action == 'ForkWarningDeleted' or part.action == 'ForkWarningMissing') then
         table.insert(fork_warnings, part)
       end
     end
@@ -714,6 +758,8 @@ local function render_system_message(msg, lines)
         local text
         if part.action == 'ForkWarningDeleted' then
           text = path .. ' no longer exists'
+        elseif part.action == 'ForkWarningMissing' then
+          text = 'image ' .. path .. ' is missing from disk'
         else
           text = path .. ' differs from the forked chat state'
         end
@@ -924,6 +970,7 @@ function M.render()
     -- Messages
     if shared.state.chat and shared.state.chat.messages then
       local last_user_model = nil
+      local last_persona = nil
       for msg_idx, msg in ipairs(shared.state.chat.messages) do
         if msg.role == 'user' and msg.model and msg.model ~= '' then
           if not last_user_model or last_user_model ~= msg.model then
@@ -938,7 +985,35 @@ function M.render()
           end
           last_user_model = msg.model
         end
+        if msg.role == 'assistant' then
+          local persona = msg.persona ~= '' and msg.persona or nil
+          if persona and persona ~= last_persona then
+            if shared.state.last_rendered_type then
+              format.add_empty_line(lines)
+            end
+            render_meta_line('Persona: ' .. persona, lines)
+            shared.state.last_rendered_type = 'meta'
+            shared.state.last_rendered_role = 'assistant'
+          end
+          last_persona = persona
+        end
         render_message(msg, lines, msg_idx)
+        -- Earlier replies kept by regenerate
+        if msg.role == 'user' and type(msg.alternates) == 'table' and #msg.alternates > 0 then
+          format.add_empty_line(lines)
+          local n = #msg.alternates
+          render_meta_line(n .. ' earlier ' .. (n == 1 and 'reply' or 'replies') .. ' (:BB7Variants)', lines)
+          shared.state.last_rendered_type = 'meta'
+          shared.state.last_rendered_role = 'user'
+        end
+        -- Replies that ended early say why
+        local stopped = msg.role == 'assistant' and STOP_REASONS[msg.finish_reason]
+        if stopped then
+          format.add_empty_line(lines)
+          render_meta_line('Stopped: ' .. stopped, lines)
+          shared.state.last_rendered_type = 'meta'
+          shared.state.last_rendered_role = 'assistant'
+        end
       end
     end
 
@@ -13,7 +13,7 @@ local state = {
   project_root = nil,   -- Project root directory
   active_chat_global = false, -- true when the active chat is a global chat
   has_active_chat = false,    -- true when any chat is active
-  customization = nil,  -- { system_override, global_instructions, project_instructions, project_instructions_error }
+  customization = nil,  -- { system_override, global_instructions, project_instructions, project_instructions_error, instruction_blocks }
   context_estimate = nil, -- Estimated token count for full context
   context_limit = nil,    -- Model context_length
   max_completion = nil,   -- Model max_completion_tokens
@@ -203,7 +203,18 @@ local function render()
   else
     left4 = ' Context: -'
   end
-  table.insert(lines, left4)
+  -- Scoped instruction blocks (@when) that applied to the last send
+  local right4, hl4 = nil, nil
+  local report = state.customization and state.customization.instruction_blocks
+  if report and #report.blocks > 0 then
+    local active = 0
+    for _, block in ipairs(report.blocks) do
+      if block.active then active = active + 1 end
+    end
+    right4 = string.format(narrow and 'Scoped %d/%d' or 'Scoped instr. %d/%d', active, #report.blocks)
+    hl4 = 'Comment'
+  end
+  table.insert(lines, build_line(left4, right4, hl4))
 
   vim.bo[state.buf].modifiable = true
   vim.api.nvim_buf_set_lines(state.buf, 0, -1, false, lines)
@@ -266,6 +277,7 @@ function M.refresh_customization()
         global_instructions = response.global_instructions,
         project_instructions = response.project_instructions,
         project_instructions_error = response.project_instructions_error,
+        instruction_blocks = response.instruction_blocks ~= vim.NIL and response.instruction_blocks or nil,
       }
       render()
     end
@@ -282,6 +294,8 @@ function M.update_usage(usage)
     render()
     -- Also refresh balance to get updated account total
     M.refresh_balance()
+    -- The send decided which scoped instruction blocks applied
+    M.refresh_customization()
   end
 end
 
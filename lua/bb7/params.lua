@@ -0,0 +1,86 @@
+-- Per-chat generation parameters (:BB7Params)
+
+local M = {}
+
+local log = require('bb7.log')
+
+local KEYS = { 'max_tokens', 'temperature', 'top_p', 'reasoning_max_tokens', 'reasoning_exclude' }
+
+-- Parse "key=value" arguments into a generation update. An empty value
+-- clears the key (sent as null).
+local function parse(args)
+  local update = {}
+  for _, arg in ipairs(args) do
+    local key, value = arg:match('^([%w_]+)=(.*)$')
+    if not key or not vim.tbl_contains(KEYS, key) then
+      return nil, 'Expected key=value with key one of: ' .. table.concat(KEYS, ', ')
+    end
+    if value == '' then
+      update[key] = vim.NIL
+    elseif key == 'reasoning_exclude' then
+      if value ~= 'true' and value ~= 'false' then
+        return nil, key .. ' must be true or false'
+      end
+      update[key] = value == 'true'
+    else
+      local n = tonumber(value)
+      if not n then
+        return nil, key .. ' must be a number'
+      end
+      update[key] = n
+    end
+  end
+  return update
+end
+
+local function format(generation)
+  if not generation or vim.tbl_isempty(generation) then
+    return 'Generation: defaults'
+  end
+  local items = {}
+  for _, key in ipairs(KEYS) do
+    if generation[key] ~= nil then
+      table.insert(items, key .. '=' .. tostring(generation[key]))
+    end
+  end
+  return 'Generation: ' .. table.concat(items, ' ')
+end
+
+-- :BB7Params [key=value ...]: show or change the active chat's parameters
+function M.command(args)
+  local client = require('bb7.client')
+  if #args == 0 then
+    client.request({ action = 'chat_get' }, function(resp, err)
+      if err then
+        log.error(err)
+        return
+      end
+      vim.schedule(function()
+        log.info(format(resp.generation ~= vim.NIL and resp.generation or nil))
+      end)
+    end)
+    return
+  end
+  local update, parse_err = parse(args)
+  if not update then
+    log.error(parse_err)
+    return
+  end
+  client.request({ action = 'save_chat_settings', generation = update }, function(resp, err)
+    if err then
+      log.error('Failed to set parameters: ' .. err)
+      return
+    end
+    vim.schedule(function()
+      log.info(format(resp.generation ~= vim.NIL and resp.generation or nil))
+    end)
+  end)
+end
+
+function M.complete(arg_lead)
+  return vim.tbl_filter(function(item)
+    return item:find(arg_lead, 1, true) == 1
+  end, vim.tbl_map(function(key) return key .. '=' end, KEYS))
+end
+
+return M
@@ -0,0 +1,80 @@
+-- Personas: named system prompt fragments from config.json, selected per chat
+
+local M = {}
+
+local log = require('bb7.log')
+
+-- Apply a save_chat_settings response to the model and reasoning indicators
+local function apply(resp)
+  if resp.model and resp.model ~= '' then
+    require('bb7.models').set_current(resp.model)
+  end
+  local panes_input = require('bb7.panes.input')
+  panes_input.set_reasoning_level(resp.reasoning_effort ~= '' and resp.reasoning_effort or 'none')
+  panes_input.set_model(resp.model)
+end
+
+-- Select a persona for the active chat ('' clears it)
+function M.select(name)
+  local client = require('bb7.client')
+  client.request({ action = 'save_chat_settings', persona = name }, function(resp, err)
+    if err then
+      log.error('Failed to set persona: ' .. err)
+      return
+    end
+    vim.schedule(function()
+      if name == '' then
+        log.info('Persona cleared')
+        return
+      end
+      apply(resp)
+      log.info('Persona: ' .. name)
+    end)
+  end)
+end
+
+-- Fetch the configured personas
+function M.list(callback)
+  local client = require('bb7.client')
+  client.request({ action = 'persona_list' }, function(resp, err)
+    if err then
+      log.error(err)
+      return
+    end
+    vim.schedule(function()
+      callback(resp.personas or {})
+    end)
+  end)
+end
+
+-- :BB7Persona [name]: select a persona, picking one if no name is given
+function M.pick(name)
+  if name and name ~= '' then
+    M.select(name == 'none' and '' or name)
+    return
+  end
+  M.list(function(personas)
+    if #personas == 0 then
+      log.info('No personas configured in ~/.config/bb7/config.json')
+      return
+    end
+    local items = vim.list_extend({ { name = 'none', description = 'No persona' } }, personas)
+    vim.ui.select(items, {
+      prompt = 'Persona',
+      format_item = function(p)
+        local text = p.name
+        if p.description and p.description ~= '' then
+          text = text .. '  ' .. p.description
+        end
+        if p.model and p.model ~= '' then
+          text = text .. '  [' .. p.model .. ']'
+        end
+        return text
+      end,
+    }, function(p)
+      if p then M.select(p.name == 'none' and '' or p.name) end
+    end)
+  end)
+end
+
+return M
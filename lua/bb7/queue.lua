@@ -0,0 +1,111 @@
+-- Send queue: follow-ups lined up behind a running response, and sends that
+-- were interrupted when the backend exited
+
+local M = {}
+
+local log = require('bb7.log')
+
+-- Reload a chat if it is on screen and idle, so a reply that finished in the
+-- background shows up
+local function reload_if_displayed(chat_id)
+  local ui = require('bb7.ui')
+  if not ui.is_open() then return end
+  require('bb7.panes.chats').refresh()
+  local chat = require('bb7.panes.preview').get_chat()
+  if chat and chat.id == chat_id and not require('bb7.panes.input').is_sending() then
+    ui.switch_chat(chat_id, nil, { global = chat.global })
+  end
+end
+
+-- Follow a queued or resumed send until it finishes
+local function watch(request_id, chat_id, label, on_finish)
+  local function finished(usage)
+    if usage then
+      require('bb7.panes.provider').update_usage(usage)
+    end
+    if on_finish then on_finish() end
+    vim.schedule(function() reload_if_displayed(chat_id) end)
+  end
+  require('bb7.client').watch_stream(request_id, {
+    on_done = function(_, usage)
+      log.info(label .. ' finished')
+      finished(usage)
+    end,
+    on_diff_error = function(data)
+      log.warn(label .. ' finished with edit errors')
+      finished(data.usage)
+    end,
+    on_error = function(err)
+      if on_finish then on_finish() end
+      if err ~= 'Response aborted by user.' then
+        log.error(label .. ': ' .. err)
+      end
+    end,
+  })
+end
+
+-- Queue a send request behind the active chat's running response
+function M.send(request, chat_id, on_finish)
+  request.queue = true
+  local id = require('bb7.client').send(request)
+  watch(id, chat_id, 'Queued message', on_finish)
+  log.info('Queued: sends when the current response finishes')
+end
+
+local function format_item(item)
+  local text = item.content:gsub('%s+', ' ')
+  if #text > 60 then
+    text = text:sub(1, 57) .. '...'
+  end
+  local scope = item.global and 'global ' or ''
+  return string.format('[%s] %schat %s: %s', item.status, scope, item.chat_id, text)
+end
+
+local function resume(item)
+  local client = require('bb7.client')
+  local id = client.send({ action = 'queue_resume', id = item.id })
+  watch(id, item.chat_id, 'Resumed send')
+  log.info('Resuming send in chat ' .. item.chat_id)
+end
+
+local function cancel(item)
+  require('bb7.client').request({ action = 'queue_cancel', id = item.id }, function(_, err)
+    if err then
+      log.error(err)
+      return
+    end
+    log.info('Removed send from queue')
+  end)
+end
+
+-- Pick a queued or interrupted send, then resume or cancel it
+function M.pick()
+  require('bb7.client').request({ action = 'queue_list' }, function(resp, err)
+    if err then
+      log.error(err)
+      return
+    end
+    vim.schedule(function()
+      if #resp.items == 0 then
+        log.info('The send queue is empty')
+        return
+      end
+      vim.ui.select(resp.items, {
+        prompt = 'Send queue',
+        format_item = format_item,
+      }, function(item)
+        if not item then return end
+        local actions = item.status == 'running' and { 'Cancel' } or { 'Resume', 'Cancel' }
+        vim.ui.select(actions, { prompt = 'Queued send' }, function(action)
+          if action == 'Resume' then
+            resume(item)
+          elseif action == 'Cancel' then
+            cancel(item)
+          end
+        end)
+      end)
+    end)
+  end)
+end
+
+return M
@@ -76,30 +76,14 @@ local function open_picker()
       return function(add)
         local async = ctx.async
         local results = {}
-        local pending = 2
 
         vim.schedule(function()
-          -- Search project chats
+          -- One request searches project and global chats
           client.request({ action = 'search_chats', query = search }, function(response, err)
             if not err and type(response.results) == 'table' then
-              for _, chat in ipairs(response.results) do
-                table.insert(results, chat)
-              end
+              results = response.results
             end
-            pending = pending - 1
-            if pending == 0 then async:resume() end
-          end)
-
-          -- Search global chats
-          client.request({ action = 'search_chats', query = search, global = true }, function(response, err)
-            if not err and type(response.results) == 'table' then
-              for _, chat in ipairs(response.results) do
-                chat.global = true
-                table.insert(results, chat)
-              end
-            end
-            pending = pending - 1
-            if pending == 0 then async:resume() end
+            async:resume()
           end)
         end)
         async:suspend()
@@ -23,6 +23,9 @@ local function format_entry(entry)
   if entry.value.match_type == 'content' and entry.value.excerpt then
     display = display .. ' | ' .. entry.value.excerpt
   end
+  if entry.value.global then
+    display = display .. ' (Global)'
+  end
   return display
 end
 
@@ -67,20 +70,12 @@ local function format_chat_preview(chat)
   return lines
 end
 
--- Custom sorter that prioritizes title matches over content matches
--- Title matches (from backend) appear at bottom (lower score = higher priority)
--- Content matches appear at top (higher score = lower priority)
+-- Sorter that keeps the backend's ranking (best match nearest the prompt)
 local function chat_sorter()
   return sorters.Sorter:new({
     scoring_function = function(_, prompt, line, entry)
-      -- Backend already filtered results, just order by match type
-      if entry.value.match_type == 'title' then
-        -- Title match: low score = appears at bottom (near input)
-        return 1 + (entry.index or 0) * 0.001
-      else
-        -- Content match: higher score = appears at top
-        return 10 + (entry.index or 0) * 0.001
-      end
+      -- Backend already filtered and ranked results
+      return 1 + (entry.index or 0) * 0.001
     end,
 
     -- No highlighting needed since backend does the filtering
@@ -100,7 +95,10 @@ local function chat_previewer()
       vim.api.nvim_buf_set_lines(self.state.bufnr, 0, -1, false, { 'Loading...' })
 
       -- Select and get the full chat
-      client.request({ action = 'chat_select', id = entry.value.id }, function(_, select_err)
+      local select_req = { action = 'chat_select', id = entry.value.id }
+      if entry.value.global then select_req.global = true end
+
+      client.request(select_req, function(_, select_err)
         if select_err then
           vim.schedule(function()
             if vim.api.nvim_buf_is_valid(self.state.bufnr) then
@@ -237,7 +235,9 @@ function M.search_chats(opts)
             if entry then
               -- Open BB7 and switch to selected chat
               ui.open()
-              client.request({ action = 'chat_select', id = entry.value.id }, function(_, select_err)
+              local select_req = { action = 'chat_select', id = entry.value.id }
+              if entry.value.global then select_req.global = true end
+              client.request(select_req, function(_, select_err)
                 if select_err then
                   log.error('Failed to select chat: ' .. select_err)
                   return
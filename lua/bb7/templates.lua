@@ -0,0 +1,143 @@
+-- Prompt templates: /name slash commands in the input pane, rendered by the
+-- backend from ~/.config/bb7/templates/ and .bb7/templates/
+
+local M = {}
+
+local log = require('bb7.log')
+
+local state = {
+  names = {},    -- set of known template names (filled by refresh)
+  captured = {}, -- file, language and selection of the editor buffer
+}
+
+-- Reload the template names used to recognize slash commands
+function M.refresh(callback)
+  local client = require('bb7.client')
+  if not client.is_initialized() then
+    if callback then callback({}) end
+    return
+  end
+  client.request({ action = 'template_list' }, function(resp, err)
+    if err then
+      log.error('Failed to list templates: ' .. err)
+      if callback then callback({}) end
+      return
+    end
+    state.names = {}
+    for _, tmpl in ipairs(resp.templates) do
+      state.names[tmpl.name] = true
+    end
+    if callback then callback(resp.templates) end
+  end)
+end
+
+-- Remember the current editor buffer as {{file}} and {{language}}, and the
+-- given line range (opts.range == 2) as {{selection}}. BB-7's own buffers are
+-- ignored. Returns the captured variables.
+function M.capture(opts)
+  local buf = vim.api.nvim_get_current_buf()
+  if vim.bo[buf].buftype ~= '' then
+    return state.captured
+  end
+  local captured = {}
+  local name = vim.api.nvim_buf_get_name(buf)
+  if name ~= '' then
+    captured.file = vim.fn.fnamemodify(name, ':.')
+  end
+  captured.language = vim.bo[buf].filetype
+  if opts and opts.range == 2 then
+    local lines = vim.api.nvim_buf_get_lines(buf, opts.line1 - 1, opts.line2, false)
+    captured.selection = table.concat(lines, '\n')
+  end
+  state.captured = captured
+  M.refresh()
+  return captured
+end
+
+-- Variables for a send: the captured editor state plus the clipboard.
+-- A captured selection is used once.
+function M.variables()
+  local vars = vim.deepcopy(state.captured)
+  local ok, clipboard = pcall(vim.fn.getreg, '+')
+  if ok and clipboard ~= '' then
+    vars.clipboard = clipboard
+  end
+  state.captured.selection = nil
+  return vars
+end
+
+-- Split "/name rest" into a known template name and the rest of the message
+function M.parse(content)
+  local name, rest = content:match('^/([%w_%-]+)%s*(.*)$')
+  if name and state.names[name] then
+    return name, rest
+  end
+  return nil
+end
+
+function M.names()
+  local names = vim.tbl_keys(state.names)
+  table.sort(names)
+  return names
+end
+
+-- Put "/name " in the input pane, keeping vars for the send
+local function insert(name, vars)
+  local ui = require('bb7.ui')
+  local input = require('bb7.panes.input')
+  local draft = '/' .. name .. ' '
+  if ui.is_open() then
+    state.captured = vars
+    input.set_draft(draft)
+    input.focus_insert()
+    return
+  end
+  -- The draft is restored from the chat when the UI opens
+  require('bb7.client').request({ action = 'save_draft', draft = draft }, function(_, err)
+    if err then
+      log.error(err)
+      return
+    end
+    vim.schedule(function()
+      ui.open()
+      -- Opening captured the editor buffer again, without the range
+      state.captured = vars
+      input.focus_insert()
+    end)
+  end)
+end
+
+-- :BB7Template [name]: capture the editor state (and range) and start a
+-- slash command, picking the template if no name is given
+function M.start(name, opts)
+  local vars = M.capture(opts)
+  if name and name ~= '' then
+    insert(name, vars)
+    return
+  end
+  M.refresh(function(templates)
+    vim.schedule(function()
+      if #templates == 0 then
+        log.info('No templates in ~/.config/bb7/templates/ or .bb7/templates/')
+        return
+      end
+      vim.ui.select(templates, {
+        prompt = 'Template',
+        format_item = function(tmpl)
+          local text = '/' .. tmpl.name
+          if tmpl.error then
+            return text .. '  (error: ' .. tmpl.error .. ')'
+          end
+          if tmpl.description then
+            text = text .. '  ' .. tmpl.description
+          end
+          return text
+        end,
+      }, function(tmpl)
+        if tmpl then insert(tmpl.name, vars) end
+      end)
+    end)
+  end)
+end
+
+return M
@@ -0,0 +1,155 @@
+-- Trash, archive, and bulk cleanup (:BB7Trash, :BB7Archived, :BB7Cleanup)
+
+local M = {}
+
+local client = require('bb7.client')
+local log = require('bb7.log')
+
+-- Refresh the chats pane if it is open
+local function refresh_chats()
+  vim.schedule(function()
+    require('bb7.panes.chats').refresh()
+  end)
+end
+
+-- :BB7Trash[!]: pick a deleted chat and restore it
+function M.pick_trash(global)
+  global = global or client.is_global_only()
+  client.request({ action = 'trash_list', global = global }, function(response, err)
+    if err then
+      log.error('Failed to list trash: ' .. tostring(err))
+      return
+    end
+    local chats = type(response.chats) == 'table' and response.chats or {}
+    if #chats == 0 then
+      log.info('The trash is empty')
+      return
+    end
+    vim.schedule(function()
+      vim.ui.select(chats, {
+        prompt = string.format('Restore chat (kept %d days)', response.retention_days or 0),
+        format_item = function(chat)
+          return (chat.trashed or ''):sub(1, 10) .. '  ' .. (chat.name or chat.id)
+        end,
+      }, function(chat)
+        if not chat then return end
+        client.request({ action = 'chat_restore', id = chat.id, global = global }, function(_, restore_err)
+          if restore_err then
+            log.error('Failed to restore chat: ' .. tostring(restore_err))
+            return
+          end
+          log.info('Restored "' .. (chat.name or '') .. '"')
+          refresh_chats()
+        end)
+      end)
+    end)
+  end)
+end
+
+-- :BB7Archived[!]: pick an archived chat and unarchive it
+function M.pick_archived(global)
+  global = global or client.is_global_only()
+  client.request({ action = 'chat_list', archived = true, global = global }, function(response, err)
+    if err then
+      log.error('Failed to list archived chats: ' .. tostring(err))
+      return
+    end
+    local chats = type(response.chats) == 'table' and response.chats or {}
+    if #chats == 0 then
+      log.info('No archived chats')
+      return
+    end
+    vim.schedule(function()
+      vim.ui.select(chats, {
+        prompt = 'Unarchive chat',
+        format_item = function(chat)
+          return chat.name or chat.id
+        end,
+      }, function(chat)
+        if not chat then return end
+        client.request({ action = 'chat_archive', id = chat.id, archived = false, global = global }, function(_, archive_err)
+          if archive_err then
+            log.error('Failed to unarchive chat: ' .. tostring(archive_err))
+            return
+          end
+          log.info('Unarchived "' .. (chat.name or '') .. '"')
+          refresh_chats()
+        end)
+      end)
+    end)
+  end)
+end
+
+-- Parse :BB7Cleanup arguments into a chat_bulk request
+local function parse_cleanup_args(args)
+  local req = { action = 'chat_bulk', operation = args[1] }
+  for i = 2, #args do
+    local key, value = args[i]:match('^(%w+)=(.*)$')
+    if key == 'older' and tonumber(value) then
+      req.older_than_days = tonumber(value)
+    elseif key == 'name' and value ~= '' then
+      req.name = value
+    elseif args[i] == 'empty' then
+      req.empty = true
+    else
+      return nil, 'Unknown argument: ' .. args[i]
+    end
+  end
+  if req.operation ~= 'archive' and req.operation ~= 'unarchive' and req.operation ~= 'delete' then
+    return nil, 'Usage: BB7Cleanup {archive|unarchive|delete} [older=DAYS] [name=GLOB] [empty]'
+  end
+  return req
+end
+
+-- :BB7Cleanup[!]: preview the chats a bulk operation selects, then run it
+function M.cleanup(args, global)
+  local req, parse_err = parse_cleanup_args(args)
+  if not req then
+    log.error(parse_err)
+    return
+  end
+  req.global = global or client.is_global_only()
+  req.dry_run = true
+  client.request(req, function(preview, err)
+    if err then
+      log.error('Cleanup failed: ' .. tostring(err))
+      return
+    end
+    local chats = type(preview.chats) == 'table' and preview.chats or {}
+    if #chats == 0 then
+      log.info('No chats match')
+      return
+    end
+    vim.schedule(function()
+      local names = {}
+      for i, chat in ipairs(chats) do
+        if i > 10 then
+          table.insert(names, string.format('... and %d more', #chats - 10))
+          break
+        end
+        table.insert(names, '  ' .. (chat.name or chat.id))
+      end
+      local prompt = string.format('%s %d chats?\n%s', req.operation:gsub('^%l', string.upper), #chats, table.concat(names, '\n'))
+      if vim.fn.confirm(prompt, '&Yes\n&No', 2) ~= 1 then
+        return
+      end
+      req.dry_run = nil
+      client.request(req, function(response, run_err)
+        if run_err then
+          log.error('Cleanup failed: ' .. tostring(run_err))
+          return
+        end
+        local done = type(response.chats) == 'table' and #response.chats or 0
+        local skipped = type(response.skipped) == 'table' and #response.skipped or 0
+        local msg = string.format('%s: %d chats', req.operation, done)
+        if skipped > 0 then
+          msg = msg .. string.format(', %d skipped (active or open elsewhere)', skipped)
+        end
+        log.info(msg)
+        refresh_chats()
+      end)
+    end)
+  end)
+end
+
+return M
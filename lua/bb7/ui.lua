@@ -186,6 +186,15 @@ local function reset_focus_mode()
   session_state.focus_mode = 'auto'
 end
 
+-- A response still streaming into the chat being left continues in the
+-- background (called before the preview switches to the new chat)
+local function detach_previous_stream(chat)
+  local previous = panes_preview.get_chat()
+  if previous and not (chat and chat.id == previous.id) then
+    panes_input.detach_stream(previous)
+  end
+end
+
 -- Update preview display based on focus mode and the pane being focused.
 -- In auto mode: files pane shows file, preview pane keeps display, others show chat.
 -- In file/diff mode: always show that display (fallback to chat if no file).
@@ -620,6 +629,9 @@ function M.open()
     return
   end
 
+  -- Remember the editor buffer for template variables
+  require('bb7.templates').capture()
+
   local current_layout = layout.calc_layout()
 
   -- Create all panes
@@ -639,6 +651,7 @@ function M.open()
     end,
     on_chat_selected = function(chat)
       reset_focus_mode()
+      detach_previous_stream(chat)
       panes_preview.set_chat(chat)
       panes_context.set_chat(chat)
       panes_provider.set_chat(chat)
@@ -835,7 +848,7 @@ function M.open()
     end,
   })
 
-  -- Setup event handlers for async events (title updates)
+  -- Setup event handlers for async events (title and tag updates)
   client.set_event_handlers({
     on_title_updated = function(chat_id, title)
       -- Refresh chat list to show new title
@@ -848,6 +861,9 @@ function M.open()
         update_pane_borders()
       end
     end,
+    on_tags_updated = function()
+      panes_chats.refresh()
+    end,
   })
 
   -- Initialize pane modules
@@ -1271,6 +1287,7 @@ function M.switch_chat(chat_id, callback, opts)
           log.error('Failed to get chat: ' .. chat_err)
           return
         end
+        detach_previous_stream(chat)
         panes_preview.set_chat(chat)
         panes_context.set_chat(chat)
         panes_provider.set_chat(chat)
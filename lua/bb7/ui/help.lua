@@ -16,8 +16,12 @@ local pane_bindings = {
       { 'n', 'New chat' },
       { 'r', 'Rename chat' },
       { 'R', 'Regenerate title' },
-      { 'd', 'Delete chat' },
+      { 'a', 'Archive chat' },
+      { 'd', 'Move chat to trash' },
       { 'p', 'Toggle pin' },
+      { 't', 'Edit tags' },
+      { 'f', 'Move to folder' },
+      { 's', 'Cycle sort order' },
       { 'u', 'Unlock chat' },
       { 'm', 'Move to project/global' },
       { '<C-s>', 'Toggle project/global' },
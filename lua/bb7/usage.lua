@@ -0,0 +1,40 @@
+-- Usage totals across chats (:BB7Usage)
+
+local M = {}
+
+local client = require('bb7.client')
+local log = require('bb7.log')
+
+-- Format a token count compactly (1234 -> 1.2k)
+local function format_tokens(n)
+  n = n or 0
+  if n >= 1000000 then
+    return string.format('%.1fM', n / 1000000)
+  elseif n >= 1000 then
+    return string.format('%.1fk', n / 1000)
+  end
+  return tostring(n)
+end
+
+-- :BB7Usage[!]: show the usage of all project chats (global chats with !)
+function M.show(global)
+  global = global or client.is_global_only()
+  client.request({ action = 'project_usage', global = global }, function(response, err)
+    if err then
+      log.error('Failed to get usage: ' .. tostring(err))
+      return
+    end
+    local usage = type(response.usage) == 'table' and response.usage or {}
+    local lines = {
+      string.format('%s usage: %d chats, %d messages',
+        response.global and 'Global chat' or 'Project', usage.chats or 0, usage.messages or 0),
+      string.format('Tokens: %s prompt (%d%% cached), %s completion',
+        format_tokens(usage.prompt_tokens), math.floor((usage.cache_hit_ratio or 0) * 100 + 0.5),
+        format_tokens(usage.completion_tokens)),
+      string.format('Cost: $%.3f', usage.cost or 0),
+    }
+    log.info(table.concat(lines, '\n'))
+  end)
+end
+
+return M
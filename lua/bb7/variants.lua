@@ -0,0 +1,66 @@
+-- Regenerated replies (:BB7Regenerate, :BB7Variants)
+
+local M = {}
+
+local log = require('bb7.log')
+
+-- :BB7Regenerate [model]: answer the last message again
+function M.regenerate(model)
+  require('bb7.panes.input').regenerate(model)
+end
+
+-- Find the chat's last user message and its index
+local function last_user_message(chat)
+  local messages = chat and chat.messages or {}
+  for i = #messages, 1, -1 do
+    if messages[i].role == 'user' then
+      return messages[i], i
+    end
+  end
+end
+
+-- First line of a reply's text, for the picker
+local function summary(msg)
+  for _, part in ipairs(msg.parts or {}) do
+    if (part.type or 'text') == 'text' and part.content and part.content ~= '' then
+      return (vim.split(vim.trim(part.content), '\n', { plain = true })[1])
+    end
+  end
+  return ''
+end
+
+-- :BB7Variants: switch the last message's reply to an earlier variant
+function M.pick()
+  local chat = require('bb7.panes.preview').get_chat()
+  local msg, idx = last_user_message(chat)
+  local alternates = msg and msg.alternates or {}
+  if #alternates == 0 then
+    log.info('No other replies to the last message')
+    return
+  end
+  local items = {}
+  for i, alt in ipairs(alternates) do
+    table.insert(items, { index = i - 1, msg = alt })
+  end
+  vim.ui.select(items, {
+    prompt = 'Reply variant',
+    format_item = function(item)
+      return (item.msg.model or '?') .. '  ' .. summary(item.msg)
+    end,
+  }, function(item)
+    if not item then return end
+    local client = require('bb7.client')
+    -- message_index is 0-based in the protocol
+    client.request({ action = 'select_variant', message_index = idx - 1, variant = item.index }, function(_, err)
+      if err then
+        log.error('Failed to switch reply: ' .. err)
+        return
+      end
+      vim.schedule(function()
+        require('bb7.ui').switch_chat(chat.id, nil, { global = chat.global })
+      end)
+    end)
+  end)
+end
+
+return M